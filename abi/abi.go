@@ -0,0 +1,394 @@
+// Package abi encodes contract calls and decodes return values and logs with the
+// contract ABI definition produced by solc.
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto/sha3"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Argument is an input or output of method, or a field of event.
+type Argument struct {
+	Name    string
+	Type    Type
+	Indexed bool
+}
+
+// Arguments is the list of arguments.
+type Arguments []Argument
+
+// Method is a contract method or constructor.
+type Method struct {
+	Name    string
+	Const   bool
+	Payable bool
+	Inputs  Arguments
+	Outputs Arguments
+}
+
+// Event is a contract event.
+type Event struct {
+	Name      string
+	Anonymous bool
+	Inputs    Arguments
+}
+
+// ABI is the parsed contract ABI definition.
+type ABI struct {
+	Constructor Method
+	Methods     map[string]Method
+	Events      map[string]Event
+}
+
+// ABI definition format
+type argumentJSON struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed"`
+}
+
+type fieldJSON struct {
+	Type            string         `json:"type"`
+	Name            string         `json:"name"`
+	Constant        bool           `json:"constant"`
+	Payable         bool           `json:"payable"`
+	StateMutability string         `json:"stateMutability"`
+	Anonymous       bool           `json:"anonymous"`
+	Inputs          []argumentJSON `json:"inputs"`
+	Outputs         []argumentJSON `json:"outputs"`
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+func newArguments(args []argumentJSON) (Arguments, error) {
+	arguments := make(Arguments, 0, len(args))
+	for _, arg := range args {
+		t, err := NewType(arg.Type)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, Argument{Name: arg.Name, Type: t, Indexed: arg.Indexed})
+	}
+	return arguments, nil
+}
+
+// JSON parse the ABI definition in json.
+func JSON(reader io.Reader) (ABI, error) {
+	var fields []fieldJSON
+	if err := json.NewDecoder(reader).Decode(&fields); err != nil {
+		return ABI{}, fmt.Errorf("abi: failed to decode abi definition, as: %v", err)
+	}
+	abi := ABI{
+		Methods: make(map[string]Method),
+		Events:  make(map[string]Event),
+	}
+	for _, field := range fields {
+		inputs, err := newArguments(field.Inputs)
+		if err != nil {
+			return ABI{}, err
+		}
+		outputs, err := newArguments(field.Outputs)
+		if err != nil {
+			return ABI{}, err
+		}
+		switch field.Type {
+		case "constructor":
+			abi.Constructor = Method{Inputs: inputs, Payable: field.Payable || field.StateMutability == "payable"}
+		case "function", "":
+			key := overloadKey(field.Name, func(key string) bool {
+				_, exists := abi.Methods[key]
+				return exists
+			})
+			abi.Methods[key] = Method{
+				Name:    field.Name,
+				Const:   field.Constant || field.StateMutability == "view" || field.StateMutability == "pure",
+				Payable: field.Payable || field.StateMutability == "payable",
+				Inputs:  inputs,
+				Outputs: outputs,
+			}
+		case "event":
+			key := overloadKey(field.Name, func(key string) bool {
+				_, exists := abi.Events[key]
+				return exists
+			})
+			abi.Events[key] = Event{Name: field.Name, Anonymous: field.Anonymous, Inputs: inputs}
+		}
+	}
+	return abi, nil
+}
+
+// key of the overloaded method or event, the first one is keyed by its name and the following ones
+// by name with index suffix, such as transfer, transfer0, transfer1.
+func overloadKey(name string, exists func(key string) bool) string {
+	key := name
+	for i := 0; exists(key); i++ {
+		key = fmt.Sprintf("%s%d", name, i)
+	}
+	return key
+}
+
+// FromDefinition parse the untyped ABI definition, such as compiler.ContractInfo.AbiDefinition.
+func FromDefinition(definition interface{}) (ABI, error) {
+	if s, ok := definition.(string); ok {
+		return JSON(strings.NewReader(s))
+	}
+	content, err := json.Marshal(definition)
+	if err != nil {
+		return ABI{}, fmt.Errorf("abi: failed to encode abi definition, as: %v", err)
+	}
+	return JSON(bytes.NewReader(content))
+}
+
+func (arguments Arguments) types() []Type {
+	ts := make([]Type, 0, len(arguments))
+	for _, arg := range arguments {
+		ts = append(ts, arg.Type)
+	}
+	return ts
+}
+
+// NonIndexed returns the arguments not indexed in event topics.
+func (arguments Arguments) NonIndexed() Arguments {
+	nonIndexed := make(Arguments, 0, len(arguments))
+	for _, arg := range arguments {
+		if !arg.Indexed {
+			nonIndexed = append(nonIndexed, arg)
+		}
+	}
+	return nonIndexed
+}
+
+// Pack encode the values of the arguments.
+func (arguments Arguments) Pack(args ...interface{}) ([]byte, error) {
+	if len(args) != len(arguments) {
+		return nil, fmt.Errorf("abi: %d arguments expected, got %d", len(arguments), len(args))
+	}
+	values := make([]reflect.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, reflect.ValueOf(arg))
+	}
+	return packTuple(arguments.types(), values)
+}
+
+// Unpack decode the values of the arguments.
+func (arguments Arguments) Unpack(data []byte) ([]interface{}, error) {
+	values, err := unpackTuple(arguments.types(), data)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		results = append(results, value.Interface())
+	}
+	return results, nil
+}
+
+// Sig returns the method signature, such as transfer(address,uint256).
+func (method Method) Sig() string {
+	ts := make([]string, 0, len(method.Inputs))
+	for _, input := range method.Inputs {
+		ts = append(ts, input.Type.String())
+	}
+	return fmt.Sprintf("%s(%s)", method.Name, strings.Join(ts, ","))
+}
+
+// ID returns the method selector.
+func (method Method) ID() []byte {
+	return keccak256([]byte(method.Sig()))[:4]
+}
+
+// Sig returns the event signature, such as Transfer(address,address,uint256).
+func (event Event) Sig() string {
+	ts := make([]string, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		ts = append(ts, input.Type.String())
+	}
+	return fmt.Sprintf("%s(%s)", event.Name, strings.Join(ts, ","))
+}
+
+// ID returns the event topic.
+func (event Event) ID() types.Hash {
+	var id types.Hash
+	copy(id[:], keccak256([]byte(event.Sig())))
+	return id
+}
+
+// Pack encode the call of method, the constructor arguments are encoded when name is empty.
+func (abi ABI) Pack(name string, args ...interface{}) ([]byte, error) {
+	if name == "" {
+		return abi.Constructor.Inputs.Pack(args...)
+	}
+	method, ok := abi.Methods[name]
+	if !ok {
+		return nil, fmt.Errorf("abi: method %s not found", name)
+	}
+	arguments, err := method.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("abi: failed to pack %s, as: %v", method.Sig(), err)
+	}
+	return append(method.ID(), arguments...), nil
+}
+
+// Unpack decode the return values of method.
+func (abi ABI) Unpack(name string, output []byte) ([]interface{}, error) {
+	method, ok := abi.Methods[name]
+	if !ok {
+		return nil, fmt.Errorf("abi: method %s not found", name)
+	}
+	if len(output) == 0 && len(method.Outputs) != 0 {
+		return nil, fmt.Errorf("abi: empty output of %s", method.Sig())
+	}
+	values, err := method.Outputs.Unpack(output)
+	if err != nil {
+		return nil, fmt.Errorf("abi: failed to unpack output of %s, as: %v", method.Sig(), err)
+	}
+	return values, nil
+}
+
+// MethodByID find the method by selector.
+func (abi ABI) MethodByID(id []byte) (*Method, error) {
+	if len(id) < 4 {
+		return nil, errors.New("abi: invalid method selector")
+	}
+	for _, method := range abi.Methods {
+		if bytes.Equal(method.ID(), id[:4]) {
+			return &method, nil
+		}
+	}
+	return nil, fmt.Errorf("abi: no method with selector %x", id[:4])
+}
+
+// EventByID find the event by topic.
+func (abi ABI) EventByID(topic types.Hash) (*Event, error) {
+	for _, event := range abi.Events {
+		if event.ID() == topic {
+			return &event, nil
+		}
+	}
+	return nil, fmt.Errorf("abi: no event with topic %x", topic)
+}
+
+// PackEvent encode the topics and data of event log.
+func (abi ABI) PackEvent(name string, args ...interface{}) ([]types.Hash, []byte, error) {
+	event, ok := abi.Events[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("abi: event %s not found", name)
+	}
+	if len(args) != len(event.Inputs) {
+		return nil, nil, fmt.Errorf("abi: %d arguments expected, got %d", len(event.Inputs), len(args))
+	}
+	topics := make([]types.Hash, 0)
+	if !event.Anonymous {
+		topics = append(topics, event.ID())
+	}
+	nonIndexed := make([]interface{}, 0, len(args))
+	for i, input := range event.Inputs {
+		if !input.Indexed {
+			nonIndexed = append(nonIndexed, args[i])
+			continue
+		}
+		topic, err := input.Type.topic(reflect.ValueOf(args[i]))
+		if err != nil {
+			return nil, nil, err
+		}
+		topics = append(topics, topic)
+	}
+	data, err := event.Inputs.NonIndexed().Pack(nonIndexed...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return topics, data, nil
+}
+
+// encode the indexed value as topic like solidity, the value of string and bytes is hashed as raw
+// bytes, and the value of array is hashed as the encoding of its elements without length.
+func (t Type) topic(v reflect.Value) (topic types.Hash, err error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	var encoded []byte
+	switch t.Kind {
+	case StringTy:
+		if v.Kind() != reflect.String {
+			return topic, fmt.Errorf("abi: cannot use %v as string", v.Type())
+		}
+		encoded = []byte(v.String())
+	case BytesTy:
+		if encoded, err = toBytes(v); err != nil {
+			return topic, err
+		}
+	case SliceTy, ArrayTy:
+		if t.Elem.isDynamic() {
+			return topic, fmt.Errorf("abi: indexed %s is not supported", t)
+		}
+		if encoded, err = t.pack(v); err != nil {
+			return topic, err
+		}
+		if t.Kind == SliceTy {
+			encoded = encoded[32:]
+		}
+	default:
+		if encoded, err = t.pack(v); err != nil {
+			return topic, err
+		}
+		copy(topic[:], encoded)
+		return topic, nil
+	}
+	copy(topic[:], keccak256(encoded))
+	return topic, nil
+}
+
+// UnpackLog decode the event log to values in the order of event inputs, the indexed
+// value of dynamic type is returned as the hash in topic.
+func (abi ABI) UnpackLog(name string, topics []types.Hash, data []byte) ([]interface{}, error) {
+	event, ok := abi.Events[name]
+	if !ok {
+		return nil, fmt.Errorf("abi: event %s not found", name)
+	}
+	if !event.Anonymous {
+		if len(topics) == 0 || topics[0] != event.ID() {
+			return nil, fmt.Errorf("abi: log is not event %s", event.Sig())
+		}
+		topics = topics[1:]
+	}
+	nonIndexed, err := event.Inputs.NonIndexed().Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("abi: failed to unpack data of %s, as: %v", event.Sig(), err)
+	}
+	values := make([]interface{}, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			values = append(values, nonIndexed[0])
+			nonIndexed = nonIndexed[1:]
+			continue
+		}
+		if len(topics) == 0 {
+			return nil, fmt.Errorf("abi: missing topic of %s", event.Sig())
+		}
+		topic := topics[0]
+		topics = topics[1:]
+		if input.Type.isDynamic() {
+			values = append(values, topic)
+			continue
+		}
+		value, err := input.Type.unpack(topic[:], 0)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value.Interface())
+	}
+	return values, nil
+}
@@ -0,0 +1,237 @@
+package abi
+
+import (
+	"encoding/hex"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const erc20ABI = `[
+  {"constant":true,"inputs":[{"name":"_owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"balance","type":"uint256"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[{"name":"success","type":"bool"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"Candidates","outputs":[{"name":"","type":"address[]"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"ranking","type":"uint256"}],"name":"GetCandidateByRanking","outputs":[{"name":"","type":"address"},{"name":"","type":"uint256"},{"name":"","type":"string"}],"type":"function"},
+  {"inputs":[],"payable":false,"stateMutability":"nonpayable","type":"constructor"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"_from","type":"address"},{"indexed":true,"name":"_to","type":"address"},{"indexed":false,"name":"_value","type":"uint256"}],"name":"Transfer","type":"event"}
+]`
+
+func word(s string) string {
+	return strings.Repeat("0", 64-len(s)) + s
+}
+
+func TestNewType(t *testing.T) {
+	assert := assert.New(t)
+	ty, err := NewType("uint")
+	assert.Nil(err)
+	assert.Equal(UintTy, ty.Kind)
+	assert.Equal(256, ty.Size)
+	assert.Equal("uint256", ty.String())
+
+	ty, err = NewType("bytes32[2][]")
+	assert.Nil(err)
+	assert.Equal(SliceTy, ty.Kind)
+	assert.Equal(ArrayTy, ty.Elem.Kind)
+	assert.Equal(2, ty.Elem.Size)
+	assert.Equal(FixedBytesTy, ty.Elem.Elem.Kind)
+	assert.True(ty.isDynamic())
+	assert.Equal(64, ty.Elem.headSize())
+
+	for _, invalid := range []string{"uint7", "int264", "bytes33", "fixed", "uint[0]", "[]"} {
+		_, err = NewType(invalid)
+		assert.NotNil(err, invalid)
+	}
+}
+
+func TestMethodID(t *testing.T) {
+	assert := assert.New(t)
+	abi, err := JSON(strings.NewReader(erc20ABI))
+	assert.Nil(err)
+	assert.Equal("transfer(address,uint256)", abi.Methods["transfer"].Sig())
+	assert.Equal("a9059cbb", hex.EncodeToString(abi.Methods["transfer"].ID()))
+	assert.Equal("70a08231", hex.EncodeToString(abi.Methods["balanceOf"].ID()))
+	transferID := abi.Events["Transfer"].ID()
+	assert.Equal("ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", hex.EncodeToString(transferID[:]))
+	assert.True(abi.Methods["balanceOf"].Const)
+	assert.False(abi.Methods["transfer"].Const)
+
+	method, err := abi.MethodByID([]byte{0xa9, 0x05, 0x9c, 0xbb})
+	assert.Nil(err)
+	assert.Equal("transfer", method.Name)
+	_, err = abi.MethodByID([]byte{0x01, 0x02, 0x03, 0x04})
+	assert.NotNil(err)
+
+	// overloaded methods are keyed by name with index suffix
+	abi, err = JSON(strings.NewReader(`[
+  {"inputs":[{"name":"_to","type":"address"}],"name":"transfer","outputs":[],"type":"function"},
+  {"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[],"type":"function"}
+]`))
+	assert.Nil(err)
+	assert.Equal("transfer(address)", abi.Methods["transfer"].Sig())
+	assert.Equal("transfer(address,uint256)", abi.Methods["transfer0"].Sig())
+	assert.Equal("transfer", abi.Methods["transfer0"].Name)
+}
+
+func TestPack(t *testing.T) {
+	assert := assert.New(t)
+	abi, err := JSON(strings.NewReader(erc20ABI))
+	assert.Nil(err)
+	to := types.Address{0x01}
+	input, err := abi.Pack("transfer", to, big.NewInt(100))
+	assert.Nil(err)
+	assert.Equal("a9059cbb"+word("01"+strings.Repeat("0", 38))+word("64"), hex.EncodeToString(input))
+
+	// go integers are accepted
+	input2, err := abi.Pack("transfer", to, 100)
+	assert.Nil(err)
+	assert.Equal(input, input2)
+
+	_, err = abi.Pack("transfer", to)
+	assert.NotNil(err)
+	_, err = abi.Pack("transfer", to, big.NewInt(-1))
+	assert.NotNil(err)
+
+	// signed integers hold one bit less than unsigned ones
+	int8Type, err := NewType("int8")
+	assert.Nil(err)
+	for value, overflow := range map[int64]bool{127: false, 128: true, -128: false, -129: true} {
+		_, err = int8Type.pack(reflect.ValueOf(big.NewInt(value)))
+		assert.Equal(overflow, nil != err, "int8 %d", value)
+	}
+	_, err = abi.Pack("transfer", "0x01", big.NewInt(1))
+	assert.NotNil(err)
+	_, err = abi.Pack("notExist")
+	assert.NotNil(err)
+}
+
+func TestPackDynamic(t *testing.T) {
+	assert := assert.New(t)
+	args := Arguments{
+		{Type: mustType("uint32")},
+		{Type: mustType("string")},
+		{Type: mustType("uint256[]")},
+		{Type: mustType("bytes3[2]")},
+	}
+	encoded, err := args.Pack(uint32(0x123), "hello", []*big.Int{big.NewInt(1), big.NewInt(2)}, [2][3]byte{{'a', 'b', 'c'}, {'d', 'e', 'f'}})
+	assert.Nil(err)
+	expect := word("123") + // uint32
+		word("a0") + // offset of string
+		word("e0") + // offset of uint256[]
+		"616263" + strings.Repeat("0", 58) + // bytes3[2]
+		"646566" + strings.Repeat("0", 58) +
+		word("5") + "68656c6c6f" + strings.Repeat("0", 54) + // string
+		word("2") + word("1") + word("2") // uint256[]
+	assert.Equal(expect, hex.EncodeToString(encoded))
+
+	values, err := args.Unpack(encoded)
+	assert.Nil(err)
+	assert.Equal(uint32(0x123), values[0])
+	assert.Equal("hello", values[1])
+	assert.Equal([]*big.Int{big.NewInt(1), big.NewInt(2)}, values[2])
+	assert.Equal([2][3]byte{{'a', 'b', 'c'}, {'d', 'e', 'f'}}, values[3])
+
+	_, err = args.Unpack(encoded[:100])
+	assert.NotNil(err)
+}
+
+func TestUnpack(t *testing.T) {
+	assert := assert.New(t)
+	abi, err := JSON(strings.NewReader(erc20ABI))
+	assert.Nil(err)
+	a1, a2 := types.Address{0x01}, types.Address{0x02}
+	output, err := abi.Methods["Candidates"].Outputs.Pack([]types.Address{a1, a2})
+	assert.Nil(err)
+	values, err := abi.Unpack("Candidates", output)
+	assert.Nil(err)
+	assert.Equal([]types.Address{a1, a2}, values[0])
+
+	output, err = abi.Methods["GetCandidateByRanking"].Outputs.Pack(a1, big.NewInt(1000), "http://127.0.0.1:47768")
+	assert.Nil(err)
+	values, err = abi.Unpack("GetCandidateByRanking", output)
+	assert.Nil(err)
+	assert.Equal(a1, values[0])
+	assert.Equal(big.NewInt(1000), values[1])
+	assert.Equal("http://127.0.0.1:47768", values[2])
+
+	_, err = abi.Unpack("GetCandidateByRanking", nil)
+	assert.NotNil(err)
+
+	// negative integer in two's complement
+	args := Arguments{{Type: mustType("int256")}, {Type: mustType("int8")}}
+	encoded, err := args.Pack(big.NewInt(-1), int8(-2))
+	assert.Nil(err)
+	assert.Equal(strings.Repeat("f", 64), hex.EncodeToString(encoded[:32]))
+	values, err = args.Unpack(encoded)
+	assert.Nil(err)
+	assert.Equal(big.NewInt(-1), values[0])
+	assert.Equal(int8(-2), values[1])
+}
+
+func TestEvent(t *testing.T) {
+	assert := assert.New(t)
+	abi, err := JSON(strings.NewReader(erc20ABI))
+	assert.Nil(err)
+	from, to := types.Address{0x01}, types.Address{0x02}
+	topics, data, err := abi.PackEvent("Transfer", from, to, big.NewInt(10))
+	assert.Nil(err)
+	assert.Equal(3, len(topics))
+	assert.Equal(abi.Events["Transfer"].ID(), topics[0])
+	assert.Equal(word("a"), hex.EncodeToString(data))
+
+	event, err := abi.EventByID(topics[0])
+	assert.Nil(err)
+	assert.Equal("Transfer", event.Name)
+	values, err := abi.UnpackLog("Transfer", topics, data)
+	assert.Nil(err)
+	assert.Equal([]interface{}{from, to, big.NewInt(10)}, values)
+
+	_, err = abi.UnpackLog("Transfer", topics[1:], data)
+	assert.NotNil(err)
+
+	// indexed string and bytes are hashed as raw bytes
+	abi, err = JSON(strings.NewReader(`[{"anonymous":false,"inputs":[{"indexed":true,"name":"name","type":"string"},{"indexed":true,"name":"data","type":"bytes"},{"indexed":true,"name":"ids","type":"uint256[]"}],"name":"Named","type":"event"}]`))
+	assert.Nil(err)
+	topics, _, err = abi.PackEvent("Named", "justitia", []byte{0x01, 0x02}, []*big.Int{big.NewInt(1)})
+	assert.Nil(err)
+	assert.Equal(types.BytesToHash(keccak256([]byte("justitia"))), topics[1])
+	assert.Equal(types.BytesToHash(keccak256([]byte{0x01, 0x02})), topics[2])
+	assert.Equal(types.BytesToHash(keccak256(bigWord(big.NewInt(1)))), topics[3])
+}
+
+func TestFromDefinition(t *testing.T) {
+	assert := assert.New(t)
+	var definition interface{}
+	abi, err := JSON(strings.NewReader(erc20ABI))
+	assert.Nil(err)
+	definition = []interface{}{
+		map[string]interface{}{
+			"constant": true,
+			"inputs":   []interface{}{},
+			"name":     "name",
+			"outputs":  []interface{}{map[string]interface{}{"name": "", "type": "string"}},
+			"type":     "function",
+		},
+	}
+	parsed, err := FromDefinition(definition)
+	assert.Nil(err)
+	assert.Equal(abi.Methods["name"], parsed.Methods["name"])
+
+	parsed, err = FromDefinition(erc20ABI)
+	assert.Nil(err)
+	assert.Equal(len(abi.Methods), len(parsed.Methods))
+
+	_, err = FromDefinition(`[{"type":"function","name":"f","inputs":[{"type":"fixed128x18"}]}]`)
+	assert.NotNil(err)
+}
+
+func mustType(t string) Type {
+	ty, err := NewType(t)
+	if err != nil {
+		panic(err)
+	}
+	return ty
+}
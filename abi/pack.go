@@ -0,0 +1,307 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"math/big"
+	"reflect"
+)
+
+var (
+	tt256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	errData = errors.New("abi: output data too short")
+)
+
+// left pad the big integer to a 32 bytes word, negative value is encoded in two's complement.
+func bigWord(v *big.Int) []byte {
+	if v.Sign() < 0 {
+		v = new(big.Int).Add(tt256, v)
+	}
+	word := make([]byte, 32)
+	b := v.Bytes()
+	copy(word[32-len(b):], b)
+	return word
+}
+
+// right pad the bytes to multiple of 32 bytes.
+func rightPad(b []byte) []byte {
+	padded := make([]byte, (len(b)+31)/32*32)
+	copy(padded, b)
+	return padded
+}
+
+// convert go integers to big integer.
+func toBig(v reflect.Value) (*big.Int, error) {
+	if v.Type() == bigType {
+		if v.IsNil() {
+			return nil, errors.New("abi: nil big integer")
+		}
+		return v.Interface().(*big.Int), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(v.Uint()), nil
+	}
+	return nil, fmt.Errorf("abi: cannot use %v as integer", v.Type())
+}
+
+// convert byte array or slice to bytes.
+func toBytes(v reflect.Value) ([]byte, error) {
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return b, nil
+	}
+	return nil, fmt.Errorf("abi: cannot use %v as bytes", v.Type())
+}
+
+// pack the values of types as a tuple, static values in head and dynamic values in tail.
+func packTuple(ts []Type, values []reflect.Value) ([]byte, error) {
+	headLen := 0
+	for _, t := range ts {
+		headLen += t.headSize()
+	}
+	var head, tail []byte
+	for i, t := range ts {
+		encoded, err := t.pack(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.isDynamic() {
+			head = append(head, bigWord(big.NewInt(int64(headLen+len(tail))))...)
+			tail = append(tail, encoded...)
+		} else {
+			head = append(head, encoded...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// pack a value of the type.
+func (t Type) pack(v reflect.Value) ([]byte, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, fmt.Errorf("abi: missing value of type %s", t)
+	}
+	switch t.Kind {
+	case IntTy, UintTy:
+		i, err := toBig(v)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == UintTy && i.Sign() < 0 {
+			return nil, fmt.Errorf("abi: negative value %v for type %s", i, t)
+		}
+		// intN holds values in [-2^(N-1), 2^(N-1)-1]
+		bits := i.BitLen()
+		if t.Kind == IntTy {
+			if i.Sign() < 0 {
+				bits = new(big.Int).Not(i).BitLen()
+			}
+			bits++
+		}
+		if bits > t.Size {
+			return nil, fmt.Errorf("abi: value %v overflows type %s", i, t)
+		}
+		return bigWord(i), nil
+	case BoolTy:
+		if v.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("abi: cannot use %v as bool", v.Type())
+		}
+		if v.Bool() {
+			return bigWord(big.NewInt(1)), nil
+		}
+		return bigWord(big.NewInt(0)), nil
+	case AddressTy:
+		if v.Type() != addressType {
+			return nil, fmt.Errorf("abi: cannot use %v as address", v.Type())
+		}
+		addr := v.Interface().(types.Address)
+		word := make([]byte, 32)
+		copy(word[32-len(addr):], addr[:])
+		return word, nil
+	case FixedBytesTy:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > t.Size {
+			return nil, fmt.Errorf("abi: %d bytes overflows type %s", len(b), t)
+		}
+		word := make([]byte, 32)
+		copy(word, b)
+		return word, nil
+	case BytesTy, StringTy:
+		var b []byte
+		if v.Kind() == reflect.String {
+			b = []byte(v.String())
+		} else {
+			var err error
+			if b, err = toBytes(v); err != nil {
+				return nil, err
+			}
+		}
+		return append(bigWord(big.NewInt(int64(len(b)))), rightPad(b)...), nil
+	case SliceTy, ArrayTy:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, fmt.Errorf("abi: cannot use %v as %s", v.Type(), t)
+		}
+		if t.Kind == ArrayTy && v.Len() != t.Size {
+			return nil, fmt.Errorf("abi: %d elements for type %s", v.Len(), t)
+		}
+		ts := make([]Type, v.Len())
+		values := make([]reflect.Value, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ts[i] = *t.Elem
+			values[i] = v.Index(i)
+		}
+		encoded, err := packTuple(ts, values)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == SliceTy {
+			return append(bigWord(big.NewInt(int64(v.Len()))), encoded...), nil
+		}
+		return encoded, nil
+	}
+	return nil, fmt.Errorf("abi: unsupported type %s", t)
+}
+
+// read a 32 bytes word at offset.
+func readWord(data []byte, offset int) ([]byte, error) {
+	if offset < 0 || offset+32 > len(data) {
+		return nil, errData
+	}
+	return data[offset : offset+32], nil
+}
+
+// read a length or offset.
+func readLength(data []byte, offset int) (int, error) {
+	word, err := readWord(data, offset)
+	if err != nil {
+		return 0, err
+	}
+	length := new(big.Int).SetBytes(word)
+	if !length.IsInt64() || length.Int64() > int64(len(data)) {
+		return 0, fmt.Errorf("abi: invalid length or offset %v", length)
+	}
+	return int(length.Int64()), nil
+}
+
+// unpack a tuple of the types.
+func unpackTuple(ts []Type, data []byte) ([]reflect.Value, error) {
+	values := make([]reflect.Value, len(ts))
+	offset := 0
+	for i, t := range ts {
+		value, err := t.unpack(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+		offset += t.headSize()
+	}
+	return values, nil
+}
+
+// unpack a value of the type whose head is at offset.
+func (t Type) unpack(data []byte, offset int) (reflect.Value, error) {
+	if t.isDynamic() {
+		ptr, err := readLength(data, offset)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return t.unpackContent(data[ptr:])
+	}
+	if t.Kind == ArrayTy {
+		if offset > len(data) {
+			return reflect.Value{}, errData
+		}
+		return t.unpackContent(data[offset:])
+	}
+	word, err := readWord(data, offset)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	switch t.Kind {
+	case IntTy, UintTy:
+		i := new(big.Int).SetBytes(word)
+		if t.Kind == IntTy && word[0]&0x80 != 0 {
+			i.Sub(i, tt256)
+		}
+		goType := t.goType()
+		if goType == bigType {
+			return reflect.ValueOf(i), nil
+		}
+		value := reflect.New(goType).Elem()
+		if t.Kind == IntTy {
+			value.SetInt(i.Int64())
+		} else {
+			value.SetUint(i.Uint64())
+		}
+		return value, nil
+	case BoolTy:
+		return reflect.ValueOf(word[31] == 1), nil
+	case AddressTy:
+		var addr types.Address
+		copy(addr[:], word[32-len(addr):])
+		return reflect.ValueOf(addr), nil
+	case FixedBytesTy:
+		value := reflect.New(t.goType()).Elem()
+		reflect.Copy(value, reflect.ValueOf(word[:t.Size]))
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("abi: unsupported type %s", t)
+}
+
+// unpack the content of dynamic types and static arrays.
+func (t Type) unpackContent(content []byte) (reflect.Value, error) {
+	switch t.Kind {
+	case BytesTy, StringTy:
+		length, err := readLength(content, 0)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if 32+length > len(content) {
+			return reflect.Value{}, errData
+		}
+		b := make([]byte, length)
+		copy(b, content[32:32+length])
+		if t.Kind == StringTy {
+			return reflect.ValueOf(string(b)), nil
+		}
+		return reflect.ValueOf(b), nil
+	case SliceTy, ArrayTy:
+		length := t.Size
+		if t.Kind == SliceTy {
+			var err error
+			if length, err = readLength(content, 0); err != nil {
+				return reflect.Value{}, err
+			}
+			content = content[32:]
+		}
+		ts := make([]Type, length)
+		for i := range ts {
+			ts[i] = *t.Elem
+		}
+		elems, err := unpackTuple(ts, content)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		var value reflect.Value
+		if t.Kind == SliceTy {
+			value = reflect.MakeSlice(t.goType(), length, length)
+		} else {
+			value = reflect.New(t.goType()).Elem()
+		}
+		for i, elem := range elems {
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("abi: unsupported type %s", t)
+}
@@ -0,0 +1,173 @@
+package abi
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of an abi type.
+type Kind int
+
+const (
+	IntTy        Kind = iota // IntTy --> intN
+	UintTy                   // UintTy --> uintN
+	BoolTy                   // BoolTy --> bool
+	AddressTy                // AddressTy --> address
+	FixedBytesTy             // FixedBytesTy --> bytesN
+	BytesTy                  // BytesTy --> bytes
+	StringTy                 // StringTy --> string
+	SliceTy                  // SliceTy --> T[]
+	ArrayTy                  // ArrayTy --> T[k]
+)
+
+var (
+	bigType     = reflect.TypeOf(&big.Int{})
+	addressType = reflect.TypeOf(types.Address{})
+)
+
+// Type is the abi type of an argument.
+type Type struct {
+	Kind Kind
+	Size int   // bit size of intN/uintN, byte size of bytesN, length of T[k]
+	Elem *Type // element type of T[] and T[k]
+
+	stringKind string
+}
+
+// NewType parse the abi type from its string representation, such as uint256, address[] or bytes32[2].
+func NewType(t string) (Type, error) {
+	if strings.HasSuffix(t, "]") {
+		i := strings.LastIndex(t, "[")
+		if i <= 0 {
+			return Type{}, fmt.Errorf("abi: invalid type %s", t)
+		}
+		elem, err := NewType(t[:i])
+		if err != nil {
+			return Type{}, err
+		}
+		dim := t[i+1 : len(t)-1]
+		if dim == "" {
+			return Type{Kind: SliceTy, Elem: &elem, stringKind: t}, nil
+		}
+		size, err := strconv.Atoi(dim)
+		if err != nil || size <= 0 {
+			return Type{}, fmt.Errorf("abi: invalid array size in type %s", t)
+		}
+		return Type{Kind: ArrayTy, Size: size, Elem: &elem, stringKind: t}, nil
+	}
+
+	switch {
+	case t == "bool":
+		return Type{Kind: BoolTy, stringKind: t}, nil
+	case t == "address":
+		return Type{Kind: AddressTy, Size: 20, stringKind: t}, nil
+	case t == "string":
+		return Type{Kind: StringTy, stringKind: t}, nil
+	case t == "bytes":
+		return Type{Kind: BytesTy, stringKind: t}, nil
+	case strings.HasPrefix(t, "bytes"):
+		size, err := strconv.Atoi(t[len("bytes"):])
+		if err != nil || size <= 0 || size > 32 {
+			return Type{}, fmt.Errorf("abi: invalid type %s", t)
+		}
+		return Type{Kind: FixedBytesTy, Size: size, stringKind: t}, nil
+	case strings.HasPrefix(t, "uint"):
+		size, err := intSize(t[len("uint"):])
+		if err != nil {
+			return Type{}, fmt.Errorf("abi: invalid type %s", t)
+		}
+		return Type{Kind: UintTy, Size: size, stringKind: "uint" + strconv.Itoa(size)}, nil
+	case strings.HasPrefix(t, "int"):
+		size, err := intSize(t[len("int"):])
+		if err != nil {
+			return Type{}, fmt.Errorf("abi: invalid type %s", t)
+		}
+		return Type{Kind: IntTy, Size: size, stringKind: "int" + strconv.Itoa(size)}, nil
+	}
+	return Type{}, fmt.Errorf("abi: unsupported type %s", t)
+}
+
+// parse the bit size of intN/uintN, int and uint are alias of int256 and uint256.
+func intSize(s string) (int, error) {
+	if s == "" {
+		return 256, nil
+	}
+	size, err := strconv.Atoi(s)
+	if err != nil || size <= 0 || size > 256 || size%8 != 0 {
+		return 0, fmt.Errorf("invalid int size %s", s)
+	}
+	return size, nil
+}
+
+// String returns the canonical representation of the type used in signatures.
+func (t Type) String() string {
+	return t.stringKind
+}
+
+// whether the type is encoded in the tail part.
+func (t Type) isDynamic() bool {
+	switch t.Kind {
+	case BytesTy, StringTy, SliceTy:
+		return true
+	case ArrayTy:
+		return t.Elem.isDynamic()
+	}
+	return false
+}
+
+// size of the type in the head part.
+func (t Type) headSize() int {
+	if t.Kind == ArrayTy && !t.isDynamic() {
+		return t.Size * t.Elem.headSize()
+	}
+	return 32
+}
+
+// go type of the unpacked value.
+func (t Type) goType() reflect.Type {
+	switch t.Kind {
+	case IntTy:
+		switch t.Size {
+		case 8:
+			return reflect.TypeOf(int8(0))
+		case 16:
+			return reflect.TypeOf(int16(0))
+		case 32:
+			return reflect.TypeOf(int32(0))
+		case 64:
+			return reflect.TypeOf(int64(0))
+		}
+		return bigType
+	case UintTy:
+		switch t.Size {
+		case 8:
+			return reflect.TypeOf(uint8(0))
+		case 16:
+			return reflect.TypeOf(uint16(0))
+		case 32:
+			return reflect.TypeOf(uint32(0))
+		case 64:
+			return reflect.TypeOf(uint64(0))
+		}
+		return bigType
+	case BoolTy:
+		return reflect.TypeOf(false)
+	case AddressTy:
+		return addressType
+	case FixedBytesTy:
+		return reflect.ArrayOf(t.Size, reflect.TypeOf(byte(0)))
+	case BytesTy:
+		return reflect.TypeOf([]byte{})
+	case StringTy:
+		return reflect.TypeOf("")
+	case SliceTy:
+		return reflect.SliceOf(t.Elem.goType())
+	case ArrayTy:
+		return reflect.ArrayOf(t.Size, t.Elem.goType())
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/abi"
+	"github.com/DSiSc/justitia/tools"
+	"math/big"
+	"strings"
+)
+
+// Caller execute read-only contract calls.
+type Caller interface {
+	// Call the contract with input, returns the output of the call.
+	Call(contract types.Address, input []byte) ([]byte, error)
+}
+
+// Transactor send transactions to contracts.
+type Transactor interface {
+	// Transact send a transaction with value and input to the contract, returns the tx hash.
+	Transact(contract types.Address, value *big.Int, input []byte) (types.Hash, error)
+}
+
+// BoundContract is a contract bound to its address and ABI.
+type BoundContract struct {
+	Address    types.Address
+	abi        abi.ABI
+	caller     Caller
+	transactor Transactor
+}
+
+// NewBoundContract bind the contract at address with the ABI definition, the transactor can be nil
+// when the contract is used for read-only calls only.
+func NewBoundContract(address types.Address, definition string, caller Caller, transactor Transactor) (*BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		return nil, err
+	}
+	return &BoundContract{
+		Address:    address,
+		abi:        parsed,
+		caller:     caller,
+		transactor: transactor,
+	}, nil
+}
+
+// ABI returns the ABI of the contract.
+func (contract *BoundContract) ABI() abi.ABI {
+	return contract.abi
+}
+
+// Call invoke the read-only method, returns the unpacked outputs.
+func (contract *BoundContract) Call(method string, args ...interface{}) ([]interface{}, error) {
+	if nil == contract.caller {
+		return nil, errors.New("contract is not bound to a caller")
+	}
+	input, err := contract.abi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := contract.caller.Call(contract.Address, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s of contract %x, as: %v", method, contract.Address, err)
+	}
+	return contract.abi.Unpack(method, output)
+}
+
+// Transact send a transaction invoking the method with value.
+func (contract *BoundContract) Transact(value *big.Int, method string, args ...interface{}) (types.Hash, error) {
+	if nil == contract.transactor {
+		return types.Hash{}, errors.New("contract is not bound to a transactor")
+	}
+	input, err := contract.abi.Pack(method, args...)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	hash, err := contract.transactor.Transact(contract.Address, value, input)
+	if err != nil {
+		return types.Hash{}, fmt.Errorf("failed to transact %s of contract %x, as: %v", method, contract.Address, err)
+	}
+	return hash, nil
+}
+
+// UnpackLog decode the log of event emitted by the contract.
+func (contract *BoundContract) UnpackLog(event string, log *types.Log) ([]interface{}, error) {
+	if log.Address != contract.Address {
+		return nil, fmt.Errorf("log is emitted by %x, not contract %x", log.Address, contract.Address)
+	}
+	return contract.abi.UnpackLog(event, log.Topics, log.Data)
+}
+
+// DeployContract deploy the contract with creation code and constructor arguments, and wait until it is mined.
+func DeployContract(client *Client, abiJSON, bin string, value *big.Int, args ...interface{}) (*BoundContract, *Receipt, error) {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := parsed.Pack("", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash, err := client.Deploy(value, append(tools.FromHex(bin), input...))
+	if err != nil {
+		return nil, nil, err
+	}
+	receipt, err := client.WaitMined(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if (receipt.ContractAddress == types.Address{}) {
+		return nil, receipt, fmt.Errorf("no contract created by transaction %x", hash)
+	}
+	contract, err := NewBoundContract(receipt.ContractAddress, abiJSON, client, client)
+	return contract, receipt, err
+}
+
+// FilterEvents get the logs of event emitted by the contract in blocks [fromBlock, toBlock],
+// and the unpacked values of each log.
+func FilterEvents(client *Client, contract *BoundContract, event string, fromBlock, toBlock uint64) ([]*types.Log, [][]interface{}, error) {
+	abiEvent, ok := contract.ABI().Events[event]
+	if !ok {
+		return nil, nil, fmt.Errorf("event %s not found", event)
+	}
+	logs, err := client.FilterLogs(FilterQuery{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+		Addresses: []types.Address{contract.Address},
+		Topics:    [][]types.Hash{{abiEvent.ID()}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([][]interface{}, 0, len(logs))
+	for _, log := range logs {
+		value, err := contract.UnpackLog(event, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, value)
+	}
+	return logs, values, nil
+}
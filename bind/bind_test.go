@@ -0,0 +1,255 @@
+package bind
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	mockFrom     = types.Address{0x01}
+	mockContract = types.Address{0x10}
+	mockTxHash   = types.Hash{0x0a}
+)
+
+const tokenABI = `[
+  {"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"balance","type":"uint256"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[{"name":"success","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[],"name":"buyJR","outputs":[],"payable":true,"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"_from","type":"address"},{"indexed":true,"name":"_to","type":"address"},{"indexed":false,"name":"_value","type":"uint256"}],"name":"Transfer","type":"event"}
+]`
+
+// abi with overloaded methods and names mapped to the same Go name
+const collidedABI = `[
+  {"constant":false,"inputs":[{"name":"_to","type":"address"}],"name":"transfer","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[],"type":"function"},
+  {"constant":true,"inputs":[{"name":"to","type":"address"},{"name":"_to","type":"address"}],"name":"Transfer","outputs":[{"name":"","type":"bool"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"filterTransfer","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"raw","type":"string"},{"indexed":false,"name":"Raw","type":"string"}],"name":"Transfer","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"to","type":"address"}],"name":"transfer","type":"event"},
+  {"anonymous":false,"inputs":[],"name":"ABI","type":"event"}
+]`
+
+// type check the generated source of package, imports are resolved from source.
+func typeCheck(pkg, code string) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, pkg+".go", code, 0)
+	if err != nil {
+		return err
+	}
+	conf := gotypes.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check(pkg, fset, []*ast.File{file}, nil)
+	return err
+}
+
+// mock api gateway, handlers are keyed by method and return the result
+type mockGateway struct {
+	handlers map[string]func(params []json.RawMessage) interface{}
+	requests map[string][]json.RawMessage
+}
+
+func newMockGateway() *mockGateway {
+	return &mockGateway{
+		handlers: make(map[string]func(params []json.RawMessage) interface{}),
+		requests: make(map[string][]json.RawMessage),
+	}
+}
+
+func (gateway *mockGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var request struct {
+		ID     uint64            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.Unmarshal(body, &request)
+	gateway.requests[request.Method] = request.Params
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	if handler, ok := gateway.handlers[request.Method]; ok {
+		response["result"] = handler(request.Params)
+	} else {
+		response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+	gateway := newMockGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"), mockFrom)
+	assert.Equal(server.URL, client.Endpoint())
+
+	gateway.handlers["eth_blockNumber"] = func([]json.RawMessage) interface{} { return "0x1a" }
+	height, err := client.BlockNumber()
+	assert.Nil(err)
+	assert.Equal(uint64(26), height)
+
+	gateway.handlers["eth_call"] = func([]json.RawMessage) interface{} { return "0x0102" }
+	output, err := client.Call(mockContract, []byte{0x0a})
+	assert.Nil(err)
+	assert.Equal([]byte{0x01, 0x02}, output)
+	var msg map[string]string
+	json.Unmarshal(gateway.requests["eth_call"][0], &msg)
+	assert.Equal(fmt.Sprintf("0x%x", mockContract), msg["to"])
+	assert.Equal("0x0a", msg["data"])
+
+	gateway.handlers["eth_getTransactionCount"] = func([]json.RawMessage) interface{} { return "0x2" }
+	gateway.handlers["eth_sendTransaction"] = func([]json.RawMessage) interface{} { return fmt.Sprintf("0x%x", mockTxHash) }
+	hash, err := client.Transact(mockContract, big.NewInt(16), []byte{0x0b})
+	assert.Nil(err)
+	assert.Equal(mockTxHash, hash)
+	var tx map[string]string
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x2", tx["nonce"])
+	assert.Equal("0x10", tx["value"])
+	assert.Equal(fmt.Sprintf("0x%x", mockContract), tx["to"])
+
+	// the tx sent is not seen in pending nonce yet, its nonce is not reused
+	_, err = client.Transact(mockContract, nil, nil)
+	assert.Nil(err)
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x3", tx["nonce"])
+	gateway.handlers["eth_getTransactionCount"] = func([]json.RawMessage) interface{} { return "0x5" }
+	_, err = client.Transact(mockContract, nil, nil)
+	assert.Nil(err)
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x5", tx["nonce"])
+	_, err = client.TransactWithNonce(mockContract, nil, nil, 4)
+	assert.Nil(err)
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x4", tx["nonce"])
+
+	// a failed tx does not take its nonce
+	delete(gateway.handlers, "eth_sendTransaction")
+	_, err = client.Transact(mockContract, nil, nil)
+	assert.NotNil(err)
+	gateway.handlers["eth_sendTransaction"] = func([]json.RawMessage) interface{} { return fmt.Sprintf("0x%x", mockTxHash) }
+	gateway.handlers["eth_getTransactionCount"] = func([]json.RawMessage) interface{} { return "0x2" }
+	_, err = client.Transact(mockContract, nil, nil)
+	assert.Nil(err)
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x2", tx["nonce"])
+
+	_, err = client.TransactionReceipt(mockTxHash)
+	assert.NotNil(err)
+	gateway.handlers["eth_getTransactionReceipt"] = func([]json.RawMessage) interface{} { return nil }
+	_, err = client.TransactionReceipt(mockTxHash)
+	assert.Equal(ErrNoReceipt, err)
+}
+
+func TestDeployContract(t *testing.T) {
+	assert := assert.New(t)
+	gateway := newMockGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	client := NewClient(server.URL, mockFrom)
+
+	gateway.handlers["eth_getTransactionCount"] = func([]json.RawMessage) interface{} { return "0x0" }
+	gateway.handlers["eth_sendTransaction"] = func([]json.RawMessage) interface{} { return fmt.Sprintf("0x%x", mockTxHash) }
+	gateway.handlers["eth_getTransactionReceipt"] = func([]json.RawMessage) interface{} {
+		return map[string]interface{}{
+			"transactionHash": fmt.Sprintf("0x%x", mockTxHash),
+			"blockNumber":     "0x3",
+			"status":          "0x1",
+			"contractAddress": fmt.Sprintf("0x%x", mockContract),
+			"logs":            []interface{}{},
+		}
+	}
+	contract, receipt, err := DeployContract(client, tokenABI, "0x6060", nil)
+	assert.Nil(err)
+	assert.Equal(mockContract, contract.Address)
+	assert.Equal(uint64(3), receipt.BlockNumber)
+	var tx map[string]string
+	json.Unmarshal(gateway.requests["eth_sendTransaction"][0], &tx)
+	assert.Equal("0x6060", tx["data"])
+	_, ok := tx["to"]
+	assert.False(ok)
+}
+
+func TestFilterEvents(t *testing.T) {
+	assert := assert.New(t)
+	gateway := newMockGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	client := NewClient(server.URL, mockFrom)
+	contract, err := NewBoundContract(mockContract, tokenABI, client, client)
+	assert.Nil(err)
+
+	from, to := types.Address{0x02}, types.Address{0x03}
+	topics, data, err := contract.ABI().PackEvent("Transfer", from, to, big.NewInt(10))
+	assert.Nil(err)
+	gateway.handlers["eth_getLogs"] = func([]json.RawMessage) interface{} {
+		hexTopics := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			hexTopics = append(hexTopics, fmt.Sprintf("0x%x", topic))
+		}
+		return []interface{}{map[string]interface{}{
+			"address":         fmt.Sprintf("0x%x", mockContract),
+			"topics":          hexTopics,
+			"data":            fmt.Sprintf("0x%x", data),
+			"blockNumber":     "0x5",
+			"transactionHash": fmt.Sprintf("0x%x", mockTxHash),
+		}}
+	}
+	logs, values, err := FilterEvents(client, contract, "Transfer", 1, 10)
+	assert.Nil(err)
+	assert.Equal(1, len(logs))
+	assert.Equal(uint64(5), logs[0].BlockNumber)
+	assert.Equal([]interface{}{from, to, big.NewInt(10)}, values[0])
+	var filter map[string]interface{}
+	json.Unmarshal(gateway.requests["eth_getLogs"][0], &filter)
+	assert.Equal("0x1", filter["fromBlock"])
+	assert.Equal("0xa", filter["toBlock"])
+
+	_, _, err = FilterEvents(client, contract, "NotExist", 1, 10)
+	assert.NotNil(err)
+}
+
+func TestBind(t *testing.T) {
+	assert := assert.New(t)
+	code, err := Bind("token", []Contract{{Type: "JustitiaRight", ABI: tokenABI, Bin: "0x6060"}})
+	assert.Nil(err)
+	assert.Nil(typeCheck("token", code))
+	assert.True(strings.Contains(code, "package token"))
+	assert.True(strings.Contains(code, "func DeployJustitiaRight(client *bind.Client) (*JustitiaRight, *bind.Receipt, error)"))
+	assert.True(strings.Contains(code, "func NewJustitiaRight(address types.Address, client *bind.Client) (*JustitiaRight, error)"))
+	assert.True(strings.Contains(code, "func (_JustitiaRight *JustitiaRight) BalanceOf(owner types.Address) (*big.Int, error)"))
+	assert.True(strings.Contains(code, "func (_JustitiaRight *JustitiaRight) Decimals() (uint8, error)"))
+	assert.True(strings.Contains(code, "func (_JustitiaRight *JustitiaRight) Transfer(to types.Address, arg1 *big.Int) (types.Hash, error)"))
+	assert.True(strings.Contains(code, "func (_JustitiaRight *JustitiaRight) BuyJR(value *big.Int) (types.Hash, error)"))
+	assert.True(strings.Contains(code, "func (_JustitiaRight *JustitiaRight) FilterTransfer(fromBlock, toBlock uint64) ([]*JustitiaRightTransfer, error)"))
+
+	// no deploy function without creation code
+	code, err = Bind("token", []Contract{{Type: "JustitiaRight", ABI: tokenABI}})
+	assert.Nil(err)
+	assert.False(strings.Contains(code, "DeployJustitiaRight"))
+
+	_, err = Bind("token", []Contract{{Type: "Broken", ABI: "{"}})
+	assert.NotNil(err)
+
+	// colliding names are deduplicated by index suffix
+	code, err = Bind("collided", []Contract{{Type: "Collided", ABI: collidedABI}})
+	assert.Nil(err)
+	assert.Nil(typeCheck("collided", code))
+	assert.True(strings.Contains(code, "func (_Collided *Collided) Transfer(to types.Address, arg1 types.Address) (bool, error)"))
+	assert.True(strings.Contains(code, "func (_Collided *Collided) Transfer0(to types.Address) (types.Hash, error)"))
+	assert.True(strings.Contains(code, "func (_Collided *Collided) Transfer1(to types.Address, arg1 *big.Int) (types.Hash, error)"))
+	assert.True(strings.Contains(code, "func (_Collided *Collided) FilterTransfer0(fromBlock, toBlock uint64) ([]*CollidedTransfer0, error)"))
+	assert.True(strings.Contains(code, "func (_Collided *Collided) FilterTransfer1(fromBlock, toBlock uint64) ([]*CollidedTransfer1, error)"))
+	assert.True(strings.Contains(code, "type CollidedABI0 struct"))
+}
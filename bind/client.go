@@ -0,0 +1,379 @@
+// Package bind talks to justitia node through its JSON-RPC gateway, and generates
+// type-safe Go bindings of contracts on top of it.
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/tools"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// default gas limit of the sent transactions
+	DefaultGasLimit = uint64(0x6400000)
+	// interval to poll the receipt of transaction
+	receiptPollInterval = 500 * time.Millisecond
+)
+
+// ErrNoReceipt is returned when the transaction is not mined yet.
+var ErrNoReceipt = errors.New("receipt not found")
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// Client is a JSON-RPC client of the api gateway.
+type Client struct {
+	endpoint string
+	client   *http.Client
+	id       uint64
+	// account the transactions are sent from
+	From     types.Address
+	GasLimit uint64
+	GasPrice *big.Int
+	// timeout waiting for transaction mined
+	Timeout time.Duration
+	// next nonce of From tracked locally, the transactions sent but not seen by the node yet
+	// still take their nonces
+	nonceLock sync.Mutex
+	nonce     uint64
+}
+
+// NewClient create a client of the api gateway at endpoint, such as http://127.0.0.1:47768.
+func NewClient(endpoint string, from types.Address) *Client {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "http://" + endpoint
+	}
+	return &Client{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		From:     from,
+		GasLimit: DefaultGasLimit,
+		GasPrice: big.NewInt(0),
+		Timeout:  time.Minute,
+	}
+}
+
+// Endpoint returns the endpoint of api gateway.
+func (client *Client) Endpoint() string {
+	return client.endpoint
+}
+
+// CallRPC call the JSON-RPC method and decode the result.
+func (client *Client) CallRPC(result interface{}, method string, params ...interface{}) error {
+	if nil == params {
+		params = make([]interface{}, 0)
+	}
+	request := rpcRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&client.id, 1),
+		Method:  method,
+		Params:  params,
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request of %s, as: %v", method, err)
+	}
+	resp, err := client.client.Post(client.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send request of %s to %s, as: %v", method, client.endpoint, err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s, as: %v", method, err)
+	}
+	var response rpcResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		return fmt.Errorf("failed to parse response of %s, as: %v", method, err)
+	}
+	if nil != response.Error {
+		return fmt.Errorf("%s failed with code %d: %s", method, response.Error.Code, response.Error.Message)
+	}
+	if nil == result || len(response.Result) == 0 || string(response.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("failed to decode result of %s, as: %v", method, err)
+	}
+	return nil
+}
+
+// parse the hex quantity, such as 0x1a.
+func parseQuantity(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func encodeQuantity(v uint64) string {
+	return fmt.Sprintf("0x%x", v)
+}
+
+func hexToHash(s string) types.Hash {
+	return types.BytesToHash(tools.FromHex(s))
+}
+
+// BlockNumber get the height of the latest block.
+func (client *Client) BlockNumber() (uint64, error) {
+	var result string
+	if err := client.CallRPC(&result, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// Nonce get the pending nonce of the account.
+func (client *Client) Nonce(account types.Address) (uint64, error) {
+	var result string
+	if err := client.CallRPC(&result, "eth_getTransactionCount", fmt.Sprintf("0x%x", account), "pending"); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// MinedNonce get the nonce of the account on the latest state, the transactions in pool are not counted.
+func (client *Client) MinedNonce(account types.Address) (uint64, error) {
+	var result string
+	if err := client.CallRPC(&result, "eth_getTransactionCount", fmt.Sprintf("0x%x", account), "latest"); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// NextNonce take the next nonce of From, which is the greater of the pending nonce and the nonce
+// tracked locally, so that the transactions sent in a row never reuse a nonce.
+func (client *Client) NextNonce() (uint64, error) {
+	client.nonceLock.Lock()
+	defer client.nonceLock.Unlock()
+	pending, err := client.Nonce(client.From)
+	if err != nil {
+		return 0, err
+	}
+	if pending > client.nonce {
+		client.nonce = pending
+	}
+	nonce := client.nonce
+	client.nonce++
+	return nonce, nil
+}
+
+// ResetNonce drop the nonce tracked locally, the next nonce is the pending nonce again. It is
+// called when a transaction sent is dropped, so that its nonce is not skipped.
+func (client *Client) ResetNonce() {
+	client.nonceLock.Lock()
+	defer client.nonceLock.Unlock()
+	client.nonce = 0
+}
+
+// Call the contract on the latest state with eth_call.
+func (client *Client) Call(contract types.Address, input []byte) ([]byte, error) {
+	msg := map[string]string{
+		"from": fmt.Sprintf("0x%x", client.From),
+		"to":   fmt.Sprintf("0x%x", contract),
+		"data": fmt.Sprintf("0x%x", input),
+	}
+	var result string
+	if err := client.CallRPC(&result, "eth_call", msg, "latest"); err != nil {
+		return nil, err
+	}
+	return tools.FromHex(result), nil
+}
+
+// Transact send a transaction to the contract with eth_sendTransaction.
+func (client *Client) Transact(contract types.Address, value *big.Int, input []byte) (types.Hash, error) {
+	return client.sendTransaction(&contract, value, input)
+}
+
+// TransactWithNonce send a transaction to the contract with the nonce, such as resending a
+// transaction dropped by the node.
+func (client *Client) TransactWithNonce(contract types.Address, value *big.Int, input []byte, nonce uint64) (types.Hash, error) {
+	return client.sendTransactionWithNonce(&contract, value, input, nonce)
+}
+
+// Deploy send a transaction creating contract with code, returns the tx hash.
+func (client *Client) Deploy(value *big.Int, code []byte) (types.Hash, error) {
+	return client.sendTransaction(nil, value, code)
+}
+
+func (client *Client) sendTransaction(to *types.Address, value *big.Int, input []byte) (types.Hash, error) {
+	nonce, err := client.NextNonce()
+	if err != nil {
+		return types.Hash{}, err
+	}
+	hash, err := client.sendTransactionWithNonce(to, value, input, nonce)
+	if err != nil {
+		// the nonce is not taken by the node
+		client.ResetNonce()
+	}
+	return hash, err
+}
+
+func (client *Client) sendTransactionWithNonce(to *types.Address, value *big.Int, input []byte, nonce uint64) (types.Hash, error) {
+	if nil == value {
+		value = big.NewInt(0)
+	}
+	tx := map[string]string{
+		"from":     fmt.Sprintf("0x%x", client.From),
+		"nonce":    encodeQuantity(nonce),
+		"gas":      encodeQuantity(client.GasLimit),
+		"gasPrice": fmt.Sprintf("0x%x", client.GasPrice),
+		"value":    fmt.Sprintf("0x%x", value),
+		"data":     fmt.Sprintf("0x%x", input),
+	}
+	if nil != to {
+		tx["to"] = fmt.Sprintf("0x%x", *to)
+	}
+	var result string
+	if err := client.CallRPC(&result, "eth_sendTransaction", tx); err != nil {
+		return types.Hash{}, err
+	}
+	return hexToHash(result), nil
+}
+
+// Receipt is the receipt of mined transaction.
+type Receipt struct {
+	TxHash          types.Hash
+	BlockNumber     uint64
+	Status          uint64
+	ContractAddress types.Address
+	Logs            []*types.Log
+}
+
+type logJSON struct {
+	Address     string   `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	BlockNumber string   `json:"blockNumber"`
+	TxHash      string   `json:"transactionHash"`
+}
+
+type receiptJSON struct {
+	TxHash          string     `json:"transactionHash"`
+	BlockNumber     string     `json:"blockNumber"`
+	Status          string     `json:"status"`
+	ContractAddress string     `json:"contractAddress"`
+	Logs            []*logJSON `json:"logs"`
+}
+
+func (l *logJSON) toLog() *types.Log {
+	log := &types.Log{
+		Address: tools.HexToAddress(l.Address),
+		Topics:  make([]types.Hash, 0, len(l.Topics)),
+		Data:    tools.FromHex(l.Data),
+		TxHash:  hexToHash(l.TxHash),
+	}
+	log.BlockNumber, _ = parseQuantity(l.BlockNumber)
+	for _, topic := range l.Topics {
+		log.Topics = append(log.Topics, hexToHash(topic))
+	}
+	return log
+}
+
+// TransactionReceipt get the receipt of transaction, ErrNoReceipt is returned if it is not mined.
+func (client *Client) TransactionReceipt(hash types.Hash) (*Receipt, error) {
+	var result *receiptJSON
+	if err := client.CallRPC(&result, "eth_getTransactionReceipt", fmt.Sprintf("0x%x", hash)); err != nil {
+		return nil, err
+	}
+	if nil == result {
+		return nil, ErrNoReceipt
+	}
+	receipt := &Receipt{
+		TxHash:          hexToHash(result.TxHash),
+		ContractAddress: tools.HexToAddress(result.ContractAddress),
+		Logs:            make([]*types.Log, 0, len(result.Logs)),
+	}
+	receipt.BlockNumber, _ = parseQuantity(result.BlockNumber)
+	receipt.Status, _ = parseQuantity(result.Status)
+	for _, log := range result.Logs {
+		receipt.Logs = append(receipt.Logs, log.toLog())
+	}
+	return receipt, nil
+}
+
+// WaitMined wait until the transaction is mined or timeout.
+func (client *Client) WaitMined(hash types.Hash) (*Receipt, error) {
+	deadline := time.Now().Add(client.Timeout)
+	for {
+		receipt, err := client.TransactionReceipt(hash)
+		if err != ErrNoReceipt {
+			return receipt, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transaction %x not mined in %v", hash, client.Timeout)
+		}
+		time.Sleep(receiptPollInterval)
+	}
+}
+
+// FilterQuery is the query of logs.
+type FilterQuery struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Addresses []types.Address
+	// topics at each position, nil matches any topic
+	Topics [][]types.Hash
+}
+
+// FilterLogs get the logs matching the query with eth_getLogs.
+func (client *Client) FilterLogs(query FilterQuery) ([]*types.Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": encodeQuantity(query.FromBlock),
+		"toBlock":   encodeQuantity(query.ToBlock),
+	}
+	addresses := make([]string, 0, len(query.Addresses))
+	for _, address := range query.Addresses {
+		addresses = append(addresses, fmt.Sprintf("0x%x", address))
+	}
+	if len(addresses) > 0 {
+		filter["address"] = addresses
+	}
+	topics := make([]interface{}, 0, len(query.Topics))
+	for _, position := range query.Topics {
+		if nil == position {
+			topics = append(topics, nil)
+			continue
+		}
+		hashes := make([]string, 0, len(position))
+		for _, topic := range position {
+			hashes = append(hashes, fmt.Sprintf("0x%x", topic))
+		}
+		topics = append(topics, hashes)
+	}
+	if len(topics) > 0 {
+		filter["topics"] = topics
+	}
+	var result []*logJSON
+	if err := client.CallRPC(&result, "eth_getLogs", filter); err != nil {
+		return nil, err
+	}
+	logs := make([]*types.Log, 0, len(result))
+	for _, log := range result {
+		logs = append(logs, log.toLog())
+	}
+	return logs, nil
+}
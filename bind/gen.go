@@ -0,0 +1,380 @@
+package bind
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DSiSc/justitia/abi"
+	"go/format"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Contract is the contract to generate binding of.
+type Contract struct {
+	// Go type name of the binding
+	Type string
+	// ABI definition in JSON
+	ABI string
+	// creation code in hex, Deploy function is generated only if it is not empty
+	Bin string
+}
+
+type tmplArg struct {
+	Name   string
+	GoType string
+	Zero   string
+}
+
+type tmplMethod struct {
+	Name    string
+	GoName  string
+	Sig     string
+	Payable bool
+	Inputs  []tmplArg
+	Outputs []tmplArg
+}
+
+type tmplEvent struct {
+	Name   string
+	GoName string
+	Sig    string
+	Fields []tmplArg
+}
+
+type tmplContract struct {
+	Type        string
+	ABI         string
+	Bin         string
+	Constructor tmplMethod
+	Calls       []tmplMethod
+	Transacts   []tmplMethod
+	Events      []tmplEvent
+}
+
+type tmplData struct {
+	Package   string
+	Contracts []tmplContract
+}
+
+// Bind generate the source of Go package pkg, which contains the type-safe bindings of the contracts.
+func Bind(pkg string, contracts []Contract) (string, error) {
+	data := tmplData{
+		Package:   pkg,
+		Contracts: make([]tmplContract, 0, len(contracts)),
+	}
+	for _, contract := range contracts {
+		parsed, err := abi.JSON(strings.NewReader(contract.ABI))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse abi of %s, as: %v", contract.Type, err)
+		}
+		bound := tmplContract{
+			Type:        capitalise(contract.Type),
+			ABI:         contract.ABI,
+			Bin:         strings.TrimPrefix(contract.Bin, "0x"),
+			Constructor: newTmplMethod("", "", parsed.Constructor),
+		}
+		// overloaded methods and names differing only in case, such as transfer and Transfer, are mapped
+		// to the same Go name, so the names are deduplicated by index suffix.
+		methodNames := make(goNames)
+		for _, key := range sortedMethods(parsed.Methods) {
+			method := parsed.Methods[key]
+			if method.Const {
+				bound.Calls = append(bound.Calls, newTmplMethod(key, methodNames.unique(capitalise(method.Name)), method))
+			} else {
+				bound.Transacts = append(bound.Transacts, newTmplMethod(key, methodNames.unique(capitalise(method.Name)), method))
+			}
+		}
+		// event types are named with contract type as prefix, which can not collide with ABI and Bin constants
+		eventNames := goNames{"ABI": true, "Bin": true}
+		for _, key := range sortedEvents(parsed.Events) {
+			event := parsed.Events[key]
+			goName := eventNames.unique(capitalise(event.Name))
+			// the Filter method of event can not collide with contract methods either
+			for methodNames["Filter"+goName] {
+				goName = eventNames.unique(capitalise(event.Name))
+			}
+			methodNames["Filter"+goName] = true
+			bound.Events = append(bound.Events, newTmplEvent(key, goName, event))
+		}
+		data.Contracts = append(data.Contracts, bound)
+	}
+
+	var buffer bytes.Buffer
+	if err := bindTemplate.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("failed to generate binding, as: %v", err)
+	}
+	code, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to format generated binding, as: %v", err)
+	}
+	return string(code), nil
+}
+
+func sortedMethods(methods map[string]abi.Method) []string {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedEvents(events map[string]abi.Event) []string {
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// names used by the generated code, which can not be the name of arguments
+var reservedNames = map[string]bool{
+	"value": true, "client": true, "contract": true, "receipt": true, "out": true, "err": true,
+	"big": true, "types": true, "bind": true,
+}
+
+// goNames is the set of Go names already used in a scope.
+type goNames map[string]bool
+
+// unique returns name if it is not used yet, otherwise name with the first unused index suffix.
+func (names goNames) unique(name string) string {
+	candidate := name
+	for i := 0; names[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	names[candidate] = true
+	return candidate
+}
+
+// newTmplMethod bind the method keyed by key in abi methods to the Go method goName.
+func newTmplMethod(key, goName string, method abi.Method) tmplMethod {
+	bound := tmplMethod{
+		Name:    key,
+		GoName:  goName,
+		Payable: method.Payable,
+	}
+	if "" != method.Name {
+		bound.Sig = method.Sig()
+	}
+	argNames := make(goNames)
+	for name := range reservedNames {
+		argNames[name] = true
+	}
+	for i, input := range method.Inputs {
+		name := decapitalise(input.Name)
+		if "" == name || token.Lookup(name).IsKeyword() || argNames[name] {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		bound.Inputs = append(bound.Inputs, newTmplArg(argNames.unique(name), input.Type))
+	}
+	for _, output := range method.Outputs {
+		bound.Outputs = append(bound.Outputs, newTmplArg(output.Name, output.Type))
+	}
+	return bound
+}
+
+// newTmplEvent bind the event keyed by key in abi events to the Go struct goName.
+func newTmplEvent(key, goName string, event abi.Event) tmplEvent {
+	bound := tmplEvent{
+		Name:   key,
+		GoName: goName,
+		Sig:    event.Sig(),
+	}
+	fieldNames := goNames{"Raw": true}
+	for i, input := range event.Inputs {
+		name := capitalise(input.Name)
+		if "" == name || fieldNames[name] {
+			name = fmt.Sprintf("Arg%d", i)
+		}
+		field := newTmplArg(fieldNames.unique(name), input.Type)
+		if input.Indexed && isDynamic(input.Type) {
+			// only the hash of indexed dynamic value is kept in topic
+			field.GoType, field.Zero = "types.Hash", "types.Hash{}"
+		}
+		bound.Fields = append(bound.Fields, field)
+	}
+	return bound
+}
+
+func newTmplArg(name string, t abi.Type) tmplArg {
+	goType := bindType(t)
+	return tmplArg{
+		Name:   name,
+		GoType: goType,
+		Zero:   zeroValue(goType),
+	}
+}
+
+// Go type of the abi type, consistent with the values unpacked by package abi.
+func bindType(t abi.Type) string {
+	switch t.Kind {
+	case abi.IntTy, abi.UintTy:
+		prefix := "int"
+		if abi.UintTy == t.Kind {
+			prefix = "uint"
+		}
+		switch t.Size {
+		case 8, 16, 32, 64:
+			return fmt.Sprintf("%s%d", prefix, t.Size)
+		}
+		return "*big.Int"
+	case abi.BoolTy:
+		return "bool"
+	case abi.AddressTy:
+		return "types.Address"
+	case abi.FixedBytesTy:
+		return fmt.Sprintf("[%d]byte", t.Size)
+	case abi.BytesTy:
+		return "[]byte"
+	case abi.StringTy:
+		return "string"
+	case abi.SliceTy:
+		return "[]" + bindType(*t.Elem)
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]%s", t.Size, bindType(*t.Elem))
+	}
+	return "interface{}"
+}
+
+func zeroValue(goType string) string {
+	switch {
+	case "bool" == goType:
+		return "false"
+	case "string" == goType:
+		return `""`
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "0"
+	case strings.HasPrefix(goType, "*"), strings.HasPrefix(goType, "[]"), "interface{}" == goType:
+		return "nil"
+	}
+	return goType + "{}"
+}
+
+func isDynamic(t abi.Type) bool {
+	switch t.Kind {
+	case abi.BytesTy, abi.StringTy, abi.SliceTy:
+		return true
+	case abi.ArrayTy:
+		return isDynamic(*t.Elem)
+	}
+	return false
+}
+
+func capitalise(name string) string {
+	name = strings.TrimLeft(name, "_")
+	if "" == name {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func decapitalise(name string) string {
+	name = strings.TrimLeft(name, "_")
+	if "" == name {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+var bindTemplate = template.Must(template.New("bind").Funcs(template.FuncMap{"literal": literal}).Parse(bindSource))
+
+// Go string literal of s, raw string literal is preferred for readability.
+func literal(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+const bindSource = `// Code generated by justitia contracts bindgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"math/big"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = big.NewInt
+	_ = types.Address{}
+)
+{{range $contract := .Contracts}}
+// {{.Type}}ABI is the ABI definition of {{.Type}}.
+const {{.Type}}ABI = {{literal .ABI}}
+
+// {{.Type}} is the binding of contract {{.Type}}.
+type {{.Type}} struct {
+	contract *bind.BoundContract
+	client   *bind.Client
+}
+{{if .Bin}}
+// {{.Type}}Bin is the creation code of {{.Type}}.
+const {{.Type}}Bin = "{{.Bin}}"
+
+// Deploy{{.Type}} deploy {{.Type}} through the client and wait until it is mined.
+func Deploy{{.Type}}(client *bind.Client{{if .Constructor.Payable}}, value *big.Int{{end}}{{range .Constructor.Inputs}}, {{.Name}} {{.GoType}}{{end}}) (*{{.Type}}, *bind.Receipt, error) {
+	contract, receipt, err := bind.DeployContract(client, {{.Type}}ABI, {{.Type}}Bin, {{if .Constructor.Payable}}value{{else}}nil{{end}}{{range .Constructor.Inputs}}, {{.Name}}{{end}})
+	if err != nil {
+		return nil, receipt, err
+	}
+	return &{{.Type}}{contract: contract, client: client}, receipt, nil
+}
+{{end}}
+// New{{.Type}} bind {{.Type}} deployed at address through the client.
+func New{{.Type}}(address types.Address, client *bind.Client) (*{{.Type}}, error) {
+	contract, err := bind.NewBoundContract(address, {{.Type}}ABI, client, client)
+	if err != nil {
+		return nil, err
+	}
+	return &{{.Type}}{contract: contract, client: client}, nil
+}
+{{range .Calls}}
+// {{.GoName}} call the read-only method {{.Sig}}.
+func (_{{$contract.Type}} *{{$contract.Type}}) {{.GoName}}({{range $i, $in := .Inputs}}{{if $i}}, {{end}}{{.Name}} {{.GoType}}{{end}}) ({{range .Outputs}}{{.GoType}}, {{end}}error) {
+	{{if .Outputs}}out{{else}}_{{end}}, err := _{{$contract.Type}}.contract.Call("{{.Name}}"{{range .Inputs}}, {{.Name}}{{end}})
+	if err != nil {
+		return {{range .Outputs}}{{.Zero}}, {{end}}err
+	}
+	return {{range $i, $out := .Outputs}}out[{{$i}}].({{.GoType}}), {{end}}nil
+}
+{{end}}{{range .Transacts}}
+// {{.GoName}} send a transaction invoking method {{.Sig}}, returns the tx hash.
+func (_{{$contract.Type}} *{{$contract.Type}}) {{.GoName}}({{if .Payable}}value *big.Int{{if .Inputs}}, {{end}}{{end}}{{range $i, $in := .Inputs}}{{if $i}}, {{end}}{{.Name}} {{.GoType}}{{end}}) (types.Hash, error) {
+	return _{{$contract.Type}}.contract.Transact({{if .Payable}}value{{else}}nil{{end}}, "{{.Name}}"{{range .Inputs}}, {{.Name}}{{end}})
+}
+{{end}}{{range .Events}}
+// {{$contract.Type}}{{.GoName}} is the event {{.Sig}} emitted by {{$contract.Type}}.
+type {{$contract.Type}}{{.GoName}} struct {
+	{{range .Fields}}{{.Name}} {{.GoType}}
+	{{end}}Raw *types.Log
+}
+
+// Filter{{.GoName}} get the {{.Name}} events emitted in blocks [fromBlock, toBlock].
+func (_{{$contract.Type}} *{{$contract.Type}}) Filter{{.GoName}}(fromBlock, toBlock uint64) ([]*{{$contract.Type}}{{.GoName}}, error) {
+	logs, {{if .Fields}}values{{else}}_{{end}}, err := bind.FilterEvents(_{{$contract.Type}}.client, _{{$contract.Type}}.contract, "{{.Name}}", fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*{{$contract.Type}}{{.GoName}}, 0, len(logs))
+	for {{if .Fields}}i{{else}}_{{end}}, log := range logs {
+		events = append(events, &{{$contract.Type}}{{.GoName}}{
+			{{range $j, $field := .Fields}}{{.Name}}: values[i][{{$j}}].({{.GoType}}),
+			{{end}}Raw: log,
+		})
+	}
+	return events, nil
+}
+{{end}}{{end}}`
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/rlp"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/worker"
+	"io"
+	"os"
+	"strconv"
+)
+
+func init() {
+	register(&Command{
+		Name:  "chain",
+		Usage: "justitia chain export [from] [to] > blocks.rlp | justitia chain import blocks.rlp",
+		SubCommands: []*Command{
+			{
+				Name:  "export",
+				Usage: "justitia chain export [from] [to] > blocks.rlp",
+				Run:   chainExport,
+			},
+			{
+				Name:  "import",
+				Usage: "justitia chain import blocks.rlp",
+				Run:   chainImport,
+			},
+		},
+	})
+}
+
+// export blocks in range [from, to] to stdout as rlp stream.
+func chainExport(args []string) error {
+	if len(args) > 2 {
+		return errors.New("usage: justitia chain export [from] [to] > blocks.rlp")
+	}
+	chain, _, err := initRepository()
+	if err != nil {
+		return err
+	}
+	currentBlock := chain.GetCurrentBlock()
+	if nil == currentBlock {
+		return errors.New("no block in local repository")
+	}
+	from, to := uint64(0), currentBlock.Header.Height
+	if len(args) > 0 {
+		if from, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid from height %s", args[0])
+		}
+	}
+	if len(args) > 1 {
+		if to, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+			return fmt.Errorf("invalid to height %s", args[1])
+		}
+	}
+	if from > to || to > currentBlock.Header.Height {
+		return fmt.Errorf("invalid height range [%d, %d], current height is %d", from, to, currentBlock.Header.Height)
+	}
+	writer := bufio.NewWriter(os.Stdout)
+	if err := exportBlocks(chain, writer, from, to); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// write blocks in range [from, to] to writer in rlp encoding.
+func exportBlocks(chain *repository.Repository, w io.Writer, from, to uint64) error {
+	for height := from; height <= to; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return fmt.Errorf("failed to get block with height %d, as: %v", height, err)
+		}
+		if err := rlp.Encode(w, block); err != nil {
+			return fmt.Errorf("failed to encode block with height %d, as: %v", height, err)
+		}
+	}
+	return nil
+}
+
+// import blocks from rlp stream file.
+func chainImport(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: justitia chain import blocks.rlp")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open block file, as: %v", err)
+	}
+	defer file.Close()
+	_, nodeConf, err := initRepository()
+	if err != nil {
+		return err
+	}
+	if err := config.ImportGenesisBlock(); err != nil {
+		return err
+	}
+	if err := config.CheckChainMeta(nodeConf); err != nil {
+		return err
+	}
+	imported, err := importBlocks(bufio.NewReader(file), nodeConf.SwitchConf[config.BlockSwitch].VerifySignature)
+	fmt.Printf("import %d blocks\n", imported)
+	return err
+}
+
+// import blocks from rlp stream, every block is re-executed and validated before written.
+func importBlocks(r io.Reader, signVerify bool) (int, error) {
+	stream := rlp.NewStream(r, 0)
+	imported := 0
+	for {
+		block := new(types.Block)
+		if err := stream.Decode(block); err != nil {
+			if err == io.EOF {
+				return imported, nil
+			}
+			return imported, fmt.Errorf("failed to decode block, as: %v", err)
+		}
+		chain, err := repository.NewLatestStateRepository()
+		if err != nil {
+			return imported, fmt.Errorf("failed to get latest state repository, as: %v", err)
+		}
+		currentBlock := chain.GetCurrentBlock()
+		if block.Header.Height <= currentBlock.Header.Height {
+			localBlock, err := chain.GetBlockByHeight(block.Header.Height)
+			if err != nil {
+				return imported, fmt.Errorf("failed to get local block with height %d, as: %v", block.Header.Height, err)
+			}
+			if common.HeaderHash(localBlock) != common.HeaderHash(block) {
+				return imported, fmt.Errorf("block %d hash %x mismatch with local block hash %x", block.Header.Height, common.HeaderHash(block), common.HeaderHash(localBlock))
+			}
+			log.Debug("block %d already exists in local repository, skip it", block.Header.Height)
+			continue
+		}
+		if block.Header.Height != currentBlock.Header.Height+1 || block.Header.PrevBlockHash != common.HeaderHash(currentBlock) {
+			return imported, fmt.Errorf("block %d is not the successor of local block %d(%x)", block.Header.Height, currentBlock.Header.Height, common.HeaderHash(currentBlock))
+		}
+		if err := validateAndWriteBlock(block, signVerify); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+}
+
+// re-execute the block through the validator and write it with the receipts.
+func validateAndWriteBlock(block *types.Block, signVerify bool) error {
+	chain, err := repository.NewRepositoryByBlockHash(block.Header.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("failed to get state of block %x, as: %v", block.Header.PrevBlockHash, err)
+	}
+	blockWorker := worker.NewWorker(chain, block, signVerify)
+	if err := blockWorker.VerifyBlock(); err != nil {
+		return fmt.Errorf("failed to validate block %d, as: %v", block.Header.Height, err)
+	}
+	if err := chain.WriteBlockWithReceipts(block, blockWorker.GetReceipts()); err != nil {
+		return fmt.Errorf("failed to write block %d, as: %v", block.Header.Height, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package cmd implements the sub commands of justitia, such as snapshot export and import.
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Command is a sub command of justitia, a command either runs itself or dispatches to its sub commands.
+type Command struct {
+	Name        string
+	Usage       string
+	Run         func(args []string) error
+	SubCommands []*Command
+}
+
+var commands = make(map[string]*Command)
+
+func register(command *Command) {
+	if _, found := commands[command.Name]; found {
+		panic(fmt.Sprintf("command %s has been registered", command.Name))
+	}
+	commands[command.Name] = command
+}
+
+// IsCommand check whether the name is a registered command.
+func IsCommand(name string) bool {
+	_, found := commands[name]
+	return found
+}
+
+// Run run the command specified by args, args[0] is the command name.
+func Run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command specified, available commands: %s", availableCommands())
+	}
+	command, found := commands[args[0]]
+	if !found {
+		return fmt.Errorf("unknown command %s, available commands: %s", args[0], availableCommands())
+	}
+	return command.run(args[1:])
+}
+
+func (command *Command) run(args []string) error {
+	if nil != command.Run {
+		return command.Run(args)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", command.Usage)
+	}
+	for _, sub := range command.SubCommands {
+		if sub.Name == args[0] {
+			return sub.run(args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %s %s, usage: %s", command.Name, args[0], command.Usage)
+}
+
+func availableCommands() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/craft/rlp"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/compiler"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	var runArgs []string
+	register(&Command{
+		Name:  "mock",
+		Usage: "justitia mock sub [args]",
+		SubCommands: []*Command{
+			{
+				Name: "sub",
+				Run: func(args []string) error {
+					runArgs = args
+					return nil
+				},
+			},
+			{
+				Name: "failed",
+				Run: func(args []string) error {
+					return errors.New("mock failed")
+				},
+			},
+		},
+	})
+	defer delete(commands, "mock")
+
+	assert.True(IsCommand("mock"))
+	assert.False(IsCommand("unknown"))
+	assert.Nil(Run([]string{"mock", "sub", "arg1"}))
+	assert.Equal([]string{"arg1"}, runArgs)
+	assert.NotNil(Run([]string{"mock", "failed"}))
+	assert.NotNil(Run([]string{"mock"}))
+	assert.NotNil(Run([]string{"mock", "unknown"}))
+	assert.NotNil(Run([]string{"unknown"}))
+	assert.NotNil(Run([]string{}))
+}
+
+func TestSnapshotCommand(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsCommand("snapshot"))
+	assert.NotNil(Run([]string{"snapshot", "export"}))
+	assert.NotNil(Run([]string{"snapshot", "import"}))
+}
+
+func TestChainCommand(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsCommand("chain"))
+	assert.NotNil(Run([]string{"chain", "export", "1", "2", "3"}))
+	assert.NotNil(Run([]string{"chain", "import"}))
+}
+
+func TestImportBlocks(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	localBlock := &types.Block{
+		Header: &types.Header{
+			Height: 1,
+		},
+	}
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return localBlock
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(*repository.Repository, uint64) (*types.Block, error) {
+		return localBlock, nil
+	})
+
+	var buf bytes.Buffer
+	assert.Nil(rlp.Encode(&buf, localBlock))
+	imported, err := importBlocks(bytes.NewReader(buf.Bytes()), false)
+	assert.Nil(err)
+	assert.Equal(0, imported)
+
+	buf.Reset()
+	assert.Nil(rlp.Encode(&buf, &types.Block{
+		Header: &types.Header{
+			Height: 3,
+		},
+	}))
+	imported, err = importBlocks(bytes.NewReader(buf.Bytes()), false)
+	assert.NotNil(err)
+	assert.Equal(0, imported)
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	blocks := []*types.Block{
+		{
+			Header: &types.Header{
+				Height: 0,
+			},
+		},
+		{
+			Header: &types.Header{
+				Height: 1,
+			},
+		},
+	}
+	blocks[1].Header.PrevBlockHash = common.HeaderHash(blocks[0])
+	chain := &repository.Repository{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		return blocks[height], nil
+	})
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(types.Hash) (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "IntermediateRoot", func(*repository.Repository, bool) types.Hash {
+		return types.Hash{}
+	})
+	lastGood, err := verifyBlocks(chain, 1)
+	assert.Nil(err)
+	assert.Equal(int64(1), lastGood)
+
+	blocks[1].Header.PrevBlockHash = types.Hash{}
+	lastGood, err = verifyBlocks(chain, 1)
+	assert.NotNil(err)
+	assert.Equal(int64(0), lastGood)
+}
+
+func TestDbCommand(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsCommand("db"))
+	assert.NotNil(Run([]string{"db", "rollback"}))
+	assert.NotNil(Run([]string{"db", "get", "block"}))
+}
+
+func TestContractsCommand(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	assert.True(IsCommand("contracts"))
+	assert.NotNil(Run([]string{"contracts", "build", "--solc", "solc", "--solc-version", "0.4.25", "Voting"}))
+
+	var built []string
+	monkey.Patch(compiler.FindSolidity, func(string) (*compiler.Solidity, error) {
+		return &compiler.Solidity{Version: "0.4.25"}, nil
+	})
+	monkey.Patch(compiler.SourcePath, func(contract string) (string, error) {
+		return contract + ".sol", nil
+	})
+	cache := compiler.NewArtifactCache("")
+	monkey.PatchInstanceMethod(reflect.TypeOf(cache), "Build", func(_ *compiler.ArtifactCache, _ *compiler.Solidity, contract, _ string, _ compiler.StandardOptions) (*compiler.Artifact, error) {
+		built = append(built, contract)
+		return &compiler.Artifact{Contract: contract, CompilerVersion: "0.4.25"}, nil
+	})
+	assert.Nil(Run([]string{"contracts", "build", "--solc-version", "0.4.25", "Voting", "MetaData"}))
+	assert.Equal([]string{"Voting", "MetaData"}, built)
+
+	monkey.Patch(compiler.FindSolidity, func(string) (*compiler.Solidity, error) {
+		return nil, errors.New("solc: version 0.4.25 not found")
+	})
+	assert.NotNil(Run([]string{"contracts", "build", "--solc-version", "0.4.25", "Voting"}))
+
+	// bindgen
+	assert.NotNil(Run([]string{"contracts", "bindgen", "--abi", "token.abi", "--type", "Token"}))
+	assert.NotNil(Run([]string{"contracts", "bindgen", "--sol", "Token.sol", "--abi", "token.abi", "--pkg", "token"}))
+	assert.NotNil(Run([]string{"contracts", "bindgen", "--abi", "token.abi", "--pkg", "token"}))
+	dir, _ := ioutil.TempDir("", "bindgen")
+	defer os.RemoveAll(dir)
+	abiFile, outFile := filepath.Join(dir, "token.abi"), filepath.Join(dir, "token.go")
+	ioutil.WriteFile(abiFile, []byte(syscontract.JustitiaRightABI), 0644)
+	assert.Nil(Run([]string{"contracts", "bindgen", "--abi", abiFile, "--type", "Token", "--pkg", "token", "--out", outFile}))
+	code, err := ioutil.ReadFile(outFile)
+	assert.Nil(err)
+	assert.True(strings.Contains(string(code), "func NewToken("))
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/DSiSc/justitia/bind"
+	"github.com/DSiSc/justitia/compiler"
+	"github.com/DSiSc/justitia/config"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(&Command{
+		Name:  "contracts",
+		Usage: "justitia contracts (build|bindgen) [args...]",
+		SubCommands: []*Command{
+			{
+				Name:  "build",
+				Usage: "justitia contracts build [--solc path | --solc-version v] [--out dir] [contract...]",
+				Run:   contractsBuild,
+			},
+			{
+				Name:  "bindgen",
+				Usage: "justitia contracts bindgen (--sol file [--solc path] | --abi file [--bin file] --type name) --pkg name [--out file]",
+				Run:   contractsBindgen,
+			},
+		},
+	})
+}
+
+// compile the builtin contracts and cache their artifacts, the contracts declared
+// without code in genesis file are built if no contract specified.
+func contractsBuild(args []string) error {
+	var solcPath, solcVersion, outDir string
+	flagSet := flag.NewFlagSet("contracts build", flag.ContinueOnError)
+	flagSet.StringVar(&solcPath, "solc", "", "Path of the solc executable.")
+	flagSet.StringVar(&solcVersion, "solc-version", "", "Version of the solc executable to find on PATH, default to the version builtin contracts are built with.")
+	flagSet.StringVar(&outDir, "out", config.ArtifactPath(), "Directory of the artifact cache.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if "" != solcPath && "" != solcVersion {
+		return errors.New("only one of --solc and --solc-version can be specified")
+	}
+	contracts := flagSet.Args()
+	if len(contracts) == 0 {
+		var err error
+		if contracts, err = config.GenesisContracts(); err != nil {
+			return err
+		}
+	}
+	if len(contracts) == 0 {
+		fmt.Println("no contract to build")
+		return nil
+	}
+
+	var solc *compiler.Solidity
+	var err error
+	if "" != solcPath {
+		solc, err = compiler.SolidityVersion(solcPath)
+	} else {
+		if "" == solcVersion {
+			solcVersion = compiler.BuiltinSolidityVersion
+		}
+		solc, err = compiler.FindSolidity(solcVersion)
+	}
+	if err != nil {
+		return err
+	}
+	if compiler.BuiltinSolidityVersion != solc.Version {
+		fmt.Printf("warning: artifacts built by solc %s are not loaded by genesis, which requires solc %s\n", solc.Version, compiler.BuiltinSolidityVersion)
+	}
+	cache := compiler.NewArtifactCache(outDir)
+	for _, contract := range contracts {
+		sourcePath, err := compiler.SourcePath(contract)
+		if err != nil {
+			return err
+		}
+		artifact, err := cache.Build(solc, contract, sourcePath, compiler.DefaultArtifactOptions)
+		if err != nil {
+			return fmt.Errorf("failed to build contract %s, as: %v", contract, err)
+		}
+		fmt.Printf("build %s with solc %s: %s\n", contract, artifact.CompilerVersion, artifact.Key)
+	}
+	return nil
+}
+
+// generate the Go bindings of contracts, which are compiled from solidity source or
+// loaded from the ABI and creation code files.
+func contractsBindgen(args []string) error {
+	var solFile, solcPath, abiFile, binFile, typeName, pkg, outFile string
+	flagSet := flag.NewFlagSet("contracts bindgen", flag.ContinueOnError)
+	flagSet.StringVar(&solFile, "sol", "", "Solidity source file, bindings of all the contracts in it are generated.")
+	flagSet.StringVar(&solcPath, "solc", "solc", "Path of the solc executable.")
+	flagSet.StringVar(&abiFile, "abi", "", "File of the contract ABI definition.")
+	flagSet.StringVar(&binFile, "bin", "", "File of the contract creation code in hex, optional.")
+	flagSet.StringVar(&typeName, "type", "", "Go type name of the contract bound with --abi.")
+	flagSet.StringVar(&pkg, "pkg", "", "Package name of the generated bindings.")
+	flagSet.StringVar(&outFile, "out", "", "File to write the bindings to, stdout by default.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if "" == pkg {
+		return errors.New("package name must be specified with --pkg")
+	}
+	if ("" == solFile) == ("" == abiFile) {
+		return errors.New("one of --sol and --abi must be specified")
+	}
+
+	var contracts []bind.Contract
+	if "" != solFile {
+		compiled, err := compiler.CompileSolidity(solcPath, solFile)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(compiled))
+		for name := range compiled {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			definition, err := json.Marshal(compiled[name].Info.AbiDefinition)
+			if err != nil {
+				return fmt.Errorf("failed to encode abi of %s, as: %v", name, err)
+			}
+			contracts = append(contracts, bind.Contract{
+				Type: name[strings.LastIndex(name, ":")+1:],
+				ABI:  string(definition),
+				Bin:  compiled[name].Code,
+			})
+		}
+	} else {
+		if "" == typeName {
+			return errors.New("type name must be specified with --type")
+		}
+		definition, err := ioutil.ReadFile(abiFile)
+		if err != nil {
+			return fmt.Errorf("failed to read abi file %s, as: %v", abiFile, err)
+		}
+		contract := bind.Contract{Type: typeName, ABI: string(definition)}
+		if "" != binFile {
+			code, err := ioutil.ReadFile(binFile)
+			if err != nil {
+				return fmt.Errorf("failed to read bin file %s, as: %v", binFile, err)
+			}
+			contract.Bin = strings.TrimSpace(string(code))
+		}
+		contracts = append(contracts, contract)
+	}
+
+	code, err := bind.Bind(pkg, contracts)
+	if err != nil {
+		return err
+	}
+	if "" == outFile {
+		fmt.Print(code)
+		return nil
+	}
+	if err := ioutil.WriteFile(outFile, []byte(code), 0644); err != nil {
+		return fmt.Errorf("failed to write bindings to %s, as: %v", outFile, err)
+	}
+	return nil
+}
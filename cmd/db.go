@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/pruner"
+	"github.com/DSiSc/justitia/tools"
+	"github.com/DSiSc/repository"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+func init() {
+	// rollback is not supported, as the repository can't delete the blocks, receipts and tx
+	// indexes above a height. A node whose blocks fail verify is re-synced from an empty data dir.
+	register(&Command{
+		Name:  "db",
+		Usage: "justitia db stat | verify | prune [--keep N | --keep-time S] | get block|tx|account <key> (rollback is not supported, re-sync the node instead)",
+		SubCommands: []*Command{
+			{
+				Name:  "stat",
+				Usage: "justitia db stat",
+				Run:   dbStat,
+			},
+			{
+				Name:  "verify",
+				Usage: "justitia db verify",
+				Run:   dbVerify,
+			},
+			{
+				Name:  "prune",
+				Usage: "justitia db prune [--keep N | --keep-time S]",
+				Run:   dbPrune,
+			},
+			{
+				Name:  "get",
+				Usage: "justitia db get block <height|hash> | tx <hash> | account <address>",
+				Run:   dbGet,
+			},
+		},
+	})
+}
+
+// print the heights, sizes and latest state root of the repository.
+func dbStat(args []string) error {
+	chain, nodeConf, err := initRepository()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("plugin:        %s\n", nodeConf.RepositoryConf.PluginName)
+	fmt.Printf("state path:    %s (%d bytes)\n", nodeConf.RepositoryConf.StateDataPath, dirSize(nodeConf.RepositoryConf.StateDataPath))
+	fmt.Printf("block path:    %s (%d bytes)\n", nodeConf.RepositoryConf.BlockDataPath, dirSize(nodeConf.RepositoryConf.BlockDataPath))
+	currentBlock := chain.GetCurrentBlock()
+	if nil == currentBlock {
+		fmt.Println("current block: none")
+		return nil
+	}
+	fmt.Printf("height:        %d\n", currentBlock.Header.Height)
+	fmt.Printf("block hash:    %x\n", common.HeaderHash(currentBlock))
+	fmt.Printf("state root:    %x\n", currentBlock.Header.StateRoot)
+	return nil
+}
+
+// total size of the files in the directory.
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if nil == err && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// walk blocks from genesis, checking block links, header hashes and state roots.
+func dbVerify(args []string) error {
+	chain, _, err := initRepository()
+	if err != nil {
+		return err
+	}
+	currentBlock := chain.GetCurrentBlock()
+	if nil == currentBlock {
+		return errors.New("no block in local repository")
+	}
+	lastGood, err := verifyBlocks(chain, currentBlock.Header.Height)
+	if err != nil {
+		if lastGood < 0 {
+			return fmt.Errorf("%v, no known-good height", err)
+		}
+		return fmt.Errorf("%v, last known-good height is %d, re-sync the node from an empty data dir", err, lastGood)
+	}
+	fmt.Printf("verify %d blocks success\n", currentBlock.Header.Height+1)
+	return nil
+}
+
+// verify blocks in range [0, to], return the last known-good height.
+func verifyBlocks(chain *repository.Repository, to uint64) (int64, error) {
+	var prevHash types.Hash
+	for height := uint64(0); height <= to; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return int64(height) - 1, fmt.Errorf("failed to get block %d, as: %v", height, err)
+		}
+		if height > 0 && block.Header.PrevBlockHash != prevHash {
+			return int64(height) - 1, fmt.Errorf("block %d previous hash %x mismatch with block %d hash %x", height, block.Header.PrevBlockHash, height-1, prevHash)
+		}
+		// genesis header hash is computed before its state root is filled, so skip the check for it.
+		if headerHash := common.HeaderHash(&types.Block{Header: block.Header}); height > 0 && headerHash != common.HeaderHash(block) {
+			return int64(height) - 1, fmt.Errorf("block %d header hash %x mismatch with computed hash %x", height, common.HeaderHash(block), headerHash)
+		}
+		stateChain, err := repository.NewRepositoryByBlockHash(common.HeaderHash(block))
+		if err != nil {
+			return int64(height) - 1, fmt.Errorf("failed to get state of block %d, as: %v", height, err)
+		}
+		if stateRoot := stateChain.IntermediateRoot(false); stateRoot != block.Header.StateRoot {
+			return int64(height) - 1, fmt.Errorf("block %d state root %x mismatch with stored state root %x", height, block.Header.StateRoot, stateRoot)
+		}
+		prevHash = common.HeaderHash(block)
+	}
+	return int64(to), nil
+}
+
+// prune the states of old blocks, use the pruning setting in config if not specified. The repository
+// locks the state store, so the states to prune are planned by a child process opening the repository,
+// and swept after it exits.
+func dbPrune(args []string) error {
+	var keep, keepTime int64
+	var planOnly bool
+	flagSet := flag.NewFlagSet("db prune", flag.ContinueOnError)
+	flagSet.Int64Var(&keep, "keep", -1, "Number of latest states to keep.")
+	flagSet.Int64Var(&keepTime, "keep-time", -1, "Time in second to keep states.")
+	flagSet.BoolVar(&planOnly, "plan", false, "Only plan the states to prune, which are swept at next start.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if planOnly {
+		return planPrune(keep, keepTime)
+	}
+	nodeConf := config.NewNodeConfig()
+	if common.LevelDBPlugin != nodeConf.RepositoryConf.PluginName {
+		return fmt.Errorf("state pruning is not supported by repository plugin %s", nodeConf.RepositoryConf.PluginName)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	planner := exec.Command(executable, append([]string{"db", "prune", "--plan"}, args...)...)
+	planner.Stdout, planner.Stderr = os.Stdout, os.Stderr
+	if err := planner.Run(); err != nil {
+		return fmt.Errorf("failed to plan state pruning, as: %v", err)
+	}
+	pruned, reclaimed, err := pruner.ApplyPlan(nodeConf.RepositoryConf.StateDataPath)
+	if err != nil {
+		return err
+	}
+	if 0 == pruned {
+		fmt.Println("no state need to be pruned")
+		return nil
+	}
+	fmt.Printf("prune %d states, reclaimed %d bytes\n", pruned, reclaimed)
+	return nil
+}
+
+// plan the states to prune with the repository.
+func planPrune(keep, keepTime int64) error {
+	chain, nodeConf, err := initRepository()
+	if err != nil {
+		return err
+	}
+	pruningConf := nodeConf.PruningConf
+	if keep >= 0 {
+		pruningConf = config.PruningConfig{Mode: common.StatesPruningMode, KeepStates: uint64(keep)}
+	} else if keepTime >= 0 {
+		pruningConf = config.PruningConfig{Mode: common.AgePruningMode, KeepTime: keepTime}
+	}
+	if nil == chain.GetCurrentBlock() {
+		return errors.New("no block in local repository")
+	}
+	progress, err := pruner.ReadPlan(nodeConf.RepositoryConf.StateDataPath)
+	if err != nil {
+		return err
+	}
+	plan, err := pruner.NewPlan(chain, pruningConf, progress.Pruned)
+	if err != nil {
+		return err
+	}
+	return pruner.WritePlan(nodeConf.RepositoryConf.StateDataPath, plan)
+}
+
+// print block, transaction or account in json.
+func dbGet(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: justitia db get block <height|hash> | tx <hash> | account <address>")
+	}
+	chain, _, err := initRepository()
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	switch args[0] {
+	case "block":
+		var block *types.Block
+		if height, perr := strconv.ParseUint(args[1], 10, 64); nil == perr {
+			block, err = chain.GetBlockByHeight(height)
+		} else {
+			block, err = chain.GetBlockByHash(types.BytesToHash(tools.FromHex(args[1])))
+		}
+		value = block
+	case "tx":
+		tx, blockHash, height, index, terr := chain.GetTransactionByHash(types.BytesToHash(tools.FromHex(args[1])))
+		err = terr
+		value = map[string]interface{}{
+			"transaction": tx,
+			"blockHash":   fmt.Sprintf("%x", blockHash),
+			"blockHeight": height,
+			"index":       index,
+		}
+	case "account":
+		addr := tools.HexToAddress(args[1])
+		value = map[string]interface{}{
+			"address": fmt.Sprintf("%x", addr),
+			"balance": chain.GetBalance(addr).String(),
+			"nonce":   chain.GetNonce(addr),
+			"code":    fmt.Sprintf("%x", chain.GetCode(addr)),
+		}
+	default:
+		return fmt.Errorf("unknown object %s, which choose from [block, tx, account]", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s %s, as: %v", args[0], args[1], err)
+	}
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
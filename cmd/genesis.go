@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	craftConfig "github.com/DSiSc/craft/config"
+	"github.com/DSiSc/justitia/config"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	register(&Command{
+		Name:  "genesis",
+		Usage: "justitia genesis hash | justitia genesis new --spec file [--out dir] | justitia genesis compile [--genesis file]",
+		SubCommands: []*Command{
+			{
+				Name:  "new",
+				Usage: "justitia genesis new --spec file [--out dir]",
+				Run:   genesisNew,
+			},
+			{
+				Name:  "compile",
+				Usage: "justitia genesis compile [--genesis file]",
+				Run:   genesisCompile,
+			},
+			{
+				Name:  "hash",
+				Usage: "justitia genesis hash",
+				Run:   genesisHash,
+			},
+		},
+	})
+}
+
+// print the genesis header hash built from genesis file.
+func genesisHash(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: justitia genesis hash")
+	}
+	nodeConf := config.NewNodeConfig()
+	craftConfig.GlobalConfig.Store(craftConfig.HashAlgName, nodeConf.AlgorithmConf.HashAlgorithm)
+	hash, err := config.GenesisHash()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%x\n", hash)
+	if rules, err := config.GetChainRulesFromConfig(); nil == err && nil == rules {
+		fmt.Fprintln(os.Stderr, "warning: version 1 genesis hash doesn't cover accounts and contract code, compare genesis.json as well")
+	}
+	return nil
+}
+
+// build genesis.json and per-validator justitia.yaml from genesis spec.
+func genesisNew(args []string) error {
+	var specPath, outDir string
+	flagSet := flag.NewFlagSet("genesis new", flag.ContinueOnError)
+	flagSet.StringVar(&specPath, "spec", "", "Genesis spec file in yaml or json.")
+	flagSet.StringVar(&outDir, "out", ".", "Output directory of genesis.json and validators' justitia.yaml.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if "" == specPath {
+		return errors.New("genesis spec must be specified with --spec")
+	}
+	spec, err := config.LoadGenesisSpec(specPath)
+	if err != nil {
+		return err
+	}
+	genesis, err := config.BuildGenesisConfig(spec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	genesisPath := filepath.Join(outDir, config.GenesisFileName)
+	if err := config.WriteGenesisConfig(genesis, genesisPath); err != nil {
+		return fmt.Errorf("failed to write genesis file, as: %v", err)
+	}
+	if err := config.WriteValidatorConfigs(spec, outDir); err != nil {
+		return err
+	}
+	fmt.Printf("write genesis file to %s with %d validators\n", genesisPath, len(spec.Validators))
+	return nil
+}
+
+// compile the contracts in genesis file once, and store their code and addresses in it.
+func genesisCompile(args []string) error {
+	var genesisPath string
+	flagSet := flag.NewFlagSet("genesis compile", flag.ContinueOnError)
+	flagSet.StringVar(&genesisPath, "genesis", filepath.Join(config.HomeDir(), config.GenesisFileName), "Genesis file to compile.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if err := config.CompileGenesisFile(genesisPath); err != nil {
+		return fmt.Errorf("failed to compile genesis file, as: %v", err)
+	}
+	fmt.Printf("write compiled contracts to genesis file %s\n", genesisPath)
+	return nil
+}
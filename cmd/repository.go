@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	craftConfig "github.com/DSiSc/craft/config"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/pruner"
+	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/repository"
+)
+
+// initRepository init the repository with node config, the node must be stopped
+// when the repository is leveldb based.
+func initRepository() (*repository.Repository, config.NodeConfig, error) {
+	nodeConf := config.NewNodeConfig()
+	craftConfig.GlobalConfig.Store(craftConfig.HashAlgName, nodeConf.AlgorithmConf.HashAlgorithm)
+	if common.LevelDBPlugin == nodeConf.RepositoryConf.PluginName {
+		// the states planned to prune may be written by the command
+		if err := pruner.DiscardPlan(nodeConf.RepositoryConf.StateDataPath); err != nil {
+			return nil, nodeConf, err
+		}
+	}
+	if err := repository.InitRepository(nodeConf.RepositoryConf, events.NewEvent()); err != nil {
+		return nil, nodeConf, fmt.Errorf("failed to init repository, as: %v", err)
+	}
+	chain, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, nodeConf, fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	return chain, nodeConf, nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/snapshot"
+	"os"
+)
+
+func init() {
+	register(&Command{
+		Name:  "snapshot",
+		Usage: "justitia snapshot export [--height H] --out file | justitia snapshot import file",
+		SubCommands: []*Command{
+			{
+				Name:  "export",
+				Usage: "justitia snapshot export [--height H] --out file",
+				Run:   snapshotExport,
+			},
+			{
+				Name:  "import",
+				Usage: "justitia snapshot import file",
+				Run:   snapshotImport,
+			},
+		},
+	})
+}
+
+// export the state and block at specified height to a snapshot archive.
+func snapshotExport(args []string) error {
+	var height int64
+	var out string
+	flagSet := flag.NewFlagSet("snapshot export", flag.ContinueOnError)
+	flagSet.Int64Var(&height, "height", -1, "Height of the snapshot, default to current height.")
+	flagSet.StringVar(&out, "out", "", "Output file of the snapshot archive.")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if "" == out {
+		return errors.New("output file must be specified with --out")
+	}
+	chain, _, err := initRepository()
+	if err != nil {
+		return err
+	}
+	if height < 0 {
+		currentBlock := chain.GetCurrentBlock()
+		if nil == currentBlock {
+			return errors.New("no block in local repository")
+		}
+		height = int64(currentBlock.Header.Height)
+	}
+	snap, err := snapshot.Take(common.ProcessChain, uint64(height))
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot archive, as: %v", err)
+	}
+	defer file.Close()
+	if err := snapshot.WriteArchive(file, snap); err != nil {
+		return fmt.Errorf("failed to write snapshot archive, as: %v", err)
+	}
+	fmt.Printf("export snapshot at height %d with %d accounts to %s\n", snap.Height, len(snap.Accounts), out)
+	return nil
+}
+
+// import snapshot archive to seed a new node.
+func snapshotImport(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: justitia snapshot import file")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot archive, as: %v", err)
+	}
+	defer file.Close()
+	snap, err := snapshot.ReadArchive(file)
+	if err != nil {
+		return err
+	}
+	chain, _, err := initRepository()
+	if err != nil {
+		return err
+	}
+	if currentBlock := chain.GetCurrentBlock(); nil != currentBlock {
+		return fmt.Errorf("local repository already has block with height %d, snapshot can only be imported to a new node", currentBlock.Header.Height)
+	}
+	if err := snap.Install(chain); err != nil {
+		return err
+	}
+	fmt.Printf("import snapshot at height %d with %d accounts\n", snap.Height, len(snap.Accounts))
+	return nil
+}
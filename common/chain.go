@@ -0,0 +1,29 @@
+package common
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+)
+
+// Chain is the repository of a node. The services of node read blocks and states through the chain
+// passed to them, instead of the repository initialized in process by repository.InitRepository.
+type Chain interface {
+	// Latest get the repository on the state of current block
+	Latest() (*repository.Repository, error)
+	// At get the repository on the state of the block
+	At(blockHash types.Hash) (*repository.Repository, error)
+}
+
+// ProcessChain is the repository initialized in process, it is read by the commands working on
+// the repository without a node.
+var ProcessChain Chain = processChain{}
+
+type processChain struct{}
+
+func (processChain) Latest() (*repository.Repository, error) {
+	return repository.NewLatestStateRepository()
+}
+
+func (processChain) At(blockHash types.Hash) (*repository.Repository, error) {
+	return repository.NewRepositoryByBlockHash(blockHash)
+}
@@ -26,6 +26,22 @@ const (
 	BlankString string = ""
 )
 
+const (
+	FullSyncMode = "full" // FullSyncMode --> replay every block from genesis
+	FastSyncMode = "fast" // FastSyncMode --> install a snapshot at trusted height, then sync blocks
+)
+
+const (
+	NonePruningMode   = "none"   // NonePruningMode --> keep all states
+	StatesPruningMode = "states" // StatesPruningMode --> keep the latest N states
+	AgePruningMode    = "age"    // AgePruningMode --> keep the states produced in recent time
+)
+
+const (
+	MemoryDBPlugin = "memorydb" // MemoryDBPlugin --> repository kept in memory
+	LevelDBPlugin  = "leveldb"  // LevelDBPlugin --> repository persisted in leveldb
+)
+
 func HashAlg() hash.Hash {
 	var alg string
 	if value, ok := gconf.GlobalConfig.Load(gconf.HashAlgName); ok {
@@ -102,6 +118,16 @@ func newTransaction(nonce uint64, to *types.Address, amount *big.Int, gasLimit u
 	return &types.Transaction{Data: d}
 }
 
+// CreateAddress get the address of contract created by the account with nonce.
+func CreateAddress(from types.Address, nonce uint64) types.Address {
+	data, _ := rlp.EncodeToBytes([]interface{}{from, nonce})
+	hw := sha3.NewKeccak256()
+	hw.Write(data)
+	var addr types.Address
+	copy(addr[:], hw.Sum(nil)[12:])
+	return addr
+}
+
 func NewTransaction(nonce uint64, to types.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, from types.Address) *types.Transaction {
 	return newTransaction(nonce, &to, amount, gasLimit, gasPrice, data, &from)
 }
@@ -120,8 +146,13 @@ const (
 	MsgOnline                            //  node online
 	MsgBlockWithoutTx                    // block without transaction
 	MsgWaitTimeOut
+	MsgChangeValidators //  validators elected by Voting contract changed
 )
 
+// EventValidatorsChanged is notified with the validators taking effect when the validators elected
+// by Voting contract change, it is numbered from the top of EventType to keep clear of craft events.
+const EventValidatorsChanged = types.EventType(255)
+
 func SystemContractType(contractType string) types.ContractType {
 	var contract = types.InitialContractType
 	if contractType == types.JustitiaRightToken {
@@ -97,3 +97,21 @@ func TestHeaderHash(t *testing.T) {
 	ttt = HeaderHash(newBlock)
 	assert.NotEqual(types.Hash{}, ttt)
 }
+
+func TestCreateAddress(t *testing.T) {
+	assert := assert.New(t)
+	from := types.Address{
+		0x6a, 0xc7, 0xea, 0x33, 0xf8, 0x83, 0x1e, 0xa9, 0xdc, 0xc5,
+		0x33, 0x93, 0xaa, 0xa8, 0x8b, 0x25, 0xa7, 0x85, 0xdb, 0xf0,
+	}
+	expect := types.Address{
+		0xcd, 0x23, 0x4a, 0x47, 0x1b, 0x72, 0xba, 0x2f, 0x1c, 0xcf,
+		0x0a, 0x70, 0xfc, 0xab, 0xa6, 0x48, 0xa5, 0xee, 0xcd, 0x8d,
+	}
+	assert.Equal(expect, CreateAddress(from, 0))
+	expect = types.Address{
+		0x34, 0x3c, 0x43, 0xa3, 0x7d, 0x37, 0xdf, 0xf0, 0x8a, 0xe8,
+		0xc4, 0xa1, 0x15, 0x44, 0xc7, 0x18, 0xab, 0xb4, 0xfc, 0xf8,
+	}
+	assert.Equal(expect, CreateAddress(from, 1))
+}
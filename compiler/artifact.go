@@ -0,0 +1,133 @@
+package compiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuiltinSolidityVersion is the solc version the builtin contracts are built with, the artifacts
+// built by other versions are not loaded.
+const BuiltinSolidityVersion = "0.4.25"
+
+// DefaultArtifactOptions is the compiler options used to build the artifacts of builtin contracts.
+var DefaultArtifactOptions = StandardOptions{
+	Optimize: false,
+}
+
+// Artifact is the compiled result of a contract cached on disk.
+type Artifact struct {
+	Contract        string      `json:"contract"`
+	Key             string      `json:"key"`
+	CompilerVersion string      `json:"compilerVersion"`
+	CompilerOptions string      `json:"compilerOptions"`
+	Code            string      `json:"code"`
+	RuntimeCode     string      `json:"runtimeCode"`
+	Abi             interface{} `json:"abi"`
+	Metadata        string      `json:"metadata"`
+}
+
+// ArtifactKey get the cache key of the artifact, it is the hash of the source, compiler version and options.
+func ArtifactKey(source []byte, version string, opts StandardOptions) (string, error) {
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode compiler options, as: %v", err)
+	}
+	h := sha256.New()
+	h.Write(source)
+	h.Write([]byte(version))
+	h.Write(options)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ArtifactCache store compiled artifacts in a directory, named <contract>-<key>.json.
+type ArtifactCache struct {
+	dir string
+}
+
+// NewArtifactCache create an artifact cache in the directory.
+func NewArtifactCache(dir string) *ArtifactCache {
+	return &ArtifactCache{
+		dir: dir,
+	}
+}
+
+func (cache *ArtifactCache) artifactPath(contract, key string) string {
+	return filepath.Join(cache.dir, fmt.Sprintf("%s-%s.json", contract, key))
+}
+
+// Get read the artifact of the contract compiled from source by the compiler version with the options.
+func (cache *ArtifactCache) Get(contract string, source []byte, version string, opts StandardOptions) (*Artifact, error) {
+	key, err := ArtifactKey(source, version, opts)
+	if err != nil {
+		return nil, err
+	}
+	path := cache.artifactPath(contract, key)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("artifact of contract %s built by solc %s not found in %s, as: %v", contract, version, cache.dir, err)
+	}
+	artifact := &Artifact{}
+	if err := json.Unmarshal(content, artifact); err != nil {
+		return nil, fmt.Errorf("failed to parse artifact %s, as: %v", path, err)
+	}
+	return artifact, nil
+}
+
+// Put write the artifact to cache.
+func (cache *ArtifactCache) Put(artifact *Artifact) (string, error) {
+	if err := os.MkdirAll(cache.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory %s, as: %v", cache.dir, err)
+	}
+	content, err := json.MarshalIndent(artifact, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode artifact of contract %s, as: %v", artifact.Contract, err)
+	}
+	path := cache.artifactPath(artifact.Contract, artifact.Key)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write artifact %s, as: %v", path, err)
+	}
+	return path, nil
+}
+
+// Build compile the contract in source file with solc and put its artifact to cache.
+func (cache *ArtifactCache) Build(solc *Solidity, contract, sourcePath string, opts StandardOptions) (*Artifact, error) {
+	source, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source %s, as: %v", sourcePath, err)
+	}
+	key, err := ArtifactKey(source, solc.Version, opts)
+	if err != nil {
+		return nil, err
+	}
+	input := NewStandardInput(map[string]string{sourcePath: string(source)}, opts)
+	contracts, err := solc.CompileStandardJSON(input, opts.AllowPaths...)
+	if err != nil {
+		return nil, err
+	}
+	for name, compiled := range contracts {
+		if !strings.HasSuffix(name, ":"+contract) {
+			continue
+		}
+		artifact := &Artifact{
+			Contract:        contract,
+			Key:             key,
+			CompilerVersion: compiled.Info.CompilerVersion,
+			CompilerOptions: compiled.Info.CompilerOptions,
+			Code:            compiled.Code,
+			RuntimeCode:     compiled.RuntimeCode,
+			Abi:             compiled.Info.AbiDefinition,
+			Metadata:        compiled.Info.Metadata,
+		}
+		if _, err := cache.Put(artifact); err != nil {
+			return nil, err
+		}
+		return artifact, nil
+	}
+	return nil, fmt.Errorf("contract %s not present in compile result of %s", contract, sourcePath)
+}
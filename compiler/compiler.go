@@ -0,0 +1,102 @@
+package compiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// names of the supported compilers
+const (
+	SolcCompiler     = "solc"
+	VyperCompiler    = "vyper"
+	ArtifactCompiler = "artifact"
+)
+
+// Compiler compiles contract sources to contracts.
+type Compiler interface {
+	// Name of the compiler, such as solc, vyper or artifact.
+	Name() string
+	// Compile the source files, returns the contracts keyed by <source>:<name>.
+	Compile(files ...string) (map[string]*Contract, error)
+}
+
+// NewCompiler create the compiler by name, path is the executable of solc or vyper,
+// the one on PATH is used if it is blank.
+func NewCompiler(name, path string) (Compiler, error) {
+	switch name {
+	case SolcCompiler:
+		s, err := SolidityVersion(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case VyperCompiler:
+		v, err := VyperVersion(path)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case ArtifactCompiler:
+		return &Prebuilt{}, nil
+	}
+	return nil, fmt.Errorf("unknown compiler %q, must be one of %s, %s and %s", name, SolcCompiler, VyperCompiler, ArtifactCompiler)
+}
+
+// FindCompiler find the compiler of the specified version on PATH by name, the prebuilt
+// artifact loader has no version.
+func FindCompiler(name, version string) (Compiler, error) {
+	switch name {
+	case SolcCompiler:
+		s, err := FindSolidity(version)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case VyperCompiler:
+		v, err := FindVyper(version)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return NewCompiler(name, "")
+}
+
+// CompilerOf get the compiler of source file by its extension, .vy is compiled by vyper,
+// .json is a prebuilt artifact, others are compiled by solc.
+func CompilerOf(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".vy":
+		return VyperCompiler
+	case ".json":
+		return ArtifactCompiler
+	}
+	return SolcCompiler
+}
+
+// SelectContract select the contract by name from the compile result, the only contract
+// is selected if name is blank.
+func SelectContract(contracts map[string]*Contract, name string) (*Contract, error) {
+	if "" == name {
+		if len(contracts) != 1 {
+			return nil, fmt.Errorf("%d contracts in compile result, contract name must be specified", len(contracts))
+		}
+		for _, contract := range contracts {
+			return contract, nil
+		}
+	}
+	if contract, ok := contracts[name]; ok {
+		return contract, nil
+	}
+	names := make([]string, 0, len(contracts))
+	for key, contract := range contracts {
+		if strings.HasSuffix(key, ":"+name) {
+			return contract, nil
+		}
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("contract %s not present in compile result, found %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,96 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Prebuilt loads contracts from the artifacts built by Truffle or Hardhat, no compiler is invoked.
+type Prebuilt struct{}
+
+// artifact format shared by Truffle and Hardhat
+type prebuiltArtifact struct {
+	ContractName     string      `json:"contractName"`
+	Abi              interface{} `json:"abi"`
+	Bytecode         string      `json:"bytecode"`
+	DeployedBytecode string      `json:"deployedBytecode"`
+	Metadata         string      `json:"metadata"`
+	// Truffle only
+	SourcePath string `json:"sourcePath"`
+	Source     string `json:"source"`
+	Compiler   struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"compiler"`
+	// Hardhat only
+	Format     string `json:"_format"`
+	SourceName string `json:"sourceName"`
+}
+
+// Name returns the name of compiler.
+func (p *Prebuilt) Name() string {
+	return ArtifactCompiler
+}
+
+// Compile load the contracts from artifact files.
+func (p *Prebuilt) Compile(files ...string) (map[string]*Contract, error) {
+	if len(files) == 0 {
+		return nil, errors.New("artifact: no artifact files")
+	}
+	contracts := make(map[string]*Contract)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("artifact: failed to read %s, as: %v", file, err)
+		}
+		name, contract, err := ParsePrebuiltArtifact(content)
+		if err != nil {
+			return nil, fmt.Errorf("artifact: failed to parse %s, as: %v", file, err)
+		}
+		contracts[name] = contract
+	}
+	return contracts, nil
+}
+
+// ParsePrebuiltArtifact parses the Truffle or Hardhat artifact, returns the contract and its name
+// in <source>:<contract> format.
+func ParsePrebuiltArtifact(content []byte) (string, *Contract, error) {
+	var artifact prebuiltArtifact
+	if err := json.Unmarshal(content, &artifact); err != nil {
+		return "", nil, err
+	}
+	if "" == artifact.ContractName {
+		return "", nil, errors.New("contract name not found, not a Truffle or Hardhat artifact")
+	}
+	code := strings.TrimPrefix(artifact.Bytecode, "0x")
+	if "" == code {
+		return "", nil, fmt.Errorf("contract %s has no bytecode, it may be an interface or abstract contract", artifact.ContractName)
+	}
+	// library placeholders are in __LibName___ or __$hash$__ format
+	if strings.Contains(code, "__") {
+		return "", nil, fmt.Errorf("contract %s has unlinked libraries", artifact.ContractName)
+	}
+	source := artifact.SourceName
+	if "" == source {
+		source = artifact.SourcePath
+	}
+	language := "Solidity"
+	if strings.HasSuffix(source, ".vy") {
+		language = "Vyper"
+	}
+	name := source + ":" + artifact.ContractName
+	return name, &Contract{
+		Code:        code,
+		RuntimeCode: strings.TrimPrefix(artifact.DeployedBytecode, "0x"),
+		Info: ContractInfo{
+			Source:          artifact.Source,
+			Language:        language,
+			CompilerVersion: artifact.Compiler.Version,
+			AbiDefinition:   artifact.Abi,
+			Metadata:        artifact.Metadata,
+		},
+	}, nil
+}
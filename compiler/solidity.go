@@ -14,7 +14,8 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package compiler wraps the Solidity compiler executable (solc).
+// Package compiler wraps the contract compiler executables (solc and vyper), and loads
+// prebuilt contract artifacts.
 package compiler
 
 import (
@@ -88,15 +89,17 @@ func (s *Solidity) makeArgs() []string {
 	return p
 }
 
-// SolidityVersion runs solc and parses its version output.
-func SolidityVersion() (*Solidity, error) {
+// SolidityVersion runs solc and parses its version output, solc on PATH is used if solc is blank.
+func SolidityVersion(solc string) (*Solidity, error) {
+	if solc == "" {
+		solc = "solc"
+	}
 	var out bytes.Buffer
-	var solc = "solc"
 	cmd := exec.Command(solc, "--version")
 	cmd.Stdout = &out
 	err := cmd.Run()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("solc: failed to get version of %s, as: %v", solc, err)
 	}
 	matches := versionRegexp.FindStringSubmatch(out.String())
 	if len(matches) != 4 {
@@ -115,42 +118,75 @@ func SolidityVersion() (*Solidity, error) {
 	return s, nil
 }
 
-func SolidityCompile(source string) string {
-	sourcePath := fmt.Sprintf("src/github.com/DSiSc/justitia/compiler/contracts/%s.sol", source)
-	var absolutePath = ""
-	goPath := os.Getenv("GOPATH")
-	for _, p := range filepath.SplitList(goPath) {
-		cpath := filepath.Join(p, sourcePath)
-		if tools.PathExists(cpath) {
-			absolutePath = cpath
-			break
+// FindSolidity find the solc executable of the specified version on PATH, as solc-<version>,
+// solc-v<version> or solc. The solc on PATH is returned if version is blank.
+func FindSolidity(version string) (*Solidity, error) {
+	if version == "" {
+		return SolidityVersion("solc")
+	}
+	candidates := []string{"solc-" + version, "solc-v" + version, "solc"}
+	for _, candidate := range candidates {
+		path, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		s, err := SolidityVersion(path)
+		if err == nil && s.Version == version {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("solc: version %s not found, tried %s", version, strings.Join(candidates, ", "))
+}
+
+// SourcePath find the source file of the builtin contract, in the contracts folder
+// under working directory or in the justitia source under GOPATH.
+func SourcePath(contract string) (string, error) {
+	candidates := []string{filepath.Join("compiler", "contracts", contract+".sol")}
+	for _, p := range filepath.SplitList(os.Getenv("GOPATH")) {
+		candidates = append(candidates, filepath.Join(p, "src/github.com/DSiSc/justitia/compiler/contracts", contract+".sol"))
+	}
+	for _, candidate := range candidates {
+		if tools.PathExists(candidate) {
+			return candidate, nil
 		}
 	}
-	contract, err := CompileSolidityString(absolutePath)
+	return "", fmt.Errorf("solc: source of contract %s not found, tried %s", contract, strings.Join(candidates, ", "))
+}
+
+// SolidityCompile compiles the builtin contract with solc and returns its code, solc on PATH
+// is used if solc is blank.
+func SolidityCompile(solc, source string) (string, error) {
+	sourcePath, err := SourcePath(source)
+	if err != nil {
+		return "", err
+	}
+	contract, err := CompileSolidityString(solc, sourcePath)
 	if nil != err {
-		panic("info for contract 'test' not present in result")
+		return "", err
 	}
 	key := fmt.Sprintf("<stdin>:%s", source)
 	c, ok := contract[key]
 	if !ok {
-		panic("info for contract 'test' not present in result")
+		return "", fmt.Errorf("solc: contract %s not present in compile result of %s", source, sourcePath)
 	}
-	return c.Code
+	return c.Code, nil
 }
 
-// CompileSolidityString builds and returns all the contracts contained within a source string.
-func CompileSolidityString(sourcePath string) (map[string]*Contract, error) {
-	s, err := SolidityVersion()
+// CompileSolidityString builds and returns all the contracts contained within a source file,
+// the source is piped to solc on stdin. solc on PATH is used if solc is blank.
+func CompileSolidityString(solc, sourcePath string) (map[string]*Contract, error) {
+	s, err := SolidityVersion(solc)
 	if err != nil {
-		panic("info for contract 'test' not present in result")
+		return nil, err
+	}
+	fileObj, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("solc: failed to open source %s, as: %v", sourcePath, err)
 	}
+	defer fileObj.Close()
 	args := append(s.makeArgs(), "--")
 	cmd := exec.Command(s.Path, append(args, "-")...)
-	if fileObj, err := os.Open(sourcePath); err == nil {
-		defer fileObj.Close()
-		reader := bufio.NewReader(fileObj)
-		cmd.Stdin = reader
-	}
+	cmd.Stdin = bufio.NewReader(fileObj)
 	return s.run(cmd, sourcePath)
 }
 
@@ -159,11 +195,24 @@ func CompileSolidity(solc string, sourcefiles ...string) (map[string]*Contract,
 	if len(sourcefiles) == 0 {
 		return nil, errors.New("solc: no source files")
 	}
-	source, err := slurpFiles(sourcefiles)
+	s, err := SolidityVersion(solc)
 	if err != nil {
 		return nil, err
 	}
-	s, err := SolidityVersion()
+	return s.Compile(sourcefiles...)
+}
+
+// Name returns the name of compiler.
+func (s *Solidity) Name() string {
+	return SolcCompiler
+}
+
+// Compile the Solidity source files with --combined-json.
+func (s *Solidity) Compile(sourcefiles ...string) (map[string]*Contract, error) {
+	if len(sourcefiles) == 0 {
+		return nil, errors.New("solc: no source files")
+	}
+	source, err := slurpFiles(sourcefiles)
 	if err != nil {
 		return nil, err
 	}
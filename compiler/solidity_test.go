@@ -17,9 +17,14 @@
 package compiler
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -64,7 +69,7 @@ func skipWithoutSolc(t *testing.T) {
 
 func TestCompileSolidityString(t *testing.T) {
 	skipWithoutSolc(t)
-	contracts, err := CompileSolidityString(contract)
+	contracts, err := CompileSolidityString("", contract)
 	if err != nil {
 		t.Fatalf("error compiling source. result %v: %v", contracts, err)
 	}
@@ -89,6 +94,282 @@ func TestCompileSolidityString(t *testing.T) {
 
 func TestSolidityCompile(t *testing.T) {
 	skipWithoutSolc(t)
-	contractCode := SolidityCompile(contractName)
+	contractCode, err := SolidityCompile("", contractName)
+	assert.Nil(t, err)
 	assert.Equal(t, byteCode, contractCode)
 }
+
+const stubStandardOutput = `{
+  "errors": [{"severity": "warning", "type": "Warning", "message": "unused variable"}],
+  "contracts": {
+    "contracts/Test.sol": {
+      "Test": {
+        "abi": [],
+        "metadata": "{}",
+        "evm": {
+          "bytecode": {"object": "6080604052", "sourceMap": "0:1:0"},
+          "deployedBytecode": {"object": "60806040", "sourceMap": "0:1:0"}
+        }
+      }
+    }
+  }
+}`
+
+// write a stub solc to dir, it records the standard json input to input.json
+// and prints the output file as result.
+func writeStubSolc(t *testing.T, dir, name, version, output string) string {
+	outputFile := filepath.Join(dir, name+".out")
+	if err := ioutil.WriteFile(outputFile, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = "--version" ]; then
+  echo "solc, the solidity compiler commandline interface"
+  echo "Version: %s+commit.59dbf8f1.Linux.g++"
+  exit 0
+fi
+echo "$@" > %s
+cat > %s
+cat %s
+`, version, filepath.Join(dir, "args"), filepath.Join(dir, "input.json"), outputFile)
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompileStandard(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "solc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	solc := writeStubSolc(t, dir, "solc", "0.4.25", stubStandardOutput)
+
+	opts := StandardOptions{
+		Remappings: []string{"zeppelin/=contracts/zeppelin/"},
+		Optimize:   true,
+		EvmVersion: "byzantium",
+		AllowPaths: []string{"contracts"},
+	}
+	contracts, err := CompileStandard(solc, opts, contract)
+	assert.Nil(err)
+	c, ok := contracts[contract+":Test"]
+	assert.True(ok)
+	assert.Equal("6080604052", c.Code)
+	assert.Equal("60806040", c.RuntimeCode)
+	assert.Equal("0.4.25", c.Info.CompilerVersion)
+
+	// check the input sent to solc
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.Nil(err)
+	assert.Equal("--standard-json --allow-paths contracts", strings.TrimSpace(string(args)))
+	inputJSON, err := ioutil.ReadFile(filepath.Join(dir, "input.json"))
+	assert.Nil(err)
+	var input StandardInput
+	assert.Nil(json.Unmarshal(inputJSON, &input))
+	assert.Equal("Solidity", input.Language)
+	assert.Contains(input.Sources[contract].Content, "contract Test")
+	assert.Equal(opts.Remappings, input.Settings.Remappings)
+	assert.Equal(Optimizer{Enabled: true, Runs: 200}, input.Settings.Optimizer)
+	assert.Equal("byzantium", input.Settings.EvmVersion)
+}
+
+func TestCompileStandardFailed(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "solc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	solc := writeStubSolc(t, dir, "solc", "0.4.25", `{"errors": [{"severity": "error", "type": "ParserError", "formattedMessage": "Test.sol:1:1: ParserError: Expected pragma"}]}`)
+	_, err = CompileStandard(solc, StandardOptions{}, contract)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "Expected pragma")
+
+	// no source files
+	_, err = CompileStandard(solc, StandardOptions{})
+	assert.NotNil(err)
+
+	// solc not exist
+	_, err = CompileStandard(filepath.Join(dir, "not-exist"), StandardOptions{}, contract)
+	assert.NotNil(err)
+}
+
+func TestFindSolidity(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "solc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	writeStubSolc(t, dir, "solc-0.4.24", "0.4.24", stubStandardOutput)
+	writeStubSolc(t, dir, "solc", "0.4.25", stubStandardOutput)
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	s, err := FindSolidity("0.4.24")
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "solc-0.4.24"), s.Path)
+	assert.Equal(4, s.Minor)
+	assert.Equal(24, s.Patch)
+
+	s, err = FindSolidity("0.4.25")
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "solc"), s.Path)
+
+	s, err = FindSolidity("")
+	assert.Nil(err)
+	assert.Equal("0.4.25", s.Version)
+
+	_, err = FindSolidity("0.5.0")
+	assert.NotNil(err)
+}
+
+func TestSourcePath(t *testing.T) {
+	_, err := SourcePath("NotExist")
+	assert.NotNil(t, err)
+}
+
+// write a stub vyper to dir, it prints the combined json output of source
+func writeStubVyper(t *testing.T, dir, version, source string) string {
+	output := fmt.Sprintf(`{"%s": {"bytecode": "0x6080604052", "bytecode_runtime": "0x6080", "abi": []}, "version": "%s"}`, source, version)
+	outputFile := filepath.Join(dir, "vyper.out")
+	if err := ioutil.WriteFile(outputFile, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = "--version" ]; then
+  echo "%s+commit.069936f"
+  exit 0
+fi
+echo "$@" > %s
+cat %s
+`, version, filepath.Join(dir, "args"), outputFile)
+	path := filepath.Join(dir, "vyper")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVyperCompile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "vyper")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "Token.vy")
+	assert.Nil(ioutil.WriteFile(source, []byte("owner: public(address)\n"), 0644))
+
+	c, err := NewCompiler(VyperCompiler, writeStubVyper(t, dir, "0.2.8", source))
+	assert.Nil(err)
+	assert.Equal(VyperCompiler, c.Name())
+	assert.Equal("0.2.8", c.(*Vyper).Version)
+	contracts, err := c.Compile(source)
+	assert.Nil(err)
+	contract, ok := contracts[source+":Token"]
+	assert.True(ok)
+	assert.Equal("6080604052", contract.Code)
+	assert.Equal("6080", contract.RuntimeCode)
+	assert.Equal("Vyper", contract.Info.Language)
+	assert.Contains(contract.Info.Source, "owner")
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.Nil(err)
+	assert.Equal("-f combined_json "+source, strings.TrimSpace(string(args)))
+
+	_, err = c.Compile()
+	assert.NotNil(err)
+	_, err = c.Compile(filepath.Join(dir, "Other.vy"))
+	assert.NotNil(err)
+	_, err = NewCompiler(VyperCompiler, filepath.Join(dir, "not-exist"))
+	assert.NotNil(err)
+}
+
+func TestFindCompiler(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "vyper")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "Token.vy")
+	assert.Nil(os.Rename(writeStubVyper(t, dir, "0.2.8", source), filepath.Join(dir, "vyper-0.2.8")))
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir)
+
+	c, err := FindCompiler(VyperCompiler, "0.2.8")
+	assert.Nil(err)
+	assert.Equal("0.2.8", c.(*Vyper).Version)
+	_, err = FindCompiler(VyperCompiler, "0.2.9")
+	assert.NotNil(err)
+	c, err = FindCompiler(ArtifactCompiler, "")
+	assert.Nil(err)
+	assert.Equal(ArtifactCompiler, c.Name())
+}
+
+func TestPrebuiltCompile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	truffle := filepath.Join(dir, "Token.json")
+	assert.Nil(ioutil.WriteFile(truffle, []byte(`{
+  "contractName": "Token",
+  "abi": [],
+  "bytecode": "0x6080604052",
+  "deployedBytecode": "0x6080",
+  "sourcePath": "/project/contracts/Token.sol",
+  "source": "contract Token {}",
+  "compiler": {"name": "solc", "version": "0.4.25+commit.59dbf8f1.Emscripten.clang"}
+}`), 0644))
+	hardhat := filepath.Join(dir, "Voting.json")
+	assert.Nil(ioutil.WriteFile(hardhat, []byte(`{
+  "_format": "hh-sol-artifact-1",
+  "contractName": "Voting",
+  "sourceName": "contracts/Voting.sol",
+  "abi": [],
+  "bytecode": "0x60806040",
+  "deployedBytecode": "0x60"
+}`), 0644))
+
+	c, err := NewCompiler(CompilerOf(truffle), "")
+	assert.Nil(err)
+	assert.Equal(ArtifactCompiler, c.Name())
+	contracts, err := c.Compile(truffle, hardhat)
+	assert.Nil(err)
+	assert.Equal(2, len(contracts))
+	token, err := SelectContract(contracts, "Token")
+	assert.Nil(err)
+	assert.Equal("6080604052", token.Code)
+	assert.Equal("0.4.25+commit.59dbf8f1.Emscripten.clang", token.Info.CompilerVersion)
+	voting, err := SelectContract(contracts, "contracts/Voting.sol:Voting")
+	assert.Nil(err)
+	assert.Equal("60806040", voting.Code)
+	_, err = SelectContract(contracts, "")
+	assert.NotNil(err)
+	_, err = SelectContract(contracts, "NotExist")
+	assert.NotNil(err)
+
+	// unlinked library
+	linked := filepath.Join(dir, "Linked.json")
+	assert.Nil(ioutil.WriteFile(linked, []byte(`{"contractName": "Linked", "bytecode": "0x73__$a3c1e2$__63"}`), 0644))
+	_, err = c.Compile(linked)
+	assert.NotNil(err)
+	// not an artifact
+	_, err = c.Compile(filepath.Join(dir, "args"))
+	assert.NotNil(err)
+}
+
+func TestNewCompiler(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(SolcCompiler, CompilerOf("contracts/Token.sol"))
+	assert.Equal(VyperCompiler, CompilerOf("contracts/Token.vy"))
+	assert.Equal(ArtifactCompiler, CompilerOf("build/contracts/Token.json"))
+
+	dir, err := ioutil.TempDir("", "solc")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	c, err := NewCompiler(SolcCompiler, writeStubSolc(t, dir, "solc", "0.4.25", stubStandardOutput))
+	assert.Nil(err)
+	assert.Equal(SolcCompiler, c.Name())
+	_, err = NewCompiler(SolcCompiler, filepath.Join(dir, "not-exist"))
+	assert.NotNil(err)
+	_, err = NewCompiler("llvm", "")
+	assert.NotNil(err)
+}
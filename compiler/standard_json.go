@@ -0,0 +1,203 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// default outputs selected from solc --standard-json
+var defaultOutputSelection = map[string]map[string][]string{
+	"*": {
+		"*": {
+			"abi", "metadata", "userdoc", "devdoc",
+			"evm.bytecode.object", "evm.bytecode.sourceMap",
+			"evm.deployedBytecode.object", "evm.deployedBytecode.sourceMap",
+		},
+	},
+}
+
+// StandardSource is a source unit of the standard json input.
+type StandardSource struct {
+	Content string   `json:"content,omitempty"`
+	Urls    []string `json:"urls,omitempty"`
+}
+
+// Optimizer is the optimizer settings of the standard json input.
+type Optimizer struct {
+	Enabled bool `json:"enabled"`
+	Runs    int  `json:"runs"`
+}
+
+// StandardSettings is the settings of the standard json input.
+type StandardSettings struct {
+	Remappings      []string                       `json:"remappings,omitempty"`
+	Optimizer       Optimizer                      `json:"optimizer"`
+	EvmVersion      string                         `json:"evmVersion,omitempty"`
+	OutputSelection map[string]map[string][]string `json:"outputSelection"`
+}
+
+// StandardInput is the input of solc --standard-json.
+type StandardInput struct {
+	Language string                    `json:"language"`
+	Sources  map[string]StandardSource `json:"sources"`
+	Settings StandardSettings          `json:"settings"`
+}
+
+// StandardOptions contains the options to compile sources in standard json mode.
+type StandardOptions struct {
+	Remappings []string // import remappings, in the form of prefix=path
+	Optimize   bool     // switch on the optimizer
+	Runs       int      // optimizer runs, 200 is used if not set
+	EvmVersion string   // target evm version, the compiler default is used if not set
+	AllowPaths []string // paths that imports are allowed to be read from
+}
+
+// StandardError is an error or warning reported by solc.
+type StandardError struct {
+	Type             string `json:"type"`
+	Component        string `json:"component"`
+	Severity         string `json:"severity"`
+	Message          string `json:"message"`
+	FormattedMessage string `json:"formattedMessage"`
+}
+
+type standardBytecode struct {
+	Object    string `json:"object"`
+	SourceMap string `json:"sourceMap"`
+}
+
+// --standard-json output format
+type standardOutput struct {
+	Errors    []StandardError `json:"errors"`
+	Contracts map[string]map[string]struct {
+		Abi      interface{} `json:"abi"`
+		Metadata string      `json:"metadata"`
+		Userdoc  interface{} `json:"userdoc"`
+		Devdoc   interface{} `json:"devdoc"`
+		Evm      struct {
+			Bytecode         standardBytecode `json:"bytecode"`
+			DeployedBytecode standardBytecode `json:"deployedBytecode"`
+		} `json:"evm"`
+	} `json:"contracts"`
+}
+
+// NewStandardInput build the standard json input from sources keyed by source name.
+func NewStandardInput(sources map[string]string, opts StandardOptions) *StandardInput {
+	input := &StandardInput{
+		Language: "Solidity",
+		Sources:  make(map[string]StandardSource),
+		Settings: StandardSettings{
+			Remappings:      opts.Remappings,
+			EvmVersion:      opts.EvmVersion,
+			OutputSelection: defaultOutputSelection,
+			Optimizer: Optimizer{
+				Enabled: opts.Optimize,
+				Runs:    opts.Runs,
+			},
+		},
+	}
+	if input.Settings.Optimizer.Runs == 0 {
+		input.Settings.Optimizer.Runs = 200
+	}
+	for name, content := range sources {
+		input.Sources[name] = StandardSource{Content: content}
+	}
+	return input
+}
+
+// CompileStandard compiles all given Solidity source files with solc --standard-json,
+// the contracts are keyed by <source file>:<contract name>.
+func CompileStandard(solc string, opts StandardOptions, sourcefiles ...string) (map[string]*Contract, error) {
+	if len(sourcefiles) == 0 {
+		return nil, errors.New("solc: no source files")
+	}
+	sources := make(map[string]string)
+	for _, file := range sourcefiles {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("solc: failed to read source %s, as: %v", file, err)
+		}
+		sources[file] = string(content)
+	}
+	s, err := SolidityVersion(solc)
+	if err != nil {
+		return nil, err
+	}
+	return s.CompileStandardJSON(NewStandardInput(sources, opts), opts.AllowPaths...)
+}
+
+// CompileStandardJSON run solc --standard-json with the input.
+func (s *Solidity) CompileStandardJSON(input *StandardInput, allowPaths ...string) (map[string]*Contract, error) {
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("solc: failed to encode standard json input, as: %v", err)
+	}
+	args := []string{"--standard-json"}
+	if len(allowPaths) > 0 {
+		args = append(args, "--allow-paths", strings.Join(allowPaths, ","))
+	}
+	var stderr, stdout bytes.Buffer
+	cmd := exec.Command(s.Path, args...)
+	cmd.Stdin = bytes.NewReader(inputJSON)
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("solc: %v\n%s", err, stderr.Bytes())
+	}
+	settings, _ := json.Marshal(input.Settings)
+	return ParseStandardJSON(stdout.Bytes(), input, s.Version, s.Version, string(settings))
+}
+
+// ParseStandardJSON takes the output of a solc --standard-json run and parses it into
+// a map of <source name>:<contract name> to Contract structs.
+//
+// Returns an error if the JSON is malformed, or if solc reports any error.
+func ParseStandardJSON(standardJSON []byte, input *StandardInput, languageVersion string, compilerVersion string, compilerOptions string) (map[string]*Contract, error) {
+	var output standardOutput
+	if err := json.Unmarshal(standardJSON, &output); err != nil {
+		return nil, fmt.Errorf("solc: error reading standard json output (%v)", err)
+	}
+	var failures []string
+	for _, e := range output.Errors {
+		if e.Severity != "error" {
+			continue
+		}
+		if e.FormattedMessage != "" {
+			failures = append(failures, strings.TrimSpace(e.FormattedMessage))
+		} else {
+			failures = append(failures, fmt.Sprintf("%s: %s", e.Type, e.Message))
+		}
+	}
+	if len(failures) > 0 {
+		return nil, fmt.Errorf("solc: compilation failed:\n%s", strings.Join(failures, "\n"))
+	}
+
+	contracts := make(map[string]*Contract)
+	for sourceName, sourceContracts := range output.Contracts {
+		for name, info := range sourceContracts {
+			contracts[sourceName+":"+name] = &Contract{
+				Code:        info.Evm.Bytecode.Object,
+				RuntimeCode: info.Evm.DeployedBytecode.Object,
+				Info: ContractInfo{
+					Source:          input.Sources[sourceName].Content,
+					Language:        input.Language,
+					LanguageVersion: languageVersion,
+					CompilerVersion: compilerVersion,
+					CompilerOptions: compilerOptions,
+					SrcMap:          info.Evm.Bytecode.SourceMap,
+					SrcMapRuntime:   info.Evm.DeployedBytecode.SourceMap,
+					AbiDefinition:   info.Abi,
+					UserDoc:         info.Userdoc,
+					DeveloperDoc:    info.Devdoc,
+					Metadata:        info.Metadata,
+				},
+			}
+		}
+	}
+	return contracts, nil
+}
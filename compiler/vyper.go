@@ -0,0 +1,119 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Vyper contains information about the vyper compiler.
+type Vyper struct {
+	Path, Version, FullVersion string
+}
+
+// -f combined_json format, contracts are keyed by source file
+type vyperContract struct {
+	Bytecode        string      `json:"bytecode"`
+	BytecodeRuntime string      `json:"bytecode_runtime"`
+	Abi             interface{} `json:"abi"`
+}
+
+// VyperVersion runs vyper and parses its version output, vyper on PATH is used if vyper is blank.
+func VyperVersion(vyper string) (*Vyper, error) {
+	if vyper == "" {
+		vyper = "vyper"
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(vyper, "--version")
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("vyper: failed to get version of %s, as: %v", vyper, err)
+	}
+	version := versionRegexp.FindString(out.String())
+	if "" == version {
+		return nil, fmt.Errorf("can't parse vyper version %q", out.String())
+	}
+	return &Vyper{Path: cmd.Path, FullVersion: strings.TrimSpace(out.String()), Version: version}, nil
+}
+
+// FindVyper find the vyper executable of the specified version on PATH, as vyper-<version>,
+// vyper-v<version> or vyper. The vyper on PATH is returned if version is blank.
+func FindVyper(version string) (*Vyper, error) {
+	if version == "" {
+		return VyperVersion("vyper")
+	}
+	candidates := []string{"vyper-" + version, "vyper-v" + version, "vyper"}
+	for _, candidate := range candidates {
+		path, err := exec.LookPath(candidate)
+		if err != nil {
+			continue
+		}
+		v, err := VyperVersion(path)
+		if err == nil && v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("vyper: version %s not found, tried %s", version, strings.Join(candidates, ", "))
+}
+
+// Name returns the name of compiler.
+func (v *Vyper) Name() string {
+	return VyperCompiler
+}
+
+// Compile the vyper source files, the contract in each file is named after the file.
+func (v *Vyper) Compile(files ...string) (map[string]*Contract, error) {
+	if len(files) == 0 {
+		return nil, errors.New("vyper: no source files")
+	}
+	var stderr, stdout bytes.Buffer
+	cmd := exec.Command(v.Path, append([]string{"-f", "combined_json"}, files...)...)
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("vyper: %v\n%s", err, stderr.Bytes())
+	}
+	return ParseVyperCombinedJSON(stdout.Bytes(), v.Version, files...)
+}
+
+// ParseVyperCombinedJSON parses the output of vyper -f combined_json run on the source files.
+func ParseVyperCombinedJSON(combinedJSON []byte, compilerVersion string, files ...string) (map[string]*Contract, error) {
+	var output map[string]json.RawMessage
+	if err := json.Unmarshal(combinedJSON, &output); err != nil {
+		return nil, fmt.Errorf("vyper: failed to parse output, as: %v", err)
+	}
+	contracts := make(map[string]*Contract)
+	for _, file := range files {
+		raw, ok := output[file]
+		if !ok {
+			return nil, fmt.Errorf("vyper: source %s not present in output", file)
+		}
+		var info vyperContract
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return nil, fmt.Errorf("vyper: failed to parse output of %s, as: %v", file, err)
+		}
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("vyper: failed to read source %s, as: %v", file, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		contracts[file+":"+name] = &Contract{
+			Code:        strings.TrimPrefix(info.Bytecode, "0x"),
+			RuntimeCode: strings.TrimPrefix(info.BytecodeRuntime, "0x"),
+			Info: ContractInfo{
+				Source:          string(source),
+				Language:        "Vyper",
+				LanguageVersion: compilerVersion,
+				CompilerVersion: compilerVersion,
+				CompilerOptions: "-f combined_json",
+				AbiDefinition:   info.Abi,
+			},
+		}
+	}
+	return contracts, nil
+}
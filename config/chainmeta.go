@@ -0,0 +1,183 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/repository"
+	"io/ioutil"
+	"strings"
+)
+
+// keys of the chain meta record and the configured genesis record in repository
+var (
+	chainMetaKey     = []byte("justitia-chain-meta")
+	genesisRecordKey = []byte("justitia-genesis-record")
+)
+
+// MetaStore is the key-value record store of repository, where the chain meta is persisted.
+type MetaStore interface {
+	Put(key []byte, value []byte) error
+	Get(key []byte) ([]byte, error)
+}
+
+// ChainMeta identify the chain that a repository belongs to.
+type ChainMeta struct {
+	GenesisHash   string `json:"genesisHash"`
+	ChainId       uint64 `json:"chainId"`
+	HashAlgorithm string `json:"hashAlgorithm"`
+}
+
+// genesisRecord is the hash of the genesis built from the genesis file with the specified content.
+type genesisRecord struct {
+	FileHash    string `json:"fileHash"`
+	GenesisHash string `json:"genesisHash"`
+}
+
+// NewChainMeta get the chain meta from the genesis file and node config.
+func NewChainMeta(store MetaStore, nodeConf NodeConfig) (*ChainMeta, error) {
+	genesisHash, err := configuredGenesisHash(store)
+	if err != nil {
+		return nil, err
+	}
+	chainId, err := GetChainIdFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &ChainMeta{
+		GenesisHash:   genesisHash,
+		ChainId:       chainId,
+		HashAlgorithm: nodeConf.AlgorithmConf.HashAlgorithm,
+	}, nil
+}
+
+// get the hash of the genesis built from genesis file, genesis is rebuilt only when the file
+// content differs from the one recorded in repository.
+func configuredGenesisHash(store MetaStore) (string, error) {
+	var fileHash string
+	if genesisPath := genesisFilePath(); InvalidPath != genesisPath {
+		content, err := ioutil.ReadFile(genesisPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read genesis file, as: %v", err)
+		}
+		fileHash = fmt.Sprintf("0x%x", sha256.Sum256(content))
+	}
+	record := &genesisRecord{}
+	if data, err := store.Get(genesisRecordKey); nil == err && nil == json.Unmarshal(data, record) && record.FileHash == fileHash {
+		return record.GenesisHash, nil
+	}
+	genesisHash, err := GenesisHash()
+	if err != nil {
+		return "", err
+	}
+	record = &genesisRecord{
+		FileHash:    fileHash,
+		GenesisHash: fmt.Sprintf("0x%x", genesisHash),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode genesis record, as: %v", err)
+	}
+	if err := store.Put(genesisRecordKey, data); err != nil {
+		return "", fmt.Errorf("failed to write genesis record, as: %v", err)
+	}
+	return record.GenesisHash, nil
+}
+
+// Mismatch list the fields that differ between stored and configured chain meta.
+func (stored *ChainMeta) Mismatch(configured *ChainMeta) []string {
+	mismatches := make([]string, 0)
+	if stored.GenesisHash != configured.GenesisHash {
+		mismatches = append(mismatches, fmt.Sprintf("genesis hash: stored %s, configured %s", stored.GenesisHash, configured.GenesisHash))
+	}
+	if stored.ChainId != configured.ChainId {
+		mismatches = append(mismatches, fmt.Sprintf("chain id: stored %d, configured %d", stored.ChainId, configured.ChainId))
+	}
+	if stored.HashAlgorithm != configured.HashAlgorithm {
+		mismatches = append(mismatches, fmt.Sprintf("hash algorithm: stored %s, configured %s", stored.HashAlgorithm, configured.HashAlgorithm))
+	}
+	return mismatches
+}
+
+// CheckChainMeta compare the chain meta stored in repository with the configured one.
+// If the repository has no record yet, the chain meta is derived from the stored chain and recorded.
+// Node seeded by snapshot has no genesis block, its chain meta is recorded when installing the snapshot.
+func CheckChainMeta(nodeConf NodeConfig) error {
+	chain, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	if nil == chain.GetCurrentBlock() {
+		log.Debug("no block in repository, skip checking chain meta")
+		return nil
+	}
+	stored, err := ReadChainMeta(chain)
+	if err != nil {
+		return err
+	}
+	if nil == stored {
+		if stored, err = deriveChainMeta(chain, nodeConf); err != nil {
+			return fmt.Errorf("failed to derive chain meta from stored chain, as: %v", err)
+		}
+		log.Info("record chain meta derived from stored chain, genesis hash %s", stored.GenesisHash)
+		if err := WriteChainMeta(chain, stored); err != nil {
+			return err
+		}
+	}
+	configured, err := NewChainMeta(chain, nodeConf)
+	if err != nil {
+		return fmt.Errorf("failed to get configured chain meta, as: %v", err)
+	}
+	if mismatches := stored.Mismatch(configured); len(mismatches) > 0 {
+		return fmt.Errorf("repository belongs to another chain, mismatch: %s", strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// derive the chain meta from the genesis block and the block hashes in repository.
+func deriveChainMeta(chain *repository.Repository, nodeConf NodeConfig) (*ChainMeta, error) {
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored genesis block, as: %v", err)
+	}
+	// genesis header hash is computed before its state root is filled, so check the hash algorithm by current block.
+	if currentBlock := chain.GetCurrentBlock(); currentBlock.Header.Height > 0 && (currentBlock.HeaderHash != types.Hash{}) {
+		if computed := common.HeaderHash(&types.Block{Header: currentBlock.Header}); computed != currentBlock.HeaderHash {
+			return nil, fmt.Errorf("block %d hash %x mismatch with hash %x computed by %s, the chain is hashed by another algorithm",
+				currentBlock.Header.Height, currentBlock.HeaderHash, computed, nodeConf.AlgorithmConf.HashAlgorithm)
+		}
+	}
+	return &ChainMeta{
+		GenesisHash:   fmt.Sprintf("0x%x", common.HeaderHash(genesis)),
+		ChainId:       genesis.Header.ChainID,
+		HashAlgorithm: nodeConf.AlgorithmConf.HashAlgorithm,
+	}, nil
+}
+
+// ReadChainMeta read the chain meta from repository, nil if it has not been recorded.
+func ReadChainMeta(store MetaStore) (*ChainMeta, error) {
+	data, err := store.Get(chainMetaKey)
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+	meta := &ChainMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("failed to parse chain meta, as: %v", err)
+	}
+	return meta, nil
+}
+
+// WriteChainMeta record the chain meta in repository.
+func WriteChainMeta(store MetaStore, meta *ChainMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode chain meta, as: %v", err)
+	}
+	if err := store.Put(chainMetaKey, data); err != nil {
+		return fmt.Errorf("failed to write chain meta, as: %v", err)
+	}
+	return nil
+}
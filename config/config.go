@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/monitor"
+	"github.com/DSiSc/craft/types"
 	consensusConfig "github.com/DSiSc/galaxy/consensus/config"
 	participatesConfig "github.com/DSiSc/galaxy/participates/config"
 	roleConfig "github.com/DSiSc/galaxy/role/config"
 	swConf "github.com/DSiSc/gossipswitch/config"
 	"github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/tools"
+	"github.com/DSiSc/justitia/tools/fault"
 	p2pConf "github.com/DSiSc/p2p/config"
 	producerConfig "github.com/DSiSc/producer/config"
 	repositoryConfig "github.com/DSiSc/repository/config"
@@ -25,6 +27,8 @@ import (
 const (
 	// config file prefix
 	ConfigPrefix = "justitia"
+	// environment variable of the directory holding justitia.yaml and genesis.json, default to ~/.justitia
+	HomeEnv = "JUSTITIA_HOME"
 	// node type
 	NodeType = "general.nodeType"
 	// algorithm setting
@@ -41,6 +45,9 @@ const (
 	ConsensusTimeoutViewChange        = "general.consensus.timeoutToViewChange"
 	ConsensusLocalSignatureVerify     = "general.consensus.localSignatureVerify"
 	ConsensusSyncSignatureVerify      = "general.consensus.syncSignatureVerify"
+	// urls dialed for the consensus messages to validators instead of their urls in genesis,
+	// in the form of <account address>@<host>:<port>
+	ConsensusRoutes = "general.consensus.routes"
 
 	ParticipatesPolicy = "general.participates.policy"
 	RolePolicy         = "general.role.policy"
@@ -52,6 +59,26 @@ const (
 	RepositoryPlugin    = "general.repository.plugin"
 	RepositoryStatePath = "general.repository.statePath"
 	RepositoryDataPath  = "general.repository.dataPath"
+	// state pruning
+	PruningMode       = "general.repository.pruning.mode"
+	PruningKeepStates = "general.repository.pruning.keepStates"
+	PruningKeepTime   = "general.repository.pruning.keepTime"
+	// cross chain relayer
+	RelayerEnabled       = "general.relayer.enabled"
+	RelayerDataPath      = "general.relayer.dataPath"
+	RelayerConfirmations = "general.relayer.confirmations"
+	RelayerAccount       = "general.relayer.account"
+	RelayerRoutes        = "general.relayer.routes"
+	RelayerResubmit      = "general.relayer.resubmitTimeout"
+	// fault injection
+	FaultEnabled    = "general.fault.enabled"
+	FaultListenAddr = "general.fault.listenAddress"
+	FaultFaults     = "general.fault.faults"
+	// block syncer
+	SyncerMode          = "general.syncer.mode"
+	SyncerTrustedHeight = "general.syncer.trustedHeight"
+	SyncerTrustedHash   = "general.syncer.trustedHash"
+	SyncerTimeout       = "general.syncer.timeout"
 	// api gateway
 	ApiGatewayAddr = "general.apigateway"
 	// Default parameter for solo block producer
@@ -73,6 +100,8 @@ const (
 	P2PDisableDNSSeed  = "DisableDNSSeed"
 	P2PDNSSeeds        = "DNSSeeds"
 	P2PService         = "Service"
+	// block p2p addresses of consensus participants, in the form of <account address>@<host>:<port>
+	P2PConsensusPeers = "ConsensusPeers"
 
 	// prometheus
 	PrometheusEnabled = "monitor.prometheus.enabled"
@@ -122,6 +151,57 @@ type AlgorithmConfig struct {
 	SignAlgorithm string
 }
 
+type PruningConfig struct {
+	// pruning mode, none, states or age
+	Mode string
+	// number of latest states to keep when prune by states
+	KeepStates uint64
+	// time in second to keep states when prune by age
+	KeepTime int64
+}
+
+type RelayerRoute struct {
+	// chain flag of the cross chain tx
+	ChainFlag string
+	// api gateway of the target chain, such as 127.0.0.1:47768
+	ApiGateway string
+	// address of CrossFundsPool contract on the target chain
+	Contract types.Address
+}
+
+type RelayerConfig struct {
+	Enabled bool
+	// directory to persist the relay progress
+	DataPath string
+	// number of blocks a tx must be buried under before it is treated as final
+	Confirmations uint64
+	// account sending receiveFunds on target chains, must be unlocked by their api gateways
+	Account types.Address
+	Routes  []RelayerRoute
+	// time in second to wait for a receiveFunds tx mined before resubmitting it
+	ResubmitTimeout int64
+}
+
+type FaultConfig struct {
+	Enabled bool
+	// address of the fault debug api, not served if empty
+	ListenAddr string
+	// faults injected at start
+	Faults []fault.Fault
+}
+
+type SyncerConfig struct {
+	// sync mode, full or fast
+	Mode string
+	// height of the snapshot to fetch when fast sync
+	TrustedHeight uint64
+	// header hash of the block at trusted height, required when fast sync, as the snapshot from
+	// peers is verified against it
+	TrustedHash types.Hash
+	// timeout to fetch snapshot in millisecond
+	Timeout int64
+}
+
 type SysConfig struct {
 	LogLevel log.Level
 	LogPath  string
@@ -144,6 +224,14 @@ type NodeConfig struct {
 	ConsensusConf consensusConfig.ConsensusConfig
 	// repositoryConfig
 	RepositoryConf repositoryConfig.RepositoryConfig
+	// state pruning config
+	PruningConf PruningConfig
+	// cross chain relayer config
+	RelayerConf RelayerConfig
+	// fault injection config
+	FaultConf FaultConfig
+	// block syncer config
+	SyncerConf SyncerConfig
 	// Block Produce Interval
 	BlockInterval int64
 	//algorithm config
@@ -163,6 +251,13 @@ type NodeConfig struct {
 	P2PConf map[string]*p2pConf.P2PConfig
 	//Switch config
 	SwitchConf map[string]*swConf.SwitchConfig
+	// block p2p address of consensus participants, committed blocks are relayed to them first
+	ConsensusPeers map[types.Address]string
+	// url dialed for the consensus messages to validators by account address, the validators
+	// not in it are dialed at their own urls
+	ConsensusRoutes map[types.Address]string
+	// chain rules from genesis file, nil if genesis file has no chain rules
+	ChainRules *ChainRules
 }
 
 type Config struct {
@@ -179,8 +274,7 @@ func LoadConfig() (config *viper.Viper) {
 	config.SetEnvKeyReplacer(replacer)
 
 	config.SetConfigName("justitia")
-	homePath, _ := tools.Home()
-	config.AddConfigPath(fmt.Sprintf("%s/.justitia", homePath))
+	config.AddConfigPath(HomeDir())
 	// Path to look for the config file in based on GOPATH
 	goPath := os.Getenv("GOPATH")
 	for _, p := range filepath.SplitList(goPath) {
@@ -194,6 +288,15 @@ func LoadConfig() (config *viper.Viper) {
 	return
 }
 
+// HomeDir get the directory holding justitia.yaml and genesis.json.
+func HomeDir() string {
+	if home := os.Getenv(HomeEnv); common.BlankString != home {
+		return home
+	}
+	homePath, _ := tools.Home()
+	return filepath.Join(homePath, ".justitia")
+}
+
 func NewNodeConfig() NodeConfig {
 	config := LoadConfig()
 	nodeType := getNodeType(config)
@@ -205,15 +308,21 @@ func NewNodeConfig() NodeConfig {
 	roleConf := NewRoleConf(config)
 	consensusConf := NewConsensusConf(config)
 	RepositoryConf := NewRepositoryConf(config)
+	pruningConf := NewPruningConf(config)
+	relayerConf := NewRelayerConf(config)
+	faultConf := NewFaultConf(config)
+	syncerConf := NewSyncerConf(config)
 	blockIntervalTime := GetBlockProducerInterval(config)
 	prometheusConf := GetPrometheusConf(config)
 	expvarConf := GetExpvarConf(config)
 	pprofConf := GetPprofConf(config)
 	logConf := GetLogSetting(config)
 	p2pConf := GetP2PConf(config)
+	consensusPeers := GetConsensusPeers(config)
+	consensusRoutes := GetConsensusRoutes(config)
 	producerConf := GetProducerConf(config)
 	switchConf := GetSwitchConf(config)
-	return NodeConfig{
+	nodeConf := NodeConfig{
 		Account:          nodeAccount,
 		NodeType:         nodeType,
 		ApiGatewayAddr:   apiGatewayTcpAddr,
@@ -222,6 +331,10 @@ func NewNodeConfig() NodeConfig {
 		RoleConf:         roleConf,
 		ConsensusConf:    consensusConf,
 		RepositoryConf:   RepositoryConf,
+		PruningConf:      pruningConf,
+		RelayerConf:      relayerConf,
+		FaultConf:        faultConf,
+		SyncerConf:       syncerConf,
 		BlockInterval:    blockIntervalTime,
 		AlgorithmConf:    algorithmConf,
 		PrometheusConf:   prometheusConf,
@@ -229,9 +342,45 @@ func NewNodeConfig() NodeConfig {
 		PprofConf:        pprofConf,
 		Logger:           logConf,
 		P2PConf:          p2pConf,
+		ConsensusPeers:   consensusPeers,
+		ConsensusRoutes:  consensusRoutes,
 		ProducerConf:     producerConf,
 		SwitchConf:       switchConf,
 	}
+	if err := applyChainRules(&nodeConf); err != nil {
+		panic(fmt.Errorf("failed to apply chain rules, as: %v", err))
+	}
+	return nodeConf
+}
+
+// applyChainRules override the local setting with the chain rules in genesis file.
+func applyChainRules(nodeConf *NodeConfig) error {
+	rules, err := GetChainRulesFromConfig()
+	if err != nil || nil == rules {
+		return err
+	}
+	nodeConf.ChainRules = rules
+	if common.BlankString != rules.HashAlgorithm {
+		nodeConf.AlgorithmConf.HashAlgorithm = rules.HashAlgorithm
+	}
+	consensus := rules.Consensus
+	if common.BlankString != consensus.Policy {
+		nodeConf.ConsensusConf.PolicyName = consensus.Policy
+	}
+	nodeConf.ConsensusConf.EnableEmptyBlock = consensus.EnableEmptyBlock
+	if consensus.BlockInterval > 0 {
+		nodeConf.BlockInterval = consensus.BlockInterval
+	}
+	if consensus.TimeoutToCollectResponse > 0 {
+		nodeConf.ConsensusConf.Timeout.TimeoutToCollectResponseMsg = consensus.TimeoutToCollectResponse
+	}
+	if consensus.TimeoutToWaitCommit > 0 {
+		nodeConf.ConsensusConf.Timeout.TimeoutToWaitCommitMsg = consensus.TimeoutToWaitCommit
+	}
+	if consensus.TimeoutToViewChange > 0 {
+		nodeConf.ConsensusConf.Timeout.TimeoutToChangeView = consensus.TimeoutToViewChange
+	}
+	return nil
 }
 
 func GetAlgorithmConf(config *viper.Viper) AlgorithmConfig {
@@ -305,6 +454,84 @@ func NewRepositoryConf(conf *viper.Viper) repositoryConfig.RepositoryConfig {
 	return RepositoryConf
 }
 
+func NewPruningConf(conf *viper.Viper) PruningConfig {
+	mode := conf.GetString(PruningMode)
+	if common.BlankString == mode {
+		mode = common.NonePruningMode
+	}
+	if common.NonePruningMode != mode && common.StatesPruningMode != mode && common.AgePruningMode != mode {
+		panic(fmt.Errorf("unknown pruning mode %s", mode))
+	}
+	keepStates := conf.GetInt64(PruningKeepStates)
+	keepTime := conf.GetInt64(PruningKeepTime)
+	return PruningConfig{
+		Mode:       mode,
+		KeepStates: uint64(keepStates),
+		KeepTime:   keepTime,
+	}
+}
+
+func NewFaultConf(conf *viper.Viper) FaultConfig {
+	faults := make([]fault.Fault, 0)
+	if err := conf.UnmarshalKey(FaultFaults, &faults); err != nil {
+		panic(fmt.Errorf("failed to parse faults, as: %v", err))
+	}
+	return FaultConfig{
+		Enabled:    conf.GetBool(FaultEnabled),
+		ListenAddr: conf.GetString(FaultListenAddr),
+		Faults:     faults,
+	}
+}
+
+func NewRelayerConf(conf *viper.Viper) RelayerConfig {
+	var routes []struct {
+		ChainFlag  string `mapstructure:"chainFlag"`
+		ApiGateway string `mapstructure:"apigateway"`
+		Contract   string `mapstructure:"contract"`
+	}
+	if err := conf.UnmarshalKey(RelayerRoutes, &routes); err != nil {
+		panic(fmt.Errorf("failed to parse relayer routes, as: %v", err))
+	}
+	relayerConf := RelayerConfig{
+		Enabled:         conf.GetBool(RelayerEnabled),
+		DataPath:        conf.GetString(RelayerDataPath),
+		Confirmations:   uint64(conf.GetInt64(RelayerConfirmations)),
+		Account:         tools.HexToAddress(conf.GetString(RelayerAccount)),
+		Routes:          make([]RelayerRoute, 0, len(routes)),
+		ResubmitTimeout: conf.GetInt64(RelayerResubmit),
+	}
+	for _, route := range routes {
+		relayerConf.Routes = append(relayerConf.Routes, RelayerRoute{
+			ChainFlag:  route.ChainFlag,
+			ApiGateway: route.ApiGateway,
+			Contract:   tools.HexToAddress(route.Contract),
+		})
+	}
+	return relayerConf
+}
+
+func NewSyncerConf(conf *viper.Viper) SyncerConfig {
+	mode := conf.GetString(SyncerMode)
+	if common.BlankString == mode {
+		mode = common.FullSyncMode
+	}
+	if common.FullSyncMode != mode && common.FastSyncMode != mode {
+		panic(fmt.Errorf("unknown sync mode %s", mode))
+	}
+	trustedHeight := conf.GetInt64(SyncerTrustedHeight)
+	trustedHash := conf.GetString(SyncerTrustedHash)
+	if common.FastSyncMode == mode && common.BlankString == trustedHash {
+		panic(fmt.Errorf("trusted hash is required by fast sync, set %s to the header hash of block at trusted height", SyncerTrustedHash))
+	}
+	timeout := conf.GetInt64(SyncerTimeout)
+	return SyncerConfig{
+		Mode:          mode,
+		TrustedHeight: uint64(trustedHeight),
+		TrustedHash:   types.BytesToHash(tools.FromHex(trustedHash)),
+		Timeout:       timeout,
+	}
+}
+
 func GetApiGatewayTcpAddr(conf *viper.Viper) string {
 	apiGatewayAddr := conf.GetString(ApiGatewayAddr)
 	return apiGatewayAddr
@@ -440,6 +667,33 @@ func getP2PConf(p2pType string, conf *viper.Viper) *p2pConf.P2PConfig {
 	}
 }
 
+// GetConsensusPeers get the block p2p address of consensus participants by account address.
+func GetConsensusPeers(conf *viper.Viper) map[types.Address]string {
+	return addressedPeers(conf.GetString(BlockP2P+"."+P2PConsensusPeers), "consensus peer")
+}
+
+// GetConsensusRoutes get the url dialed for the consensus messages to validators by account address.
+func GetConsensusRoutes(conf *viper.Viper) map[types.Address]string {
+	return addressedPeers(conf.GetString(ConsensusRoutes), "consensus route")
+}
+
+// parse the comma separated peers in the form of <address>@<host>:<port>.
+func addressedPeers(value string, name string) map[types.Address]string {
+	peers := make(map[types.Address]string)
+	for _, peer := range strings.Split(value, ",") {
+		peer = strings.TrimSpace(peer)
+		index := strings.Index(peer, "@")
+		if index <= 0 {
+			if common.BlankString != peer {
+				log.Warn("ignore %s %s, as it is not in the form of <address>@<host>:<port>", name, peer)
+			}
+			continue
+		}
+		peers[tools.HexToAddress(peer[:index])] = peer[index+1:]
+	}
+	return peers
+}
+
 func GetSwitchConf(conf *viper.Viper) map[string]*swConf.SwitchConfig {
 	swConfig := make(map[string]*swConf.SwitchConfig)
 	swConfig[TxSwitxh] = getTxSwitchConf(conf)
@@ -3,9 +3,12 @@ package config
 import (
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/monkey"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -23,6 +26,11 @@ func Test_NewNodeConfig(t *testing.T) {
 	assert.NotNil("solo_node", nodeConf.Account)
 	assert.Equal("tcp://0.0.0.0:47768", nodeConf.ApiGatewayAddr)
 	assert.Equal(int64(2000), nodeConf.BlockInterval)
+	assert.False(nodeConf.RelayerConf.Enabled)
+	assert.Equal(uint64(3), nodeConf.RelayerConf.Confirmations)
+	assert.Equal(int64(60), nodeConf.RelayerConf.ResubmitTimeout)
+	assert.False(nodeConf.FaultConf.Enabled)
+	assert.Equal(0, len(nodeConf.FaultConf.Faults))
 	var address = types.Address{
 		0x33, 0x3c, 0x33, 0x10, 0x82, 0x4b, 0x7c, 0x68, 0x51, 0x33,
 		0xf2, 0xbe, 0xdb, 0x2c, 0xa4, 0xb8, 0xb4, 0xdf, 0x63, 0x3d,
@@ -33,3 +41,52 @@ func Test_NewNodeConfig(t *testing.T) {
 	assert.Equal(int64(30000), nodeConf.ConsensusConf.Timeout.TimeoutToChangeView)
 	monkey.UnpatchAll()
 }
+
+func Test_HomeDir(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv(HomeEnv, "/tmp/justitia")
+	assert.Equal("/tmp/justitia", HomeDir())
+	os.Unsetenv(HomeEnv)
+	assert.True(strings.HasSuffix(HomeDir(), ".justitia"))
+}
+
+func Test_GetConsensusPeers(t *testing.T) {
+	assert := assert.New(t)
+	conf := viper.New()
+	conf.Set(BlockP2P+"."+P2PConsensusPeers, "0x333c3310824b7c685133f2bedb2ca4b8b4df633d@127.0.0.1:46661, 127.0.0.1:46671,")
+	peers := GetConsensusPeers(conf)
+	assert.Equal(1, len(peers))
+	var address = types.Address{
+		0x33, 0x3c, 0x33, 0x10, 0x82, 0x4b, 0x7c, 0x68, 0x51, 0x33,
+		0xf2, 0xbe, 0xdb, 0x2c, 0xa4, 0xb8, 0xb4, 0xdf, 0x63, 0x3d,
+	}
+	assert.Equal("127.0.0.1:46661", peers[address])
+}
+
+func Test_GetConsensusRoutes(t *testing.T) {
+	assert := assert.New(t)
+	conf := viper.New()
+	assert.Equal(0, len(GetConsensusRoutes(conf)))
+	conf.Set(ConsensusRoutes, "0x333c3310824b7c685133f2bedb2ca4b8b4df633d@127.0.0.1:48081")
+	routes := GetConsensusRoutes(conf)
+	assert.Equal(1, len(routes))
+	var address = types.Address{
+		0x33, 0x3c, 0x33, 0x10, 0x82, 0x4b, 0x7c, 0x68, 0x51, 0x33,
+		0xf2, 0xbe, 0xdb, 0x2c, 0xa4, 0xb8, 0xb4, 0xdf, 0x63, 0x3d,
+	}
+	assert.Equal("127.0.0.1:48081", routes[address])
+}
+
+func Test_NewSyncerConf(t *testing.T) {
+	assert := assert.New(t)
+	conf := viper.New()
+	conf.Set(SyncerMode, common.FastSyncMode)
+	conf.Set(SyncerTrustedHeight, 10)
+	assert.Panics(func() {
+		NewSyncerConf(conf)
+	})
+	conf.Set(SyncerTrustedHash, "0x01")
+	syncerConf := NewSyncerConf(conf)
+	assert.Equal(uint64(10), syncerConf.TrustedHeight)
+	assert.Equal(types.BytesToHash([]byte{0x01}), syncerConf.TrustedHash)
+}
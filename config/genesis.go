@@ -1,21 +1,27 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	types2 "github.com/DSiSc/apigateway/core/types"
 	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/rlp"
 	"github.com/DSiSc/craft/types"
 	justitiac "github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/compiler"
 	"github.com/DSiSc/justitia/tools"
 	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/tools/account"
 	"github.com/DSiSc/validator/worker"
 	"github.com/DSiSc/validator/worker/common"
+	"io/ioutil"
 	"math"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -24,25 +30,123 @@ const (
 	InvalidPath     = ""
 )
 
+// defaultGenesisTimestamp is the genesis timestamp used when it is not specified in genesis file.
+var defaultGenesisTimestamp = uint64(time.Date(2018, time.August, 28, 0, 0, 0, 0, time.UTC).Unix())
+
+// genesis file schema versions, the file without version is treated as version 1.
+const (
+	GenesisVersion1 = 1
+	GenesisVersion2 = 2
+)
+
 type GenesisAccountConfig struct {
-	Addr     string   `json:"addr"     gencodec:"required"`
-	Balance  *big.Int `json:"balance"`
-	Code     string   `json:"code"`
-	Contract string   `json:"contract"`
+	Addr     string            `json:"addr"     gencodec:"required"`
+	Balance  *big.Int          `json:"balance"`
+	Nonce    uint64            `json:"nonce"`
+	Storage  map[string]string `json:"storage"`
+	Code     string            `json:"code"`
+	Contract string            `json:"contract"`
+	// source file of the contract, relative to genesis file, and its compiler
+	Source   string `json:"source"`
+	Compiler string `json:"compiler"`
+	// version of solc or vyper, which must be pinned so that all nodes build the same code
+	CompilerVersion string `json:"compilerVersion"`
+}
+
+// GenesisValidatorConfig is the initial validator in genesis file.
+type GenesisValidatorConfig struct {
+	Address string `json:"address" gencodec:"required"`
+	Id      uint64 `json:"id"`
+	Url     string `json:"url"`
+}
+
+// GenesisConsensusConfig is the consensus policy and timeouts in genesis file, timeouts in millisecond.
+type GenesisConsensusConfig struct {
+	Policy                   string `json:"policy"`
+	BlockInterval            int64  `json:"blockInterval"`
+	EnableEmptyBlock         bool   `json:"enableEmptyBlock"`
+	TimeoutToCollectResponse int64  `json:"timeoutToCollectResponse"`
+	TimeoutToWaitCommit      int64  `json:"timeoutToWaitCommit"`
+	TimeoutToViewChange      int64  `json:"timeoutToViewChange"`
+	// validators elected by Voting contract take effect every Epoch blocks, 0 to use the participates policy
+	Epoch uint64 `json:"epoch"`
+	// block interval, txs per block and empty block policy are overridden by the MetaData contract if set
+	ChainParams bool `json:"chainParams"`
+}
+
+// ChainRulesConfig is the chain rules in genesis file, all nodes of the chain must agree on it.
+type ChainRulesConfig struct {
+	ChainId       uint64                   `json:"chainId"`
+	HashAlgorithm string                   `json:"hashAlgorithm"`
+	Validators    []GenesisValidatorConfig `json:"validators"`
+	Consensus     GenesisConsensusConfig   `json:"consensus"`
+	// only admit the txs whose sender is in the WhiteList contract
+	TxWhiteList bool `json:"txWhiteList"`
 }
 
 type GenesisBlockConfig struct {
+	Version         int `json:"version"`
 	Block           *types.Block
 	GenesisAccounts []GenesisAccountConfig
 	ExtraData       []byte `json:"extra_data"`
+	Timestamp       uint64 `json:"timestamp"`
+	Coinbase        string `json:"coinbase"`
+	GasLimit        uint64 `json:"gasLimit"`
+	// version 2 fields
+	Rules           *ChainRulesConfig      `json:"rules"`
+	Alloc           []GenesisAccountConfig `json:"alloc"`
+	SystemContracts []GenesisAccountConfig `json:"systemContracts"`
 }
 
 // GenesisAccount is the account in genesis block.
+// For the account with code, Addr is the declared address before importing,
+// and it is set to the deployed address after importing if it is not declared.
 type GenesisAccount struct {
-	Addr     types.Address `json:"addr"     gencodec:"required"`
-	Balance  *big.Int      `json:"balance"`
-	Code     []byte        `json:"code"`
-	Contract string        `json:"contract"`
+	Addr     types.Address             `json:"addr"     gencodec:"required"`
+	Balance  *big.Int                  `json:"balance"`
+	Nonce    uint64                    `json:"nonce"`
+	Storage  map[types.Hash]types.Hash `json:"storage"`
+	Code     []byte                    `json:"code"`
+	Contract string                    `json:"contract"`
+}
+
+// ChainRules is the chain rules committed into genesis header.
+type ChainRules struct {
+	ChainId       uint64
+	HashAlgorithm string
+	Validators    []account.Account
+	Consensus     GenesisConsensusConfig
+	TxWhiteList   bool
+}
+
+// Hash returns the sha256 hash of the rlp encoded chain rules, which is independent of the hash algorithm setting.
+func (rules *ChainRules) Hash() (h types.Hash) {
+	consensus := rules.Consensus
+	fields := []interface{}{
+		rules.ChainId,
+		rules.HashAlgorithm,
+		rules.Validators,
+		consensus.Policy,
+		uint64(consensus.BlockInterval),
+		consensus.EnableEmptyBlock,
+		uint64(consensus.TimeoutToCollectResponse),
+		uint64(consensus.TimeoutToWaitCommit),
+		uint64(consensus.TimeoutToViewChange),
+	}
+	// appended only if set, so the hash of chain rules without them is unchanged
+	if consensus.Epoch > 0 || consensus.ChainParams || rules.TxWhiteList {
+		fields = append(fields, consensus.Epoch)
+	}
+	if consensus.ChainParams || rules.TxWhiteList {
+		fields = append(fields, consensus.ChainParams)
+	}
+	if rules.TxWhiteList {
+		fields = append(fields, rules.TxWhiteList)
+	}
+	hw := sha256.New()
+	rlp.Encode(hw, fields)
+	hw.Sum(h[:0])
+	return h
 }
 
 // GenesisBlock is the genesis block struct of the chain.
@@ -50,6 +154,38 @@ type GenesisBlock struct {
 	Block           *types.Block
 	GenesisAccounts []GenesisAccount
 	ExtraData       []byte `json:"extra_data"`
+	// gas limit of the gas pool to execute genesis transactions
+	GasLimit uint64
+	// chain rules, nil if genesis file is version 1
+	Rules *ChainRules
+}
+
+// AllocHash returns the sha256 hash of the rlp encoded genesis accounts and gas limit, which
+// identifies the allocation and contract code of genesis block without executing it.
+func (genesis *GenesisBlock) AllocHash() (h types.Hash) {
+	accounts := make([]interface{}, 0, len(genesis.GenesisAccounts))
+	for _, account := range genesis.GenesisAccounts {
+		keys := make([]types.Hash, 0, len(account.Storage))
+		for key := range account.Storage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		storage := make([]types.Hash, 0, 2*len(keys))
+		for _, key := range keys {
+			storage = append(storage, key, account.Storage[key])
+		}
+		balance := new(big.Int)
+		if nil != account.Balance {
+			balance = account.Balance
+		}
+		accounts = append(accounts, []interface{}{account.Addr, balance, account.Nonce, storage, account.Code, account.Contract})
+	}
+	hw := sha256.New()
+	rlp.Encode(hw, []interface{}{accounts, genesis.GasLimit})
+	hw.Sum(h[:0])
+	return h
 }
 
 // BuildGenesisBlock build genesis block from the specified config file.
@@ -66,9 +202,8 @@ func GenerateGenesisBlock() (*GenesisBlock, error) {
 }
 
 func genesisFilePath() string {
-	homePath, _ := tools.Home()
-	if tools.PathExists(fmt.Sprintf("%s/.justitia/%s", homePath, GenesisFileName)) {
-		return fmt.Sprintf("%s/.justitia/%s", homePath, GenesisFileName)
+	if path := filepath.Join(HomeDir(), GenesisFileName); tools.PathExists(path) {
+		return path
 	}
 	goPath := os.Getenv("GOPATH")
 	for _, p := range filepath.SplitList(goPath) {
@@ -80,20 +215,140 @@ func genesisFilePath() string {
 	return InvalidPath
 }
 
+// ArtifactPath is the directory of the compiled artifacts of builtin contracts.
+func ArtifactPath() string {
+	return filepath.Join(HomeDir(), "artifacts")
+}
+
+// get the code of builtin contract from the artifact cache, solc is never invoked here.
+func builtinContractCode(contract string) (string, error) {
+	sourcePath, err := compiler.SourcePath(contract)
+	if err != nil {
+		return "", err
+	}
+	source, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read source of contract %s, as: %v", contract, err)
+	}
+	artifact, err := compiler.NewArtifactCache(ArtifactPath()).Get(contract, source, compiler.BuiltinSolidityVersion, compiler.DefaultArtifactOptions)
+	if err != nil {
+		return "", fmt.Errorf("%v, please build it with `justitia contracts build` first", err)
+	}
+	return artifact.Code, nil
+}
+
+// compile the contract from the source declared in genesis account, the compiler is chosen by
+// source file extension if not specified. Prebuilt artifacts are loaded without invoking compilers,
+// while solc and vyper must be of the version pinned in genesis account.
+// It is only called by CompileGenesisConfig when generating genesis file, never on node start.
+func sourceContractCode(account GenesisAccountConfig, genesisDir string) (string, error) {
+	source := account.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(genesisDir, source)
+	}
+	name := account.Compiler
+	if justitiac.BlankString == name {
+		name = compiler.CompilerOf(source)
+	}
+	if compiler.ArtifactCompiler != name && justitiac.BlankString == account.CompilerVersion {
+		return "", fmt.Errorf("compilerVersion of %s must be specified to compile %s, so that all nodes build the same code", name, source)
+	}
+	c, err := compiler.FindCompiler(name, account.CompilerVersion)
+	if err != nil {
+		return "", err
+	}
+	contracts, err := c.Compile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to compile %s with %s, as: %v", source, c.Name(), err)
+	}
+	contract, err := compiler.SelectContract(contracts, account.Contract)
+	if err != nil {
+		return "", fmt.Errorf("failed to get contract from %s, as: %v", source, err)
+	}
+	return contract.Code, nil
+}
+
+// hasCode returns true if the account is deployed as contract in genesis block.
+func (account *GenesisAccountConfig) hasCode() bool {
+	return justitiac.BlankString != account.Code || justitiac.BlankString != account.Source || justitiac.BlankString != account.Contract
+}
+
+// accounts get the genesis accounts in the order they are created in genesis block.
+func (genesis *GenesisBlockConfig) accounts() []*GenesisAccountConfig {
+	accounts := make([]*GenesisAccountConfig, 0)
+	if GenesisVersion2 == genesis.Version {
+		for index := range genesis.Alloc {
+			accounts = append(accounts, &genesis.Alloc[index])
+		}
+		for index := range genesis.SystemContracts {
+			accounts = append(accounts, &genesis.SystemContracts[index])
+		}
+		return accounts
+	}
+	for index := range genesis.GenesisAccounts {
+		accounts = append(accounts, &genesis.GenesisAccounts[index])
+	}
+	return accounts
+}
+
+// GenesisContractAddress get the address of the contract deployed in genesis block, which is read from
+// genesis file without building genesis block. The address recorded by `justitia genesis compile` is
+// returned, or the address derived from the deploying order for the genesis file without it.
+func GenesisContractAddress(contract string) (types.Address, error) {
+	genesisPath := genesisFilePath()
+	if InvalidPath == genesisPath {
+		return types.Address{}, fmt.Errorf("contract %s not deployed in default genesis block", contract)
+	}
+	genesis, err := loadGenesisConfig(genesisPath)
+	if err != nil {
+		return types.Address{}, err
+	}
+	var nonce uint64
+	for _, account := range genesis.accounts() {
+		if !account.hasCode() {
+			continue
+		}
+		if account.Contract == contract {
+			if justitiac.BlankString != account.Addr {
+				return tools.HexToAddress(account.Addr), nil
+			}
+			// genesis contracts are deployed by the zero address in order
+			return justitiac.CreateAddress(types.Address{}, nonce), nil
+		}
+		nonce++
+	}
+	return types.Address{}, fmt.Errorf("contract %s not deployed in genesis block", contract)
+}
+
+// GenesisContracts get the builtin contracts declared without code in genesis file.
+func GenesisContracts() ([]string, error) {
+	genesis, err := loadGenesisConfig(genesisFilePath())
+	if err != nil {
+		return nil, err
+	}
+	contracts := make([]string, 0)
+	for _, account := range genesis.GenesisAccounts {
+		if justitiac.BlankString == account.Code && justitiac.BlankString == account.Source && justitiac.BlankString != account.Contract {
+			contracts = append(contracts, account.Contract)
+		}
+	}
+	return contracts, nil
+}
+
 // add tx to genesis block
 func (genesis *GenesisBlock) addTxToGenesisBlock() {
 	var nonce uint64
 	for _, key := range genesis.GenesisAccounts {
 		if 0 != len(key.Code) {
-			tx := types2.NewTransaction(nonce, nil, key.Balance, uint64(0), big.NewInt(0), key.Code, types2.Address{})
+			tx := types2.NewTransaction(nonce, nil, big.NewInt(0), uint64(0), big.NewInt(0), key.Code, types2.Address{})
 			genesis.Block.Transactions = append(genesis.Block.Transactions, tx)
 			nonce++
 		}
 	}
 }
 
-// parse genesis block from config file.
-func buildGenesisFromConfig(genesisPath string) (*GenesisBlock, error) {
+// read genesis config from genesis file as it is.
+func readGenesisConfig(genesisPath string) (*GenesisBlockConfig, error) {
 	file, err := os.Open(genesisPath)
 	if err != nil {
 		log.Error("Failed to open genesis file, as: %v", err)
@@ -106,30 +361,122 @@ func buildGenesisFromConfig(genesisPath string) (*GenesisBlock, error) {
 		log.Error("Failed to parse genesis file, as: %v", err)
 		return nil, fmt.Errorf("Failed to parse genesis file, as: %v ", err)
 	}
+	return genesis, nil
+}
+
+// load genesis config from genesis file.
+func loadGenesisConfig(genesisPath string) (*GenesisBlockConfig, error) {
+	genesis, err := readGenesisConfig(genesisPath)
+	if err != nil {
+		return nil, err
+	}
+	switch genesis.Version {
+	case 0, GenesisVersion1:
+		if nil == genesis.Block || nil == genesis.Block.Header {
+			return nil, fmt.Errorf("genesis file of version %d must contain block header", GenesisVersion1)
+		}
+		genesis.Version = GenesisVersion1
+	case GenesisVersion2:
+		if nil == genesis.Rules {
+			return nil, fmt.Errorf("genesis file of version %d must contain rules", genesis.Version)
+		}
+		if nil == genesis.Block {
+			genesis.Block = &types.Block{}
+		}
+		if nil == genesis.Block.Header {
+			genesis.Block.Header = &types.Header{}
+		}
+		genesis.Block.Header.ChainID = genesis.Rules.ChainId
+		genesis.GenesisAccounts = append(append(make([]GenesisAccountConfig, 0), genesis.Alloc...), genesis.SystemContracts...)
+	default:
+		return nil, fmt.Errorf("unsupported genesis file version %d", genesis.Version)
+	}
+	return genesis, nil
+}
+
+// parse chain rules from genesis config.
+func parseChainRules(genesis *GenesisBlockConfig) (*ChainRules, error) {
+	rules := &ChainRules{
+		ChainId:       genesis.Rules.ChainId,
+		HashAlgorithm: genesis.Rules.HashAlgorithm,
+		Validators:    make([]account.Account, 0, len(genesis.Rules.Validators)),
+		Consensus:     genesis.Rules.Consensus,
+		TxWhiteList:   genesis.Rules.TxWhiteList,
+	}
+	for _, validator := range genesis.Rules.Validators {
+		rules.Validators = append(rules.Validators, account.Account{
+			Address: tools.HexToAddress(validator.Address),
+			Extension: account.AccountExtension{
+				Id:  validator.Id,
+				Url: validator.Url,
+			},
+		})
+	}
+	for _, contract := range genesis.SystemContracts {
+		if types.InitialContractType == justitiac.SystemContractType(contract.Contract) {
+			return nil, fmt.Errorf("unknown system contract %s", contract.Contract)
+		}
+	}
+	return rules, nil
+}
+
+// parse genesis block from config file.
+func buildGenesisFromConfig(genesisPath string) (*GenesisBlock, error) {
+	genesis, err := loadGenesisConfig(genesisPath)
+	if err != nil {
+		return nil, err
+	}
 	genesisBlock := &GenesisBlock{
 		Block:           genesis.Block,
 		GenesisAccounts: make([]GenesisAccount, 0),
 		ExtraData:       genesis.ExtraData,
+		GasLimit:        genesis.GasLimit,
 	}
 	for _, account := range genesis.GenesisAccounts {
 		contractByteCode := ""
 		genesisAccount := GenesisAccount{
 			Addr:     tools.HexToAddress(account.Addr),
 			Balance:  account.Balance,
+			Nonce:    account.Nonce,
+			Storage:  make(map[types.Hash]types.Hash),
 			Contract: account.Contract,
 		}
+		for key, value := range account.Storage {
+			genesisAccount.Storage[types.BytesToHash(tools.FromHex(key))] = types.BytesToHash(tools.FromHex(value))
+		}
 		if contractByteCode != account.Code {
 			genesisAccount.Code = tools.Hex2Bytes(account.Code)
+		} else if justitiac.BlankString != account.Source {
+			return nil, fmt.Errorf("contract %s from %s is not compiled, please compile it with `justitia genesis compile` first", account.Contract, account.Source)
 		} else {
 			if contractByteCode != account.Contract {
-				contractByteCode = compiler.SolidityCompile(account.Contract)
+				if contractByteCode, err = builtinContractCode(account.Contract); err != nil {
+					return nil, err
+				}
 				genesisAccount.Code = tools.Hex2Bytes(contractByteCode)
 			}
 		}
 		genesisBlock.GenesisAccounts = append(genesisBlock.GenesisAccounts, genesisAccount)
 	}
 	genesisBlock.addTxToGenesisBlock()
-	genesisBlock.Block.Header.Timestamp = uint64(time.Date(2018, time.August, 28, 0, 0, 0, 0, time.UTC).Unix())
+	genesisBlock.Block.Header.Timestamp = defaultGenesisTimestamp
+	if 0 != genesis.Timestamp {
+		genesisBlock.Block.Header.Timestamp = genesis.Timestamp
+	}
+	if justitiac.BlankString != genesis.Coinbase {
+		genesisBlock.Block.Header.Coinbase = tools.HexToAddress(genesis.Coinbase)
+	}
+	genesisBlock.Block.Header.Extra = genesis.ExtraData
+	if GenesisVersion2 == genesis.Version {
+		if genesisBlock.Rules, err = parseChainRules(genesis); err != nil {
+			return nil, err
+		}
+		// commit chain rules into genesis header
+		genesisBlock.Block.Header.MixDigest = genesisBlock.Rules.Hash()
+		// genesis header hash is computed before executing genesis transactions, so commit the
+		// allocation and contract code as its tx root instead of the state root.
+		genesisBlock.Block.Header.TxRoot = genesisBlock.AllocHash()
+	}
 	return genesisBlock, err
 }
 
@@ -140,7 +487,7 @@ func buildDefaultGenesis() (*GenesisBlock, error) {
 		TxRoot:        types.Hash{},
 		ReceiptsRoot:  types.Hash{},
 		Height:        uint64(0),
-		Timestamp:     uint64(time.Date(2018, time.August, 28, 0, 0, 0, 0, time.UTC).Unix()),
+		Timestamp:     defaultGenesisTimestamp,
 	}
 
 	// genesis block
@@ -164,47 +511,61 @@ func buildDefaultGenesis() (*GenesisBlock, error) {
 	return genesisBlock, nil
 }
 
-func ImportGenesisBlock() {
+// ImportGenesisBlock import genesis block to repository if there is no block in it.
+// The stored chain is checked against the configured genesis by CheckChainMeta.
+func ImportGenesisBlock() error {
 	chain, err := repository.NewLatestStateRepository()
 	if err != nil {
-		panic(fmt.Errorf("failed to create init-state block chain, as: %v", err))
+		return fmt.Errorf("failed to create init-state block chain, as: %v", err)
 	}
 
 	currentBlock := chain.GetCurrentBlock()
 	if currentBlock != nil {
 		log.Info("found latest block with height %d from local database, will skip importing genesis block", currentBlock.Header.Height)
-		return
+		return nil
 	}
 
 	genesisBlock, err := GenerateGenesisBlock()
 	if err != nil {
-		panic(fmt.Errorf("get genesis block failed with error %s", err))
+		return fmt.Errorf("get genesis block failed with error %v", err)
 	}
 
-	// set balance and record map
-	for _, account := range genesisBlock.GenesisAccounts {
-		if nil != account.Balance && account.Balance.Cmp(big.NewInt(0)) == 1 {
-			chain.CreateAccount(account.Addr)
-			chain.SetBalance(account.Addr, account.Balance)
-		}
+	// set the state of the accounts without code
+	for index, account := range genesisBlock.GenesisAccounts {
 		if len(account.Code) != 0 {
 			contractType := justitiac.SystemContractType(account.Contract)
 			if types.InitialContractType == contractType {
-				panic("illegal parameter")
+				return fmt.Errorf("genesis account %d(%x) has code, while contract %q is not a system contract", index, account.Addr, account.Contract)
 			}
+			continue
 		}
+		setGenesisAccountState(chain, account.Addr, account)
+	}
+	// deploy the contracts, then set the state declared for them
+	gasPool := new(common.GasPool)
+	if 0 != genesisBlock.GasLimit {
+		gasPool.AddGas(genesisBlock.GasLimit)
 	}
-	// execute transaction
-	for index, tx := range genesisBlock.Block.Transactions {
-		_, _, _, err, addr := worker.ApplyTransaction(genesisBlock.Block.Header.Coinbase, genesisBlock.Block.Header, chain, tx, new(common.GasPool))
+	txIndex := 0
+	for index, account := range genesisBlock.GenesisAccounts {
+		if len(account.Code) == 0 {
+			continue
+		}
+		tx := genesisBlock.Block.Transactions[txIndex]
+		txIndex++
+		_, _, failed, err, addr := worker.ApplyTransaction(genesisBlock.Block.Header.Coinbase, genesisBlock.Block.Header, chain, tx, gasPool)
 		if err != nil {
-			panic("apply transaction failed")
+			return fmt.Errorf("failed to deploy contract %s of genesis account %d(%x), as: %v", account.Contract, index, account.Addr, err)
 		}
-
-		//TODO: optimize
-		if index == 4 {
-			chain.SetBalance(addr, big.NewInt(1000000))
+		if failed {
+			return fmt.Errorf("failed to deploy contract %s of genesis account %d(%x), as: execution reverted", account.Contract, index, account.Addr)
 		}
+		if (account.Addr != types.Address{}) && account.Addr != addr {
+			return fmt.Errorf("contract %s of genesis account %d declared address %x mismatch with deployed address %x", account.Contract, index, account.Addr, addr)
+		}
+		log.Info("deploy genesis contract %s at address %x", account.Contract, addr)
+		genesisBlock.GenesisAccounts[index].Addr = addr
+		setGenesisAccountState(chain, addr, account)
 	}
 	// update block header hash
 	genesisBlock.Block.HeaderHash = justitiac.HeaderHash(genesisBlock.Block)
@@ -212,8 +573,38 @@ func ImportGenesisBlock() {
 	// write block
 	err = chain.WriteBlock(genesisBlock.Block)
 	if nil != err {
-		panic("import genesis block failed.")
+		return fmt.Errorf("import genesis block failed, as: %v", err)
+	}
+	return nil
+}
+
+// set the balance, nonce and storage declared in genesis account.
+func setGenesisAccountState(chain *repository.Repository, addr types.Address, account GenesisAccount) {
+	if !chain.Exist(addr) {
+		chain.CreateAccount(addr)
+	}
+	if nil != account.Balance && account.Balance.Sign() > 0 {
+		chain.SetBalance(addr, account.Balance)
+	}
+	if 0 != account.Nonce {
+		chain.SetNonce(addr, account.Nonce)
+	}
+	for key, value := range account.Storage {
+		chain.SetState(addr, key, value)
+	}
+}
+
+// GenesisHash get the header hash of the genesis block built from genesis file.
+// genesis header hash does not depend on the execution of genesis transactions,
+// so it can be computed without importing genesis block. The header of version 2 genesis
+// commits the chain rules and the allocation, while version 1 header is kept as it is for
+// the chains already running on it, so its hash doesn't cover accounts and contract code.
+func GenesisHash() (types.Hash, error) {
+	genesisBlock, err := GenerateGenesisBlock()
+	if err != nil {
+		return types.Hash{}, err
 	}
+	return justitiac.HeaderHash(genesisBlock.Block), nil
 }
 
 func GetChainIdFromConfig() (uint64, error) {
@@ -223,21 +614,27 @@ func GetChainIdFromConfig() (uint64, error) {
 		return 0, nil
 	}
 
-	//Open genesisFile by the path
-	file, err := os.Open(genesisPath)
+	genesis, err := loadGenesisConfig(genesisPath)
 	if err != nil {
-		log.Error("Failed to open genesis file, as: %v", err)
-		return 0, fmt.Errorf("Failed to open genesis file, as: %v ", err)
-	}
-	defer file.Close()
-
-	//Decode the file to genesis
-	genesis := new(GenesisBlockConfig)
-	if err := json.NewDecoder(file).Decode(genesis); err != nil {
-		log.Error("Failed to parse genesis file, as: %v", err)
-		return 0, fmt.Errorf("Failed to parse genesis file, as: %v ", err)
+		return 0, err
 	}
 	chainId := genesis.Block.Header.ChainID
 
 	return chainId, nil
 }
+
+// GetChainRulesFromConfig get chain rules from genesis file, nil if the genesis file has no chain rules.
+func GetChainRulesFromConfig() (*ChainRules, error) {
+	var genesisPath = genesisFilePath()
+	if InvalidPath == genesisPath {
+		return nil, nil
+	}
+	genesis, err := loadGenesisConfig(genesisPath)
+	if err != nil {
+		return nil, err
+	}
+	if GenesisVersion2 != genesis.Version {
+		return nil, nil
+	}
+	return parseChainRules(genesis)
+}
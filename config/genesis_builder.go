@@ -0,0 +1,310 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	justitiac "github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/compiler"
+	"github.com/DSiSc/justitia/tools"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GenesisSpecValidator is the validator in genesis spec.
+type GenesisSpecValidator struct {
+	Address string `mapstructure:"address"`
+	Id      uint64 `mapstructure:"id"`
+	// consensus url of the validator
+	Url string `mapstructure:"url"`
+	// host that other nodes use to connect the validator's p2p, default to the host of url
+	Host string `mapstructure:"host"`
+}
+
+// GenesisSpecAccount is the funded account in genesis spec.
+type GenesisSpecAccount struct {
+	Addr    string `mapstructure:"addr"`
+	Balance string `mapstructure:"balance"`
+}
+
+// GenesisSpecContract is the system contract in genesis spec.
+type GenesisSpecContract struct {
+	// system contract name, such as JustitiaRight, Voting, WhiteList, MetaData
+	Name string `mapstructure:"name"`
+	// solidity source file, default to compiler/contracts/<name>.sol or scripts/contracts/<name>.sol
+	Source string `mapstructure:"source"`
+	// contract name in source file, default to name
+	Contract string `mapstructure:"contract"`
+	Balance  string `mapstructure:"balance"`
+}
+
+// GenesisSpec is the spec to build a new network, in yaml or json.
+type GenesisSpec struct {
+	ChainId       uint64                 `mapstructure:"chainId"`
+	HashAlgorithm string                 `mapstructure:"hashAlgorithm"`
+	Consensus     GenesisConsensusConfig `mapstructure:"consensus"`
+	Validators    []GenesisSpecValidator `mapstructure:"validators"`
+	Accounts      []GenesisSpecAccount   `mapstructure:"accounts"`
+	Contracts     []GenesisSpecContract  `mapstructure:"contracts"`
+	// only admit the txs whose sender is in the WhiteList contract
+	TxWhiteList bool `mapstructure:"txWhiteList"`
+	// port offset between validators, used when validators run on the same host
+	PortOffset int `mapstructure:"portOffset"`
+}
+
+// LoadGenesisSpec load genesis spec from yaml or json file.
+func LoadGenesisSpec(specPath string) (*GenesisSpec, error) {
+	v := viper.New()
+	v.SetConfigFile(specPath)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read genesis spec, as: %v", err)
+	}
+	spec := new(GenesisSpec)
+	if err := v.Unmarshal(spec); err != nil {
+		return nil, fmt.Errorf("failed to parse genesis spec, as: %v", err)
+	}
+	if len(spec.Validators) == 0 {
+		return nil, fmt.Errorf("genesis spec must contain at least one validator")
+	}
+	return spec, nil
+}
+
+// BuildGenesisConfig build version 2 genesis config from spec, the contracts are compiled with solc.
+func BuildGenesisConfig(spec *GenesisSpec) (*GenesisBlockConfig, error) {
+	genesis := &GenesisBlockConfig{
+		Version:         GenesisVersion2,
+		Timestamp:       defaultGenesisTimestamp,
+		Alloc:           make([]GenesisAccountConfig, 0, len(spec.Accounts)),
+		SystemContracts: make([]GenesisAccountConfig, 0, len(spec.Contracts)),
+		Rules: &ChainRulesConfig{
+			ChainId:       spec.ChainId,
+			HashAlgorithm: spec.HashAlgorithm,
+			Validators:    make([]GenesisValidatorConfig, 0, len(spec.Validators)),
+			Consensus:     spec.Consensus,
+			TxWhiteList:   spec.TxWhiteList,
+		},
+	}
+	for _, validator := range spec.Validators {
+		genesis.Rules.Validators = append(genesis.Rules.Validators, GenesisValidatorConfig{
+			Address: validator.Address,
+			Id:      validator.Id,
+			Url:     validator.Url,
+		})
+	}
+	for _, account := range spec.Accounts {
+		balance, err := parseBalance(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", account.Addr, err)
+		}
+		genesis.Alloc = append(genesis.Alloc, GenesisAccountConfig{
+			Addr:    account.Addr,
+			Balance: balance,
+		})
+	}
+	for _, contract := range spec.Contracts {
+		if types.InitialContractType == justitiac.SystemContractType(contract.Name) {
+			return nil, fmt.Errorf("unknown system contract %s", contract.Name)
+		}
+		balance, err := parseBalance(contract.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("contract %s: %v", contract.Name, err)
+		}
+		code, err := compileSpecContract(contract)
+		if err != nil {
+			return nil, err
+		}
+		genesis.SystemContracts = append(genesis.SystemContracts, GenesisAccountConfig{
+			Balance:  balance,
+			Code:     code,
+			Contract: contract.Name,
+		})
+	}
+	recordContractAddresses(genesis)
+	return genesis, nil
+}
+
+// CompileGenesisConfig compile the contracts declared by source or builtin contract name in genesis
+// config, and store the byte code and deployed address of the contracts in it, so that nodes load
+// the code from genesis file instead of compiling it on every start.
+func CompileGenesisConfig(genesis *GenesisBlockConfig, genesisDir string) error {
+	for _, account := range genesis.accounts() {
+		if justitiac.BlankString != account.Code {
+			continue
+		}
+		var code string
+		var err error
+		if justitiac.BlankString != account.Source {
+			code, err = sourceContractCode(*account, genesisDir)
+		} else if justitiac.BlankString != account.Contract {
+			code, err = builtinContractCode(account.Contract)
+		} else {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		account.Code = strings.TrimPrefix(code, "0x")
+	}
+	recordContractAddresses(genesis)
+	return nil
+}
+
+// CompileGenesisFile compile the contracts in genesis file, and write them back to the file.
+func CompileGenesisFile(genesisPath string) error {
+	genesis, err := readGenesisConfig(genesisPath)
+	if err != nil {
+		return err
+	}
+	if err := CompileGenesisConfig(genesis, filepath.Dir(genesisPath)); err != nil {
+		return err
+	}
+	return WriteGenesisConfig(genesis, genesisPath)
+}
+
+// record the address of the contracts without declared address, which are deployed by the zero address in order.
+func recordContractAddresses(genesis *GenesisBlockConfig) {
+	var nonce uint64
+	for _, account := range genesis.accounts() {
+		if !account.hasCode() {
+			continue
+		}
+		if justitiac.BlankString == account.Addr {
+			account.Addr = fmt.Sprintf("0x%x", justitiac.CreateAddress(types.Address{}, nonce))
+		}
+		nonce++
+	}
+}
+
+func parseBalance(balance string) (*big.Int, error) {
+	if justitiac.BlankString == balance {
+		return nil, nil
+	}
+	value, ok := new(big.Int).SetString(balance, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %s", balance)
+	}
+	return value, nil
+}
+
+// compile the contract in spec, return the byte code in hex.
+func compileSpecContract(contract GenesisSpecContract) (string, error) {
+	source := contract.Source
+	if justitiac.BlankString == source {
+		for _, dir := range []string{"compiler/contracts", "scripts/contracts"} {
+			path := filepath.Join(dir, contract.Name+".sol")
+			if tools.PathExists(path) {
+				source = path
+				break
+			}
+		}
+	}
+	if justitiac.BlankString == source {
+		return "", fmt.Errorf("source of contract %s not found", contract.Name)
+	}
+	contractName := contract.Contract
+	if justitiac.BlankString == contractName {
+		contractName = contract.Name
+	}
+	contracts, err := compiler.CompileSolidity("solc", source)
+	if err != nil {
+		return "", fmt.Errorf("failed to compile contract %s, as: %v", contract.Name, err)
+	}
+	for name, compiled := range contracts {
+		if strings.HasSuffix(name, ":"+contractName) {
+			return strings.TrimPrefix(compiled.Code, "0x"), nil
+		}
+	}
+	return "", fmt.Errorf("contract %s not found in %s", contractName, source)
+}
+
+// WriteGenesisConfig write genesis config to file in json.
+func WriteGenesisConfig(genesis *GenesisBlockConfig, path string) error {
+	content, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// WriteValidatorConfigs write justitia.yaml for each validator in spec to outDir/node<id>,
+// the config is based on the justitia.yaml found by LoadConfig.
+func WriteValidatorConfigs(spec *GenesisSpec, outDir string) error {
+	p2pTypes := []string{BlockSyncerP2P, BlockP2P, TxP2P}
+	template := LoadConfig()
+	peers := make(map[string][]string)
+	consensusPeers := make([]string, 0, len(spec.Validators))
+	for index, validator := range spec.Validators {
+		host := validatorHost(validator)
+		for _, p2pType := range p2pTypes {
+			port := AddrPort(template.GetString(p2pType+"."+P2PListenAddr)) + index*spec.PortOffset
+			peers[p2pType] = append(peers[p2pType], fmt.Sprintf("%s:%d", host, port))
+		}
+		consensusPeers = append(consensusPeers, validator.Address+"@"+peers[BlockP2P][index])
+	}
+	for index, validator := range spec.Validators {
+		conf := LoadConfig()
+		offset := index * spec.PortOffset
+		conf.Set(NodeType, int(justitiac.ConsensusNode))
+		conf.Set(NodeAddress, strings.TrimPrefix(validator.Address, "0x"))
+		conf.Set(NodeId, validator.Id)
+		conf.Set(NodeUrl, validator.Url)
+		conf.Set(ApiGatewayAddr, OffsetAddr(template.GetString(ApiGatewayAddr), offset))
+		for _, p2pType := range p2pTypes {
+			conf.Set(p2pType+"."+P2PListenAddr, OffsetAddr(template.GetString(p2pType+"."+P2PListenAddr), offset))
+			otherPeers := make([]string, 0, len(spec.Validators)-1)
+			for peerIndex, peer := range peers[p2pType] {
+				if peerIndex != index {
+					otherPeers = append(otherPeers, peer)
+				}
+			}
+			conf.Set(p2pType+"."+P2PPersistendPeers, strings.Join(otherPeers, ","))
+		}
+		conf.Set(BlockP2P+"."+P2PConsensusPeers, strings.Join(consensusPeers, ","))
+		conf.Set(PrometheusPort, strconv.Itoa(template.GetInt(PrometheusPort)+offset))
+		conf.Set(ExpvarPort, strconv.Itoa(template.GetInt(ExpvarPort)+offset))
+		conf.Set(PprofPort, strconv.Itoa(template.GetInt(PprofPort)+offset))
+		nodeDir := filepath.Join(outDir, fmt.Sprintf("node%d", validator.Id))
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			return err
+		}
+		if err := conf.WriteConfigAs(filepath.Join(nodeDir, "justitia.yaml")); err != nil {
+			return fmt.Errorf("failed to write config of validator %s, as: %v", validator.Address, err)
+		}
+	}
+	return nil
+}
+
+func validatorHost(validator GenesisSpecValidator) string {
+	if justitiac.BlankString != validator.Host {
+		return validator.Host
+	}
+	if index := strings.LastIndex(validator.Url, ":"); index > 0 {
+		return validator.Url[:index]
+	}
+	return validator.Url
+}
+
+// AddrPort get the port of address like tcp://0.0.0.0:46660.
+func AddrPort(addr string) int {
+	if u, err := url.Parse(addr); nil == err {
+		port, _ := strconv.Atoi(u.Port())
+		return port
+	}
+	return 0
+}
+
+// OffsetAddr offset the port of address like tcp://0.0.0.0:46660.
+func OffsetAddr(addr string, offset int) string {
+	u, err := url.Parse(addr)
+	if nil != err || justitiac.BlankString == u.Port() {
+		return addr
+	}
+	u.Host = fmt.Sprintf("%s:%d", u.Hostname(), AddrPort(addr)+offset)
+	return u.String()
+}
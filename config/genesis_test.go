@@ -1,13 +1,22 @@
 package config
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/DSiSc/craft/types"
+	justitiac "github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/compiler"
 	"github.com/DSiSc/justitia/tools"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/worker"
+	"github.com/DSiSc/validator/worker/common"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -27,8 +36,8 @@ func TestBuildDefaultGensisBlock(t *testing.T) {
 // test build genesis block from config file
 func TestBuildGensisBlockFromFile(t *testing.T) {
 	assert := assert.New(t)
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(builtinContractCode, func(string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	block, err := GenerateGenesisBlock()
 	assert.NotNil(block)
@@ -40,10 +49,6 @@ func TestBuildGensisBlockFromFile(t *testing.T) {
 // test import genesis block: exists block in local database
 func TestImportGenesisBlockExistBlockInDB(t *testing.T) {
 	assert := assert.New(t)
-	defer func() {
-		r := recover()
-		assert.Nil(r)
-	}()
 	defer monkey.UnpatchAll()
 	monkey.Patch(tools.PathExists, func(string) bool {
 		return false
@@ -59,16 +64,19 @@ func TestImportGenesisBlockExistBlockInDB(t *testing.T) {
 			},
 		}
 	})
-	ImportGenesisBlock()
+	// node seeded by snapshot has no genesis block, and genesis is not rebuilt
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(*repository.Repository, uint64) (*types.Block, error) {
+		return nil, errors.New("block not found")
+	})
+	monkey.Patch(GenerateGenesisBlock, func() (*GenesisBlock, error) {
+		return nil, errors.New("genesis should not be rebuilt")
+	})
+	assert.Nil(ImportGenesisBlock())
 }
 
 // test import genesis block: have no block in local database
 func TestImportGenesisBlockNoBlockInDB(t *testing.T) {
 	assert := assert.New(t)
-	defer func() {
-		r := recover()
-		assert.NotNil(r)
-	}()
 	defer monkey.UnpatchAll()
 	monkey.Patch(tools.PathExists, func(string) bool {
 		return false
@@ -83,7 +91,9 @@ func TestImportGenesisBlockNoBlockInDB(t *testing.T) {
 	monkey.Patch(GenerateGenesisBlock, func() (*GenesisBlock, error) {
 		return nil, errors.New("failed to build genesis block")
 	})
-	ImportGenesisBlock()
+	err := ImportGenesisBlock()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "failed to build genesis block")
 }
 
 func TestGetChainIdFromConfigFailed(t *testing.T) {
@@ -117,3 +127,462 @@ func TestGetChainIdFromConfig(t *testing.T) {
 	assert.Nil(err)
 	monkey.UnpatchAll()
 }
+
+// test build genesis block from version 2 genesis file
+func TestBuildGenesisBlockFromFileV2(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	monkey.Patch(genesisFilePath, func() string {
+		return "testdata/genesis_v2.json"
+	})
+	block, err := GenerateGenesisBlock()
+	assert.Nil(err)
+	assert.NotNil(block.Rules)
+	assert.Equal(uint64(1), block.Block.Header.ChainID)
+	assert.Equal(2, len(block.GenesisAccounts))
+	assert.Equal(1, len(block.Block.Transactions))
+	assert.Equal(1, len(block.Rules.Validators))
+	assert.Equal(block.Rules.Hash(), block.Block.Header.MixDigest)
+
+	rules, err := GetChainRulesFromConfig()
+	assert.Nil(err)
+	assert.Equal(block.Rules.Hash(), rules.Hash())
+	rules.Consensus.BlockInterval = 1000
+	assert.NotEqual(block.Rules.Hash(), rules.Hash())
+	hash := rules.Hash()
+	rules.Consensus.Epoch = 100
+	assert.NotEqual(hash, rules.Hash())
+	hash = rules.Hash()
+	rules.Consensus.ChainParams = true
+	assert.NotEqual(hash, rules.Hash())
+	hash = rules.Hash()
+	rules.TxWhiteList = true
+	assert.NotEqual(hash, rules.Hash())
+
+	chainId, err := GetChainIdFromConfig()
+	assert.Nil(err)
+	assert.Equal(uint64(1), chainId)
+}
+
+// test version 1 genesis file has no chain rules
+func TestGetChainRulesFromConfigV1(t *testing.T) {
+	assert := assert.New(t)
+	rules, err := GetChainRulesFromConfig()
+	assert.Nil(err)
+	assert.Nil(rules)
+}
+
+// test genesis header is built deterministically from genesis file
+func TestGenesisHash(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	monkey.Patch(genesisFilePath, func() string {
+		return "testdata/genesis_v2.json"
+	})
+	block, err := GenerateGenesisBlock()
+	assert.Nil(err)
+	assert.Equal(uint64(1540000000), block.Block.Header.Timestamp)
+	assert.Equal(tools.HexToAddress("0x343c3310824b7c685133f2bedb2ca4b8b4df633d"), block.Block.Header.Coinbase)
+	assert.Equal([]byte("justitia"), block.Block.Header.Extra)
+	assert.Equal(uint64(100000000), block.GasLimit)
+
+	hash, err := GenesisHash()
+	assert.Nil(err)
+	hash1, err := GenesisHash()
+	assert.Nil(err)
+	assert.Equal(hash, hash1)
+
+	// genesis with different allocation has different hash
+	content, err := ioutil.ReadFile("testdata/genesis_v2.json")
+	assert.Nil(err)
+	dir, err := ioutil.TempDir("", "genesis")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	genesisPath := filepath.Join(dir, GenesisFileName)
+	assert.Nil(ioutil.WriteFile(genesisPath, bytes.Replace(content, []byte(`"balance": 50000`), []byte(`"balance": 50001`), 1), 0644))
+	monkey.Patch(genesisFilePath, func() string {
+		return genesisPath
+	})
+	hash1, err = GenesisHash()
+	assert.Nil(err)
+	assert.NotEqual(hash, hash1)
+}
+
+func mockGenesisChain(balances map[types.Address]*big.Int) *repository.Repository {
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Exist", func(*repository.Repository, types.Address) bool {
+		return false
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "CreateAccount", func(*repository.Repository, types.Address) {})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "SetBalance", func(_ *repository.Repository, addr types.Address, balance *big.Int) {
+		balances[addr] = balance
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "SetNonce", func(*repository.Repository, types.Address, uint64) {})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "SetState", func(*repository.Repository, types.Address, types.Hash, types.Hash) {})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "IntermediateRoot", func(*repository.Repository, bool) types.Hash {
+		return types.Hash{}
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "WriteBlock", func(*repository.Repository, *types.Block) error {
+		return nil
+	})
+	return chain
+}
+
+func mockGenesisBlock(contractAddr types.Address) *GenesisBlock {
+	genesis := &GenesisBlock{
+		Block: &types.Block{
+			Header: &types.Header{},
+		},
+		GenesisAccounts: []GenesisAccount{
+			{
+				Addr:    tools.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"),
+				Balance: big.NewInt(100),
+			},
+			{
+				Addr:     contractAddr,
+				Balance:  big.NewInt(1000000),
+				Code:     tools.Hex2Bytes("6080604052"),
+				Contract: types.JustitiaVoting,
+			},
+		},
+	}
+	genesis.addTxToGenesisBlock()
+	return genesis
+}
+
+// test genesis contract funded at the deployed address
+func TestImportGenesisBlockContractFunding(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	balances := make(map[types.Address]*big.Int)
+	mockGenesisChain(balances)
+	deployedAddr := tools.HexToAddress("0x47e9fbef8c83a1714f1951f142132e6e90f5fa5d")
+	monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *types.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		return nil, 0, false, nil, deployedAddr
+	})
+	monkey.Patch(GenerateGenesisBlock, func() (*GenesisBlock, error) {
+		return mockGenesisBlock(types.Address{}), nil
+	})
+	assert.Nil(ImportGenesisBlock())
+	assert.Equal(big.NewInt(100), balances[tools.HexToAddress("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b")])
+	assert.Equal(big.NewInt(1000000), balances[deployedAddr])
+
+	// declared address mismatch with deployed address
+	monkey.Patch(GenerateGenesisBlock, func() (*GenesisBlock, error) {
+		return mockGenesisBlock(tools.HexToAddress("0x333c3310824b7c685133f2bedb2ca4b8b4df633d")), nil
+	})
+	err := ImportGenesisBlock()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "mismatch with deployed address")
+
+	// contract deployment failed
+	monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *types.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		return nil, 0, true, nil, deployedAddr
+	})
+	err = ImportGenesisBlock()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "execution reverted")
+}
+
+// test build genesis config from spec
+func TestBuildGenesisConfig(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	spec, err := LoadGenesisSpec("testdata/genesis_spec.yaml")
+	assert.Nil(err)
+	assert.Equal(2, len(spec.Validators))
+	assert.Equal(int64(2000), spec.Consensus.BlockInterval)
+
+	monkey.Patch(compiler.CompileSolidity, func(string, ...string) (map[string]*compiler.Contract, error) {
+		return map[string]*compiler.Contract{
+			"../scripts/contracts/Voting.sol:ElectionManage": {
+				Code: "0x6080604052",
+			},
+		}, nil
+	})
+	genesis, err := BuildGenesisConfig(spec)
+	assert.Nil(err)
+	assert.Equal(GenesisVersion2, genesis.Version)
+	assert.Equal(uint64(1), genesis.Rules.ChainId)
+	assert.Equal(2, len(genesis.Rules.Validators))
+	assert.Equal(big.NewInt(50000), genesis.Alloc[0].Balance)
+	assert.Equal("6080604052", genesis.SystemContracts[0].Code)
+	assert.Equal(types.JustitiaVoting, genesis.SystemContracts[0].Contract)
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 0), tools.HexToAddress(genesis.SystemContracts[0].Addr))
+
+	spec.Contracts[0].Name = "Unknown"
+	_, err = BuildGenesisConfig(spec)
+	assert.NotNil(err)
+}
+
+func TestOffsetAddr(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("tcp://0.0.0.0:46670", OffsetAddr("tcp://0.0.0.0:46660", 10))
+	assert.Equal(46660, AddrPort("tcp://0.0.0.0:46660"))
+}
+
+// test chain meta derived from stored chain on first start and checked later
+func TestCheckChainMeta(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	storedGenesis := &types.Block{
+		Header: &types.Header{
+			Height:  0,
+			ChainID: 1,
+		},
+	}
+	currentBlock := &types.Block{
+		Header: &types.Header{
+			Height: 1,
+		},
+	}
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return currentBlock
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(*repository.Repository, uint64) (*types.Block, error) {
+		return storedGenesis, nil
+	})
+	records := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Put", func(_ *repository.Repository, key []byte, value []byte) error {
+		records[string(key)] = value
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Get", func(_ *repository.Repository, key []byte) ([]byte, error) {
+		if value, ok := records[string(key)]; ok {
+			return value, nil
+		}
+		return nil, errors.New("not found")
+	})
+	genesisHash := justitiac.HeaderHash(storedGenesis)
+	monkey.Patch(GenesisHash, func() (types.Hash, error) {
+		return genesisHash, nil
+	})
+	monkey.Patch(GetChainIdFromConfig, func() (uint64, error) {
+		return 1, nil
+	})
+	nodeConf := NodeConfig{}
+	nodeConf.AlgorithmConf.HashAlgorithm = "SHA256"
+	assert.Nil(CheckChainMeta(nodeConf))
+	stored, err := ReadChainMeta(chain)
+	assert.Nil(err)
+	assert.Equal(&ChainMeta{GenesisHash: fmt.Sprintf("0x%x", genesisHash), ChainId: 1, HashAlgorithm: "SHA256"}, stored)
+	// genesis is not rebuilt if genesis file is unchanged
+	monkey.Patch(GenesisHash, func() (types.Hash, error) {
+		return types.Hash{}, errors.New("genesis should not be rebuilt")
+	})
+	assert.Nil(CheckChainMeta(nodeConf))
+
+	// configured chain mismatch with the stored one
+	monkey.Patch(GetChainIdFromConfig, func() (uint64, error) {
+		return 2, nil
+	})
+	nodeConf.AlgorithmConf.HashAlgorithm = "SHA3"
+	err = CheckChainMeta(nodeConf)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "chain id: stored 1, configured 2")
+	assert.Contains(err.Error(), "hash algorithm: stored SHA256, configured SHA3")
+
+	// the stored chain is recorded on first start, even if the configured one is different
+	records = make(map[string][]byte)
+	monkey.Patch(GenesisHash, func() (types.Hash, error) {
+		return types.Hash{1}, nil
+	})
+	err = CheckChainMeta(nodeConf)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "genesis hash: stored")
+	stored, err = ReadChainMeta(chain)
+	assert.Nil(err)
+	assert.Equal(fmt.Sprintf("0x%x", genesisHash), stored.GenesisHash)
+	assert.Equal(uint64(1), stored.ChainId)
+
+	// current block hashed by another algorithm
+	records = make(map[string][]byte)
+	currentBlock.HeaderHash = types.Hash{1}
+	err = CheckChainMeta(nodeConf)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "hashed by another algorithm")
+}
+
+// test builtin contract code read from artifact cache
+func TestBuiltinContractCode(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	home, err := ioutil.TempDir("", "artifacts")
+	assert.Nil(err)
+	defer os.RemoveAll(home)
+	monkey.Patch(tools.Home, func() (string, error) {
+		return home, nil
+	})
+	sourcePath := filepath.Join(home, "Test.sol")
+	source := []byte("pragma solidity ^0.4.25;\ncontract Test {}\n")
+	assert.Nil(ioutil.WriteFile(sourcePath, source, 0644))
+	monkey.Patch(compiler.SourcePath, func(string) (string, error) {
+		return sourcePath, nil
+	})
+	monkey.Patch(compiler.SolidityVersion, func(string) (*compiler.Solidity, error) {
+		t.Fatal("solc should not be invoked when loading genesis")
+		return nil, nil
+	})
+
+	_, err = builtinContractCode("Test")
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "justitia contracts build")
+
+	// built by another solc version
+	key, err := compiler.ArtifactKey(source, "0.4.24", compiler.DefaultArtifactOptions)
+	assert.Nil(err)
+	_, err = compiler.NewArtifactCache(ArtifactPath()).Put(&compiler.Artifact{
+		Contract: "Test",
+		Key:      key,
+		Code:     "6080604052",
+	})
+	assert.Nil(err)
+	_, err = builtinContractCode("Test")
+	assert.NotNil(err)
+
+	key, err = compiler.ArtifactKey(source, compiler.BuiltinSolidityVersion, compiler.DefaultArtifactOptions)
+	assert.Nil(err)
+	_, err = compiler.NewArtifactCache(ArtifactPath()).Put(&compiler.Artifact{
+		Contract: "Test",
+		Key:      key,
+		Code:     "6080604052",
+	})
+	assert.Nil(err)
+	code, err := builtinContractCode("Test")
+	assert.Nil(err)
+	assert.Equal("6080604052", code)
+
+	// source changed after artifact built
+	assert.Nil(ioutil.WriteFile(sourcePath, []byte("contract Test { uint a; }"), 0644))
+	_, err = builtinContractCode("Test")
+	assert.NotNil(err)
+}
+
+// test get genesis contract address from genesis file
+func TestGenesisContractAddress(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "genesis")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	genesisPath := filepath.Join(dir, GenesisFileName)
+	monkey.Patch(genesisFilePath, func() string {
+		return genesisPath
+	})
+	monkey.Patch(GenerateGenesisBlock, func() (*GenesisBlock, error) {
+		t.Fatal("genesis block should not be built to get contract address")
+		return nil, nil
+	})
+
+	// address derived from the deploying order of genesis file without recorded addresses
+	genesis, err := readGenesisConfig("testdata/genesis_v2.json")
+	assert.Nil(err)
+	genesis.SystemContracts = append(genesis.SystemContracts, GenesisAccountConfig{Contract: types.JustitiaMetaData, Code: "6080604052"})
+	assert.Nil(WriteGenesisConfig(genesis, genesisPath))
+	addr, err := GenesisContractAddress(types.JustitiaVoting)
+	assert.Nil(err)
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 0), addr)
+	addr, err = GenesisContractAddress(types.JustitiaMetaData)
+	assert.Nil(err)
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 1), addr)
+	_, err = GenesisContractAddress(types.JustitiaWhiteList)
+	assert.NotNil(err)
+
+	// address recorded in genesis file
+	declared := "0x47e9fbef8c83a1714f1951f142132e6e90f5fa5d"
+	genesis.SystemContracts[0].Addr = declared
+	assert.Nil(WriteGenesisConfig(genesis, genesisPath))
+	addr, err = GenesisContractAddress(types.JustitiaVoting)
+	assert.Nil(err)
+	assert.Equal(tools.HexToAddress(declared), addr)
+}
+
+// test contracts compiled once and stored in genesis file
+func TestCompileGenesisFile(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "genesis")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	artifact := `{"_format": "hh-sol-artifact-1", "contractName": "Token", "sourceName": "contracts/Token.sol", "abi": [], "bytecode": "0x6080604052", "deployedBytecode": "0x6080"}`
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "Token.json"), []byte(artifact), 0644))
+	genesis, err := readGenesisConfig("testdata/genesis_v2.json")
+	assert.Nil(err)
+	genesis.SystemContracts = append(genesis.SystemContracts, GenesisAccountConfig{Contract: types.JustitiaMetaData, Source: "Token.json"})
+	genesisPath := filepath.Join(dir, GenesisFileName)
+	assert.Nil(WriteGenesisConfig(genesis, genesisPath))
+	monkey.Patch(genesisFilePath, func() string {
+		return genesisPath
+	})
+
+	// source is never compiled on node start
+	_, err = GenerateGenesisBlock()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "justitia genesis compile")
+
+	assert.Nil(CompileGenesisFile(genesisPath))
+	compiled, err := readGenesisConfig(genesisPath)
+	assert.Nil(err)
+	assert.Equal("6080604052", compiled.SystemContracts[1].Code)
+	assert.Equal("Token.json", compiled.SystemContracts[1].Source)
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 0), tools.HexToAddress(compiled.SystemContracts[0].Addr))
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 1), tools.HexToAddress(compiled.SystemContracts[1].Addr))
+	assert.Equal("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b", compiled.Alloc[0].Addr)
+
+	monkey.Patch(sourceContractCode, func(GenesisAccountConfig, string) (string, error) {
+		t.Fatal("compiled source should not be compiled again")
+		return "", nil
+	})
+	block, err := GenerateGenesisBlock()
+	assert.Nil(err)
+	assert.Equal(3, len(block.GenesisAccounts))
+	assert.Equal(2, len(block.Block.Transactions))
+	assert.Equal(tools.Hex2Bytes("6080604052"), block.GenesisAccounts[2].Code)
+	addr, err := GenesisContractAddress(types.JustitiaMetaData)
+	assert.Nil(err)
+	assert.Equal(justitiac.CreateAddress(types.Address{}, 1), addr)
+}
+
+// test contract code loaded from the source declared in genesis account
+func TestSourceContractCode(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "genesis")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	artifact := `{"_format": "hh-sol-artifact-1", "contractName": "Token", "sourceName": "contracts/Token.sol", "abi": [], "bytecode": "0x6080604052", "deployedBytecode": "0x6080"}`
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "Token.json"), []byte(artifact), 0644))
+
+	code, err := sourceContractCode(GenesisAccountConfig{Source: "Token.json"}, dir)
+	assert.Nil(err)
+	assert.Equal("6080604052", code)
+	code, err = sourceContractCode(GenesisAccountConfig{Source: "Token.json", Compiler: compiler.ArtifactCompiler, Contract: "Token"}, dir)
+	assert.Nil(err)
+	assert.Equal("6080604052", code)
+
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "Token.json", Contract: "Voting"}, dir)
+	assert.NotNil(err)
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "NotExist.json"}, dir)
+	assert.NotNil(err)
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "Token.json", Compiler: "llvm"}, dir)
+	assert.NotNil(err)
+
+	// compiler version must be pinned for the sources compiled by solc or vyper
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "Token.vy"}, dir)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "compilerVersion")
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "Token.sol", Contract: "Token"}, dir)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "compilerVersion")
+	_, err = sourceContractCode(GenesisAccountConfig{Source: "Token.vy", CompilerVersion: "0.0.0"}, dir)
+	assert.NotNil(err)
+}
@@ -0,0 +1,252 @@
+package governance
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools/clock"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// time to wait for the parent of a block to be committed before verifying it
+const parentCommitTimeout = 30 * time.Second
+
+// Params is the set of chain parameters controlled by the MetaData system contract.
+type Params struct {
+	// block interval in millisecond
+	BlockInterval int64
+	// max number of txs in a block
+	TxsPerBlock uint64
+	// whether to produce block without txs
+	EnableEmptyBlock bool
+}
+
+// ChainParams get the chain parameters set in the MetaData system contract. The parameters set
+// on the state of block H take effect from block H+1, and the local setting is used for the
+// parameters never set in the contract.
+type ChainParams struct {
+	chain    common.Chain
+	metaData types.Address
+	local    Params
+	lock     sync.Mutex
+	// height of the block whose state the cached params are read from
+	height uint64
+	loaded bool
+	params Params
+	// whether the cached txs per block is set in the contract
+	txsPerBlockSet bool
+	clock          clock.Clock
+	// closed when a block is committed, so that the blocks waiting for their parent are verified
+	committed chan struct{}
+}
+
+// NewChainParams create the chain parameters read from MetaData contract on chain, local is the
+// setting in config file.
+func NewChainParams(chain common.Chain, metaData types.Address, local Params, clock clock.Clock) *ChainParams {
+	return &ChainParams{
+		chain:     chain,
+		metaData:  metaData,
+		local:     local,
+		params:    local,
+		clock:     clock,
+		committed: make(chan struct{}),
+	}
+}
+
+// BlockEventFunc get a EventFunc that can be bound to event center, it wakes up the blocks
+// waiting for their parent to be committed.
+func (chainParams *ChainParams) BlockEventFunc(event interface{}) {
+	chainParams.lock.Lock()
+	defer chainParams.lock.Unlock()
+	close(chainParams.committed)
+	chainParams.committed = make(chan struct{})
+}
+
+// Check whether the MetaData contract deployed can answer getParam on the latest state.
+func (chainParams *ChainParams) Check() error {
+	metaData, err := syscontract.NewMetaData(chainParams.metaData, syscontract.NewStateCaller(chainParams.chain, types.Address{}), nil)
+	if err != nil {
+		return err
+	}
+	if _, _, err := getParam(metaData, syscontract.BlockIntervalParam); err != nil {
+		return fmt.Errorf("contract %x does not implement getParam(uint256), as: %v", chainParams.metaData, err)
+	}
+	return nil
+}
+
+// Params get the chain parameters of the block at height.
+func (chainParams *ChainParams) Params(height uint64) (Params, error) {
+	chainParams.lock.Lock()
+	defer chainParams.lock.Unlock()
+	if 0 == height {
+		return chainParams.local, nil
+	}
+	if err := chainParams.load(height); err != nil {
+		return chainParams.params, err
+	}
+	return chainParams.params, nil
+}
+
+// load the parameters of the block at height into cache.
+func (chainParams *ChainParams) load(height uint64) error {
+	if chainParams.loaded && height-1 == chainParams.height {
+		return nil
+	}
+	params, txsPerBlockSet, err := chainParams.paramsAt(height - 1)
+	if err != nil {
+		return err
+	}
+	if !chainParams.loaded || height-1 > chainParams.height {
+		logChanges(height, chainParams.params, params)
+	}
+	chainParams.height, chainParams.params, chainParams.loaded = height-1, params, true
+	chainParams.txsPerBlockSet = txsPerBlockSet
+	return nil
+}
+
+// VerifyBlock check the block against the chain parameters of its height. Txs per block is
+// checked only if it is set in the contract, as the local setting differs between nodes.
+func (chainParams *ChainParams) VerifyBlock(block *types.Block) error {
+	height := block.Header.Height
+	if 0 == height {
+		return nil
+	}
+	chainParams.lock.Lock()
+	defer chainParams.lock.Unlock()
+	if err := chainParams.load(height); err != nil {
+		return fmt.Errorf("failed to get chain parameters of block %d, as: %v", height, err)
+	}
+	txs := uint64(len(block.Transactions))
+	if chainParams.txsPerBlockSet && txs > chainParams.params.TxsPerBlock {
+		return fmt.Errorf("block %d has %d txs, exceeds chain parameter txs per block %d", height, txs, chainParams.params.TxsPerBlock)
+	}
+	if !chainParams.params.EnableEmptyBlock && 0 == txs {
+		return fmt.Errorf("block %d has no txs while chain parameter disables empty block", height)
+	}
+	return nil
+}
+
+// waitParent block until the parent of block at height is committed, as the chain parameters of
+// block are read from the state of its parent. The blocks are forwarded to the in-port in order,
+// so the parent has been forwarded before, and an error is returned if it is not committed in time.
+func (chainParams *ChainParams) waitParent(height uint64) error {
+	if 0 == height {
+		return nil
+	}
+	timer := chainParams.clock.NewTimer(parentCommitTimeout)
+	defer timer.Stop()
+	for {
+		chainParams.lock.Lock()
+		committed := chainParams.committed
+		chainParams.lock.Unlock()
+		if chainParams.hasBlock(height - 1) {
+			return nil
+		}
+		select {
+		case <-committed:
+		case <-timer.C():
+			return fmt.Errorf("parent block %d is not committed in %v", height-1, parentCommitTimeout)
+		}
+	}
+}
+
+// check whether the block at height is committed.
+func (chainParams *ChainParams) hasBlock(height uint64) bool {
+	chain, err := chainParams.chain.Latest()
+	if err != nil {
+		return false
+	}
+	_, err = chain.GetBlockByHeight(height)
+	return nil == err
+}
+
+// Wrap returns a channel in front of the block switch in-port channel, the blocks sent to it are
+// forwarded to the in-port only if they are verified by VerifyBlock, otherwise rejected is called.
+// The blocks are verified after their parent committed, so that the blocks synced in a row are
+// not rejected while their parent is still being committed by the switch.
+func (chainParams *ChainParams) Wrap(in chan<- interface{}, rejected func(block *types.Block, err error)) chan<- interface{} {
+	ch := make(chan interface{}, cap(in))
+	go func() {
+		for msg := range ch {
+			if block, ok := msg.(*types.Block); ok {
+				if err := chainParams.waitParent(block.Header.Height); err != nil {
+					rejected(block, err)
+					continue
+				}
+				if err := chainParams.VerifyBlock(block); err != nil {
+					rejected(block, err)
+					continue
+				}
+			}
+			in <- msg
+		}
+	}()
+	return ch
+}
+
+// read the parameters on the state of block at height, and whether txs per block is set in the contract.
+func (chainParams *ChainParams) paramsAt(height uint64) (Params, bool, error) {
+	chain, err := chainParams.chain.Latest()
+	if err != nil {
+		return Params{}, false, fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	block, err := chain.GetBlockByHeight(height)
+	if err != nil {
+		return Params{}, false, fmt.Errorf("failed to get block %d, as: %v", height, err)
+	}
+	caller := syscontract.NewStateCallerAt(chainParams.chain, types.Address{}, common.HeaderHash(block))
+	metaData, err := syscontract.NewMetaData(chainParams.metaData, caller, nil)
+	if err != nil {
+		return Params{}, false, err
+	}
+	params := chainParams.local
+	value, set, err := getParam(metaData, syscontract.BlockIntervalParam)
+	if err != nil {
+		return Params{}, false, err
+	}
+	if set {
+		params.BlockInterval = int64(value)
+	}
+	if value, set, err = getParam(metaData, syscontract.TxsPerBlockParam); err != nil {
+		return Params{}, false, err
+	}
+	txsPerBlockSet := set
+	if set {
+		params.TxsPerBlock = value
+	}
+	if value, set, err = getParam(metaData, syscontract.EnableEmptyBlockParam); err != nil {
+		return Params{}, false, err
+	}
+	if set {
+		params.EnableEmptyBlock = value != 0
+	}
+	return params, txsPerBlockSet, nil
+}
+
+func getParam(metaData *syscontract.MetaData, paramId int64) (uint64, bool, error) {
+	value, set, err := metaData.GetParam(big.NewInt(paramId))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get chain parameter %d, as: %v", paramId, err)
+	}
+	if !value.IsUint64() {
+		return 0, false, fmt.Errorf("chain parameter %d overflow: %v", paramId, value)
+	}
+	return value.Uint64(), set, nil
+}
+
+// log the parameters changed at height.
+func logChanges(height uint64, old, new Params) {
+	if old.BlockInterval != new.BlockInterval {
+		log.Info("chain parameter block interval changes from %d to %d at height %d", old.BlockInterval, new.BlockInterval, height)
+	}
+	if old.TxsPerBlock != new.TxsPerBlock {
+		log.Info("chain parameter txs per block changes from %d to %d at height %d", old.TxsPerBlock, new.TxsPerBlock, height)
+	}
+	if old.EnableEmptyBlock != new.EnableEmptyBlock {
+		log.Info("chain parameter enable empty block changes from %v to %v at height %d", old.EnableEmptyBlock, new.EnableEmptyBlock, height)
+	}
+}
@@ -0,0 +1,185 @@
+package governance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/abi"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var metaDataAddr = types.Address{0x20}
+
+// mock the chain parameters set in MetaData contract at each block, keyed by block height and param id
+func mockMetaData(params map[uint64]map[int64]uint64) {
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if _, ok := params[height]; !ok {
+			return nil, fmt.Errorf("block %d not found", height)
+		}
+		return &types.Block{Header: &types.Header{Height: height}, HeaderHash: types.Hash{byte(height)}}, nil
+	})
+	var height uint64
+	monkey.Patch(syscontract.NewStateCallerAt, func(_ common.Chain, _ types.Address, hash types.Hash) *syscontract.StateCaller {
+		height = uint64(hash[0])
+		return &syscontract.StateCaller{}
+	})
+	parsed, _ := abi.JSON(strings.NewReader(syscontract.MetaDataABI))
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.StateCaller{}), "Call", func(_ *syscontract.StateCaller, _ types.Address, input []byte) ([]byte, error) {
+		method, err := parsed.MethodByID(input)
+		if err != nil || "getParam" != method.Name {
+			return nil, errors.New("execution reverted")
+		}
+		args, _ := method.Inputs.Unpack(input[4:])
+		value, set := params[height][args[0].(*big.Int).Int64()]
+		return method.Outputs.Pack(new(big.Int).SetUint64(value), set)
+	})
+}
+
+func TestChainParams_Params(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockMetaData(map[uint64]map[int64]uint64{
+		0: {},
+		1: {syscontract.TxsPerBlockParam: 10},
+		2: {syscontract.TxsPerBlockParam: 10, syscontract.BlockIntervalParam: 500, syscontract.EnableEmptyBlockParam: 0},
+	})
+	local := Params{BlockInterval: 2000, TxsPerBlock: 512, EnableEmptyBlock: true}
+	chainParams := NewChainParams(common.ProcessChain, metaDataAddr, local, clock.NewSystemClock())
+
+	params, err := chainParams.Params(1)
+	assert.Nil(err)
+	assert.Equal(local, params)
+
+	// set at 1, take effect from 2
+	params, err = chainParams.Params(2)
+	assert.Nil(err)
+	assert.Equal(Params{BlockInterval: 2000, TxsPerBlock: 10, EnableEmptyBlock: true}, params)
+
+	params, err = chainParams.Params(3)
+	assert.Nil(err)
+	assert.Equal(Params{BlockInterval: 500, TxsPerBlock: 10, EnableEmptyBlock: false}, params)
+
+	// the last known params are returned if block not found
+	params, err = chainParams.Params(4)
+	assert.NotNil(err)
+	assert.Equal(int64(500), params.BlockInterval)
+}
+
+func TestChainParams_VerifyBlock(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockMetaData(map[uint64]map[int64]uint64{
+		0: {},
+		1: {syscontract.TxsPerBlockParam: 1, syscontract.EnableEmptyBlockParam: 0},
+	})
+	chainParams := NewChainParams(common.ProcessChain, metaDataAddr, Params{BlockInterval: 2000, TxsPerBlock: 0, EnableEmptyBlock: true}, clock.NewSystemClock())
+	block := func(height uint64, txs int) *types.Block {
+		return &types.Block{Header: &types.Header{Height: height}, Transactions: make([]*types.Transaction, txs)}
+	}
+
+	// txs per block of local setting is not checked, empty block enabled
+	assert.Nil(chainParams.VerifyBlock(block(1, 0)))
+	assert.Nil(chainParams.VerifyBlock(block(1, 2)))
+
+	// txs per block and empty block policy set at 1
+	assert.Nil(chainParams.VerifyBlock(block(2, 1)))
+	assert.NotNil(chainParams.VerifyBlock(block(2, 2)))
+	assert.NotNil(chainParams.VerifyBlock(block(2, 0)))
+
+	// parameters of block 3 are unknown
+	assert.NotNil(chainParams.VerifyBlock(block(3, 1)))
+
+	in := make(chan interface{}, 2)
+	rejected := make(chan *types.Block, 1)
+	ch := chainParams.Wrap(in, func(block *types.Block, err error) {
+		rejected <- block
+	})
+	ch <- block(2, 2)
+	ch <- block(2, 1)
+	assert.Equal(2, len((<-rejected).Transactions))
+	assert.Equal(1, len((<-in).(*types.Block).Transactions))
+	close(ch)
+}
+
+// test the blocks synced in a row are verified after their parent committed
+func TestChainParams_WrapInRow(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	params := make(map[uint64]map[int64]uint64)
+	for height := uint64(0); height <= 8; height++ {
+		params[height] = map[int64]uint64{syscontract.TxsPerBlockParam: 1}
+	}
+	mockMetaData(params)
+	var committedHeight uint64
+	monkey.PatchInstanceMethod(reflect.TypeOf(&repository.Repository{}), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if height > atomic.LoadUint64(&committedHeight) {
+			return nil, fmt.Errorf("block %d not found", height)
+		}
+		return &types.Block{Header: &types.Header{Height: height}, HeaderHash: types.Hash{byte(height)}}, nil
+	})
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	chainParams := NewChainParams(common.ProcessChain, metaDataAddr, Params{EnableEmptyBlock: true}, virtualClock)
+	block := func(height uint64, txs int) *types.Block {
+		return &types.Block{Header: &types.Header{Height: height}, Transactions: make([]*types.Transaction, txs)}
+	}
+
+	in := make(chan interface{}, 8)
+	rejected := make(chan *types.Block, 8)
+	ch := chainParams.Wrap(in, func(block *types.Block, err error) {
+		rejected <- block
+	})
+	defer close(ch)
+	for height := uint64(1); height <= 5; height++ {
+		ch <- block(height, 1)
+	}
+	ch <- block(6, 2)
+	ch <- block(6, 1)
+	// the switch commits the blocks one by one
+	for height := uint64(1); height <= 6; height++ {
+		committed := (<-in).(*types.Block)
+		assert.Equal(height, committed.Header.Height)
+		assert.Equal(1, len(committed.Transactions))
+		atomic.StoreUint64(&committedHeight, height)
+		chainParams.BlockEventFunc(nil)
+		if 5 == height {
+			assert.Equal(2, len((<-rejected).Transactions))
+		}
+	}
+	assert.Equal(0, len(rejected))
+
+	// the block whose parent is never committed is rejected after timeout
+	ch <- block(8, 1)
+	virtualClock.BlockUntil(1)
+	virtualClock.Advance(parentCommitTimeout)
+	assert.Equal(uint64(8), (<-rejected).Header.Height)
+	assert.Equal(0, len(in))
+}
+
+func TestChainParams_Check(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockMetaData(map[uint64]map[int64]uint64{0: {}})
+	chainParams := NewChainParams(common.ProcessChain, metaDataAddr, Params{}, clock.NewSystemClock())
+	assert.Nil(chainParams.Check())
+
+	// contract without getParam
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.StateCaller{}), "Call", func(_ *syscontract.StateCaller, _ types.Address, input []byte) ([]byte, error) {
+		return nil, errors.New("execution reverted")
+	})
+	assert.NotNil(chainParams.Check())
+}
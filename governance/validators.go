@@ -0,0 +1,205 @@
+// Package governance applies the results of on-chain governance by system contracts to the node.
+package governance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/validator/tools/account"
+	"sync"
+)
+
+// ValidatorsChange is the value of common.EventValidatorsChanged.
+type ValidatorsChange struct {
+	// height of the first block produced by the validators
+	Height     uint64
+	Validators []account.Account
+}
+
+// ValidatorSet get the validators elected by the Voting system contract. The validators elected
+// on the state of epoch boundary block H take effect from block H+1, so that all nodes switch
+// validators at the same height. The elected validators are recorded in repository once they are
+// read from the boundary state, as the state of past boundaries may be pruned or never synced.
+type ValidatorSet struct {
+	chain   common.Chain
+	epoch   uint64
+	voting  types.Address
+	genesis []account.Account
+	lock    sync.Mutex
+	// boundary height of the cached validators
+	boundary   uint64
+	validators []account.Account
+}
+
+// NewValidatorSet create a validator set of chain switching validators every epoch blocks, the
+// genesis validators are used before the first epoch boundary.
+func NewValidatorSet(chain common.Chain, epoch uint64, voting types.Address, genesis []account.Account) (*ValidatorSet, error) {
+	if 0 == epoch {
+		return nil, errors.New("epoch of validator set must be positive")
+	}
+	return &ValidatorSet{
+		chain:      chain,
+		epoch:      epoch,
+		voting:     voting,
+		genesis:    genesis,
+		boundary:   0,
+		validators: genesis,
+	}, nil
+}
+
+// IsBoundary check whether the block at height is an epoch boundary.
+func (set *ValidatorSet) IsBoundary(height uint64) bool {
+	return height > 0 && 0 == height%set.epoch
+}
+
+// Boundary get the epoch boundary height, whose elected validators take effect at height.
+func (set *ValidatorSet) Boundary(height uint64) uint64 {
+	if 0 == height {
+		return 0
+	}
+	return (height - 1) / set.epoch * set.epoch
+}
+
+// Validators get the validators of the block at height.
+func (set *ValidatorSet) Validators(height uint64) ([]account.Account, error) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	boundary := set.Boundary(height)
+	if boundary != set.boundary {
+		validators, err := set.electedAt(boundary)
+		if err != nil {
+			return nil, err
+		}
+		if boundary > set.boundary && !SameValidators(set.validators, validators) {
+			log.Info("validators change at height %d, elected at height %d: %v", boundary+1, boundary, validators)
+		}
+		set.boundary, set.validators = boundary, validators
+	}
+	return append(make([]account.Account, 0, len(set.validators)), set.validators...), nil
+}
+
+// get the validators elected at boundary, the validators of previous epoch are kept if
+// no validator is elected.
+func (set *ValidatorSet) electedAt(boundary uint64) ([]account.Account, error) {
+	if 0 == boundary {
+		return set.genesis, nil
+	}
+	chain, err := set.chain.Latest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	validators, err := ReadElected(chain, boundary)
+	if err != nil || nil != validators {
+		return validators, err
+	}
+	block, err := chain.GetBlockByHeight(boundary)
+	if err != nil {
+		return nil, fmt.Errorf("validators elected at height %d are not recorded, and failed to get the block, as: %v", boundary, err)
+	}
+	caller := syscontract.NewStateCallerAt(set.chain, types.Address{}, common.HeaderHash(block))
+	voting, err := syscontract.NewVoting(set.voting, caller, nil)
+	if err != nil {
+		return nil, err
+	}
+	if validators, err = ElectedValidators(voting); err != nil {
+		return nil, fmt.Errorf("failed to get validators elected at height %d, as: %v", boundary, err)
+	}
+	if 0 == len(validators) {
+		log.Warn("no validator elected at height %d, keep the validators of previous epoch", boundary)
+		if validators, err = set.electedAt(boundary - set.epoch); err != nil {
+			return nil, err
+		}
+	}
+	if err := WriteElected(chain, boundary, validators); err != nil {
+		return nil, err
+	}
+	return validators, nil
+}
+
+// key of the validators elected at boundary in repository
+func electedKey(boundary uint64) []byte {
+	return []byte(fmt.Sprintf("justitia-elected-validators-%d", boundary))
+}
+
+// ReadElected read the validators elected at boundary from repository, nil if they have not been recorded.
+func ReadElected(store config.MetaStore, boundary uint64) ([]account.Account, error) {
+	data, err := store.Get(electedKey(boundary))
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+	validators := make([]account.Account, 0)
+	if err := json.Unmarshal(data, &validators); err != nil {
+		return nil, fmt.Errorf("failed to parse validators elected at height %d, as: %v", boundary, err)
+	}
+	return validators, nil
+}
+
+// WriteElected record the validators elected at boundary in repository.
+func WriteElected(store config.MetaStore, boundary uint64, validators []account.Account) error {
+	data, err := json.Marshal(validators)
+	if err != nil {
+		return fmt.Errorf("failed to encode validators elected at height %d, as: %v", boundary, err)
+	}
+	if err := store.Put(electedKey(boundary), data); err != nil {
+		return fmt.Errorf("failed to write validators elected at height %d, as: %v", boundary, err)
+	}
+	return nil
+}
+
+// FindValidator find the validator with the address.
+func FindValidator(validators []account.Account, address types.Address) (account.Account, bool) {
+	for _, validator := range validators {
+		if validator.Address == address {
+			return validator, true
+		}
+	}
+	return account.Account{}, false
+}
+
+// ElectedValidators get the candidates ranked top totalNodes in the Voting contract.
+func ElectedValidators(voting *syscontract.Voting) ([]account.Account, error) {
+	total, err := voting.TotalNodes()
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := voting.Candidates()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(candidates)) < total {
+		total = uint64(len(candidates))
+	}
+	validators := make([]account.Account, 0, total)
+	for ranking := uint64(0); ranking < total; ranking++ {
+		address, url, id, err := voting.GetCandidateByRanking(ranking)
+		if err != nil {
+			return nil, err
+		}
+		validators = append(validators, account.Account{
+			Address: address,
+			Extension: account.AccountExtension{
+				Id:  id,
+				Url: url,
+			},
+		})
+	}
+	return validators, nil
+}
+
+// SameValidators check whether the validators are the same, including their order.
+func SameValidators(a, b []account.Account) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Address != b[i].Address || a[i].Extension.Id != b[i].Extension.Id || a[i].Extension.Url != b[i].Extension.Url {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package governance
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/abi"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/tools/account"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var votingAddr = types.Address{0x10}
+
+var genesisValidators = []account.Account{
+	{Address: types.Address{0x01}, Extension: account.AccountExtension{Id: 0, Url: "127.0.0.1:8080"}},
+}
+
+// mock the Voting contract state at each block, keyed by block height, returns the records in repository
+func mockVoting(candidates map[uint64][]types.Address) map[string][]byte {
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	records := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Put", func(_ *repository.Repository, key []byte, value []byte) error {
+		records[string(key)] = value
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Get", func(_ *repository.Repository, key []byte) ([]byte, error) {
+		return records[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if _, ok := candidates[height]; !ok {
+			return nil, fmt.Errorf("block %d not found", height)
+		}
+		return &types.Block{Header: &types.Header{Height: height}, HeaderHash: types.Hash{byte(height)}}, nil
+	})
+	var height uint64
+	monkey.Patch(syscontract.NewStateCallerAt, func(_ common.Chain, _ types.Address, hash types.Hash) *syscontract.StateCaller {
+		height = uint64(hash[0])
+		return &syscontract.StateCaller{}
+	})
+	parsed, _ := abi.JSON(strings.NewReader(syscontract.VotingABI))
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.StateCaller{}), "Call", func(_ *syscontract.StateCaller, _ types.Address, input []byte) ([]byte, error) {
+		method, err := parsed.MethodByID(input)
+		if err != nil {
+			return nil, err
+		}
+		elected := candidates[height]
+		switch method.Name {
+		case "totalNodes":
+			return method.Outputs.Pack(big.NewInt(2))
+		case "Candidates":
+			return method.Outputs.Pack(elected)
+		case "GetCandidateByRanking":
+			args, _ := method.Inputs.Unpack(input[4:])
+			ranking := args[0].(*big.Int).Uint64()
+			return method.Outputs.Pack(elected[ranking], big.NewInt(int64(ranking)), fmt.Sprintf("127.0.0.1:%d", 8080+ranking))
+		}
+		return nil, errors.New("execution reverted")
+	})
+	return records
+}
+
+func TestValidatorSet_Boundary(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewValidatorSet(common.ProcessChain, 0, votingAddr, genesisValidators)
+	assert.NotNil(err)
+	set, err := NewValidatorSet(common.ProcessChain, 10, votingAddr, genesisValidators)
+	assert.Nil(err)
+	assert.False(set.IsBoundary(0))
+	assert.False(set.IsBoundary(9))
+	assert.True(set.IsBoundary(10))
+	assert.Equal(uint64(0), set.Boundary(1))
+	assert.Equal(uint64(0), set.Boundary(10))
+	assert.Equal(uint64(10), set.Boundary(11))
+	assert.Equal(uint64(10), set.Boundary(20))
+	assert.Equal(uint64(20), set.Boundary(21))
+}
+
+func TestValidatorSet_Validators(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	a, b, c := types.Address{0x0a}, types.Address{0x0b}, types.Address{0x0c}
+	records := mockVoting(map[uint64][]types.Address{
+		10: {a, b, c},
+		20: {},
+	})
+	set, err := NewValidatorSet(common.ProcessChain, 10, votingAddr, genesisValidators)
+	assert.Nil(err)
+
+	// genesis validators before the first epoch boundary
+	validators, err := set.Validators(10)
+	assert.Nil(err)
+	assert.Equal(genesisValidators, validators)
+
+	// validators elected at 10 take effect from 11, limited by total nodes
+	validators, err = set.Validators(11)
+	assert.Nil(err)
+	assert.Equal(2, len(validators))
+	assert.Equal(a, validators[0].Address)
+	assert.Equal(uint64(1), validators[1].Extension.Id)
+	assert.Equal("127.0.0.1:8081", validators[1].Extension.Url)
+	assert.False(SameValidators(genesisValidators, validators))
+
+	// no validator elected at 20, keep the validators elected at 10
+	elected, err := set.Validators(21)
+	assert.Nil(err)
+	assert.True(SameValidators(validators, elected))
+
+	// block of boundary not found
+	_, err = set.Validators(31)
+	assert.NotNil(err)
+
+	// the elected validators are recorded, and read without the state of boundary
+	assert.Equal(2, len(records))
+	recorded, err := ReadElected(&repository.Repository{}, 20)
+	assert.Nil(err)
+	assert.True(SameValidators(validators, recorded))
+	records[string(electedKey(30))] = records[string(electedKey(10))]
+	set, err = NewValidatorSet(common.ProcessChain, 10, votingAddr, genesisValidators)
+	assert.Nil(err)
+	elected, err = set.Validators(31)
+	assert.Nil(err)
+	assert.True(SameValidators(validators, elected))
+}
+
+func TestFindValidator(t *testing.T) {
+	assert := assert.New(t)
+	validator, ok := FindValidator(genesisValidators, types.Address{0x01})
+	assert.True(ok)
+	assert.Equal(genesisValidators[0], validator)
+	_, ok = FindValidator(genesisValidators, types.Address{0x02})
+	assert.False(ok)
+}
+
+func TestSameValidators(t *testing.T) {
+	assert := assert.New(t)
+	a := account.Account{Address: types.Address{0x0a}, Extension: account.AccountExtension{Id: 1}}
+	b := account.Account{Address: types.Address{0x0b}, Extension: account.AccountExtension{Id: 2}}
+	assert.True(SameValidators([]account.Account{a, b}, []account.Account{a, b}))
+	assert.False(SameValidators([]account.Account{a, b}, []account.Account{b, a}))
+	assert.False(SameValidators([]account.Account{a}, []account.Account{a, b}))
+}
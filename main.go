@@ -2,7 +2,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/justitia/cmd"
 	"github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/config"
 	"github.com/DSiSc/justitia/node"
@@ -46,6 +48,13 @@ func argsParse() config.SysConfig {
 }
 
 func main() {
+	if len(os.Args) > 1 && cmd.IsCommand(os.Args[1]) {
+		if err := cmd.Run(os.Args[1:]); nil != err {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	node, err := node.NewNode(argsParse())
 	if nil != err {
 		log.Fatal("Failed to initial a node with err %v.", err)
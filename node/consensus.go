@@ -0,0 +1,80 @@
+package node
+
+import (
+	"errors"
+	"github.com/DSiSc/galaxy/consensus"
+	consensusCommon "github.com/DSiSc/galaxy/consensus/common"
+	"github.com/DSiSc/justitia/tools/clock"
+	"sync"
+	"time"
+)
+
+// errRoundTimeout is returned when the proposal is not confirmed before the round timeout.
+var errRoundTimeout = errors.New("consensus round timed out")
+
+// timedConsensus times out the consensus rounds on clock. The galaxy policies keep their timeouts
+// on wall clock, so the rounds driven by a virtual clock time out here, and the proposal not
+// confirmed in time is abandoned.
+type timedConsensus struct {
+	consensus.Consensus
+	clock   clock.Clock
+	timeout time.Duration
+}
+
+func newTimedConsensus(policy consensus.Consensus, clock clock.Clock, timeout time.Duration) *timedConsensus {
+	return &timedConsensus{
+		Consensus: policy,
+		clock:     clock,
+		timeout:   timeout,
+	}
+}
+
+// ToConsensus confirm the proposal by the consensus policy, errRoundTimeout is returned if it is not
+// confirmed before timeout. The clock held by caller is handed over to the policy, and taken back
+// with its result or the timeout.
+func (c *timedConsensus) ToConsensus(p *consensusCommon.Proposal) error {
+	var lock sync.Mutex
+	abandoned := false
+	result := make(chan error, 1)
+	timer := c.clock.NewTimer(c.timeout)
+	go func() {
+		err := c.Consensus.ToConsensus(p)
+		lock.Lock()
+		defer lock.Unlock()
+		if abandoned {
+			clock.Release(c.clock)
+			return
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		timer.Stop()
+		return err
+	case <-timer.C():
+		lock.Lock()
+		defer lock.Unlock()
+		abandoned = true
+		// confirmed while timing out, the hold of timer is not needed
+		select {
+		case err := <-result:
+			clock.Release(c.clock)
+			return err
+		default:
+		}
+		return errRoundTimeout
+	}
+}
+
+// Unwrap get the consensus policy timed out.
+func (c *timedConsensus) Unwrap() consensus.Consensus {
+	return c.Consensus
+}
+
+// get the consensus policy of node, unwrapped from the timeouts on clock.
+func policyOf(c consensus.Consensus) consensus.Consensus {
+	if timed, ok := c.(*timedConsensus); ok {
+		return timed.Unwrap()
+	}
+	return c
+}
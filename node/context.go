@@ -0,0 +1,183 @@
+package node
+
+import (
+	"errors"
+	rpc "github.com/DSiSc/apigateway/rpc/core"
+	craftConfig "github.com/DSiSc/craft/config"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/pruner"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/justitia/tools/fault"
+	"github.com/DSiSc/p2p"
+	p2pConf "github.com/DSiSc/p2p/config"
+	"github.com/DSiSc/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Context is the dependencies owned by a node instance: config, event center, clock, p2p, fault
+// injector, metrics registerer and the chain of its repository, nothing of them is shared by the
+// nodes in a process. The services of justitia read blocks and states through Chain of the context.
+//
+// The external modules keep the other dependencies in package level variables: consensus, producer,
+// block switch and syncer read the repository of repository.InitRepository, api gateway sends txs
+// to the channel of rpc.SetSwCh, and they log with the setting of log.SetGlobalConfig and hash with
+// the algorithm in craftConfig.GlobalConfig. They are bound to the process by Acquire for a node
+// to run, so a process runs one node at a time: Acquire refuses to run a second node, and the chain
+// of a context not bound returns ErrNotBound instead of the repository of another node.
+type Context struct {
+	Config      config.NodeConfig
+	EventCenter types.EventCenter
+	// time source of block interval and round timeout, a virtual clock in simulation
+	Clock clock.Clock
+	// timeout of consensus rounds on Clock, the proposal not confirmed in time is abandoned. Zero to
+	// leave the timeouts to the consensus policy, which keeps them on wall clock
+	RoundTimeout time.Duration
+	// create the p2p of name in config.BlockSyncerP2P, config.BlockP2P and config.TxP2P,
+	// a simulated network in simulation
+	NewP2P func(name string, conf *p2pConf.P2PConfig, eventCenter types.EventCenter) (p2p.P2PAPI, error)
+	// faults injected into node, nil unless fault injection is enabled in config
+	Faults *fault.Injector
+	// registerer of the metrics of node services, the prometheus server serves the default one
+	Metrics prometheus.Registerer
+	// open the handle of the state store shared by the repository, through which the states are
+	// pruned in background. nil if the repository plugin doesn't share it, then the states are
+	// only pruned at restart
+	StateDatabase func() (pruner.Database, error)
+	// channel of the tx switch in-port receiving txs from api gateway
+	swCh chan<- interface{}
+}
+
+var (
+	processLock sync.Mutex
+	// the context of the running node in process
+	processOwner *Context
+	// the context whose dependencies are bound to the process globals
+	processBound *Context
+)
+
+var (
+	// ErrProcessOwned is returned when another node is running in the process.
+	ErrProcessOwned = errors.New("another node is running in the process")
+	// ErrNotBound is returned when reading the chain of a node whose repository is not bound to the process.
+	ErrNotBound = errors.New("repository of node is not bound to the process")
+)
+
+// NewContext create the context of a node, the node config is loaded and the log and hash
+// algorithm setting are applied to the process.
+func NewContext(args config.SysConfig) *Context {
+	nodeConf := config.NewNodeConfig()
+	InitLog(args, nodeConf)
+	craftConfig.GlobalConfig.Store(craftConfig.HashAlgName, nodeConf.AlgorithmConf.HashAlgorithm)
+	ctx := &Context{
+		Config:      nodeConf,
+		EventCenter: events.NewEvent(),
+		Clock:       clock.NewSystemClock(),
+		NewP2P:      newP2P,
+		Metrics:     prometheus.DefaultRegisterer,
+	}
+	return ctx
+}
+
+// create the p2p network of node with the config.
+func newP2P(name string, conf *p2pConf.P2PConfig, eventCenter types.EventCenter) (p2p.P2PAPI, error) {
+	return p2p.NewP2P(conf, eventCenter)
+}
+
+// InitRepository init the repository of the context in process, ErrProcessOwned is returned if
+// another node is running.
+func (ctx *Context) InitRepository() error {
+	processLock.Lock()
+	defer processLock.Unlock()
+	if nil != processOwner && ctx != processOwner {
+		return ErrProcessOwned
+	}
+	processBound = nil
+	if err := repository.InitRepository(ctx.Config.RepositoryConf, ctx.EventCenter); err != nil {
+		return err
+	}
+	processBound = ctx
+	return nil
+}
+
+// Chain get the chain of the repository of context, it is readable while the context is bound to the process.
+func (ctx *Context) Chain() common.Chain {
+	return contextChain{ctx: ctx}
+}
+
+// chain of the repository bound to the process by context.
+type contextChain struct {
+	ctx *Context
+}
+
+func (chain contextChain) bound() bool {
+	processLock.Lock()
+	defer processLock.Unlock()
+	return chain.ctx == processBound
+}
+
+func (chain contextChain) Latest() (*repository.Repository, error) {
+	if !chain.bound() {
+		return nil, ErrNotBound
+	}
+	return repository.NewLatestStateRepository()
+}
+
+func (chain contextChain) At(blockHash types.Hash) (*repository.Repository, error) {
+	if !chain.bound() {
+		return nil, ErrNotBound
+	}
+	return repository.NewRepositoryByBlockHash(blockHash)
+}
+
+// SetSwCh set the channel receiving txs from api gateway, it is bound to the process unless another
+// node is running.
+func (ctx *Context) SetSwCh(swCh chan<- interface{}) {
+	processLock.Lock()
+	defer processLock.Unlock()
+	ctx.swCh = swCh
+	if nil == processOwner || ctx == processOwner {
+		rpc.SetSwCh(swCh)
+	}
+}
+
+// Acquire bind the process level dependencies of context to the process for its node to run,
+// they are bound again if another node has run in the process before. ErrProcessOwned is
+// returned if another node is running.
+func (ctx *Context) Acquire() error {
+	processLock.Lock()
+	defer processLock.Unlock()
+	if nil != processOwner && ctx != processOwner {
+		return ErrProcessOwned
+	}
+	processOwner = ctx
+	if ctx == processBound {
+		return nil
+	}
+	log.SetGlobalConfig(&ctx.Config.Logger)
+	craftConfig.GlobalConfig.Store(craftConfig.HashAlgName, ctx.Config.AlgorithmConf.HashAlgorithm)
+	processBound = nil
+	if err := repository.InitRepository(ctx.Config.RepositoryConf, ctx.EventCenter); err != nil {
+		processOwner = nil
+		return err
+	}
+	if nil != ctx.swCh {
+		rpc.SetSwCh(ctx.swCh)
+	}
+	processBound = ctx
+	return nil
+}
+
+// Release the process after the node of context stopped, so that another node can run.
+func (ctx *Context) Release() {
+	processLock.Lock()
+	defer processLock.Unlock()
+	if ctx == processOwner {
+		processOwner = nil
+	}
+}
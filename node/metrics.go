@@ -0,0 +1,29 @@
+package node
+
+import (
+	"github.com/DSiSc/justitia/tools/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of node registered in the registerer of its context.
+type nodeMetrics struct {
+	consensusPeerId   prometheus.Gauge
+	consensusMasterId prometheus.Gauge
+}
+
+func newNodeMetrics(registerer prometheus.Registerer) *nodeMetrics {
+	return &nodeMetrics{
+		consensusPeerId: metrics.Gauge(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "justitia",
+			Subsystem: "consensus",
+			Name:      "peer_id",
+			Help:      "The id of the node in consensus participates.",
+		})),
+		consensusMasterId: metrics.Gauge(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "justitia",
+			Subsystem: "consensus",
+			Name:      "master_id",
+			Help:      "The id of the master of current consensus round.",
+		})),
+	}
+}
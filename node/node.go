@@ -3,8 +3,6 @@ package node
 import (
 	"fmt"
 	"github.com/DSiSc/apigateway"
-	rpc "github.com/DSiSc/apigateway/rpc/core"
-	craftConfig "github.com/DSiSc/craft/config"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/monitor"
 	"github.com/DSiSc/craft/types"
@@ -20,20 +18,28 @@ import (
 	"github.com/DSiSc/gossipswitch/port"
 	"github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/governance"
 	"github.com/DSiSc/justitia/propagator"
+	"github.com/DSiSc/justitia/pruner"
+	"github.com/DSiSc/justitia/relayer"
+	"github.com/DSiSc/justitia/snapshot"
 	"github.com/DSiSc/justitia/tools"
+	"github.com/DSiSc/justitia/tools/clock"
 	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/justitia/tools/fault"
+	"github.com/DSiSc/justitia/whitelist"
 	"github.com/DSiSc/p2p"
 	"github.com/DSiSc/producer"
-	"github.com/DSiSc/repository"
 	"github.com/DSiSc/syncer"
 	"github.com/DSiSc/txpool"
 	"github.com/DSiSc/validator"
 	"github.com/DSiSc/validator/tools/account"
+	"github.com/prometheus/client_golang/prometheus"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,12 +55,15 @@ const msgChannelCacheLimit = 5
 // node struct with all service
 type Node struct {
 	nodeWg          sync.WaitGroup
+	context         *Context
+	clock           clock.Clock
+	chain           common.Chain
 	config          config.NodeConfig
 	txpool          txpool.TxsPool
 	participates    participates.Participates
 	role            role.Role
 	consensus       consensus.Consensus
-	producer        *producer.Producer
+	producer        blockProducer
 	txSwitch        *gossipswitch.GossipSwitch
 	blockSwitch     *gossipswitch.GossipSwitch
 	validator       *validator.Validator
@@ -64,10 +73,60 @@ type Node struct {
 	serviceChannel  chan interface{}
 	blockSyncerP2P  p2p.P2PAPI
 	blockSyncer     syncer.BlockSyncerAPI
+	snapshotService *snapshot.Service
 	blockP2P        p2p.P2PAPI
 	blockPropagator *propagator.BlockPropagator
 	txP2P           p2p.P2PAPI
 	txPropagator    *propagator.TxPropagator
+	pruner          *pruner.Pruner
+	// admit the txs whose sender is in WhiteList contract, nil if whitelist disabled
+	txFilter *whitelist.Filter
+	// validators elected by Voting contract, nil if the participates policy is used
+	validatorSet *governance.ValidatorSet
+	// the consensus node is not in the elected validators, it waits until elected
+	standby bool
+	// the latest epoch boundary notified with EventValidatorsChanged
+	notifiedBoundary uint64
+	// chain parameters from MetaData contract, nil if the local setting is used
+	chainParams *governance.ChainParams
+	// txs pool of the producer, limiting the txs of block
+	blockTxs *limitedTxPool
+	// main loop is waiting for messages, the message sent wakes it with the clock held
+	msgWaiting bool
+	msgLock    sync.Mutex
+	// relay cross chain txs to other chains, nil if relayer disabled
+	relayer *relayer.Relayer
+	// faults injected into node, nil if fault injection disabled
+	faults *fault.Injector
+	// listener of fault debug api, nil if not served
+	faultListener net.Listener
+	metrics       *nodeMetrics
+}
+
+// blockProducer make the blocks proposed by master.
+type blockProducer interface {
+	MakeBlock() (*types.Block, error)
+}
+
+// limitedTxPool limit the number of txs returned to producer by the chain parameter.
+type limitedTxPool struct {
+	txpool.TxsPool
+	limit uint64
+}
+
+// GetTxs get the txs of next block, no more than limit if it is positive.
+func (pool *limitedTxPool) GetTxs() []*types.Transaction {
+	txs := pool.TxsPool.GetTxs()
+	limit := atomic.LoadUint64(&pool.limit)
+	if limit > 0 && uint64(len(txs)) > limit {
+		txs = txs[:limit]
+	}
+	return txs
+}
+
+// SetLimit set the max number of txs in a block, 0 for no limit.
+func (pool *limitedTxPool) SetLimit(limit uint64) {
+	atomic.StoreUint64(&pool.limit, limit)
 }
 
 func InitLog(args config.SysConfig, conf config.NodeConfig) {
@@ -102,18 +161,34 @@ func InitLog(args config.SysConfig, conf config.NodeConfig) {
 }
 
 func NewNode(args config.SysConfig) (NodesService, error) {
-	nodeConf := config.NewNodeConfig()
-	InitLog(args, nodeConf)
-	craftConfig.GlobalConfig.Store(craftConfig.HashAlgName, nodeConf.AlgorithmConf.HashAlgorithm)
-	eventsCenter := events.NewEvent()
+	return NewNodeWithContext(NewContext(args))
+}
+
+// NewNodeWithContext create a node owning the dependencies in context.
+func NewNodeWithContext(ctx *Context) (NodesService, error) {
+	if nil == ctx.Clock {
+		ctx.Clock = clock.NewSystemClock()
+	}
+	if nil == ctx.NewP2P {
+		ctx.NewP2P = newP2P
+	}
+	if ctx.Config.FaultConf.Enabled && nil == ctx.Faults {
+		ctx.Faults = fault.NewInjector(ctx.Clock)
+	}
+	nodeConf := ctx.Config
+	eventsCenter := ctx.EventCenter
+	txsPerBlock := nodeConf.TxPoolConf.MaxTrsPerBlock
+	if chainParamsEnabled(nodeConf) {
+		// txs per block and empty block policy are applied by node with the chain parameters
+		nodeConf.TxPoolConf.MaxTrsPerBlock = nodeConf.TxPoolConf.GlobalSlots
+		nodeConf.ConsensusConf.EnableEmptyBlock = true
+	}
 	pool := txpool.NewTxPool(nodeConf.TxPoolConf, eventsCenter)
 	txSwitch, err := gossipswitch.NewGossipSwitchByType(gossipswitch.TxSwitch, eventsCenter, nodeConf.SwitchConf[config.TxSwitxh])
 	if err != nil {
 		log.Error("Init txSwitch failed.")
 		return nil, fmt.Errorf("txswitch init failed")
 	}
-	swChIn := txSwitch.InPort(port.LocalInPortId).Channel()
-	rpc.SetSwCh(swChIn)
 	err = txSwitch.OutPort(port.LocalInPortId).BindToPort(func(msg interface{}) error {
 		return pool.AddTx(msg.(*types.Transaction))
 	})
@@ -126,43 +201,125 @@ func NewNode(args config.SysConfig) (NodesService, error) {
 		log.Error("Init block switch failed.")
 		return nil, fmt.Errorf("blkSwitch init failed")
 	}
-	err = repository.InitRepository(nodeConf.RepositoryConf, eventsCenter)
+	var statePruner *pruner.Pruner
+	if common.NonePruningMode != nodeConf.PruningConf.Mode {
+		if common.LevelDBPlugin != nodeConf.RepositoryConf.PluginName {
+			return nil, fmt.Errorf("state pruning is not supported by repository plugin %s", nodeConf.RepositoryConf.PluginName)
+		}
+		// the states are swept before the repository locks the state store
+		statePruner = pruner.NewPruner(ctx.Chain(), nodeConf.PruningConf, nodeConf.RepositoryConf.StateDataPath, ctx.Metrics)
+		if err := statePruner.Sweep(); nil != err {
+			return nil, err
+		}
+	}
+	err = ctx.InitRepository()
 	if err != nil {
 		log.Error("Init block chain failed.")
 		return nil, fmt.Errorf("Repository init failed")
 	}
-	config.ImportGenesisBlock()
-	blockSyncerP2P, err := p2p.NewP2P(nodeConf.P2PConf[config.BlockSyncerP2P], eventsCenter)
+	if nil != statePruner && nil != ctx.StateDatabase {
+		// the states are pruned in background through the state store handle of the repository
+		stateDB, err := ctx.StateDatabase()
+		if err != nil {
+			log.Error("Open state database failed with error %v.", err)
+			return nil, fmt.Errorf("open state database failed: %v", err)
+		}
+		statePruner.SetDatabase(stateDB)
+	}
+	if err := config.ImportGenesisBlock(); nil != err {
+		log.Error("Import genesis block failed with error %v.", err)
+		return nil, fmt.Errorf("import genesis block failed: %v", err)
+	}
+	if err := config.CheckChainMeta(nodeConf); nil != err {
+		log.Error("Check chain meta failed with error %v.", err)
+		return nil, fmt.Errorf("check chain meta failed: %v", err)
+	}
+	var chainParams *governance.ChainParams
+	if chainParamsEnabled(nodeConf) {
+		chainParams, err = newChainParams(ctx.Chain(), nodeConf, txsPerBlock, ctx.Clock)
+		if err != nil {
+			log.Error("Init chain parameters failed with error %v.", err)
+			return nil, fmt.Errorf("init chain parameters failed: %v", err)
+		}
+	}
+	var crossChainRelayer *relayer.Relayer
+	if nodeConf.RelayerConf.Enabled {
+		crossChainRelayer, err = newRelayer(nodeConf, eventsCenter, ctx.Metrics, ctx.Clock)
+		if err != nil {
+			log.Error("Init relayer failed with error %v.", err)
+			return nil, fmt.Errorf("init relayer failed: %v", err)
+		}
+	}
+	var txFilter *whitelist.Filter
+	swChIn := txSwitch.InPort(port.LocalInPortId).Channel()
+	swChRemote := txSwitch.InPort(port.RemoteInPortId).Channel()
+	if whiteListEnabled(nodeConf) {
+		txFilter, err = newTxFilter(ctx.Chain(), eventsCenter, ctx.Metrics)
+		if err != nil {
+			log.Error("Init whitelist filter failed with error %v.", err)
+			return nil, fmt.Errorf("init whitelist filter failed: %v", err)
+		}
+		swChIn = txFilter.Wrap(swChIn)
+		swChRemote = txFilter.Wrap(swChRemote)
+	}
+	ctx.SetSwCh(swChIn)
+	blockIn := blkSwitch.InPort(port.LocalInPortId).Channel()
+	blockRemoteIn := blkSwitch.InPort(port.RemoteInPortId).Channel()
+	if nil != statePruner {
+		blockIn = statePruner.Wrap(blockIn)
+		blockRemoteIn = statePruner.Wrap(blockRemoteIn)
+	}
+	if nil != ctx.Faults {
+		if err := enableFaults(ctx.Faults, nodeConf.FaultConf, eventsCenter); nil != err {
+			log.Error("Enable fault injection failed with error %v.", err)
+			return nil, fmt.Errorf("enable fault injection failed: %v", err)
+		}
+		blockIn = faultyWrite(ctx.Faults, blockIn, eventsCenter)
+		blockRemoteIn = faultyWrite(ctx.Faults, blockRemoteIn, eventsCenter)
+	}
+	blockSyncerP2P, err := ctx.NewP2P(config.BlockSyncerP2P, nodeConf.P2PConf[config.BlockSyncerP2P], eventsCenter)
 	if err != nil {
 		log.Error("Init block syncer p2p failed.")
 		return nil, fmt.Errorf("init block syncer p2p failed")
 	}
-	blockSyncer, err := syncer.NewBlockSyncer(blockSyncerP2P, blkSwitch.InPort(port.LocalInPortId).Channel(), eventsCenter)
+	snapshotService := snapshot.NewService(ctx.Chain(), blockSyncerP2P)
+	syncedBlockIn, propagatedBlockIn := blockIn, blockRemoteIn
+	if nil != chainParams {
+		syncedBlockIn = chainParams.Wrap(blockIn, rejectBlock)
+		propagatedBlockIn = chainParams.Wrap(blockRemoteIn, rejectBlock)
+	}
+	blockSyncer, err := syncer.NewBlockSyncer(snapshotService.P2P(), syncedBlockIn, eventsCenter)
 	if err != nil {
 		log.Error("Init block syncer failed.")
 		return nil, fmt.Errorf("init block syncer failed")
 	}
-	blockP2P, err := p2p.NewP2P(nodeConf.P2PConf[config.BlockP2P], eventsCenter)
+	blockP2P, err := ctx.NewP2P(config.BlockP2P, nodeConf.P2PConf[config.BlockP2P], eventsCenter)
 	if err != nil {
 		log.Error("Init block p2p failed.")
 		return nil, fmt.Errorf("init block p2p failed")
 	}
-	blockPropagator, err := propagator.NewBlockPropagator(blockP2P, blkSwitch.InPort(port.RemoteInPortId).Channel(), eventsCenter)
+	blockPropagator, err := propagator.NewBlockPropagator(blockP2P, propagatedBlockIn, eventsCenter, ctx.Clock)
 	if err != nil {
 		log.Error("Init block propagator failed.")
 		return nil, fmt.Errorf("init block propagator failed")
 	}
-	txP2P, err := p2p.NewP2P(nodeConf.P2PConf[config.TxP2P], eventsCenter)
+	blockPropagator.SetFaultInjector(ctx.Faults)
+	txP2P, err := ctx.NewP2P(config.TxP2P, nodeConf.P2PConf[config.TxP2P], eventsCenter)
 	if err != nil {
 		log.Error("Init tx p2p failed.")
 		return nil, fmt.Errorf("init tx p2p failed")
 	}
-	txPropagator, err := propagator.NewTxPropagator(txP2P, txSwitch.InPort(port.RemoteInPortId).Channel(), eventsCenter)
+	txPropagator, err := propagator.NewTxPropagator(txP2P, swChRemote, eventsCenter)
 	if err != nil {
 		log.Error("Init tx propagator failed.")
 		return nil, fmt.Errorf("init tx propagator failed")
 	}
+	txPropagator.SetFaultInjector(ctx.Faults)
+	ctx.Config = nodeConf
 	node := &Node{
+		context:         ctx,
+		chain:           ctx.Chain(),
+		clock:           ctx.Clock,
 		config:          nodeConf,
 		txpool:          pool,
 		txSwitch:        txSwitch,
@@ -172,14 +329,39 @@ func NewNode(args config.SysConfig) (NodesService, error) {
 		serviceChannel:  make(chan interface{}),
 		blockSyncerP2P:  blockSyncerP2P,
 		blockSyncer:     blockSyncer,
+		snapshotService: snapshotService,
 		blockP2P:        blockP2P,
 		blockPropagator: blockPropagator,
 		txP2P:           txP2P,
 		txPropagator:    txPropagator,
+		txFilter:        txFilter,
+		chainParams:     chainParams,
+		relayer:         crossChainRelayer,
+		blockTxs:        &limitedTxPool{TxsPool: pool},
+		faults:          ctx.Faults,
+		pruner:          statePruner,
+		metrics:         newNodeMetrics(ctx.Metrics),
+	}
+	if nil != nodeConf.ChainRules && nodeConf.ChainRules.Consensus.Epoch > 0 {
+		// all nodes record the elected validators, so that they survive pruning and go with snapshots
+		if node.validatorSet, err = newValidatorSet(node.chain, nodeConf.ChainRules); nil != err {
+			return nil, err
+		}
 	}
 	if common.ConsensusNode == nodeConf.NodeType {
+		consensusBlockIn := blockIn
+		if nil != chainParams {
+			// the blocks breaking chain parameters are rejected by every node, not only skipped by master
+			consensusBlockIn = chainParams.Wrap(blockIn, func(block *types.Block, err error) {
+				rejectBlock(block, err)
+				eventsCenter.Notify(types.EventBlockCommitFailed, err)
+			})
+		}
+		if nil != ctx.Faults {
+			consensusBlockIn = faultyCommit(ctx.Faults, consensusBlockIn, eventsCenter)
+		}
 		galaxyConfig := galaxyCommon.GalaxyPluginConf{
-			BlockSwitch:     blkSwitch.InPort(port.LocalInPortId).Channel(),
+			BlockSwitch:     consensusBlockIn,
 			ParticipateConf: nodeConf.ParticipatesConf,
 			RoleConf:        nodeConf.RoleConf,
 			ConsensusConf:   nodeConf.ConsensusConf,
@@ -192,34 +374,259 @@ func NewNode(args config.SysConfig) (NodesService, error) {
 		node.participates = galaxyPlugin.Participates
 		node.role = galaxyPlugin.Role
 		node.consensus = galaxyPlugin.Consensus
+		if ctx.RoundTimeout > 0 {
+			node.consensus = newTimedConsensus(node.consensus, ctx.Clock, ctx.RoundTimeout)
+		}
 		// get node info
 		participates, err := node.participates.GetParticipates()
 		if err != nil {
 			log.Error("get participates failed with %v.", err)
 			panic("get participates failed.")
 		}
-		exits := false
-		for _, participate := range participates {
-			if participate.Address == node.config.Account.Address {
-				node.config.Account.Extension.Url = participate.Extension.Url
-				node.config.Account.Extension.Id = participate.Extension.Id
-				exits = true
-				break
+		if nil != nodeConf.ChainRules && len(nodeConf.ChainRules.Validators) > 0 {
+			if err := checkValidators(participates, nodeConf.ChainRules.Validators); nil != err {
+				return nil, fmt.Errorf("participates mismatch with genesis validators: %v", err)
 			}
 		}
-		if !exits {
-			panic("node type is consensus, while not found it by contract called")
+		if nil != node.validatorSet {
+			if participates, err = node.getParticipates(); nil != err {
+				return nil, fmt.Errorf("get validators elected by voting contract failed: %v", err)
+			}
 		}
-		_, master, err := node.role.RoleAssignments(participates)
-		if nil != err {
-			panic(fmt.Sprintf("Role assignments failed with err %v.", err))
+		if !node.joinValidators(participates) {
+			if nil == node.validatorSet {
+				panic("node type is consensus, while not found it by contract called")
+			}
+			// the node voted out keeps syncing blocks, and joins consensus once it is elected again
+			log.Warn("node %x is not in the elected validators, wait until it is elected.", node.config.Account.Address)
+			node.standby = true
+		} else {
+			_, master, err := node.role.RoleAssignments(participates)
+			if nil != err {
+				panic(fmt.Sprintf("Role assignments failed with err %v.", err))
+			}
+			routedMaster, routed := node.route(master, participates)
+			node.consensus.Initialization(node.config.Account, routedMaster, routed, node.eventCenter, false)
+			node.blockPropagator.SetConsensusPeers(node.consensusPeers(participates))
 		}
-		node.consensus.Initialization(node.config.Account, master, participates, node.eventCenter, false)
 	}
 	node.eventsRegister()
 	return node, nil
 }
 
+// create the validator set elected by the Voting contract deployed in genesis block of chain.
+func newValidatorSet(chain common.Chain, rules *config.ChainRules) (*governance.ValidatorSet, error) {
+	voting, err := config.GenesisContractAddress(types.JustitiaVoting)
+	if err != nil {
+		return nil, fmt.Errorf("voting contract is required when epoch set, as: %v", err)
+	}
+	log.Info("validators are elected by voting contract %x every %d blocks", voting, rules.Consensus.Epoch)
+	return governance.NewValidatorSet(chain, rules.Consensus.Epoch, voting, rules.Validators)
+}
+
+// check whether the chain parameters are read from MetaData contract.
+func chainParamsEnabled(nodeConf config.NodeConfig) bool {
+	return nil != nodeConf.ChainRules && nodeConf.ChainRules.Consensus.ChainParams
+}
+
+func newChainParams(chain common.Chain, nodeConf config.NodeConfig, txsPerBlock uint64, clock clock.Clock) (*governance.ChainParams, error) {
+	metaData, err := config.GenesisContractAddress(types.JustitiaMetaData)
+	if err != nil {
+		return nil, fmt.Errorf("metadata contract is required when chain parameters enabled, as: %v", err)
+	}
+	log.Info("chain parameters are read from metadata contract %x", metaData)
+	chainParams := governance.NewChainParams(chain, metaData, governance.Params{
+		BlockInterval:    nodeConf.BlockInterval,
+		TxsPerBlock:      txsPerBlock,
+		EnableEmptyBlock: nodeConf.ChainRules.Consensus.EnableEmptyBlock,
+	}, clock)
+	if err := chainParams.Check(); err != nil {
+		return nil, err
+	}
+	return chainParams, nil
+}
+
+// log the block rejected as it breaks the chain parameters.
+func rejectBlock(block *types.Block, err error) {
+	log.Warn("reject block %d, as: %v", block.Header.Height, err)
+}
+
+// get the chain parameters of next block, they are read from MetaData contract if enabled,
+// otherwise come from the local setting.
+func (instance *Node) nextParams() governance.Params {
+	local := governance.Params{
+		BlockInterval:    instance.config.BlockInterval,
+		TxsPerBlock:      instance.config.TxPoolConf.MaxTrsPerBlock,
+		EnableEmptyBlock: instance.config.ConsensusConf.EnableEmptyBlock,
+	}
+	if nil == instance.chainParams {
+		return local
+	}
+	chain, err := instance.chain.Latest()
+	if err != nil {
+		log.Error("get latest state repository failed with error %v.", err)
+		return local
+	}
+	block := chain.GetCurrentBlock()
+	if nil == block {
+		log.Error("no block in local repository.")
+		return local
+	}
+	// the last known parameters are returned on error
+	params, err := instance.chainParams.Params(block.Header.Height + 1)
+	if err != nil {
+		log.Error("get chain parameters of block %d failed with %v.", block.Header.Height+1, err)
+	}
+	return params
+}
+
+func newRelayer(nodeConf config.NodeConfig, eventCenter types.EventCenter, registerer prometheus.Registerer, clock clock.Clock) (*relayer.Relayer, error) {
+	contract, err := config.GenesisContractAddress(types.JustitiaCrossFundsPool)
+	if err != nil {
+		return nil, fmt.Errorf("crossfundspool contract is required when relayer enabled, as: %v", err)
+	}
+	chainId, err := config.GetChainIdFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the api gateway of local chain, which may listen on all interfaces
+	gateway := strings.TrimPrefix(nodeConf.ApiGatewayAddr, "tcp://")
+	gateway = strings.Replace(gateway, "0.0.0.0", "127.0.0.1", 1)
+	log.Info("relay cross chain txs of contract %x to %d chains", contract, len(nodeConf.RelayerConf.Routes))
+	return relayer.NewRelayer(nodeConf.RelayerConf, chainId, gateway, contract, eventCenter, registerer, clock)
+}
+
+// enable fault injection with the faults in config, never done unless it is enabled in config.
+func enableFaults(injector *fault.Injector, conf config.FaultConfig, eventCenter types.EventCenter) error {
+	for _, f := range conf.Faults {
+		if err := injector.Inject(f); nil != err {
+			return err
+		}
+	}
+	if event, ok := eventCenter.(*events.Event); ok {
+		event.SetFaultInjector(injector)
+	}
+	injector.Enable()
+	log.Warn("fault injection enabled with %d faults", len(conf.Faults))
+	return nil
+}
+
+// returns a channel in front of the block switch in-port, the blocks fail with EventBlockCommitFailed
+// as if block switch failed to write them to repository when fault injected. Block switch writes the
+// blocks with WriteBlockWithReceipts inside gossipswitch, so the point is checked at its in-ports.
+func faultyWrite(injector *fault.Injector, in chan<- interface{}, eventCenter types.EventCenter) chan<- interface{} {
+	return injector.Wrap(fault.RepositoryWrite, in, func(msg interface{}, err error) {
+		if block, ok := msg.(*types.Block); ok {
+			log.Warn("fail to write block %d, as: %v", block.Header.Height, err)
+			eventCenter.Notify(types.EventBlockCommitFailed, err)
+			return
+		}
+		in <- msg
+	})
+}
+
+// returns a channel in front of the block switch in-port for consensus, the blocks committed by
+// consensus fail with EventBlockCommitFailed instead of sent to block switch when fault injected.
+func faultyCommit(injector *fault.Injector, in chan<- interface{}, eventCenter types.EventCenter) chan<- interface{} {
+	return injector.Wrap(fault.ConsensusCommit, in, func(msg interface{}, err error) {
+		if block, ok := msg.(*types.Block); ok {
+			log.Warn("fail to commit block %d, as: %v", block.Header.Height, err)
+			eventCenter.Notify(types.EventBlockCommitFailed, err)
+			return
+		}
+		in <- msg
+	})
+}
+
+// check whether the txs are admitted by WhiteList contract.
+func whiteListEnabled(nodeConf config.NodeConfig) bool {
+	return nil != nodeConf.ChainRules && nodeConf.ChainRules.TxWhiteList
+}
+
+func newTxFilter(chain common.Chain, eventCenter types.EventCenter, registerer prometheus.Registerer) (*whitelist.Filter, error) {
+	contract, err := config.GenesisContractAddress(types.JustitiaWhiteList)
+	if err != nil {
+		return nil, fmt.Errorf("whitelist contract is required when whitelist enabled, as: %v", err)
+	}
+	log.Info("only admit the txs whose sender is in whitelist contract %x", contract)
+	return whitelist.NewFilter(chain, contract, eventCenter, registerer)
+}
+
+// get the participates of next block, they are elected by Voting contract if validator set enabled,
+// otherwise come from the participates policy.
+func (instance *Node) getParticipates() ([]account.Account, error) {
+	if nil == instance.validatorSet {
+		return instance.participates.GetParticipates()
+	}
+	chain, err := instance.chain.Latest()
+	if err != nil {
+		return nil, err
+	}
+	block := chain.GetCurrentBlock()
+	if nil == block {
+		return nil, fmt.Errorf("no block in local repository")
+	}
+	return instance.validatorSet.Validators(block.Header.Height + 1)
+}
+
+// check whether the validators change after the block, which is an epoch boundary. The change is
+// notified with EventValidatorsChanged once for each boundary.
+func (instance *Node) validatorsChangedAfter(v interface{}) bool {
+	block, ok := v.(*types.Block)
+	if nil == instance.validatorSet || !ok || !instance.validatorSet.IsBoundary(block.Header.Height) {
+		return false
+	}
+	current, err := instance.validatorSet.Validators(block.Header.Height)
+	if err != nil {
+		log.Error("get validators of block %d failed with %v.", block.Header.Height, err)
+		return false
+	}
+	next, err := instance.validatorSet.Validators(block.Header.Height + 1)
+	if err != nil {
+		log.Error("get validators of block %d failed with %v.", block.Header.Height+1, err)
+		return false
+	}
+	if governance.SameValidators(current, next) {
+		return false
+	}
+	boundary := block.Header.Height
+	if notified := atomic.LoadUint64(&instance.notifiedBoundary); boundary > notified && atomic.CompareAndSwapUint64(&instance.notifiedBoundary, notified, boundary) {
+		instance.eventCenter.Notify(common.EventValidatorsChanged, &governance.ValidatorsChange{
+			Height:     boundary + 1,
+			Validators: next,
+		})
+	}
+	return true
+}
+
+// check whether the node is one of the validators, the id and url of node account are updated
+// to the ones of validator if it is.
+func (instance *Node) joinValidators(validators []account.Account) bool {
+	validator, ok := governance.FindValidator(validators, instance.config.Account.Address)
+	if ok {
+		instance.config.Account.Extension.Id = validator.Extension.Id
+		instance.config.Account.Extension.Url = validator.Extension.Url
+	}
+	return ok
+}
+
+// check participates are the same as validators in genesis.
+func checkValidators(participates []account.Account, validators []account.Account) error {
+	if len(participates) != len(validators) {
+		return fmt.Errorf("participates count %d, while validators count %d", len(participates), len(validators))
+	}
+	validatorSet := make(map[types.Address]bool)
+	for _, validator := range validators {
+		validatorSet[validator.Address] = true
+	}
+	for _, participate := range participates {
+		if !validatorSet[participate.Address] {
+			return fmt.Errorf("participate %x is not a genesis validator", participate.Address)
+		}
+	}
+	return nil
+}
+
 func (instance *Node) eventsRegister() {
 	txDelEventFunc := func(v interface{}) {
 		if nil != v {
@@ -230,8 +637,31 @@ func (instance *Node) eventsRegister() {
 	}
 	instance.eventCenter.Subscribe(types.EventBlockCommitted, txDelEventFunc)
 	instance.eventCenter.Subscribe(types.EventBlockWritten, txDelEventFunc)
+	if nil != instance.chainParams {
+		// the blocks waiting for their parent in the wrapped in-ports are verified once it is committed
+		instance.eventCenter.Subscribe(types.EventBlockCommitted, instance.chainParams.BlockEventFunc)
+		instance.eventCenter.Subscribe(types.EventBlockWritten, instance.chainParams.BlockEventFunc)
+	}
+	if nil != instance.pruner {
+		instance.eventCenter.Subscribe(types.EventBlockCommitted, instance.pruner.BlockEventFunc)
+		instance.eventCenter.Subscribe(types.EventBlockWritten, instance.pruner.BlockEventFunc)
+	}
+	if nil != instance.validatorSet {
+		// the validators elected at the boundary are recorded once the block is written
+		electEventFunc := func(v interface{}) {
+			instance.validatorsChangedAfter(v)
+		}
+		instance.eventCenter.Subscribe(types.EventBlockWritten, electEventFunc)
+		if common.ConsensusNode != instance.config.NodeType {
+			instance.eventCenter.Subscribe(types.EventBlockCommitted, electEventFunc)
+		}
+	}
 	if common.ConsensusNode == instance.config.NodeType {
 		instance.eventCenter.Subscribe(types.EventBlockCommitted, func(v interface{}) {
+			if instance.validatorsChangedAfter(v) {
+				instance.sendMsgInternal(common.MsgChangeValidators)
+				return
+			}
 			instance.sendMsgInternal(common.MsgBlockCommitSuccess)
 		})
 		instance.eventCenter.Subscribe(types.EventBlockVerifyFailed, func(v interface{}) {
@@ -260,33 +690,99 @@ func (instance *Node) eventUnregister() {
 }
 
 func (instance *Node) notify() {
-	go instance.sendMsgInternal(common.MsgRoundRunFailed)
+	clock.Hold(instance.clock)
+	go func() {
+		defer clock.Release(instance.clock)
+		instance.sendMsgInternal(common.MsgRoundRunFailed)
+	}()
 }
 
+// get the block p2p addresses of participates, participates without configured address are skipped.
+func (instance *Node) consensusPeers(participates []account.Account) []string {
+	peers := make([]string, 0, len(participates))
+	for _, participate := range participates {
+		if participate.Address == instance.config.Account.Address {
+			continue
+		}
+		if addr, ok := instance.config.ConsensusPeers[participate.Address]; ok {
+			peers = append(peers, addr)
+		} else {
+			log.Debug("no block p2p address of consensus participate %x configured", participate.Address)
+		}
+	}
+	return peers
+}
+
+// route the consensus messages to participates through the configured urls, the node itself keeps
+// its url which consensus listens on.
+func (instance *Node) route(master account.Account, participates []account.Account) (account.Account, []account.Account) {
+	if 0 == len(instance.config.ConsensusRoutes) {
+		return master, participates
+	}
+	routed := make([]account.Account, 0, len(participates))
+	for _, participate := range participates {
+		routed = append(routed, instance.routeParticipate(participate))
+	}
+	return instance.routeParticipate(master), routed
+}
+
+func (instance *Node) routeParticipate(participate account.Account) account.Account {
+	if participate.Address == instance.config.Account.Address {
+		return participate
+	}
+	if url, ok := instance.config.ConsensusRoutes[participate.Address]; ok {
+		participate.Extension.Url = url
+	}
+	return participate
+}
+
+// send the message to main loop, the clock is held for main loop if the message wakes it.
 func (instance *Node) sendMsgInternal(msgType common.MsgType) {
+	instance.msgLock.Lock()
+	defer instance.msgLock.Unlock()
 	select {
 	case instance.msgChannel <- msgType:
+		if instance.msgWaiting {
+			clock.Hold(instance.clock)
+			instance.msgWaiting = false
+		}
 	default:
 		log.Info("node block produce message channel have full, will ignore this message(type: %v)", msgType)
 	}
 }
 
 func (instance *Node) blockFactory(master account.Account, participates []account.Account) {
-	monitor.JTMetrics.ConsensusPeerId.Set(float64(instance.config.Account.Extension.Id))
-	monitor.JTMetrics.ConsensusMasterId.Set(float64(master.Extension.Id))
-	instance.consensus.Initialization(instance.config.Account, master, participates, instance.eventCenter, false)
+	instance.metrics.consensusPeerId.Set(float64(instance.config.Account.Extension.Id))
+	instance.metrics.consensusMasterId.Set(float64(master.Extension.Id))
+	routedMaster, routed := instance.route(master, participates)
+	instance.consensus.Initialization(instance.config.Account, routedMaster, routed, instance.eventCenter, false)
+	instance.blockPropagator.SetConsensusPeers(instance.consensusPeers(participates))
 	isMaster := master == instance.config.Account
 	if isMaster {
 		log.Info("Master this round.")
+		if nil != instance.chainParams {
+			params := instance.nextParams()
+			if !params.EnableEmptyBlock && 0 == len(instance.txpool.GetTxs()) {
+				log.Info("No txs in pool while empty block disabled, skip this round.")
+				instance.sendMsgInternal(common.MsgBlockWithoutTx)
+				return
+			}
+			instance.blockTxs.SetLimit(params.TxsPerBlock)
+		}
 		if nil == instance.producer {
-			instance.producer = producer.NewProducer(instance.txpool, instance.config.Account, instance.config.ProducerConf)
+			instance.producer = producer.NewProducer(instance.blockTxs, instance.config.Account, instance.config.ProducerConf)
 		}
-		block, err := instance.producer.MakeBlock()
+		block, err := instance.makeBlock()
 		if err != nil {
 			log.Error("Make block failed with err %v.", err)
 			instance.notify()
 			return
 		}
+		if err = instance.faults.Error(fault.ConsensusTimeout); nil != err {
+			// nothing is sent to main loop, so it starts a new round after timeout
+			log.Warn("Skip consensus of block %d, as: %v.", block.Header.Height, err)
+			return
+		}
 		proposal := &consensusCommon.Proposal{
 			Block: block,
 		}
@@ -301,8 +797,16 @@ func (instance *Node) blockFactory(master account.Account, participates []accoun
 	}
 }
 
+// make block by producer, failed if fault injected.
+func (instance *Node) makeBlock() (*types.Block, error) {
+	if err := instance.faults.Error(fault.MakeBlock); nil != err {
+		return nil, err
+	}
+	return instance.producer.MakeBlock()
+}
+
 func (instance *Node) NextRound(msgType common.MsgType) {
-	switch instance.consensus.(type) {
+	switch policyOf(instance.consensus).(type) {
 	case *dbft.DBFTPolicy:
 		if common.MsgChangeMaster == msgType {
 			consensusResult := instance.consensus.GetConsensusResult()
@@ -316,7 +820,7 @@ func (instance *Node) NextRound(msgType common.MsgType) {
 			consensusResult.Participate, consensusResult.Master.Extension.Id)
 		if common.MsgBlockCommitSuccess == msgType || common.MsgChangeMaster == msgType {
 			//TODO: increase time spent
-			time.Sleep(time.Duration(instance.config.BlockInterval) * time.Millisecond)
+			instance.clock.Sleep(time.Duration(instance.nextParams().BlockInterval) * time.Millisecond)
 		}
 		instance.blockFactory(consensusResult.Master, consensusResult.Participate)
 	default:
@@ -326,19 +830,36 @@ func (instance *Node) NextRound(msgType common.MsgType) {
 
 func (instance *Node) Round() {
 	log.Debug("start a new round.")
-	time.Sleep(time.Duration(instance.config.BlockInterval) * time.Millisecond)
-	participate, err := instance.participates.GetParticipates()
+	instance.clock.Sleep(time.Duration(instance.nextParams().BlockInterval) * time.Millisecond)
+	participate, err := instance.getParticipates()
 	if err != nil {
 		log.Error("get participates failed with error %s.", err)
 		instance.notify()
 		return
 	}
+	if !instance.joinValidators(participate) {
+		// nothing is sent to main loop, so it checks the validators again after timeout
+		if !instance.standby {
+			log.Warn("Node leaves the elected validators, stop participating consensus.")
+			instance.standby = true
+		}
+		return
+	}
 	_, master, err := instance.role.RoleAssignments(participate)
 	if nil != err {
 		log.Error("Role assignments failed with err %v.", err)
 		instance.notify()
 		return
 	}
+	if instance.standby {
+		log.Info("Node joins the elected validators, start participating consensus.")
+		instance.standby = false
+		routedMaster, routed := instance.route(master, participate)
+		instance.consensus.Initialization(instance.config.Account, routedMaster, routed, instance.eventCenter, false)
+		instance.blockPropagator.SetConsensusPeers(instance.consensusPeers(participate))
+		instance.consensus.Online()
+		return
+	}
 	instance.blockFactory(master, participate)
 }
 
@@ -361,17 +882,44 @@ func (instance *Node) OnlineWizard() {
 	instance.consensus.Online()
 }
 */
+// wait for the next message of main loop, or the timeout of timer. Main loop holds the clock
+// while it runs: the hold is released while waiting, and taken back by the message waking it or
+// the timer fired. The messages sent while main loop runs are queued without holding the clock.
+func (instance *Node) waitMsg(timer clock.Timer) common.MsgType {
+	instance.msgLock.Lock()
+	waiting := 0 == len(instance.msgChannel)
+	instance.msgWaiting = waiting
+	instance.msgLock.Unlock()
+	if waiting {
+		clock.Release(instance.clock)
+	}
+	var msg common.MsgType
+	select {
+	case msg = <-instance.msgChannel:
+		timer.Stop()
+	case <-timer.C():
+		timer.Stop()
+		msg = common.MsgWaitTimeOut
+		log.Info("wait for node to produce new block time out, will start a new round")
+	}
+	instance.msgLock.Lock()
+	instance.msgWaiting = false
+	instance.msgLock.Unlock()
+	return msg
+}
+
+// main loop of consensus node, the clock is held by the caller starting it.
 func (instance *Node) mainLoop() {
-	instance.consensus.Online()
+	if !instance.standby {
+		instance.consensus.Online()
+	}
 	for {
-		timer := time.NewTimer(time.Duration(instance.config.BlockInterval) * 2 * time.Millisecond)
-		var msg common.MsgType
-		select {
-		case msg = <-instance.msgChannel:
-		case <-timer.C:
-			timer.Stop()
-			msg = common.MsgWaitTimeOut
-			log.Info("wait for node to produce new block time out, will start a new round")
+		timer := instance.clock.NewTimer(time.Duration(instance.nextParams().BlockInterval) * 2 * time.Millisecond)
+		msg := instance.waitMsg(timer)
+		if instance.standby && common.MsgNodeServiceStopped != msg {
+			// the consensus is not initialized with the node outside validators, check whether it is elected
+			instance.Round()
+			continue
 		}
 		switch msg {
 		case common.MsgBlockCommitSuccess:
@@ -400,8 +948,14 @@ func (instance *Node) mainLoop() {
 			instance.NextRound(common.MsgBlockCommitSuccess)
 		case common.MsgWaitTimeOut:
 			instance.NextRound(common.MsgWaitTimeOut)
+		case common.MsgChangeValidators:
+			log.Info("Receive msg of change validators.")
+			// assign roles among the new validators and re-initialize consensus with them
+			instance.Round()
 		case common.MsgNodeServiceStopped:
 			log.Warn("Stop node service.")
+			clock.Release(instance.clock)
+			return
 		}
 	}
 }
@@ -426,6 +980,16 @@ func (instance *Node) startBlockSyncer() {
 	if err := instance.blockSyncerP2P.Start(); nil != err {
 		panic(fmt.Sprintf("Start block syncer p2p failed with error %v.", err))
 	}
+	if err := instance.snapshotService.Start(); nil != err {
+		panic(fmt.Sprintf("Start snapshot service failed with error %v.", err))
+	}
+	if common.FastSyncMode == instance.config.SyncerConf.Mode {
+		syncerConf := instance.config.SyncerConf
+		err := instance.snapshotService.FastSync(syncerConf.TrustedHeight, syncerConf.TrustedHash, time.Duration(syncerConf.Timeout)*time.Millisecond)
+		if nil != err {
+			log.Error("Fast sync failed with error %v, will sync blocks from local height.", err)
+		}
+	}
 	if err := instance.blockSyncer.Start(); nil != err {
 		panic(fmt.Sprintf("Start block syncer failed with error %v.", err))
 	}
@@ -449,17 +1013,64 @@ func (instance *Node) startTxPropagator() {
 	}
 }
 
+func (instance *Node) startPruner() {
+	if nil == instance.pruner {
+		return
+	}
+	if err := instance.pruner.Start(); nil != err {
+		panic(fmt.Sprintf("Start state pruner failed with error %v.", err))
+	}
+}
+
+func (instance *Node) startTxFilter() {
+	if nil == instance.txFilter {
+		return
+	}
+	if err := instance.txFilter.Start(); nil != err {
+		panic(fmt.Sprintf("Start whitelist filter failed with error %v.", err))
+	}
+}
+
+func (instance *Node) startRelayer() {
+	if nil == instance.relayer {
+		return
+	}
+	if err := instance.relayer.Start(); nil != err {
+		panic(fmt.Sprintf("Start relayer failed with error %v.", err))
+	}
+}
+
+func (instance *Node) startFaultServer() {
+	if !instance.config.FaultConf.Enabled || common.BlankString == instance.config.FaultConf.ListenAddr {
+		return
+	}
+	var err error
+	if instance.faultListener, err = instance.faults.StartServer(instance.config.FaultConf.ListenAddr); nil != err {
+		panic(fmt.Sprintf("Start fault debug api failed with error %v.", err))
+	}
+}
+
 func (instance *Node) Start() {
+	if nil != instance.context {
+		if err := instance.context.Acquire(); nil != err {
+			panic(fmt.Sprintf("Bind node context failed with error %v.", err))
+		}
+	}
 	instance.stratRpc()
 	instance.startSwitch()
 	instance.startBlockSyncer()
 	instance.startBlockPropagator()
 	instance.startTxPropagator()
+	instance.startPruner()
+	instance.startTxFilter()
+	instance.startRelayer()
+	instance.startFaultServer()
 	monitor.StartPrometheusServer(instance.config.PrometheusConf)
 	monitor.StartExpvarServer(instance.config.ExpvarConf)
 	monitor.StartPprofServer(instance.config.PprofConf)
 	if instance.config.NodeType == common.ConsensusNode {
 		go instance.consensus.Start()
+		clock.Hold(instance.clock)
 		go instance.mainLoop()
 	}
 }
@@ -475,14 +1086,31 @@ func (instance *Node) Stop() error {
 		}
 	}
 	instance.blockSyncerP2P.Stop()
+	instance.snapshotService.Stop()
 	instance.blockSyncer.Stop()
 	instance.blockP2P.Stop()
 	instance.blockPropagator.Stop()
 	instance.txP2P.Stop()
 	instance.txPropagator.Stop()
+	if nil != instance.txFilter {
+		instance.txFilter.Stop()
+	}
+	if nil != instance.relayer {
+		instance.relayer.Stop()
+	}
+	if nil != instance.faultListener {
+		instance.faultListener.Close()
+	}
 	instance.blockSwitch.Stop()
 	instance.txSwitch.Stop()
+	if nil != instance.pruner {
+		// states are planned to prune after the blocks stop being written
+		instance.pruner.Stop()
+	}
 	instance.eventUnregister()
+	if nil != instance.context {
+		instance.context.Release()
+	}
 	if instance.config.NodeType == common.ConsensusNode {
 		instance.msgChannel <- common.MsgNodeServiceStopped
 		monitor.StopPrometheusServer()
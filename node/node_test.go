@@ -3,6 +3,7 @@ package node
 import (
 	"fmt"
 	"github.com/DSiSc/apigateway"
+	rpc "github.com/DSiSc/apigateway/rpc/core"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/galaxy"
@@ -20,8 +21,11 @@ import (
 	justitiaCommon "github.com/DSiSc/justitia/common"
 	"github.com/DSiSc/justitia/compiler"
 	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/governance"
 	"github.com/DSiSc/justitia/propagator"
+	"github.com/DSiSc/justitia/tools/clock"
 	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/justitia/tools/fault"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/p2p"
 	p2pConfig "github.com/DSiSc/p2p/config"
@@ -31,11 +35,13 @@ import (
 	"github.com/DSiSc/syncer"
 	"github.com/DSiSc/txpool"
 	"github.com/DSiSc/validator/tools/account"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"net"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var defaultConf = config.SysConfig{
@@ -80,8 +86,8 @@ func TestNewNode(t *testing.T) {
 		}
 		return nil, nil
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.NotNil(err)
@@ -107,8 +113,8 @@ func TestNewNode(t *testing.T) {
 	monkey.Patch(p2p.NewP2P, func(*p2pConfig.P2PConfig, types.EventCenter) (*p2p.P2P, error) {
 		return nil, fmt.Errorf("new p2p failed")
 	})
-	monkey.Patch(config.ImportGenesisBlock, func() {
-		return
+	monkey.Patch(config.ImportGenesisBlock, func() error {
+		return nil
 	})
 	service, err = NewNode(defaultConf)
 	assert.NotNil(err)
@@ -129,7 +135,7 @@ func TestNewNode(t *testing.T) {
 	monkey.Patch(syncer.NewBlockSyncer, func(p2p.P2PAPI, chan<- interface{}, types.EventCenter) (*syncer.BlockSyncer, error) {
 		return nil, nil
 	})
-	monkey.Patch(propagator.NewBlockPropagator, func(p2p.P2PAPI, chan<- interface{}, types.EventCenter) (*propagator.BlockPropagator, error) {
+	monkey.Patch(propagator.NewBlockPropagator, func(p2p.P2PAPI, chan<- interface{}, types.EventCenter, clock.Clock) (*propagator.BlockPropagator, error) {
 		return nil, nil
 	})
 	monkey.Patch(galaxy.NewGalaxyPlugin, func(galaxyCommon.GalaxyPluginConf) (*galaxyCommon.GalaxyPlugin, error) {
@@ -184,8 +190,8 @@ func TestNode_Start(t *testing.T) {
 	monkey.Patch(syncer.NewBlockSyncer, func(p2p.P2PAPI, chan<- interface{}, types.EventCenter) (*syncer.BlockSyncer, error) {
 		return nil, nil
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -325,11 +331,11 @@ func TestNode_Round(t *testing.T) {
 	monkey.Patch(repository.InitRepository, func(repositoryConfig.RepositoryConfig, types.EventCenter) error {
 		return nil
 	})
-	monkey.Patch(config.ImportGenesisBlock, func() {
-		return
+	monkey.Patch(config.ImportGenesisBlock, func() error {
+		return nil
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -394,8 +400,8 @@ func TestNode_NextRound(t *testing.T) {
 	monkey.Patch(InitLog, func(config.SysConfig, config.NodeConfig) {
 		return
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -445,8 +451,8 @@ func TestNode_Wait(t *testing.T) {
 	monkey.Patch(InitLog, func(config.SysConfig, config.NodeConfig) {
 		return
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -469,8 +475,8 @@ func TestNewNode2(t *testing.T) {
 	monkey.Patch(InitLog, func(config.SysConfig, config.NodeConfig) {
 		return
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -510,8 +516,8 @@ func TestNewNode3(t *testing.T) {
 	monkey.Patch(InitLog, func(config.SysConfig, config.NodeConfig) {
 		return
 	})
-	monkey.Patch(compiler.SolidityCompile, func(string) string {
-		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72"
+	monkey.Patch(compiler.SolidityCompile, func(string, string) (string, error) {
+		return "608060405234801561001057600080fd5b506040805190810160405280600d81526020017f48656c6c6f2c20776f72", nil
 	})
 	service, err := NewNode(defaultConf)
 	assert.Nil(err)
@@ -528,3 +534,220 @@ func TestNewNode3(t *testing.T) {
 	assert.Nil(err)
 	monkey.UnpatchAll()
 }
+
+func TestNode_ValidatorsChangedAfter(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	genesis := []account.Account{{Address: types.Address{0x01}}}
+	elected := []account.Account{{Address: types.Address{0x02}}}
+	validatorSet, err := governance.NewValidatorSet(justitiaCommon.ProcessChain, 10, types.Address{0x10}, genesis)
+	assert.Nil(err)
+	monkey.PatchInstanceMethod(reflect.TypeOf(validatorSet), "Validators", func(set *governance.ValidatorSet, height uint64) ([]account.Account, error) {
+		if set.Boundary(height) >= 10 {
+			return elected, nil
+		}
+		return genesis, nil
+	})
+	node := &Node{chain: justitiaCommon.ProcessChain}
+	block := &types.Block{Header: &types.Header{Height: 10}}
+	assert.False(node.validatorsChangedAfter(block))
+
+	node.validatorSet = validatorSet
+	assert.True(node.validatorsChangedAfter(block))
+	assert.False(node.validatorsChangedAfter(&types.Block{Header: &types.Header{Height: 9}}))
+	assert.False(node.validatorsChangedAfter(&types.Block{Header: &types.Header{Height: 20}}))
+	assert.False(node.validatorsChangedAfter(nil))
+
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return block
+	})
+	participates, err := node.getParticipates()
+	assert.Nil(err)
+	assert.Equal(elected, participates)
+}
+
+func TestNode_Route(t *testing.T) {
+	assert := assert.New(t)
+	self := account.Account{Address: types.Address{0x01}, Extension: account.AccountExtension{Id: 0, Url: "127.0.0.1:48080"}}
+	peer := account.Account{Address: types.Address{0x02}, Extension: account.AccountExtension{Id: 1, Url: "127.0.0.1:48090"}}
+	node := &Node{config: config.NodeConfig{Account: self}}
+	master, routed := node.route(peer, []account.Account{self, peer})
+	assert.Equal(peer, master)
+	assert.Equal([]account.Account{self, peer}, routed)
+
+	node.config.ConsensusRoutes = map[types.Address]string{
+		self.Address: "127.0.0.1:50000",
+		peer.Address: "127.0.0.1:50001",
+	}
+	master, routed = node.route(peer, []account.Account{self, peer})
+	assert.Equal("127.0.0.1:50001", master.Extension.Url)
+	assert.Equal(self, routed[0])
+	assert.Equal("127.0.0.1:50001", routed[1].Extension.Url)
+	assert.Equal(peer.Extension.Id, routed[1].Extension.Id)
+	assert.Equal("127.0.0.1:48090", peer.Extension.Url)
+}
+
+func TestLimitedTxPool_GetTxs(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockTxPool := &txpool.TxPool{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(mockTxPool), "GetTxs", func(*txpool.TxPool) []*types.Transaction {
+		return []*types.Transaction{{}, {}, {}}
+	})
+	pool := &limitedTxPool{TxsPool: mockTxPool}
+	assert.Equal(3, len(pool.GetTxs()))
+	pool.SetLimit(2)
+	assert.Equal(2, len(pool.GetTxs()))
+	pool.SetLimit(5)
+	assert.Equal(3, len(pool.GetTxs()))
+}
+
+func TestContext_Acquire(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	monkey.Patch(log.SetGlobalConfig, func(*log.Config) {})
+	inits := 0
+	monkey.Patch(repository.InitRepository, func(repositoryConfig.RepositoryConfig, types.EventCenter) error {
+		inits++
+		return nil
+	})
+	first := &Context{EventCenter: events.NewEvent()}
+	second := &Context{EventCenter: events.NewEvent()}
+	assert.Nil(first.InitRepository())
+	assert.Nil(first.Acquire())
+	assert.Equal(1, inits)
+	assert.Equal(ErrProcessOwned, second.Acquire())
+
+	first.Release()
+	assert.Nil(second.Acquire())
+	assert.Equal(2, inits)
+	second.Release()
+
+	// bound again after another node has run in the process
+	assert.Nil(first.Acquire())
+	assert.Equal(3, inits)
+	first.Release()
+}
+
+func TestContext_MainAndSideChain(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	monkey.Patch(log.SetGlobalConfig, func(*log.Config) {})
+	repositories := map[string]*repository.Repository{
+		"main": new(repository.Repository),
+		"side": new(repository.Repository),
+	}
+	var initialized string
+	monkey.Patch(repository.InitRepository, func(conf repositoryConfig.RepositoryConfig, _ types.EventCenter) error {
+		initialized = conf.StateDataPath
+		return nil
+	})
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return repositories[initialized], nil
+	})
+	var swCh chan<- interface{}
+	monkey.Patch(rpc.SetSwCh, func(ch chan<- interface{}) {
+		swCh = ch
+	})
+	newChainContext := func(name string) *Context {
+		conf := config.NodeConfig{}
+		conf.RepositoryConf.StateDataPath = name
+		return &Context{Config: conf, EventCenter: events.NewEvent(), Metrics: prometheus.NewRegistry()}
+	}
+	gauge := func(ctx *Context, name string) float64 {
+		families, err := ctx.Metrics.(*prometheus.Registry).Gather()
+		assert.Nil(err)
+		for _, family := range families {
+			if name == family.GetName() {
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+	mainChain, sideChain := newChainContext("main"), newChainContext("side")
+	mainSwCh, sideSwCh := make(chan interface{}), make(chan interface{})
+
+	// the main chain node runs, the side chain node reads neither its repository nor the main one
+	assert.Nil(mainChain.InitRepository())
+	mainChain.SetSwCh(mainSwCh)
+	assert.Nil(mainChain.Acquire())
+	chain, err := mainChain.Chain().Latest()
+	assert.Nil(err)
+	assert.True(repositories["main"] == chain)
+	_, err = sideChain.Chain().Latest()
+	assert.Equal(ErrNotBound, err)
+	assert.Equal(ErrProcessOwned, sideChain.InitRepository())
+	sideChain.SetSwCh(sideSwCh)
+	assert.True(chan<- interface{}(mainSwCh) == swCh)
+	assert.Equal(ErrProcessOwned, sideChain.Acquire())
+
+	// the metrics of nodes are registered in their own registerer
+	newNodeMetrics(mainChain.Metrics).consensusMasterId.Set(1)
+	newNodeMetrics(sideChain.Metrics).consensusMasterId.Set(2)
+	assert.Equal(float64(1), gauge(mainChain, "justitia_consensus_master_id"))
+	assert.Equal(float64(2), gauge(sideChain, "justitia_consensus_master_id"))
+
+	// the side chain node runs after the main chain node stopped
+	mainChain.Release()
+	assert.Nil(sideChain.Acquire())
+	chain, err = sideChain.Chain().Latest()
+	assert.Nil(err)
+	assert.True(repositories["side"] == chain)
+	assert.True(chan<- interface{}(sideSwCh) == swCh)
+	_, err = mainChain.Chain().Latest()
+	assert.Equal(ErrNotBound, err)
+	sideChain.Release()
+}
+
+func TestNode_MakeBlockFault(t *testing.T) {
+	assert := assert.New(t)
+	injector := fault.NewInjector(clock.NewSystemClock())
+	injector.Enable()
+	assert.Nil(injector.Inject(fault.Fault{Point: fault.MakeBlock, Action: fault.ActionError, Times: 1}))
+	node := &Node{faults: injector}
+	_, err := node.makeBlock()
+	assert.NotNil(err)
+	assert.Equal(0, len(injector.List()))
+}
+
+func TestNode_RepositoryWriteFault(t *testing.T) {
+	assert := assert.New(t)
+	injector := fault.NewInjector(clock.NewSystemClock())
+	injector.Enable()
+	assert.Nil(injector.Inject(fault.Fault{Point: fault.RepositoryWrite, Action: fault.ActionError, Times: 1}))
+	node := &Node{
+		config:      config.NodeConfig{NodeType: justitiaCommon.ConsensusNode},
+		eventCenter: events.NewEvent(),
+		msgChannel:  make(chan justitiaCommon.MsgType, msgChannelCacheLimit),
+	}
+	node.eventsRegister()
+	failed := make(chan error, 1)
+	node.eventCenter.Subscribe(types.EventBlockCommitFailed, func(v interface{}) {
+		failed <- v.(error)
+	})
+
+	in := make(chan interface{}, 2)
+	ch := faultyWrite(injector, in, node.eventCenter)
+	defer close(ch)
+	ch <- &types.Block{Header: &types.Header{Height: 1}}
+	ch <- &types.Block{Header: &types.Header{Height: 2}}
+	select {
+	case err := <-failed:
+		assert.Contains(err.Error(), fault.RepositoryWrite)
+	case <-time.After(time.Second):
+		t.Fatal("write failure is not notified")
+	}
+	// consensus learns the commit failed
+	select {
+	case msg := <-node.msgChannel:
+		assert.Equal(justitiaCommon.MsgBlockCommitFailed, msg)
+	case <-time.After(time.Second):
+		t.Fatal("commit failure is not sent to consensus")
+	}
+	assert.Equal(uint64(2), (<-in).(*types.Block).Header.Height)
+	assert.Equal(0, len(injector.List()))
+}
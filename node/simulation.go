@@ -0,0 +1,30 @@
+//go:build simulation
+// +build simulation
+
+package node
+
+import (
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/justitia/tools/simnet"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// NewSimulatedContext create the context of a node in the simulated networks, the p2p of node
+// are its endpoints at addr in networks by p2p name, and its block interval and round timeout
+// run on clock. The consensus rounds time out on clock after the commit timeout of conf, and the
+// events notified hold the clock until handled.
+func NewSimulatedContext(conf config.NodeConfig, networks map[string]*simnet.Network, addr string, clock clock.Clock) *Context {
+	eventCenter := events.NewEvent()
+	eventCenter.(*events.Event).SetClock(clock)
+	return &Context{
+		Config:       conf,
+		EventCenter:  eventCenter,
+		Clock:        clock,
+		RoundTimeout: time.Duration(conf.ConsensusConf.Timeout.TimeoutToWaitCommitMsg) * time.Millisecond,
+		NewP2P:       simnet.NewP2P(networks, addr),
+		Metrics:      prometheus.NewRegistry(),
+	}
+}
@@ -0,0 +1,568 @@
+//go:build simulation
+// +build simulation
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/galaxy/consensus"
+	consensusCommon "github.com/DSiSc/galaxy/consensus/common"
+	"github.com/DSiSc/galaxy/participates"
+	"github.com/DSiSc/galaxy/role"
+	roleCommon "github.com/DSiSc/galaxy/role/common"
+	justitiaCommon "github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/propagator"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/simnet"
+	"github.com/DSiSc/p2p/message"
+	"github.com/DSiSc/txpool"
+	"github.com/DSiSc/validator/tools/account"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// p2p name of the network carrying the proposals and votes of simulated consensus
+const simConsensusP2P = "consensus"
+
+// block interval of simulated nodes, a round without commit times out after twice of it
+const simBlockInterval = 1000
+
+// the proposal not committed in a block interval is abandoned by master
+const simRoundTimeout = simBlockInterval
+
+// votes committing a proposal, the 4 nodes tolerate 1 faulty node
+const simQuorum = 3
+
+// message types of simulated consensus
+const (
+	simProposalMsgType message.MessageType = 0x90 + iota
+	simVoteMsgType
+)
+
+// simProposal is the block proposed by the master of view.
+type simProposal struct {
+	Block    *types.Block
+	View     uint64
+	Proposer string
+}
+
+func (p *simProposal) MsgType() message.MessageType {
+	return simProposalMsgType
+}
+
+func (p *simProposal) ResponseMsgType() message.MessageType {
+	return message.NIL
+}
+
+func (p *simProposal) id() string {
+	return fmt.Sprintf("%d/%d/%s", p.Block.Header.Height, p.View, p.Proposer)
+}
+
+// simVote is the vote of a node for a proposal.
+type simVote struct {
+	Proposal string
+	Height   uint64
+	Voter    string
+}
+
+func (v *simVote) MsgType() message.MessageType {
+	return simVoteMsgType
+}
+
+func (v *simVote) ResponseMsgType() message.MessageType {
+	return message.NIL
+}
+
+// simNode is a consensus node in simulation. The galaxy policies dial the urls of validators and
+// verify blocks against the repository of process, so they can't run side by side in a process.
+// The nodes run a voting consensus on the simulated network instead: each node votes once in a
+// view, a proposal is committed once a quorum voted for it, and the master is rotated by the views
+// passed since last commit. The proposals are timed out by the node on the virtual clock, the way
+// the galaxy policies are (see timedConsensus).
+type simNode struct {
+	name     string
+	node     *Node
+	endpoint *simnet.Endpoint
+	blockOut chan interface{}
+	lock     sync.Mutex
+	height   uint64
+	// virtual time of the latest commit
+	committedAt time.Time
+	crashed     bool
+	// view of the round assigned by role
+	view uint64
+	// commits in order, with the virtual time and the proposer
+	commits []string
+	// heights of the blocks received from block propagator
+	relayed map[uint64]bool
+	// views voted in by height
+	voted map[[2]uint64]bool
+	// proposals and their voters by proposal id
+	proposals map[string]*simProposal
+	votes     map[string]map[string]bool
+	// most votes a proposal got by height
+	maxVotes map[uint64]int
+	// proposers waiting for the commit of height
+	waiters map[uint64][]chan struct{}
+}
+
+type simConsensus struct {
+	consensus.Consensus
+	sim *simNode
+}
+
+func (c *simConsensus) Initialization(local account.Account, master account.Account, participates []account.Account, eventCenter types.EventCenter, onLine bool) {
+}
+
+// Online notify the node online, which starts the first round.
+func (c *simConsensus) Online() {
+	c.sim.node.eventCenter.Notify(types.EventOnline, nil)
+}
+
+// ToConsensus broadcast the proposal and vote for it, then wait until it is committed. The clock
+// is released while waiting, and held again by the commit waking it.
+func (c *simConsensus) ToConsensus(p *consensusCommon.Proposal) error {
+	sim := c.sim
+	if sim.isCrashed() {
+		return errors.New("node crashed")
+	}
+	sim.lock.Lock()
+	proposal := &simProposal{Block: p.Block, View: sim.view, Proposer: sim.name}
+	committed := make(chan struct{})
+	sim.waiters[p.Block.Header.Height] = append(sim.waiters[p.Block.Header.Height], committed)
+	sim.lock.Unlock()
+	sim.endpoint.BroadCast(proposal)
+	sim.onProposal(proposal)
+	clock.Release(sim.node.clock)
+	<-committed
+	return nil
+}
+
+type simRole struct {
+	role.Role
+	sim *simNode
+}
+
+// RoleAssignments rotate the master by height, and by the views of 3 block intervals passed
+// since last commit, which are the rounds timed out.
+func (r *simRole) RoleAssignments(participates []account.Account) (map[account.Account]roleCommon.Roler, account.Account, error) {
+	height, committedAt := r.sim.lastCommit()
+	view := uint64(r.sim.node.clock.Now().Sub(committedAt) / (3 * simBlockInterval * time.Millisecond))
+	r.sim.lock.Lock()
+	r.sim.view = view
+	r.sim.lock.Unlock()
+	master := participates[(height+1+view)%uint64(len(participates))]
+	roles := make(map[account.Account]roleCommon.Roler)
+	for _, participate := range participates {
+		roles[participate] = roleCommon.Slave
+	}
+	roles[master] = roleCommon.Master
+	return roles, master, nil
+}
+
+type simParticipates struct {
+	participates.Participates
+}
+
+func (p *simParticipates) GetParticipates() ([]account.Account, error) {
+	return mockAccounts, nil
+}
+
+type simProducer struct {
+	sim *simNode
+}
+
+func (p *simProducer) MakeBlock() (*types.Block, error) {
+	height, _ := p.sim.lastCommit()
+	return &types.Block{Header: &types.Header{Height: height + 1}}, nil
+}
+
+func (sim *simNode) isCrashed() bool {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	return sim.crashed
+}
+
+func (sim *simNode) lastCommit() (uint64, time.Time) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	return sim.height, sim.committedAt
+}
+
+// vote for the proposal of next height, once in a view.
+func (sim *simNode) onProposal(proposal *simProposal) {
+	height := proposal.Block.Header.Height
+	sim.lock.Lock()
+	if sim.crashed || height <= sim.height {
+		sim.lock.Unlock()
+		return
+	}
+	sim.proposals[proposal.id()] = proposal
+	view := [2]uint64{height, proposal.View}
+	voting := height == sim.height+1 && !sim.voted[view]
+	sim.voted[view] = true
+	sim.lock.Unlock()
+	if !voting {
+		sim.tryCommit(proposal.id())
+		return
+	}
+	vote := &simVote{Proposal: proposal.id(), Height: height, Voter: sim.name}
+	sim.endpoint.BroadCast(vote)
+	sim.onVote(vote)
+}
+
+func (sim *simNode) onVote(vote *simVote) {
+	sim.lock.Lock()
+	if sim.crashed || vote.Height <= sim.height {
+		sim.lock.Unlock()
+		return
+	}
+	if _, ok := sim.votes[vote.Proposal]; !ok {
+		sim.votes[vote.Proposal] = make(map[string]bool)
+	}
+	sim.votes[vote.Proposal][vote.Voter] = true
+	if count := len(sim.votes[vote.Proposal]); count > sim.maxVotes[vote.Height] {
+		sim.maxVotes[vote.Height] = count
+	}
+	sim.lock.Unlock()
+	sim.tryCommit(vote.Proposal)
+}
+
+// commit the proposal once a quorum voted for it.
+func (sim *simNode) tryCommit(id string) {
+	sim.lock.Lock()
+	proposal, ok := sim.proposals[id]
+	committing := ok && len(sim.votes[id]) >= simQuorum
+	sim.lock.Unlock()
+	if committing {
+		sim.commit(proposal.Block, proposal.Proposer)
+	}
+}
+
+// commit the block of next height, which is notified as committed by block switch. The proposer
+// waiting for it is woken with the clock held.
+func (sim *simNode) commit(block *types.Block, proposer string) {
+	sim.lock.Lock()
+	if sim.crashed || block.Header.Height != sim.height+1 {
+		sim.lock.Unlock()
+		return
+	}
+	sim.height = block.Header.Height
+	sim.committedAt = sim.node.clock.Now()
+	sim.commits = append(sim.commits, fmt.Sprintf("%d at %v by %s", sim.height, sim.committedAt.Sub(time.Unix(0, 0)), proposer))
+	for _, committed := range sim.waiters[sim.height] {
+		clock.Hold(sim.node.clock)
+		close(committed)
+	}
+	delete(sim.waiters, sim.height)
+	sim.lock.Unlock()
+	sim.node.eventCenter.Notify(types.EventBlockCommitted, block)
+}
+
+// handle the proposals and votes, the clock held by each message is released once it is handled.
+func (sim *simNode) receiveConsensus() {
+	for msg := range sim.endpoint.MessageChan() {
+		switch payload := msg.Payload.(type) {
+		case *simProposal:
+			sim.onProposal(payload)
+		case *simVote:
+			sim.onVote(payload)
+		}
+		clock.Release(sim.node.clock)
+	}
+}
+
+// record the blocks from block propagator, a channel sent is closed once the blocks before it are recorded.
+func (sim *simNode) receiveBlocks() {
+	for out := range sim.blockOut {
+		switch out := out.(type) {
+		case *types.Block:
+			sim.lock.Lock()
+			sim.relayed[out.Header.Height] = true
+			sim.lock.Unlock()
+		case chan struct{}:
+			close(out)
+		}
+	}
+}
+
+// crash the node, its main loop stops.
+func (sim *simNode) crash() {
+	sim.lock.Lock()
+	sim.crashed = true
+	sim.lock.Unlock()
+	sim.node.sendMsgInternal(justitiaCommon.MsgNodeServiceStopped)
+}
+
+// create the consensus node of mockAccounts[index] in networks, its block propagator relays the
+// committed blocks to the other nodes.
+func newSimNode(t *testing.T, index int, networks map[string]*simnet.Network, virtualClock clock.Clock) *simNode {
+	name := fmt.Sprintf("node%d", index)
+	conf := config.NodeConfig{
+		Account:        mockAccounts[index],
+		NodeType:       justitiaCommon.ConsensusNode,
+		BlockInterval:  simBlockInterval,
+		ConsensusPeers: make(map[types.Address]string),
+	}
+	conf.ConsensusConf.Timeout.TimeoutToWaitCommitMsg = simRoundTimeout
+	for i, participate := range mockAccounts {
+		conf.ConsensusPeers[participate.Address] = fmt.Sprintf("node%d:0", i)
+	}
+	ctx := NewSimulatedContext(conf, networks, name, virtualClock)
+	blockP2P, err := ctx.NewP2P(config.BlockP2P, nil, ctx.EventCenter)
+	assert.Nil(t, err)
+	blockOut := make(chan interface{})
+	blockPropagator, err := propagator.NewBlockPropagator(blockP2P, blockOut, ctx.EventCenter, ctx.Clock)
+	assert.Nil(t, err)
+	consensusP2P, err := ctx.NewP2P(simConsensusP2P, nil, ctx.EventCenter)
+	assert.Nil(t, err)
+	pool := txpool.NewTxPool(txpool.TxPoolConfig{GlobalSlots: 1024, MaxTrsPerBlock: 1024}, ctx.EventCenter)
+	sim := &simNode{
+		name:      name,
+		endpoint:  consensusP2P.(*simnet.Endpoint),
+		blockOut:  blockOut,
+		relayed:   make(map[uint64]bool),
+		voted:     make(map[[2]uint64]bool),
+		proposals: make(map[string]*simProposal),
+		votes:     make(map[string]map[string]bool),
+		maxVotes:  make(map[uint64]int),
+		waiters:   make(map[uint64][]chan struct{}),
+	}
+	sim.node = &Node{
+		context:         ctx,
+		chain:           ctx.Chain(),
+		clock:           ctx.Clock,
+		config:          conf,
+		txpool:          pool,
+		participates:    &simParticipates{},
+		role:            &simRole{sim: sim},
+		consensus:       newTimedConsensus(&simConsensus{sim: sim}, ctx.Clock, ctx.RoundTimeout),
+		producer:        &simProducer{sim: sim},
+		eventCenter:     ctx.EventCenter,
+		msgChannel:      make(chan justitiaCommon.MsgType, msgChannelCacheLimit),
+		serviceChannel:  make(chan interface{}),
+		blockP2P:        blockP2P,
+		blockPropagator: blockPropagator,
+		blockTxs:        &limitedTxPool{TxsPool: pool},
+		metrics:         newNodeMetrics(ctx.Metrics),
+	}
+	sim.committedAt = virtualClock.Now()
+	assert.Nil(t, blockP2P.Start())
+	assert.Nil(t, consensusP2P.Start())
+	assert.Nil(t, blockPropagator.Start())
+	sim.node.eventsRegister()
+	go sim.receiveConsensus()
+	go sim.receiveBlocks()
+	return sim
+}
+
+// simCluster is the nodes of mockAccounts sharing the virtual clock and simulated networks.
+type simCluster struct {
+	clock    *clock.VirtualClock
+	networks map[string]*simnet.Network
+	nodes    []*simNode
+}
+
+// create the nodes and start their main loops, the latencies of networks are drawn from seed.
+func newSimCluster(t *testing.T, seed int64) *simCluster {
+	cluster := &simCluster{
+		clock: clock.NewVirtualClock(time.Unix(0, 0)),
+	}
+	cluster.networks = map[string]*simnet.Network{
+		config.BlockP2P: simnet.NewNetwork(seed, cluster.clock),
+		simConsensusP2P: simnet.NewNetwork(seed+1, cluster.clock),
+	}
+	for _, network := range cluster.networks {
+		network.SetLatency(10*time.Millisecond, 50*time.Millisecond)
+	}
+	for index := range mockAccounts {
+		cluster.nodes = append(cluster.nodes, newSimNode(t, index, cluster.networks, cluster.clock))
+	}
+	for _, sim := range cluster.nodes {
+		cluster.clock.Hold()
+		go sim.node.mainLoop()
+	}
+	return cluster
+}
+
+func (cluster *simCluster) stop() {
+	for _, sim := range cluster.nodes {
+		sim.node.blockPropagator.Stop()
+	}
+}
+
+// step the clock until done, act is called before each step. The timers are fired one at a
+// time once the work woken by the last one is done, so that the latencies drawn from seed
+// are taken in the same order.
+func (cluster *simCluster) run(t *testing.T, done func() bool, act func()) {
+	for steps := 0; ; steps++ {
+		cluster.clock.WaitIdle()
+		if done() {
+			return
+		}
+		if steps > 10000 {
+			t.Fatal("scenario not finished")
+		}
+		act()
+		if !cluster.clock.Step() {
+			t.Fatal("no timer pending, the nodes stopped")
+		}
+	}
+}
+
+func (cluster *simCluster) partition(groups ...[]string) {
+	for _, network := range cluster.networks {
+		network.Partition(groups...)
+	}
+}
+
+func (cluster *simCluster) heal() {
+	for _, network := range cluster.networks {
+		network.Heal()
+	}
+}
+
+// check whether the nodes at indexes reached height.
+func (cluster *simCluster) reached(height uint64, indexes ...int) bool {
+	for _, index := range indexes {
+		if current, _ := cluster.nodes[index].lastCommit(); current < height {
+			return false
+		}
+	}
+	return true
+}
+
+// commits of nodes, and the heights relayed to them by block propagators.
+func (cluster *simCluster) result() ([][]string, []map[uint64]bool) {
+	commits := make([][]string, 0, len(cluster.nodes))
+	relayed := make([]map[uint64]bool, 0, len(cluster.nodes))
+	for _, sim := range cluster.nodes {
+		recorded := make(chan struct{})
+		sim.blockOut <- recorded
+		<-recorded
+		sim.lock.Lock()
+		commits = append(commits, append([]string{}, sim.commits...))
+		heights := make(map[uint64]bool)
+		for height := range sim.relayed {
+			heights[height] = true
+		}
+		relayed = append(relayed, heights)
+		sim.lock.Unlock()
+	}
+	return commits, relayed
+}
+
+// proposers of commits in order, which are the same on all nodes without fork.
+func proposers(commits []string) []string {
+	proposers := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		proposers = append(proposers, commit[strings.Index(commit, " by ")+4:])
+	}
+	return proposers
+}
+
+// run the scenario of 4 nodes whose master of height 4 crashes, returns the commits of nodes.
+func runMasterCrash(t *testing.T, seed int64) [][]string {
+	cluster := newSimCluster(t, seed)
+	defer cluster.stop()
+	nodes := cluster.nodes
+	cluster.run(t, func() bool {
+		return cluster.reached(8, 1, 2, 3)
+	}, func() {
+		if cluster.reached(3, 0) && !nodes[0].isCrashed() {
+			// node0 is the master of height 4, it crashes before its next round
+			nodes[0].crash()
+			cluster.partition([]string{"node0"}, []string{"node1", "node2", "node3"})
+		}
+	})
+
+	commits, relayed := cluster.result()
+	for index := 1; index < len(nodes); index++ {
+		for height := uint64(1); height < 8; height++ {
+			assert.True(t, relayed[index][height], "block %d not relayed to %s", height, nodes[index].name)
+		}
+	}
+	return commits
+}
+
+// the master crashes, the others time out and rotate the master, and the scenario replays the
+// same from the same seed.
+func TestSimulation_MasterCrash(t *testing.T) {
+	assert := assert.New(t)
+	commits := runMasterCrash(t, 7)
+	assert.Equal(3, len(commits[0]))
+	assert.Equal([]string{"node1", "node2", "node3"}, proposers(commits[0]))
+	for _, nodeCommits := range commits[1:] {
+		assert.Equal(8, len(nodeCommits))
+		for index, commit := range nodeCommits {
+			assert.Contains(commit, fmt.Sprintf("%d at ", index+1))
+		}
+		// node0 is the master of height 4 and 8, the master of next view proposes them
+		assert.Equal([]string{"node1", "node2", "node3", "node1", "node1", "node2", "node3", "node1"}, proposers(nodeCommits))
+	}
+	// the round of node0 times out after twice the block interval, and the master of next view
+	// proposes after another block interval
+	assert.Contains(commits[1][3], "4 at 7.")
+
+	assert.Equal(commits, runMasterCrash(t, 7))
+}
+
+// run the scenario of 4 nodes split in halves for 4 views, returns the commits of nodes, the height
+// they stopped at while partitioned, and the most votes a proposal got at the next height.
+func runSplitVote(t *testing.T, seed int64) ([][]string, uint64, []int) {
+	cluster := newSimCluster(t, seed)
+	defer cluster.stop()
+	nodes := cluster.nodes
+	all := []int{0, 1, 2, 3}
+	cluster.run(t, func() bool {
+		return cluster.reached(2, all...)
+	}, func() {})
+
+	cluster.partition([]string{"node0", "node1"}, []string{"node2", "node3"})
+	partitionedAt := cluster.clock.Now()
+	cluster.run(t, func() bool {
+		return !cluster.clock.Now().Before(partitionedAt.Add(4 * 3 * simBlockInterval * time.Millisecond))
+	}, func() {})
+	stopped, _ := nodes[0].lastCommit()
+	maxVotes := make([]int, 0, len(nodes))
+	for _, sim := range nodes {
+		height, _ := sim.lastCommit()
+		assert.Equal(t, stopped, height, "%s committed while partitioned", sim.name)
+		sim.lock.Lock()
+		maxVotes = append(maxVotes, sim.maxVotes[stopped+1])
+		sim.lock.Unlock()
+	}
+
+	cluster.heal()
+	cluster.run(t, func() bool {
+		return cluster.reached(stopped+3, all...)
+	}, func() {})
+	commits, _ := cluster.result()
+	return commits, stopped, maxVotes
+}
+
+// the halves vote for the proposals of their own masters, neither reaches a quorum and the rounds
+// time out on the virtual clock. Once healed, the proposal of next master is committed on all
+// nodes, and the scenario replays the same from the same seed.
+func TestSimulation_SplitVote(t *testing.T) {
+	assert := assert.New(t)
+	commits, stopped, maxVotes := runSplitVote(t, 11)
+	for _, votes := range maxVotes {
+		assert.Equal(2, votes)
+	}
+	for _, nodeCommits := range commits {
+		assert.True(uint64(len(nodeCommits)) >= stopped+3)
+		assert.Equal(proposers(commits[0])[:stopped+3], proposers(nodeCommits)[:stopped+3])
+	}
+
+	replayed, replayedStopped, replayedVotes := runSplitVote(t, 11)
+	assert.Equal(commits, replayed)
+	assert.Equal(stopped, replayedStopped)
+	assert.Equal(maxVotes, replayedVotes)
+}
@@ -2,14 +2,27 @@ package propagator
 
 import (
 	"errors"
+	"fmt"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/fault"
 	"github.com/DSiSc/p2p"
+	pcommon "github.com/DSiSc/p2p/common"
 	"github.com/DSiSc/p2p/message"
+	"net"
+	"sort"
 	"sync"
+	"time"
 )
 
+// priorityLaneCacheLimit is the number of committed blocks that can wait on the priority lane.
+const priorityLaneCacheLimit = 16
+
+// priorityRelayLead is the time committed blocks are relayed to consensus peers ahead of the others.
+const priorityRelayLead = 100 * time.Millisecond
+
 //BlockPropagator block message propagator
 type BlockPropagator struct {
 	p2p         p2p.P2PAPI
@@ -19,20 +32,66 @@ type BlockPropagator struct {
 	subscribers map[types.EventType]types.Subscriber
 	lock        sync.Mutex
 	isRuning    int32
+	// time source of the relay lead, a virtual clock in simulation
+	clock clock.Clock
+	// block p2p addresses of consensus participants in address order, committed blocks are relayed to them first
+	consensusPeers     []*pcommon.NetAddress
+	consensusPeersLock sync.RWMutex
+	priorityLane       chan *types.Block
+	// faults injected into block messages, nil if fault injection disabled
+	faults *fault.Injector
 }
 
 // NewBlockPropagator create a new NewBlockPropagator instance.
-func NewBlockPropagator(p2p p2p.P2PAPI, blockOut chan<- interface{}, eventCenter types.EventCenter) (*BlockPropagator, error) {
+func NewBlockPropagator(p2p p2p.P2PAPI, blockOut chan<- interface{}, eventCenter types.EventCenter, clock clock.Clock) (*BlockPropagator, error) {
 	return &BlockPropagator{
-		p2p:         p2p,
-		blockOut:    blockOut,
-		quitChan:    make(chan interface{}),
-		eventCenter: eventCenter,
-		subscribers: make(map[types.EventType]types.Subscriber),
-		isRuning:    0,
+		p2p:            p2p,
+		blockOut:       blockOut,
+		quitChan:       make(chan interface{}),
+		eventCenter:    eventCenter,
+		subscribers:    make(map[types.EventType]types.Subscriber),
+		isRuning:       0,
+		clock:          clock,
+		consensusPeers: make([]*pcommon.NetAddress, 0),
+		priorityLane:   make(chan *types.Block, priorityLaneCacheLimit),
 	}, nil
 }
 
+// SetFaultInjector set the injector of faults at block messages sent and received.
+func (bp *BlockPropagator) SetFaultInjector(injector *fault.Injector) {
+	bp.faults = injector
+}
+
+// SetConsensusPeers update the block p2p addresses(host:port) of consensus participants that
+// committed blocks will be relayed to first. The invalid addresses are skipped.
+func (bp *BlockPropagator) SetConsensusPeers(addrs []string) {
+	sorted := append([]string{}, addrs...)
+	sort.Strings(sorted)
+	consensusPeers := make([]*pcommon.NetAddress, 0, len(sorted))
+	for _, addr := range sorted {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			log.Warn("invalid block p2p address %s of consensus peer, as: %v", addr, err)
+			continue
+		}
+		peer := &pcommon.NetAddress{IP: host}
+		if _, err := fmt.Sscan(port, &peer.Port); err != nil {
+			log.Warn("invalid block p2p address %s of consensus peer, as: %v", addr, err)
+			continue
+		}
+		consensusPeers = append(consensusPeers, peer)
+	}
+	bp.consensusPeersLock.Lock()
+	defer bp.consensusPeersLock.Unlock()
+	bp.consensusPeers = consensusPeers
+}
+
+func (bp *BlockPropagator) getConsensusPeers() []*pcommon.NetAddress {
+	bp.consensusPeersLock.RLock()
+	defer bp.consensusPeersLock.RUnlock()
+	return bp.consensusPeers
+}
+
 // BlockEventFunc get a EventFunc that can be bound to event center
 func (bp *BlockPropagator) BlockEventFunc(event interface{}) {
 	switch event.(type) {
@@ -43,14 +102,99 @@ func (bp *BlockPropagator) BlockEventFunc(event interface{}) {
 	}
 }
 
+// CommittedBlockEventFunc get a EventFunc that put the committed block to the priority lane
+func (bp *BlockPropagator) CommittedBlockEventFunc(event interface{}) {
+	switch event.(type) {
+	case *types.Block:
+		// the clock is held until the block relayed by priority handler
+		clock.Hold(bp.clock)
+		select {
+		case bp.priorityLane <- event.(*types.Block):
+		default:
+			clock.Release(bp.clock)
+			log.Warn("block priority lane is full, will broadcast block directly")
+			bp.broadCastBlock(event.(*types.Block))
+		}
+	default:
+		log.Warn("received a unknown committed block event")
+	}
+}
+
 // broadcast message to p2p network
 func (bp *BlockPropagator) broadCastBlock(block *types.Block) {
+	if bp.faults.Drop(fault.BlockSend) {
+		log.Warn("drop block %x to broadcast, as fault injected", common.HeaderHash(block))
+		return
+	}
 	bmsg := &message.Block{
 		Block: block,
 	}
 	bp.p2p.BroadCast(bmsg)
 }
 
+// relay block to consensus peers first, then send it to the other peers once the consensus peers
+// have a lead of priorityRelayLead.
+func (bp *BlockPropagator) relayBlock(block *types.Block) {
+	if bp.faults.Drop(fault.BlockSend) {
+		log.Warn("drop block %x to relay, as fault injected", common.HeaderHash(block))
+		return
+	}
+	bmsg := &message.Block{
+		Block: block,
+	}
+	consensusPeers := bp.getConsensusPeers()
+	if 0 == len(consensusPeers) {
+		bp.p2p.BroadCast(bmsg)
+		return
+	}
+	for _, addr := range consensusPeers {
+		if err := bp.p2p.SendMsg(addr, bmsg); nil != err {
+			log.Warn("failed to relay block %x to consensus peer %s, as: %v", common.HeaderHash(block), addr.ToString(), err)
+		}
+	}
+	bp.clock.AfterFunc(priorityRelayLead, func() {
+		select {
+		case <-bp.quitChan:
+			return
+		default:
+		}
+		for _, addr := range bp.peerAddrs() {
+			if isConsensusPeer(consensusPeers, addr) {
+				continue
+			}
+			if err := bp.p2p.SendMsg(addr, bmsg); nil != err {
+				log.Warn("failed to relay block %x to peer %s, as: %v", common.HeaderHash(block), addr.ToString(), err)
+			}
+		}
+	})
+}
+
+// peerAddrs get the addresses of connected peers, from the p2p listing them directly if it can.
+func (bp *BlockPropagator) peerAddrs() []*pcommon.NetAddress {
+	if lister, ok := bp.p2p.(interface {
+		PeerAddrs() []*pcommon.NetAddress
+	}); ok {
+		return lister.PeerAddrs()
+	}
+	peers := bp.p2p.GetPeers()
+	addrs := make([]*pcommon.NetAddress, 0, len(peers))
+	for _, peer := range peers {
+		addrs = append(addrs, peer.GetAddr())
+	}
+	return addrs
+}
+
+// isConsensusPeer check whether addr is one of the consensus peers, which have got the block
+// on priority lane.
+func isConsensusPeer(consensusPeers []*pcommon.NetAddress, addr *pcommon.NetAddress) bool {
+	for _, peer := range consensusPeers {
+		if peer.IP == addr.IP && peer.Port == addr.Port {
+			return true
+		}
+	}
+	return false
+}
+
 // Start start propagator
 func (bp *BlockPropagator) Start() error {
 	bp.lock.Lock()
@@ -61,9 +205,10 @@ func (bp *BlockPropagator) Start() error {
 	}
 	bp.isRuning = 1
 
-	bp.subscribers[types.EventBlockCommitted] = bp.eventCenter.Subscribe(types.EventBlockCommitted, bp.BlockEventFunc)
+	bp.subscribers[types.EventBlockCommitted] = bp.eventCenter.Subscribe(types.EventBlockCommitted, bp.CommittedBlockEventFunc)
 	bp.subscribers[types.EventBlockWritten] = bp.eventCenter.Subscribe(types.EventBlockWritten, bp.BlockEventFunc)
 	go bp.recvHandler()
+	go bp.priorityHandler()
 	return nil
 }
 
@@ -82,22 +227,46 @@ func (bp *BlockPropagator) Stop() {
 	}
 }
 
-// receive handler will receive block from p2p, and send the block to gossip switch
+// receive handler will receive block from p2p, and send the block to gossip switch. The clock
+// held by the message received is released once the block is sent.
 func (bp *BlockPropagator) recvHandler() {
 	for {
 		select {
 		case msg := <-bp.p2p.MessageChan():
-			switch msg.Payload.(type) {
-			case *message.Block:
-				bmsg := msg.Payload.(*message.Block)
-				log.Debug("received a block %x", common.HeaderHash(bmsg.Block))
-				bp.blockOut <- bmsg.Block
-			default:
-				log.Error("received an invalid block message, message type: %v", msg.Payload.MsgType())
-			}
+			bp.recvBlock(msg)
+			clock.Release(bp.clock)
 		case <-bp.quitChan:
 			log.Info("exit propagator receive handler, as propagator already stopped")
 			return
 		}
 	}
 }
+
+func (bp *BlockPropagator) recvBlock(msg *p2p.InternalMsg) {
+	switch msg.Payload.(type) {
+	case *message.Block:
+		bmsg := msg.Payload.(*message.Block)
+		log.Debug("received a block %x", common.HeaderHash(bmsg.Block))
+		if bp.faults.Drop(fault.BlockRecv) {
+			log.Warn("drop received block %x, as fault injected", common.HeaderHash(bmsg.Block))
+			return
+		}
+		bp.blockOut <- bmsg.Block
+	default:
+		log.Error("received an invalid block message, message type: %v", msg.Payload.MsgType())
+	}
+}
+
+// priority handler relay the committed blocks in the priority lane
+func (bp *BlockPropagator) priorityHandler() {
+	for {
+		select {
+		case block := <-bp.priorityLane:
+			bp.relayBlock(block)
+			clock.Release(bp.clock)
+		case <-bp.quitChan:
+			log.Info("exit propagator priority handler, as propagator already stopped")
+			return
+		}
+	}
+}
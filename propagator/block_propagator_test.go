@@ -1,15 +1,20 @@
 package propagator
 
 import (
+	"fmt"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/tools/clock"
 	"github.com/DSiSc/justitia/tools/events"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/p2p"
+	pcommon "github.com/DSiSc/p2p/common"
 	pconf "github.com/DSiSc/p2p/config"
 	"github.com/DSiSc/p2p/message"
 	"github.com/stretchr/testify/assert"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func mockP2P() *p2p.P2P {
@@ -23,7 +28,7 @@ func mockP2P() *p2p.P2P {
 func TestNewBlockPropagator(t *testing.T) {
 	assert := assert.New(t)
 	blockOut := make(chan interface{})
-	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent())
+	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent(), clock.NewSystemClock())
 	assert.Nil(err)
 	assert.NotNil(bp)
 }
@@ -31,7 +36,7 @@ func TestNewBlockPropagator(t *testing.T) {
 func TestBlockPropagator_Start(t *testing.T) {
 	assert := assert.New(t)
 	blockOut := make(chan interface{})
-	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent())
+	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent(), clock.NewSystemClock())
 	assert.Nil(err)
 	assert.NotNil(bp)
 	err = bp.Start()
@@ -50,7 +55,7 @@ func TestBlockPropagator_RecvMsg(t *testing.T) {
 		return msgChan
 	})
 
-	bp, err := NewBlockPropagator(p2pN, blockOut, events.NewEvent())
+	bp, err := NewBlockPropagator(p2pN, blockOut, events.NewEvent(), clock.NewSystemClock())
 	assert.Nil(err)
 	assert.NotNil(bp)
 	err = bp.Start()
@@ -76,7 +81,7 @@ func TestBlockPropagator_RecvMsg(t *testing.T) {
 func TestBlockPropagator_BlockEventFunc(t *testing.T) {
 	assert := assert.New(t)
 	blockOut := make(chan interface{})
-	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent())
+	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent(), clock.NewSystemClock())
 	assert.Nil(err)
 	assert.NotNil(bp)
 	err = bp.Start()
@@ -91,7 +96,7 @@ func TestBlockPropagator_BlockEventFunc(t *testing.T) {
 func TestBlockPropagator_Stop(t *testing.T) {
 	assert := assert.New(t)
 	blockOut := make(chan interface{})
-	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent())
+	bp, err := NewBlockPropagator(mockP2P(), blockOut, events.NewEvent(), clock.NewSystemClock())
 	assert.Nil(err)
 	assert.NotNil(bp)
 	err = bp.Start()
@@ -100,3 +105,55 @@ func TestBlockPropagator_Stop(t *testing.T) {
 	bp.Stop()
 	assert.Equal(int32(0), bp.isRuning)
 }
+
+func TestBlockPropagator_RelayBlock(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	p2pN := mockP2P()
+	var lock sync.Mutex
+	sendOrder := make([]string, 0)
+	sent := make(chan string, 4)
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "SendMsg", func(this *p2p.P2P, addr *pcommon.NetAddress, msg message.Message) error {
+		lock.Lock()
+		defer lock.Unlock()
+		sendOrder = append(sendOrder, fmt.Sprintf("%s:%d", addr.IP, addr.Port))
+		sent <- fmt.Sprintf("%s:%d", addr.IP, addr.Port)
+		return nil
+	})
+	consensusPeer, otherPeer := &p2p.Peer{}, &p2p.Peer{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "GetPeers", func(this *p2p.P2P) []*p2p.Peer {
+		return []*p2p.Peer{consensusPeer, otherPeer}
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(consensusPeer), "GetAddr", func(this *p2p.Peer) *pcommon.NetAddress {
+		if this == consensusPeer {
+			return &pcommon.NetAddress{IP: "127.0.0.1", Port: 8080}
+		}
+		return &pcommon.NetAddress{IP: "127.0.0.1", Port: 8070}
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "BroadCast", func(this *p2p.P2P, msg message.Message) {
+		t.Fatal("block relayed to consensus peers should not be broadcast")
+	})
+
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	bp, err := NewBlockPropagator(p2pN, make(chan interface{}), events.NewEvent(), virtualClock)
+	assert.Nil(err)
+	bp.SetConsensusPeers([]string{"127.0.0.1:8090", "127.0.0.1:8080", "invalid"})
+	bp.relayBlock(&types.Block{})
+	assert.Equal("127.0.0.1:8080", <-sent)
+	assert.Equal("127.0.0.1:8090", <-sent)
+
+	// the other peers get the block after the consensus peers' lead, and the consensus peers
+	// don't get it twice
+	virtualClock.Advance(priorityRelayLead - time.Millisecond)
+	assert.Equal(0, len(sent))
+	virtualClock.Advance(time.Millisecond)
+	select {
+	case addr := <-sent:
+		assert.Equal("127.0.0.1:8070", addr)
+	case <-time.After(time.Second):
+		t.Fatal("block not relayed to the other peers")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal([]string{"127.0.0.1:8080", "127.0.0.1:8090", "127.0.0.1:8070"}, sendOrder)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/tools/fault"
 	"github.com/DSiSc/p2p"
 	"github.com/DSiSc/p2p/message"
 	"sync"
@@ -19,6 +20,8 @@ type TxPropagator struct {
 	lock        sync.Mutex
 	eventCenter types.EventCenter
 	subscribers map[types.EventType]types.Subscriber
+	// faults injected into tx messages, nil if fault injection disabled
+	faults *fault.Injector
 }
 
 // NewBlockPropagator create a new NewBlockPropagator instance.
@@ -33,6 +36,11 @@ func NewTxPropagator(p2p p2p.P2PAPI, txOut chan<- interface{}, eventCenter types
 	}, nil
 }
 
+// SetFaultInjector set the injector of faults at tx messages sent and received.
+func (tp *TxPropagator) SetFaultInjector(injector *fault.Injector) {
+	tp.faults = injector
+}
+
 // BlockEventFunc get a EventFunc that can be bound to event center
 func (tp *TxPropagator) TxEventFunc(event interface{}) {
 	switch event.(type) {
@@ -45,6 +53,10 @@ func (tp *TxPropagator) TxEventFunc(event interface{}) {
 
 // broadcast tx message to p2p network
 func (tp *TxPropagator) broadCastTx(tx *types.Transaction) {
+	if tp.faults.Drop(fault.TxSend) {
+		log.Warn("drop transaction %x to broadcast, as fault injected", common.TxHash(tx))
+		return
+	}
 	tmsg := &message.Transaction{
 		Tx: tx,
 	}
@@ -91,6 +103,10 @@ func (tp *TxPropagator) recvHandler() {
 			case *message.Transaction:
 				txmsg := msg.Payload.(*message.Transaction)
 				log.Debug("received a transaction %x", common.TxHash(txmsg.Tx))
+				if tp.faults.Drop(fault.TxRecv) {
+					log.Warn("drop received transaction %x, as fault injected", common.TxHash(txmsg.Tx))
+					continue
+				}
 				tp.txOut <- txmsg.Tx
 			default:
 				log.Error("received an invalid transaction message, message type: %v", msg.Payload.MsgType())
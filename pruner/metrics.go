@@ -0,0 +1,36 @@
+package pruner
+
+import (
+	"github.com/DSiSc/justitia/tools/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of pruner registered in the registerer of node.
+type pruneMetrics struct {
+	prunedHeight   prometheus.Gauge
+	prunedStates   prometheus.Counter
+	reclaimedBytes prometheus.Counter
+}
+
+func newPruneMetrics(registerer prometheus.Registerer) *pruneMetrics {
+	return &pruneMetrics{
+		prunedHeight: metrics.Gauge(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "justitia",
+			Subsystem: "pruner",
+			Name:      "pruned_height",
+			Help:      "The highest height whose state has been pruned.",
+		})),
+		prunedStates: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "pruner",
+			Name:      "pruned_states",
+			Help:      "The number of states pruned.",
+		})),
+		reclaimedBytes: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "pruner",
+			Name:      "reclaimed_bytes",
+			Help:      "The bytes reclaimed by pruning.",
+		})),
+	}
+}
@@ -0,0 +1,306 @@
+package pruner
+
+import (
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/repository"
+	"time"
+)
+
+// Database is the handle of the state store shared by the repository opening it, through which
+// the states are pruned while the repository is writing.
+type Database interface {
+	// Get get the value of key, nil if the key not exist
+	Get(key []byte) ([]byte, error)
+	// Delete delete the keys from the database
+	Delete(keys [][]byte) error
+}
+
+// refCounter count the references to the trie nodes and codes from the state roots of kept blocks,
+// a node losing all its references is dead.
+type refCounter struct {
+	db   Database
+	refs map[types.Hash]int
+}
+
+func newRefCounter(db Database) *refCounter {
+	return &refCounter{
+		db:   db,
+		refs: make(map[types.Hash]int),
+	}
+}
+
+// ref add a reference to node, the children of the node referred the first time are referred by it.
+// The node not in database is skipped, which is the root of empty trie.
+func (counter *refCounter) ref(node nodeRef) error {
+	if count, ok := counter.refs[node.hash]; ok {
+		counter.refs[node.hash] = count + 1
+		return nil
+	}
+	data, err := counter.db.Get(node.hash[:])
+	if err != nil {
+		return fmt.Errorf("failed to get trie node %x, as: %v", node.hash, err)
+	}
+	if nil == data {
+		return nil
+	}
+	counter.refs[node.hash] = 1
+	if node.isCode {
+		return nil
+	}
+	refs, err := nodeRefs(data, node.isState)
+	if err != nil {
+		return fmt.Errorf("failed to decode trie node %x, as: %v", node.hash, err)
+	}
+	for _, ref := range refs {
+		if err := counter.ref(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deref remove a reference to node, the node losing all its references is appended to dead and its
+// children lose the reference from it.
+func (counter *refCounter) deref(node nodeRef, dead *[]deadNode) error {
+	count, ok := counter.refs[node.hash]
+	if !ok {
+		return nil
+	}
+	if count > 1 {
+		counter.refs[node.hash] = count - 1
+		return nil
+	}
+	delete(counter.refs, node.hash)
+	data, err := counter.db.Get(node.hash[:])
+	if err != nil {
+		return fmt.Errorf("failed to get trie node %x, as: %v", node.hash, err)
+	}
+	*dead = append(*dead, deadNode{hash: node.hash, size: len(node.hash) + len(data)})
+	if node.isCode || nil == data {
+		return nil
+	}
+	refs, err := nodeRefs(data, node.isState)
+	if err != nil {
+		return fmt.Errorf("failed to decode trie node %x, as: %v", node.hash, err)
+	}
+	for _, ref := range refs {
+		if err := counter.deref(ref, dead); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referred check whether the node is referred by a kept state root.
+func (counter *refCounter) referred(hash types.Hash) bool {
+	_, ok := counter.refs[hash]
+	return ok
+}
+
+// trie node or code losing all its references, size is the bytes of its entry in database.
+type deadNode struct {
+	hash types.Hash
+	size int
+}
+
+// SetDatabase set the handle of the state store shared by the repository, it must be called before
+// Start. Once it is set, the states of the blocks beyond the kept ones are deleted in background as
+// blocks committed, otherwise they are only swept at restart.
+func (pruner *Pruner) SetDatabase(db Database) {
+	pruner.lock.Lock()
+	defer pruner.lock.Unlock()
+	pruner.db = db
+}
+
+// Wrap returns a channel in front of the block switch in-port channel, the dead states are not
+// deleted while the blocks sent to it are being written, as the block written may bring a dead
+// node back. The in-port is returned as is if there is no database to prune states in background.
+func (pruner *Pruner) Wrap(in chan<- interface{}) chan<- interface{} {
+	if nil == pruner.db {
+		return in
+	}
+	ch := make(chan interface{}, cap(in))
+	go func() {
+		for msg := range ch {
+			if block, ok := msg.(*types.Block); ok {
+				pruner.gate.Lock()
+				pruner.writing[block.Header.Height] = true
+				pruner.gate.Unlock()
+			}
+			in <- msg
+		}
+	}()
+	return ch
+}
+
+// BlockEventFunc prune the states in background after a block committed.
+func (pruner *Pruner) BlockEventFunc(event interface{}) {
+	select {
+	case pruner.committed <- struct{}{}:
+	default:
+	}
+}
+
+// start pruning states in background, the state roots of the blocks above the prune target are
+// counted. The states of lower blocks left by last run are swept at next start.
+func (pruner *Pruner) startOnline() error {
+	chain, err := pruner.chain.Latest()
+	if err != nil {
+		return fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	pruner.counter = newRefCounter(pruner.db)
+	pruner.kept = pruner.kept[:0]
+	pruner.pending = nil
+	pruner.stop = make(chan struct{})
+	pruner.done = make(chan struct{})
+	pruner.last = 0
+	if current := chain.GetCurrentBlock(); nil != current {
+		target, err := PruneTarget(chain, pruner.conf, current)
+		if err != nil {
+			return err
+		}
+		// the current state is always kept
+		if target >= current.Header.Height && current.Header.Height > 0 {
+			target = current.Header.Height - 1
+		}
+		// the genesis state is always kept
+		genesis, err := chain.GetBlockByHeight(0)
+		if nil == err && nil != genesis {
+			if err := pruner.counter.ref(nodeRef{hash: genesis.Header.StateRoot, isState: true}); err != nil {
+				return err
+			}
+		}
+		// the node seeded by snapshot has no block below the snapshot, nor their states
+		for height := target + 1; height <= current.Header.Height; height++ {
+			block, err := chain.GetBlockByHeight(height)
+			if err != nil || nil == block {
+				continue
+			}
+			if err := pruner.keep(block.Header); err != nil {
+				return err
+			}
+		}
+		pruner.last = current.Header.Height
+	}
+	go pruner.run(pruner.stop, pruner.done)
+	return nil
+}
+
+// stop pruning states in background, the dead states not deleted yet are left to the sweep at next start.
+func (pruner *Pruner) stopOnline() {
+	close(pruner.stop)
+	<-pruner.done
+}
+
+func (pruner *Pruner) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-pruner.committed:
+			chain, err := pruner.chain.Latest()
+			if err != nil {
+				log.Error("failed to get latest state repository, as: %v", err)
+				continue
+			}
+			if err := pruner.prune(chain); err != nil {
+				// the counts may miss references now, the states are left to the sweep at next start
+				log.Error("failed to prune states, stop pruning until restart, as: %v", err)
+				<-stop
+				return
+			}
+		}
+	}
+}
+
+// prune the states after blocks committed: the state roots of new blocks are counted, then the
+// states dead since last pruning are deleted, and the blocks beyond the kept ones lose their states.
+// The dead states are deleted a block later, so that the states brought back by the new blocks are
+// counted before deletion.
+func (pruner *Pruner) prune(chain *repository.Repository) error {
+	current := chain.GetCurrentBlock()
+	if nil == current {
+		return nil
+	}
+	for height := pruner.last + 1; height <= current.Header.Height; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil || nil == block {
+			return fmt.Errorf("failed to get block %d, as: %v", height, err)
+		}
+		if err := pruner.keep(block.Header); err != nil {
+			return err
+		}
+		pruner.last = height
+	}
+	if err := pruner.deleteDead(current.Header.Height); err != nil {
+		return err
+	}
+	for len(pruner.kept) > 1 && pruner.expired(pruner.kept[0], current.Header) {
+		header := pruner.kept[0]
+		if err := pruner.counter.deref(nodeRef{hash: header.StateRoot, isState: true}, &pruner.pending); err != nil {
+			return err
+		}
+		pruner.kept = pruner.kept[1:]
+		pruner.metrics.prunedHeight.Set(float64(header.Height))
+		pruner.metrics.prunedStates.Inc()
+	}
+	return nil
+}
+
+// keep the state of block until it is beyond the kept ones.
+func (pruner *Pruner) keep(header *types.Header) error {
+	if err := pruner.counter.ref(nodeRef{hash: header.StateRoot, isState: true}); err != nil {
+		return err
+	}
+	pruner.kept = append(pruner.kept, header)
+	return nil
+}
+
+// check whether the state of block is beyond the kept ones after current block.
+func (pruner *Pruner) expired(header *types.Header, current *types.Header) bool {
+	switch pruner.conf.Mode {
+	case common.StatesPruningMode:
+		return header.Height+pruner.conf.KeepStates <= current.Height
+	case common.AgePruningMode:
+		return header.Timestamp < uint64(time.Now().Unix()-pruner.conf.KeepTime)
+	default:
+		return false
+	}
+}
+
+// delete the dead states not referred again, they are kept while blocks above current are being written.
+func (pruner *Pruner) deleteDead(current uint64) error {
+	pruner.gate.Lock()
+	defer pruner.gate.Unlock()
+	for height := range pruner.writing {
+		if height <= current {
+			delete(pruner.writing, height)
+		}
+	}
+	if len(pruner.writing) > 0 || 0 == len(pruner.pending) {
+		return nil
+	}
+	keys := make([][]byte, 0, len(pruner.pending))
+	deleted := make(map[types.Hash]bool)
+	var reclaimed int
+	for _, node := range pruner.pending {
+		// the node dies again after it is referred by a new block
+		if pruner.counter.referred(node.hash) || deleted[node.hash] {
+			continue
+		}
+		deleted[node.hash] = true
+		keys = append(keys, append([]byte{}, node.hash[:]...))
+		reclaimed += node.size
+	}
+	if err := pruner.db.Delete(keys); err != nil {
+		return fmt.Errorf("failed to delete dead states, as: %v", err)
+	}
+	pruner.pending = nil
+	pruner.metrics.reclaimedBytes.Add(float64(reclaimed))
+	log.Debug("delete %d dead states, reclaimed %d bytes", len(keys), reclaimed)
+	return nil
+}
@@ -0,0 +1,145 @@
+package pruner
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/repository"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Plan is the pruning progress of the state store, it is recorded beside the store, as the store
+// is only swept while the repository is not opened on it.
+type Plan struct {
+	// highest height whose state has been swept
+	Pruned uint64 `json:"pruned"`
+	// highest height whose state will be swept
+	Target uint64 `json:"target"`
+	// roots of all the states not pruned, which are kept by sweeping
+	Keep []types.Hash `json:"keep"`
+	// the roots are collected after the repository stopped writing states, the plan is not applied otherwise
+	Clean bool `json:"clean"`
+}
+
+// Pending check whether there are states to sweep.
+func (plan *Plan) Pending() bool {
+	return plan.Clean && plan.Target > plan.Pruned
+}
+
+// path of the plan of state store at stateDataPath.
+func planPath(stateDataPath string) string {
+	return filepath.Clean(stateDataPath) + ".prune.json"
+}
+
+// ReadPlan read the pruning plan of state store, a plan without progress is returned if it is not recorded.
+func ReadPlan(stateDataPath string) (*Plan, error) {
+	plan := new(Plan)
+	data, err := ioutil.ReadFile(planPath(stateDataPath))
+	if os.IsNotExist(err) {
+		return plan, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pruning plan, as: %v", err)
+	}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("failed to parse pruning plan, as: %v", err)
+	}
+	return plan, nil
+}
+
+// WritePlan record the pruning plan of state store, the plan is replaced as a whole.
+func WritePlan(stateDataPath string, plan *Plan) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode pruning plan, as: %v", err)
+	}
+	path := planPath(stateDataPath)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write pruning plan, as: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write pruning plan, as: %v", err)
+	}
+	return nil
+}
+
+// DiscardPlan drop the states planned to sweep, as the repository is going to write states not
+// kept by the plan. The progress is kept.
+func DiscardPlan(stateDataPath string) error {
+	plan, err := ReadPlan(stateDataPath)
+	if err != nil {
+		return err
+	}
+	if !plan.Clean {
+		return nil
+	}
+	return WritePlan(stateDataPath, &Plan{Pruned: plan.Pruned, Target: plan.Pruned})
+}
+
+// NewPlan plan to prune the states to the prune target of current block, the repository must not
+// write states until the plan is applied or discarded.
+func NewPlan(chain *repository.Repository, conf config.PruningConfig, pruned uint64) (*Plan, error) {
+	current := chain.GetCurrentBlock()
+	if nil == current || 0 == current.Header.Height {
+		return &Plan{Pruned: pruned, Target: pruned}, nil
+	}
+	target, err := PruneTarget(chain, conf, current)
+	if err != nil {
+		return nil, err
+	}
+	// the current state is always kept
+	if target >= current.Header.Height {
+		target = current.Header.Height - 1
+	}
+	if target < pruned {
+		target = pruned
+	}
+	plan := &Plan{
+		Pruned: pruned,
+		Target: target,
+		Keep:   []types.Hash{current.Header.StateRoot},
+		Clean:  true,
+	}
+	// the node seeded by snapshot has no block below the snapshot, nor their states
+	for height := current.Header.Height - 1; height > target; height-- {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil || nil == block {
+			break
+		}
+		plan.Keep = append(plan.Keep, block.Header.StateRoot)
+	}
+	// the genesis state is always kept
+	if genesis, err := chain.GetBlockByHeight(0); nil == err && nil != genesis {
+		plan.Keep = append(plan.Keep, genesis.Header.StateRoot)
+	}
+	return plan, nil
+}
+
+// ApplyPlan sweep the states planned in the leveldb state store, return the number of states pruned
+// and the bytes reclaimed. The repository must not be opened on the store.
+func ApplyPlan(stateDataPath string) (uint64, int64, error) {
+	plan, err := ReadPlan(stateDataPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !plan.Pending() {
+		return 0, 0, nil
+	}
+	store, err := OpenStateStore(stateDataPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer store.Close()
+	_, reclaimed, err := Sweep(store, plan.Keep)
+	if err != nil {
+		return 0, 0, err
+	}
+	pruned := plan.Target - plan.Pruned
+	if err := WritePlan(stateDataPath, &Plan{Pruned: plan.Target, Target: plan.Target}); err != nil {
+		return 0, 0, err
+	}
+	return pruned, reclaimed, nil
+}
@@ -0,0 +1,168 @@
+package pruner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Pruner prune the states of old blocks. The states shared by blocks are swept by mark-and-sweep,
+// which needs the state store not written, and the leveldb state store is locked by the repository
+// opening it. So the states to prune are planned when the node stops, and swept before the
+// repository is opened at next start.
+//
+// With the database handle shared by the repository, the states are also pruned in background as
+// blocks committed: the references from the state roots of kept blocks are counted, and the nodes
+// losing all references are deleted. The counts are kept in memory, so the sweep at start reclaims
+// the states left by last run.
+type Pruner struct {
+	chain         common.Chain
+	conf          config.PruningConfig
+	stateDataPath string
+	lock          sync.Mutex
+	isRunning     int32
+	metrics       *pruneMetrics
+
+	db      Database
+	counter *refCounter
+	// headers of the kept blocks whose state roots are counted, in ascending height
+	kept []*types.Header
+	// height of the last block counted
+	last uint64
+	// nodes dead since last pruning
+	pending []deadNode
+	// guard of the heights of blocks being written by block switch
+	gate      sync.Mutex
+	writing   map[uint64]bool
+	committed chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewPruner create a state pruner of chain whose leveldb state store is at stateDataPath, its
+// metrics are registered in registerer.
+func NewPruner(chain common.Chain, conf config.PruningConfig, stateDataPath string, registerer prometheus.Registerer) *Pruner {
+	return &Pruner{
+		chain:         chain,
+		conf:          conf,
+		stateDataPath: stateDataPath,
+		isRunning:     0,
+		metrics:       newPruneMetrics(registerer),
+		writing:       make(map[uint64]bool),
+		committed:     make(chan struct{}, 1),
+	}
+}
+
+// Sweep sweep the states planned when the node stopped, it must be called before the repository is opened.
+func (pruner *Pruner) Sweep() error {
+	pruned, reclaimed, err := ApplyPlan(pruner.stateDataPath)
+	if err != nil {
+		return fmt.Errorf("failed to sweep states, as: %v", err)
+	}
+	plan, err := ReadPlan(pruner.stateDataPath)
+	if err != nil {
+		return err
+	}
+	pruner.metrics.prunedHeight.Set(float64(plan.Pruned))
+	if pruned > 0 {
+		pruner.metrics.prunedStates.Add(float64(pruned))
+		pruner.metrics.reclaimedBytes.Add(float64(reclaimed))
+		log.Info("prune %d states to height %d, reclaimed %d bytes", pruned, plan.Pruned, reclaimed)
+	}
+	return nil
+}
+
+// Start start pruner, the plan not applied is discarded as the repository will write states.
+// The states are pruned in background if the database is set.
+func (pruner *Pruner) Start() error {
+	pruner.lock.Lock()
+	defer pruner.lock.Unlock()
+	if pruner.isRunning == 1 {
+		log.Error("state pruner already started")
+		return errors.New("state pruner already started")
+	}
+	if err := DiscardPlan(pruner.stateDataPath); err != nil {
+		return err
+	}
+	if nil != pruner.db {
+		if err := pruner.startOnline(); err != nil {
+			return fmt.Errorf("failed to start pruning states in background, as: %v", err)
+		}
+	}
+	pruner.isRunning = 1
+	return nil
+}
+
+// Stop stop pruner, the states to prune are planned after the repository stopped writing states.
+func (pruner *Pruner) Stop() {
+	pruner.lock.Lock()
+	defer pruner.lock.Unlock()
+	if pruner.isRunning == 0 {
+		return
+	}
+	pruner.isRunning = 0
+	if nil != pruner.db {
+		pruner.stopOnline()
+	}
+	if err := pruner.plan(); err != nil {
+		log.Error("failed to plan state pruning, as: %v", err)
+	}
+}
+
+// plan the states to prune at next start.
+func (pruner *Pruner) plan() error {
+	progress, err := ReadPlan(pruner.stateDataPath)
+	if err != nil {
+		return err
+	}
+	chain, err := pruner.chain.Latest()
+	if err != nil {
+		return fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	plan, err := NewPlan(chain, pruner.conf, progress.Pruned)
+	if err != nil {
+		return err
+	}
+	if !plan.Pending() {
+		return nil
+	}
+	if err := WritePlan(pruner.stateDataPath, plan); err != nil {
+		return err
+	}
+	log.Info("plan to prune states to height %d at next start", plan.Target)
+	return nil
+}
+
+// PruneTarget get the highest height whose state can be pruned after the current block.
+func PruneTarget(chain *repository.Repository, conf config.PruningConfig, current *types.Block) (uint64, error) {
+	switch conf.Mode {
+	case common.StatesPruningMode:
+		if current.Header.Height <= conf.KeepStates {
+			return 0, nil
+		}
+		return current.Header.Height - conf.KeepStates, nil
+	case common.AgePruningMode:
+		cutoff := uint64(time.Now().Unix() - conf.KeepTime)
+		var target uint64
+		for height := uint64(1); height < current.Header.Height; height++ {
+			block, err := chain.GetBlockByHeight(height)
+			if err != nil {
+				return target, fmt.Errorf("failed to get block %d, as: %v", height, err)
+			}
+			if block.Header.Timestamp >= cutoff {
+				break
+			}
+			target = height
+		}
+		return target, nil
+	default:
+		return 0, nil
+	}
+}
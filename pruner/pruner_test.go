@@ -0,0 +1,347 @@
+package pruner
+
+import (
+	"crypto/sha256"
+	"errors"
+	"github.com/DSiSc/craft/rlp"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mockBlock(height uint64, timestamp int64) *types.Block {
+	return &types.Block{
+		Header: &types.Header{
+			Height:    height,
+			Timestamp: uint64(timestamp),
+		},
+	}
+}
+
+func TestPruneTarget(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	chain := &repository.Repository{}
+	conf := config.PruningConfig{
+		Mode:       common.StatesPruningMode,
+		KeepStates: 10,
+	}
+	target, err := PruneTarget(chain, conf, mockBlock(5, 0))
+	assert.Nil(err)
+	assert.Equal(uint64(0), target)
+	target, err = PruneTarget(chain, conf, mockBlock(15, 0))
+	assert.Nil(err)
+	assert.Equal(uint64(5), target)
+
+	now := time.Now().Unix()
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		return mockBlock(height, now-int64(100-height)), nil
+	})
+	conf = config.PruningConfig{
+		Mode:     common.AgePruningMode,
+		KeepTime: 10,
+	}
+	target, err = PruneTarget(chain, conf, mockBlock(100, now))
+	assert.Nil(err)
+	assert.Equal(uint64(89), target)
+
+	conf.Mode = common.NonePruningMode
+	target, err = PruneTarget(chain, conf, mockBlock(100, now))
+	assert.Nil(err)
+	assert.Equal(uint64(0), target)
+}
+
+func TestPruner_Start(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pruner")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	stateDataPath := filepath.Join(dir, "state")
+	assert.Nil(WritePlan(stateDataPath, &Plan{Pruned: 1, Target: 5, Keep: []types.Hash{{0x01}}, Clean: true}))
+
+	pruner := NewPruner(common.ProcessChain, config.PruningConfig{Mode: common.StatesPruningMode}, stateDataPath, prometheus.NewRegistry())
+	assert.Nil(pruner.Start())
+	plan, err := ReadPlan(stateDataPath)
+	assert.Nil(err)
+	assert.False(plan.Pending())
+	assert.Equal(uint64(1), plan.Pruned)
+	assert.NotNil(pruner.Start())
+	assert.Equal(int32(1), pruner.isRunning)
+	pruner.Stop()
+	assert.Equal(int32(0), pruner.isRunning)
+}
+
+// mock states at two blocks in leveldb, they share the storage and code of account a and the account b.
+type mockStates struct {
+	store        StateStore
+	root1, root2 types.Hash
+	shared       []types.Hash
+	stale        []types.Hash
+	garbage      types.Hash
+}
+
+// encode the items of trie node with rlp, an embedded node is rlp.RawValue.
+func encodeNode(items ...interface{}) []byte {
+	data, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func newMockStates(t *testing.T, path string) *mockStates {
+	store, err := OpenStateStore(path)
+	assert.Nil(t, err)
+	db := store.(*levelDBStore).db
+	put := func(value []byte) types.Hash {
+		key := types.Hash(sha256.Sum256(value))
+		assert.Nil(t, db.Put(key[:], value, nil))
+		return key
+	}
+	leafKey := func(b byte) []byte {
+		key := make([]byte, 33)
+		key[0], key[1] = 0x20, b
+		return key
+	}
+	empty := types.Hash{0xee}
+
+	storageLeaf := put(encodeNode(leafKey(0x01), []byte{0x2a, 0x2b}))
+	storageRoot := put(encodeNode(
+		[]byte{}, storageLeaf[:], rlp.RawValue(encodeNode([]byte{0x20, 0x02}, []byte{0x07})), []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+		[]byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+	))
+	code := put([]byte("contract code of account a"))
+	account := func(key byte, balance byte, storage types.Hash, code types.Hash) types.Hash {
+		return put(encodeNode(leafKey(key), encodeNode([]byte{0x01}, []byte{balance}, storage[:], code[:])))
+	}
+	a1 := account(0x0a, 10, storageRoot, code)
+	a2 := account(0x0a, 20, storageRoot, code)
+	b := account(0x0b, 30, empty, empty)
+	branch := func(a types.Hash) types.Hash {
+		return put(encodeNode(
+			[]byte{}, a[:], b[:], []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+			[]byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+		))
+	}
+	states := &mockStates{
+		store:  store,
+		root1:  branch(a1),
+		root2:  branch(a2),
+		shared: []types.Hash{storageRoot, storageLeaf, code, b},
+	}
+	states.stale = []types.Hash{states.root1, a1}
+	states.garbage = put([]byte("node not referred by any state"))
+	assert.Nil(t, db.Put([]byte("justitia-meta"), []byte("meta"), nil))
+	return states
+}
+
+func TestSweep(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pruner")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	states := newMockStates(t, filepath.Join(dir, "state"))
+	defer states.store.Close()
+
+	_, _, err = Sweep(states.store, nil)
+	assert.NotNil(err)
+	_, _, err = Sweep(states.store, []types.Hash{{0x01}})
+	assert.NotNil(err)
+
+	swept, _, err := Sweep(states.store, []types.Hash{states.root1, states.root2})
+	assert.Nil(err)
+	assert.Equal(1, swept)
+	value, err := states.store.Get(states.garbage[:])
+	assert.Nil(err)
+	assert.Nil(value)
+
+	swept, reclaimed, err := Sweep(states.store, []types.Hash{states.root2})
+	assert.Nil(err)
+	assert.Equal(len(states.stale), swept)
+	assert.True(reclaimed > 0)
+	for _, key := range states.stale {
+		value, err := states.store.Get(key[:])
+		assert.Nil(err)
+		assert.Nil(value)
+	}
+	for _, key := range append(states.shared, states.root2) {
+		value, err := states.store.Get(key[:])
+		assert.Nil(err)
+		assert.NotNil(value)
+	}
+	value, err = states.store.Get([]byte("justitia-meta"))
+	assert.Nil(err)
+	assert.Equal([]byte("meta"), value)
+}
+
+func TestPruner_Prune(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pruner")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	stateDataPath := filepath.Join(dir, "state")
+	states := newMockStates(t, stateDataPath)
+	defer states.store.Close()
+
+	// the genesis state is empty, the blocks after block 2 change nothing
+	chain := &repository.Repository{}
+	current := uint64(1)
+	blockAt := func(height uint64) *types.Block {
+		root := states.root2
+		switch height {
+		case 0:
+			root = types.Hash{}
+		case 1:
+			root = states.root1
+		}
+		return &types.Block{Header: &types.Header{Height: height, StateRoot: root}}
+	}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return blockAt(current)
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if height > current {
+			return nil, errors.New("block not found")
+		}
+		return blockAt(height), nil
+	})
+	exists := func(key types.Hash) bool {
+		value, err := states.store.Get(key[:])
+		assert.Nil(err)
+		return nil != value
+	}
+
+	conf := config.PruningConfig{
+		Mode:       common.StatesPruningMode,
+		KeepStates: 1,
+	}
+	pruner := NewPruner(common.ProcessChain, conf, stateDataPath, prometheus.NewRegistry())
+	in := make(chan interface{}, 1)
+	assert.True(in == pruner.Wrap(in))
+	pruner.SetDatabase(states.store)
+	blockIn := pruner.Wrap(in)
+	assert.Nil(pruner.Start())
+	defer pruner.Stop()
+
+	blockIn <- blockAt(2)
+	assert.Equal(blockAt(2), <-in)
+	current = 2
+	assert.Nil(pruner.prune(chain))
+	// the state of block 1 is dead, but deleted after next block counted
+	assert.True(exists(states.root1))
+
+	// the dead states are kept while block 3 is being written
+	blockIn <- blockAt(3)
+	assert.Equal(blockAt(3), <-in)
+	assert.Nil(pruner.prune(chain))
+	assert.True(exists(states.root1))
+
+	current = 3
+	assert.Nil(pruner.prune(chain))
+	for _, key := range states.stale {
+		assert.False(exists(key))
+	}
+	for _, key := range append(states.shared, states.root2) {
+		assert.True(exists(key))
+	}
+	// the garbage not counted is left to the sweep at next start
+	assert.True(exists(states.garbage))
+	assert.Equal(1, len(pruner.kept))
+	assert.Equal(uint64(3), pruner.kept[0].Height)
+
+	pruner.Stop()
+	plan, err := ReadPlan(stateDataPath)
+	assert.Nil(err)
+	assert.True(plan.Pending())
+	assert.Equal(uint64(2), plan.Target)
+}
+
+func TestApplyPlan(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pruner")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	stateDataPath := filepath.Join(dir, "state")
+	states := newMockStates(t, stateDataPath)
+	assert.Nil(states.store.Close())
+
+	// the plan made while states are being written is not applied
+	assert.Nil(WritePlan(stateDataPath, &Plan{Target: 5, Keep: []types.Hash{states.root2}}))
+	pruned, _, err := ApplyPlan(stateDataPath)
+	assert.Nil(err)
+	assert.Equal(uint64(0), pruned)
+
+	assert.Nil(WritePlan(stateDataPath, &Plan{Pruned: 2, Target: 5, Keep: []types.Hash{states.root2}, Clean: true}))
+	pruned, reclaimed, err := ApplyPlan(stateDataPath)
+	assert.Nil(err)
+	assert.Equal(uint64(3), pruned)
+	assert.True(reclaimed > 0)
+	plan, err := ReadPlan(stateDataPath)
+	assert.Nil(err)
+	assert.Equal(uint64(5), plan.Pruned)
+	assert.False(plan.Pending())
+
+	store, err := OpenStateStore(stateDataPath)
+	assert.Nil(err)
+	defer store.Close()
+	value, err := store.Get(states.root1[:])
+	assert.Nil(err)
+	assert.Nil(value)
+	value, err = store.Get(states.root2[:])
+	assert.Nil(err)
+	assert.NotNil(value)
+}
+
+func TestNewPlan(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	chain := &repository.Repository{}
+	blockAt := func(height uint64) *types.Block {
+		return &types.Block{Header: &types.Header{Height: height, StateRoot: types.Hash{byte(height)}}}
+	}
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return blockAt(20)
+	})
+	lowest := uint64(0)
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if height < lowest {
+			return nil, errors.New("block not found")
+		}
+		return blockAt(height), nil
+	})
+	conf := config.PruningConfig{
+		Mode:       common.StatesPruningMode,
+		KeepStates: 5,
+	}
+	plan, err := NewPlan(chain, conf, 10)
+	assert.Nil(err)
+	assert.True(plan.Pending())
+	assert.Equal(uint64(15), plan.Target)
+	assert.Equal([]types.Hash{{20}, {19}, {18}, {17}, {16}, {0}}, plan.Keep)
+
+	// the node seeded by snapshot at 18
+	lowest = 18
+	plan, err = NewPlan(chain, conf, 10)
+	assert.Nil(err)
+	assert.Equal([]types.Hash{{20}, {19}, {18}}, plan.Keep)
+
+	conf.KeepStates = 0
+	plan, err = NewPlan(chain, conf, 10)
+	assert.Nil(err)
+	assert.Equal(uint64(19), plan.Target)
+	assert.Equal([]types.Hash{{20}}, plan.Keep)
+}
@@ -0,0 +1,77 @@
+package pruner
+
+import (
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// number of keys deleted in a batch of the state store
+const deleteBatchLimit = 1024
+
+// StateStore is the key-value store of repository state. Trie nodes and contract codes are keyed
+// by their 32 bytes hash, which are the only entries swept by pruning.
+type StateStore interface {
+	// Get get the value of key, nil if the key not exist
+	Get(key []byte) ([]byte, error)
+	// Iterate call fn with each entry of the store, the iteration stops if fn returns an error
+	Iterate(fn func(key, value []byte) error) error
+	// Delete delete the keys from the store
+	Delete(keys [][]byte) error
+	Close() error
+}
+
+// levelDBStore is the state store of leveldb repository plugin.
+type levelDBStore struct {
+	db *leveldb.DB
+}
+
+// OpenStateStore open the leveldb state store at path. leveldb is locked by the process opening it,
+// so the repository must not be opened on the path at the same time.
+func OpenStateStore(path string) (StateStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s, as: %v", path, err)
+	}
+	return &levelDBStore{db: db}, nil
+}
+
+func (store *levelDBStore) Get(key []byte) ([]byte, error) {
+	value, err := store.db.Get(key, nil)
+	if leveldb.ErrNotFound == err {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (store *levelDBStore) Iterate(fn func(key, value []byte) error) error {
+	iter := store.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := fn(iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+func (store *levelDBStore) Delete(keys [][]byte) error {
+	for len(keys) > 0 {
+		size := len(keys)
+		if size > deleteBatchLimit {
+			size = deleteBatchLimit
+		}
+		batch := new(leveldb.Batch)
+		for _, key := range keys[:size] {
+			batch.Delete(key)
+		}
+		if err := store.db.Write(batch, nil); err != nil {
+			return err
+		}
+		keys = keys[size:]
+	}
+	return nil
+}
+
+func (store *levelDBStore) Close() error {
+	return store.db.Close()
+}
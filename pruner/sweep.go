@@ -0,0 +1,233 @@
+package pruner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+)
+
+// length of the keys of trie nodes and codes in state store
+const hashLength = len(types.Hash{})
+
+var errInvalidNode = errors.New("invalid rlp encoding of trie node")
+
+// rlp item of trie node, content is the payload of string or list.
+type rlpItem struct {
+	isList  bool
+	content []byte
+}
+
+// split the first rlp item from data.
+func splitItem(data []byte) (rlpItem, []byte, error) {
+	if 0 == len(data) {
+		return rlpItem{}, nil, errInvalidNode
+	}
+	prefix := data[0]
+	var isList bool
+	var offset, size uint64
+	switch {
+	case prefix < 0x80:
+		offset, size = 0, 1
+	case prefix < 0xb8:
+		offset, size = 1, uint64(prefix-0x80)
+	case prefix < 0xc0:
+		offset = 1 + uint64(prefix-0xb7)
+		size = readSize(data[1:], prefix-0xb7)
+	case prefix < 0xf8:
+		isList, offset, size = true, 1, uint64(prefix-0xc0)
+	default:
+		isList, offset = true, 1+uint64(prefix-0xf7)
+		size = readSize(data[1:], prefix-0xf7)
+	}
+	if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+		return rlpItem{}, nil, errInvalidNode
+	}
+	end := offset + size
+	return rlpItem{isList: isList, content: data[offset:end]}, data[end:], nil
+}
+
+// read the big endian size of length bytes, the size overflows data if it is truncated.
+func readSize(data []byte, length byte) uint64 {
+	if int(length) > len(data) || length > 8 {
+		return ^uint64(0)
+	}
+	var size uint64
+	for _, b := range data[:length] {
+		size = size<<8 | uint64(b)
+	}
+	return size
+}
+
+// split the items of rlp list.
+func listItems(list rlpItem) ([]rlpItem, error) {
+	if !list.isList {
+		return nil, errInvalidNode
+	}
+	items := make([]rlpItem, 0, 17)
+	for rest := list.content; len(rest) > 0; {
+		item, next, err := splitItem(rest)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		rest = next
+	}
+	return items, nil
+}
+
+// reference from a trie node to a trie node or code in state store.
+type nodeRef struct {
+	hash types.Hash
+	// the referred node is in state trie, whose leaves are accounts
+	isState bool
+	// the hash is of contract code rather than trie node
+	isCode bool
+}
+
+// collect the references of the trie node encoded in data, the leaves of state trie are accounts
+// referring their storage trie and code.
+func nodeRefs(data []byte, isState bool) ([]nodeRef, error) {
+	node, _, err := splitItem(data)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]nodeRef, 0)
+	if err := collectNode(node, isState, &refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// collect the references of the children of full node or short node.
+func collectNode(node rlpItem, isState bool, refs *[]nodeRef) error {
+	items, err := listItems(node)
+	if err != nil {
+		return err
+	}
+	switch len(items) {
+	case 17:
+		for _, child := range items[:16] {
+			if err := collectChild(child, isState, refs); err != nil {
+				return err
+			}
+		}
+		if len(items[16].content) > 0 {
+			return collectValue(items[16], isState, refs)
+		}
+		return nil
+	case 2:
+		// the flag nibble of compact encoded key tells whether the short node is a leaf
+		if len(items[0].content) > 0 && items[0].content[0]&0x20 != 0 {
+			return collectValue(items[1], isState, refs)
+		}
+		return collectChild(items[1], isState, refs)
+	default:
+		return errInvalidNode
+	}
+}
+
+// collect the child referred by hash, or the references of the child embedded in its parent when
+// it is shorter than a hash.
+func collectChild(child rlpItem, isState bool, refs *[]nodeRef) error {
+	if child.isList {
+		return collectNode(child, isState, refs)
+	}
+	if len(child.content) == hashLength {
+		*refs = append(*refs, nodeRef{hash: types.BytesToHash(child.content), isState: isState})
+	}
+	return nil
+}
+
+// collect the storage trie and code of the account in leaf of state trie: [nonce, balance, root, codeHash].
+func collectValue(value rlpItem, isState bool, refs *[]nodeRef) error {
+	if !isState {
+		return nil
+	}
+	account, _, err := splitItem(value.content)
+	if err != nil {
+		return err
+	}
+	fields, err := listItems(account)
+	if err != nil || len(fields) != 4 {
+		return errInvalidNode
+	}
+	*refs = append(*refs,
+		nodeRef{hash: types.BytesToHash(fields[2].content)},
+		nodeRef{hash: types.BytesToHash(fields[3].content), isCode: true},
+	)
+	return nil
+}
+
+// marker mark the trie nodes and codes reachable from the kept state roots.
+type marker struct {
+	store  StateStore
+	marked map[types.Hash]bool
+}
+
+// mark the trie at root, the leaves of state trie are accounts whose storage trie and code are marked too.
+// The node not in store is skipped, which is the root of empty trie.
+func (m *marker) markTrie(root types.Hash, isState bool) error {
+	if m.marked[root] {
+		return nil
+	}
+	data, err := m.store.Get(root[:])
+	if err != nil {
+		return fmt.Errorf("failed to get trie node %x, as: %v", root, err)
+	}
+	if nil == data {
+		return nil
+	}
+	m.marked[root] = true
+	refs, err := nodeRefs(data, isState)
+	if err != nil {
+		return fmt.Errorf("failed to decode trie node %x, as: %v", root, err)
+	}
+	for _, ref := range refs {
+		if ref.isCode {
+			m.marked[ref.hash] = true
+			continue
+		}
+		if err := m.markTrie(ref.hash, ref.isState); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep delete the trie nodes and codes not reachable from the kept state roots, return the number
+// of entries deleted and the bytes reclaimed. The store must not be written during sweeping.
+func Sweep(store StateStore, keep []types.Hash) (int, int64, error) {
+	m := &marker{
+		store:  store,
+		marked: make(map[types.Hash]bool),
+	}
+	if 0 == len(keep) {
+		return 0, 0, errors.New("no state root is kept")
+	}
+	for _, root := range keep {
+		// a missing kept root means the states are written after the roots are collected
+		if data, err := store.Get(root[:]); err != nil || nil == data {
+			return 0, 0, fmt.Errorf("kept state root %x is not found in state store", root)
+		}
+		if err := m.markTrie(root, true); err != nil {
+			return 0, 0, err
+		}
+	}
+	var reclaimed int64
+	swept := make([][]byte, 0)
+	err := store.Iterate(func(key, value []byte) error {
+		if len(key) != hashLength || m.marked[types.BytesToHash(key)] {
+			return nil
+		}
+		swept = append(swept, append([]byte{}, key...))
+		reclaimed += int64(len(key) + len(value))
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to iterate state store, as: %v", err)
+	}
+	if err := store.Delete(swept); err != nil {
+		return 0, 0, fmt.Errorf("failed to delete swept states, as: %v", err)
+	}
+	return len(swept), reclaimed, nil
+}
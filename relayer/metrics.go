@@ -0,0 +1,51 @@
+package relayer
+
+import (
+	"github.com/DSiSc/justitia/tools/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of relayer registered in the registerer of node.
+type relayMetrics struct {
+	scannedHeight    prometheus.Gauge
+	pendingTransfers prometheus.Gauge
+	relayedTransfers prometheus.Counter
+	failedTransfers  prometheus.Counter
+	// txs resubmitted as not mined before timeout
+	resubmittedTxs prometheus.Counter
+}
+
+func newRelayMetrics(registerer prometheus.Registerer) *relayMetrics {
+	return &relayMetrics{
+		scannedHeight: metrics.Gauge(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "justitia",
+			Subsystem: "relayer",
+			Name:      "scanned_height",
+			Help:      "The highest source block scanned for cross chain txs.",
+		})),
+		pendingTransfers: metrics.Gauge(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "justitia",
+			Subsystem: "relayer",
+			Name:      "pending_transfers",
+			Help:      "The number of cross chain txs not confirmed on target chains.",
+		})),
+		relayedTransfers: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "relayer",
+			Name:      "relayed_transfers",
+			Help:      "The number of cross chain txs relayed and confirmed.",
+		})),
+		failedTransfers: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "relayer",
+			Name:      "failed_transfers",
+			Help:      "The number of cross chain txs failed on target chains.",
+		})),
+		resubmittedTxs: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "relayer",
+			Name:      "resubmitted_txs",
+			Help:      "The number of receiveFunds txs resubmitted to target chains, as not mined before timeout.",
+		})),
+	}
+}
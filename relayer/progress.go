@@ -0,0 +1,87 @@
+package relayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// name of the file persisting the relay progress in data path
+const progressFileName = "progress.json"
+
+// states of the transfer
+const (
+	// not submitted to the target chain yet
+	TransferPending = "pending"
+	// receiveFunds is submitted to the target chain, waiting for confirmations
+	TransferSubmitted = "submitted"
+)
+
+// Transfer is the cross chain tx to relay.
+type Transfer struct {
+	// <source tx hash>:<index of the event in tx>
+	Id          string        `json:"id"`
+	Block       uint64        `json:"block"`
+	From        types.Address `json:"from"`
+	To          types.Address `json:"to"`
+	Amount      uint64        `json:"amount"`
+	Payload     string        `json:"payload"`
+	ChainFlag   string        `json:"chainFlag"`
+	State       string        `json:"state"`
+	TargetTx    types.Hash    `json:"targetTx"`
+	TargetBlock uint64        `json:"targetBlock"`
+	// nonce of the target tx, which is reused when the tx is resubmitted
+	TargetNonce uint64 `json:"targetNonce"`
+	// time the target tx is submitted, it is resubmitted if not mined before timeout
+	SubmittedAt time.Time `json:"submittedAt"`
+	// times the target tx is resubmitted
+	Resubmits uint64 `json:"resubmits"`
+}
+
+// Progress is the relay progress persisted in data path.
+type Progress struct {
+	// the highest source block scanned
+	Scanned uint64 `json:"scanned"`
+	// number of transfers relayed and confirmed
+	Relayed uint64 `json:"relayed"`
+	// number of transfers failed on target chain
+	Failed uint64 `json:"failed"`
+	// transfers not confirmed yet
+	Transfers []*Transfer `json:"transfers"`
+}
+
+// LoadProgress load the progress from data path, an empty progress is returned if not persisted yet.
+func LoadProgress(dataPath string) (*Progress, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dataPath, progressFileName))
+	if os.IsNotExist(err) {
+		return &Progress{Transfers: make([]*Transfer, 0)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relay progress, as: %v", err)
+	}
+	progress := new(Progress)
+	if err := json.Unmarshal(content, progress); err != nil {
+		return nil, fmt.Errorf("failed to parse relay progress, as: %v", err)
+	}
+	return progress, nil
+}
+
+// Save persist the progress to data path, the file is replaced atomically.
+func (progress *Progress) Save(dataPath string) error {
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return fmt.Errorf("failed to create relayer data path, as: %v", err)
+	}
+	content, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataPath, progressFileName)
+	if err := ioutil.WriteFile(path+".tmp", content, 0644); err != nil {
+		return fmt.Errorf("failed to write relay progress, as: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,323 @@
+// Package relayer relays the cross chain txs of CrossFundsPool contract to their target chains.
+package relayer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// max number of source blocks scanned in one pass
+const maxScanBlocks = 1000
+
+// interval to relay when no block committed, so that target chains are still polled
+const relayInterval = 5 * time.Second
+
+// default time to wait for the target tx mined before resubmitting it
+const defaultResubmitTimeout = time.Minute
+
+// the CrossFundsPool contract on a target chain
+type target struct {
+	client *bind.Client
+	pool   *syscontract.CrossFundsPool
+}
+
+// Relayer watch the CrossTxEvent of CrossFundsPool contract on local chain, and submit the
+// matching receiveFunds tx to the target chain through its api gateway. Both the source event
+// and the target tx are treated as final after buried under confirmations blocks. The target tx
+// not mined before resubmit timeout is resubmitted, as it may be dropped by the target chain.
+type Relayer struct {
+	conf            config.RelayerConfig
+	chainId         uint64
+	resubmitTimeout time.Duration
+	clock           clock.Clock
+	client          *bind.Client
+	source          *syscontract.CrossFundsPool
+	targets         map[string]*target
+	eventCenter     types.EventCenter
+	subscriber      types.Subscriber
+	progress        *Progress
+	relayChan       chan struct{}
+	quitChan        chan interface{}
+	lock            sync.Mutex
+	isRunning       int32
+	metrics         *relayMetrics
+}
+
+// NewRelayer create a relayer of the local chain with chainId, gateway is the local api gateway
+// and contract is the local CrossFundsPool contract. Its metrics are registered in registerer.
+func NewRelayer(conf config.RelayerConfig, chainId uint64, gateway string, contract types.Address, eventCenter types.EventCenter, registerer prometheus.Registerer, clock clock.Clock) (*Relayer, error) {
+	client := bind.NewClient(gateway, conf.Account)
+	source, err := syscontract.NewCrossFundsPool(contract, client, nil)
+	if err != nil {
+		return nil, err
+	}
+	targets := make(map[string]*target)
+	for _, route := range conf.Routes {
+		if _, ok := targets[route.ChainFlag]; ok {
+			return nil, fmt.Errorf("duplicated relayer route of chain %s", route.ChainFlag)
+		}
+		targetClient := bind.NewClient(route.ApiGateway, conf.Account)
+		pool, err := syscontract.NewCrossFundsPool(route.Contract, targetClient, targetClient)
+		if err != nil {
+			return nil, err
+		}
+		targets[route.ChainFlag] = &target{client: targetClient, pool: pool}
+	}
+	progress, err := LoadProgress(conf.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	resubmitTimeout := time.Duration(conf.ResubmitTimeout) * time.Second
+	if resubmitTimeout <= 0 {
+		resubmitTimeout = defaultResubmitTimeout
+	}
+	return &Relayer{
+		conf:            conf,
+		chainId:         chainId,
+		resubmitTimeout: resubmitTimeout,
+		clock:           clock,
+		client:          client,
+		source:          source,
+		targets:         targets,
+		eventCenter:     eventCenter,
+		progress:        progress,
+		relayChan:       make(chan struct{}, 1),
+		quitChan:        make(chan interface{}),
+		isRunning:       0,
+		metrics:         newRelayMetrics(registerer),
+	}, nil
+}
+
+// BlockEventFunc get a EventFunc that can be bound to event center
+func (relayer *Relayer) BlockEventFunc(event interface{}) {
+	select {
+	case relayer.relayChan <- struct{}{}:
+	default:
+	}
+}
+
+// Start start relayer
+func (relayer *Relayer) Start() error {
+	relayer.lock.Lock()
+	defer relayer.lock.Unlock()
+	if relayer.isRunning == 1 {
+		log.Error("relayer already started")
+		return errors.New("relayer already started")
+	}
+	relayer.isRunning = 1
+	relayer.subscriber = relayer.eventCenter.Subscribe(types.EventBlockCommitted, relayer.BlockEventFunc)
+	go relayer.relayHandler()
+	return nil
+}
+
+// Stop stop relayer
+func (relayer *Relayer) Stop() {
+	relayer.lock.Lock()
+	defer relayer.lock.Unlock()
+	if relayer.isRunning == 0 {
+		return
+	}
+	relayer.isRunning = 0
+	close(relayer.quitChan)
+	relayer.eventCenter.UnSubscribe(types.EventBlockCommitted, relayer.subscriber)
+}
+
+func (relayer *Relayer) relayHandler() {
+	for {
+		timer := relayer.clock.NewTimer(relayInterval)
+		select {
+		case <-relayer.relayChan:
+		case <-timer.C():
+		case <-relayer.quitChan:
+			timer.Stop()
+			log.Info("exit relay handler, as relayer already stopped")
+			return
+		}
+		timer.Stop()
+		if err := relayer.Relay(); err != nil {
+			log.Error("failed to relay cross chain txs, as: %v", err)
+		}
+	}
+}
+
+// Progress get the relay progress.
+func (relayer *Relayer) Progress() *Progress {
+	return relayer.progress
+}
+
+// Relay scan the confirmed source blocks for new cross chain txs, then submit the pending ones
+// and check the submitted ones on their target chains. The progress is saved after each step,
+// so a crash between submitting a tx and saving it is the only case it may be submitted twice.
+func (relayer *Relayer) Relay() error {
+	if err := relayer.scan(); err != nil {
+		return err
+	}
+	transfers := make([]*Transfer, 0, len(relayer.progress.Transfers))
+	for _, transfer := range relayer.progress.Transfers {
+		done, err := relayer.relayTransfer(transfer)
+		if err != nil {
+			log.Warn("failed to relay cross chain tx %s, as: %v", transfer.Id, err)
+		}
+		if !done {
+			transfers = append(transfers, transfer)
+		}
+	}
+	relayer.progress.Transfers = transfers
+	relayer.metrics.pendingTransfers.Set(float64(len(transfers)))
+	return relayer.progress.Save(relayer.conf.DataPath)
+}
+
+// scan the source blocks buried under confirmations blocks.
+func (relayer *Relayer) scan() error {
+	height, err := relayer.client.BlockNumber()
+	if err != nil {
+		return fmt.Errorf("failed to get height of local chain, as: %v", err)
+	}
+	if height < relayer.conf.Confirmations {
+		return nil
+	}
+	from, to := relayer.progress.Scanned+1, height-relayer.conf.Confirmations
+	if from > to {
+		return nil
+	}
+	if to-from >= maxScanBlocks {
+		to = from + maxScanBlocks - 1
+	}
+	logs, _, err := bind.FilterEvents(relayer.client, relayer.source.Contract(), "CrossTxEvent", from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get cross chain txs in blocks [%d, %d], as: %v", from, to, err)
+	}
+	indexes := make(map[types.Hash]int)
+	for _, eventLog := range logs {
+		id := fmt.Sprintf("%x:%d", eventLog.TxHash, indexes[eventLog.TxHash])
+		indexes[eventLog.TxHash]++
+		event, err := relayer.source.ParseCrossTxEvent(eventLog)
+		if err != nil {
+			log.Warn("skip cross chain tx %s, as: %v", id, err)
+			continue
+		}
+		if _, ok := relayer.targets[event.ChainFlag]; !ok {
+			log.Warn("skip cross chain tx %s, as no route to chain %s", id, event.ChainFlag)
+			continue
+		}
+		if !event.Amount.IsUint64() {
+			log.Warn("skip cross chain tx %s, as amount %v overflow", id, event.Amount)
+			continue
+		}
+		log.Info("found cross chain tx %s transferring %v to %x on chain %s", id, event.Amount, event.To, event.ChainFlag)
+		relayer.progress.Transfers = append(relayer.progress.Transfers, &Transfer{
+			Id:        id,
+			Block:     eventLog.BlockNumber,
+			From:      event.From,
+			To:        event.To,
+			Amount:    event.Amount.Uint64(),
+			Payload:   event.Payload,
+			ChainFlag: event.ChainFlag,
+			State:     TransferPending,
+		})
+	}
+	relayer.progress.Scanned = to
+	relayer.metrics.scannedHeight.Set(float64(to))
+	return relayer.progress.Save(relayer.conf.DataPath)
+}
+
+// relay the transfer to its target chain, returns true if it is confirmed or failed.
+func (relayer *Relayer) relayTransfer(transfer *Transfer) (bool, error) {
+	target, ok := relayer.targets[transfer.ChainFlag]
+	if !ok {
+		return false, fmt.Errorf("no route to chain %s", transfer.ChainFlag)
+	}
+	switch transfer.State {
+	case TransferPending:
+		nonce, err := target.client.NextNonce()
+		if err != nil {
+			return false, fmt.Errorf("failed to get nonce on chain %s, as: %v", transfer.ChainFlag, err)
+		}
+		hash, err := relayer.submit(target, transfer, nonce)
+		if err != nil {
+			target.client.ResetNonce()
+			return false, fmt.Errorf("failed to submit receiveFunds, as: %v", err)
+		}
+		transfer.State, transfer.TargetTx, transfer.TargetNonce, transfer.SubmittedAt = TransferSubmitted, hash, nonce, relayer.clock.Now()
+		log.Info("submit cross chain tx %s to chain %s with tx %x", transfer.Id, transfer.ChainFlag, hash)
+		return false, relayer.progress.Save(relayer.conf.DataPath)
+	case TransferSubmitted:
+		receipt, err := target.client.TransactionReceipt(transfer.TargetTx)
+		if err == bind.ErrNoReceipt {
+			return false, relayer.resubmit(target, transfer)
+		}
+		if err != nil {
+			return false, err
+		}
+		transfer.TargetBlock = receipt.BlockNumber
+		height, err := target.client.BlockNumber()
+		if err != nil {
+			return false, err
+		}
+		if height < receipt.BlockNumber+relayer.conf.Confirmations {
+			return false, nil
+		}
+		if 1 != receipt.Status {
+			log.Error("cross chain tx %s failed on chain %s with tx %x", transfer.Id, transfer.ChainFlag, transfer.TargetTx)
+			relayer.progress.Failed++
+			relayer.metrics.failedTransfers.Inc()
+			return true, nil
+		}
+		log.Info("cross chain tx %s confirmed on chain %s at height %d", transfer.Id, transfer.ChainFlag, receipt.BlockNumber)
+		relayer.progress.Relayed++
+		relayer.metrics.relayedTransfers.Inc()
+		return true, nil
+	}
+	return true, fmt.Errorf("unknown state %s", transfer.State)
+}
+
+// submit the receiveFunds tx of transfer to target chain with nonce.
+func (relayer *Relayer) submit(target *target, transfer *Transfer, nonce uint64) (types.Hash, error) {
+	contract := target.pool.Contract()
+	input, err := contract.ABI().Pack("receiveFunds", transfer.To, transfer.Payload, transfer.Amount, relayer.chainId)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	return target.client.TransactWithNonce(contract.Address, nil, input, nonce)
+}
+
+// resubmit the target tx not mined before resubmit timeout. The tx is resent with its own nonce,
+// so that it can never be mined twice, and the txs after it are not blocked by a nonce gap if
+// it is dropped. A new nonce is taken only if its nonce is used by another tx of the account.
+func (relayer *Relayer) resubmit(target *target, transfer *Transfer) error {
+	if relayer.clock.Now().Sub(transfer.SubmittedAt) < relayer.resubmitTimeout {
+		return nil
+	}
+	mined, err := target.client.MinedNonce(relayer.conf.Account)
+	if err != nil {
+		return fmt.Errorf("failed to get nonce on chain %s, as: %v", transfer.ChainFlag, err)
+	}
+	nonce := transfer.TargetNonce
+	if mined > nonce {
+		// the tx may be mined after its receipt checked
+		if _, err := target.client.TransactionReceipt(transfer.TargetTx); err != bind.ErrNoReceipt {
+			return err
+		}
+		if nonce, err = target.client.NextNonce(); err != nil {
+			return fmt.Errorf("failed to get nonce on chain %s, as: %v", transfer.ChainFlag, err)
+		}
+	}
+	hash, err := relayer.submit(target, transfer, nonce)
+	if err != nil {
+		return fmt.Errorf("failed to resubmit receiveFunds, as: %v", err)
+	}
+	log.Warn("resubmit cross chain tx %s to chain %s with tx %x, as tx %x not mined after %v", transfer.Id, transfer.ChainFlag, hash, transfer.TargetTx, relayer.resubmitTimeout)
+	transfer.TargetTx, transfer.TargetNonce, transfer.SubmittedAt = hash, nonce, relayer.clock.Now()
+	transfer.Resubmits++
+	relayer.metrics.resubmittedTxs.Inc()
+	return relayer.progress.Save(relayer.conf.DataPath)
+}
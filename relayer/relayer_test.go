@@ -0,0 +1,320 @@
+package relayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	sourcePool     = types.Address{0x10}
+	targetPool     = types.Address{0x20}
+	relayerAccount = types.Address{0x30}
+	user           = types.Address{0x01}
+	receiver       = types.Address{0x02}
+	sourceTx       = types.Hash{0x0a}
+	targetTx       = types.Hash{0x0b}
+)
+
+// mock api gateway of a chain, handlers are keyed by method and return the result
+type mockGateway struct {
+	lock     sync.Mutex
+	handlers map[string]func(params []json.RawMessage) interface{}
+	calls    map[string]int
+}
+
+func newMockGateway() *mockGateway {
+	return &mockGateway{
+		handlers: make(map[string]func(params []json.RawMessage) interface{}),
+		calls:    make(map[string]int),
+	}
+}
+
+func (gateway *mockGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gateway.lock.Lock()
+	defer gateway.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	var request struct {
+		ID     uint64            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.Unmarshal(body, &request)
+	gateway.calls[request.Method]++
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	if handler, ok := gateway.handlers[request.Method]; ok {
+		response["result"] = handler(request.Params)
+	} else {
+		response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (gateway *mockGateway) height(height uint64) {
+	gateway.handlers["eth_blockNumber"] = func([]json.RawMessage) interface{} { return fmt.Sprintf("0x%x", height) }
+}
+
+// mock the CrossTxEvent logs emitted in source chain at block 2
+func mockCrossTxLogs(chainFlags ...string) func([]json.RawMessage) interface{} {
+	pool, _ := syscontract.NewCrossFundsPool(sourcePool, nil, nil)
+	logs := make([]interface{}, 0, len(chainFlags))
+	for _, chainFlag := range chainFlags {
+		topics, data, _ := pool.Contract().ABI().PackEvent("CrossTxEvent", user, receiver, big.NewInt(100), "payload", chainFlag)
+		hexTopics := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			hexTopics = append(hexTopics, fmt.Sprintf("0x%x", topic))
+		}
+		logs = append(logs, map[string]interface{}{
+			"address":         fmt.Sprintf("0x%x", sourcePool),
+			"topics":          hexTopics,
+			"data":            fmt.Sprintf("0x%x", data),
+			"blockNumber":     "0x2",
+			"transactionHash": fmt.Sprintf("0x%x", sourceTx),
+		})
+	}
+	return func([]json.RawMessage) interface{} { return logs }
+}
+
+func TestRelayer_Relay(t *testing.T) {
+	assert := assert.New(t)
+	dataPath, err := ioutil.TempDir("", "relayer")
+	assert.Nil(err)
+	defer os.RemoveAll(dataPath)
+
+	source, target := newMockGateway(), newMockGateway()
+	sourceServer, targetServer := httptest.NewServer(source), httptest.NewServer(target)
+	defer sourceServer.Close()
+	defer targetServer.Close()
+	conf := config.RelayerConfig{
+		Enabled:       true,
+		DataPath:      dataPath,
+		Confirmations: 2,
+		Account:       relayerAccount,
+		Routes: []config.RelayerRoute{
+			{ChainFlag: "sidechain", ApiGateway: targetServer.URL, Contract: targetPool},
+		},
+	}
+	r, err := NewRelayer(conf, 1, sourceServer.URL, sourcePool, events.NewEvent(), prometheus.NewRegistry(), clock.NewSystemClock())
+	assert.Nil(err)
+
+	// block 2 is not confirmed yet
+	source.height(3)
+	source.handlers["eth_getLogs"] = func([]json.RawMessage) interface{} { return []interface{}{} }
+	assert.Nil(r.Relay())
+	assert.Equal(uint64(1), r.Progress().Scanned)
+	assert.Equal(0, len(r.Progress().Transfers))
+
+	// submit receiveFunds to target chain
+	source.height(4)
+	source.handlers["eth_getLogs"] = mockCrossTxLogs("sidechain", "unknown")
+	target.handlers["eth_getTransactionCount"] = func([]json.RawMessage) interface{} { return "0x0" }
+	target.handlers["eth_sendTransaction"] = func([]json.RawMessage) interface{} { return fmt.Sprintf("0x%x", targetTx) }
+	target.handlers["eth_getTransactionReceipt"] = func([]json.RawMessage) interface{} { return nil }
+	assert.Nil(r.Relay())
+	assert.Equal(uint64(2), r.Progress().Scanned)
+	assert.Equal(1, len(r.Progress().Transfers))
+	transfer := r.Progress().Transfers[0]
+	assert.Equal(fmt.Sprintf("%x:0", sourceTx), transfer.Id)
+	assert.Equal(receiver, transfer.To)
+	assert.Equal(uint64(100), transfer.Amount)
+	assert.Equal(TransferSubmitted, transfer.State)
+	assert.Equal(targetTx, transfer.TargetTx)
+
+	// progress survives restart, and the tx is not submitted again
+	r, err = NewRelayer(conf, 1, sourceServer.URL, sourcePool, events.NewEvent(), prometheus.NewRegistry(), clock.NewSystemClock())
+	assert.Nil(err)
+	assert.Equal(uint64(2), r.Progress().Scanned)
+	assert.Equal(1, len(r.Progress().Transfers))
+
+	// mined but not confirmed
+	target.height(6)
+	target.handlers["eth_getTransactionReceipt"] = func([]json.RawMessage) interface{} {
+		return map[string]interface{}{
+			"transactionHash": fmt.Sprintf("0x%x", targetTx),
+			"blockNumber":     "0x5",
+			"status":          "0x1",
+			"logs":            []interface{}{},
+		}
+	}
+	assert.Nil(r.Relay())
+	assert.Equal(1, len(r.Progress().Transfers))
+	assert.Equal(uint64(5), r.Progress().Transfers[0].TargetBlock)
+
+	target.height(7)
+	assert.Nil(r.Relay())
+	assert.Equal(0, len(r.Progress().Transfers))
+	assert.Equal(uint64(1), r.Progress().Relayed)
+	assert.Equal(1, target.calls["eth_sendTransaction"])
+
+	progress, err := LoadProgress(dataPath)
+	assert.Nil(err)
+	assert.Equal(uint64(1), progress.Relayed)
+	assert.Equal(0, len(progress.Transfers))
+}
+
+// nonce of the tx in params of eth_sendTransaction
+func txNonce(params []json.RawMessage) string {
+	var tx map[string]string
+	json.Unmarshal(params[0], &tx)
+	return tx["nonce"]
+}
+
+func TestRelayer_Resubmit(t *testing.T) {
+	assert := assert.New(t)
+	dataPath, err := ioutil.TempDir("", "relayer")
+	assert.Nil(err)
+	defer os.RemoveAll(dataPath)
+
+	source, target := newMockGateway(), newMockGateway()
+	sourceServer, targetServer := httptest.NewServer(source), httptest.NewServer(target)
+	defer sourceServer.Close()
+	defer targetServer.Close()
+	conf := config.RelayerConfig{
+		DataPath:        dataPath,
+		Confirmations:   2,
+		Account:         relayerAccount,
+		ResubmitTimeout: 60,
+		Routes: []config.RelayerRoute{
+			{ChainFlag: "sidechain", ApiGateway: targetServer.URL, Contract: targetPool},
+		},
+	}
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	r, err := NewRelayer(conf, 1, sourceServer.URL, sourcePool, events.NewEvent(), prometheus.NewRegistry(), virtualClock)
+	assert.Nil(err)
+
+	// the txs sent in a row take successive nonces, while the pending nonce is not updated yet
+	source.height(4)
+	source.handlers["eth_getLogs"] = mockCrossTxLogs("sidechain", "sidechain")
+	mined := "0x0"
+	target.handlers["eth_getTransactionCount"] = func(params []json.RawMessage) interface{} {
+		if string(params[1]) == `"latest"` {
+			return mined
+		}
+		return "0x0"
+	}
+	nonces := make([]string, 0)
+	target.handlers["eth_sendTransaction"] = func(params []json.RawMessage) interface{} {
+		nonces = append(nonces, txNonce(params))
+		return fmt.Sprintf("0x%x", types.Hash{byte(len(nonces))})
+	}
+	target.handlers["eth_getTransactionReceipt"] = func([]json.RawMessage) interface{} { return nil }
+	assert.Nil(r.Relay())
+	assert.Equal([]string{"0x0", "0x1"}, nonces)
+	assert.Equal(uint64(0), r.Progress().Transfers[0].TargetNonce)
+	assert.Equal(uint64(1), r.Progress().Transfers[1].TargetNonce)
+
+	// not resubmitted before timeout
+	virtualClock.Advance(59 * time.Second)
+	assert.Nil(r.Relay())
+	assert.Equal(2, len(nonces))
+
+	// the dropped txs are resubmitted with their own nonces
+	virtualClock.Advance(time.Second)
+	assert.Nil(r.Relay())
+	assert.Equal([]string{"0x0", "0x1", "0x0", "0x1"}, nonces)
+	transfer := r.Progress().Transfers[0]
+	assert.Equal(uint64(1), transfer.Resubmits)
+	assert.Equal(types.Hash{3}, transfer.TargetTx)
+	assert.Equal(virtualClock.Now(), transfer.SubmittedAt)
+
+	// the nonce of the second tx is taken by another tx of the account, it takes a new nonce
+	virtualClock.Advance(time.Minute)
+	mined = "0x2"
+	target.handlers["eth_getTransactionReceipt"] = func(params []json.RawMessage) interface{} {
+		if string(params[0]) != fmt.Sprintf(`"0x%x"`, types.Hash{3}) {
+			return nil
+		}
+		return map[string]interface{}{
+			"transactionHash": fmt.Sprintf("0x%x", types.Hash{3}),
+			"blockNumber":     "0x5",
+			"status":          "0x1",
+			"logs":            []interface{}{},
+		}
+	}
+	target.height(5)
+	assert.Nil(r.Relay())
+	assert.Equal([]string{"0x0", "0x1", "0x0", "0x1", "0x2"}, nonces)
+	assert.Equal(uint64(2), r.Progress().Transfers[1].TargetNonce)
+	assert.Equal(uint64(2), r.Progress().Transfers[1].Resubmits)
+	// the mined tx is waiting for confirmations
+	assert.Equal(uint64(1), r.Progress().Transfers[0].Resubmits)
+	assert.Equal(uint64(5), r.Progress().Transfers[0].TargetBlock)
+}
+
+// the target chains are polled by the clock when no block committed
+func TestRelayer_RelayInterval(t *testing.T) {
+	assert := assert.New(t)
+	dataPath, err := ioutil.TempDir("", "relayer")
+	assert.Nil(err)
+	defer os.RemoveAll(dataPath)
+
+	source := newMockGateway()
+	polled := make(chan struct{}, 1)
+	source.handlers["eth_blockNumber"] = func([]json.RawMessage) interface{} {
+		polled <- struct{}{}
+		return "0x0"
+	}
+	sourceServer := httptest.NewServer(source)
+	defer sourceServer.Close()
+	conf := config.RelayerConfig{DataPath: dataPath, Confirmations: 2}
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	r, err := NewRelayer(conf, 1, sourceServer.URL, sourcePool, events.NewEvent(), prometheus.NewRegistry(), virtualClock)
+	assert.Nil(err)
+	assert.Nil(r.Start())
+	defer r.Stop()
+
+	virtualClock.BlockUntil(1)
+	virtualClock.Advance(relayInterval - time.Millisecond)
+	assert.Equal(0, len(polled))
+	virtualClock.Advance(time.Millisecond)
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("source chain not polled after relay interval")
+	}
+	// polled again after another interval
+	virtualClock.BlockUntil(1)
+	virtualClock.Advance(relayInterval)
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("source chain not polled after relay interval")
+	}
+}
+
+func TestNewRelayer(t *testing.T) {
+	assert := assert.New(t)
+	dataPath, err := ioutil.TempDir("", "relayer")
+	assert.Nil(err)
+	defer os.RemoveAll(dataPath)
+	conf := config.RelayerConfig{
+		DataPath: dataPath,
+		Routes: []config.RelayerRoute{
+			{ChainFlag: "sidechain", ApiGateway: "127.0.0.1:47768", Contract: targetPool},
+			{ChainFlag: "sidechain", ApiGateway: "127.0.0.1:47769", Contract: targetPool},
+		},
+	}
+	_, err = NewRelayer(conf, 1, "127.0.0.1:47768", sourcePool, events.NewEvent(), prometheus.NewRegistry(), clock.NewSystemClock())
+	assert.NotNil(err)
+
+	conf.Routes = conf.Routes[:1]
+	r, err := NewRelayer(conf, 1, "127.0.0.1:47768", sourcePool, events.NewEvent(), prometheus.NewRegistry(), clock.NewSystemClock())
+	assert.Nil(err)
+	assert.Nil(r.Start())
+	assert.NotNil(r.Start())
+	r.Stop()
+}
@@ -18,6 +18,9 @@ contract CrossFundsPool {
     mapping(address => uint256) public funds;
     mapping(address => crossTxInfo) public txnsInfo;
 
+    // relayed to the chain of chainFlag by the relayer
+    event CrossTxEvent(address indexed from, address to, uint256 amount, string payload, string chainFlag);
+
     //deploy contract will first call
     constructor() public {
         //deploy address as owner
@@ -48,6 +51,7 @@ contract CrossFundsPool {
         //record crossTxInfo
         uint status = 0;
         txnsInfo[msg.sender] = crossTxInfo({toAddr: to, txHash: targetHash, txState: status, isValid: true});
+        emit CrossTxEvent(msg.sender, to, msg.value, payload, chainFlag);
 
         return targetHash;
     }
@@ -5,6 +5,7 @@ contract WhiteList {
     function inWhiteList(address _account) public view returns(bool);
     function contractProposalStatus(uint proposalId, uint contractId) public returns(bool);
     function changeWhiteListProposalStatus(uint proposalId, address newAddress) public returns(bool);
+    function paramProposalStatus(uint proposalId, uint paramId, uint value) public returns(bool);
 }
 
 contract MetaData {
@@ -59,4 +60,28 @@ contract MetaData {
         whiteListContractAddress = _newAddress;
         whilteList = WhiteList(whiteListContractAddress);
     }
-}
\ No newline at end of file
+
+    // chain parameters read by nodes, take effect from the block after the one changing them
+    // 1: block interval in millisecond, 2: txs per block, 3: enable empty block (0 or 1)
+    struct chainParam{
+        bool registered;
+        uint value;
+    }
+    mapping(uint => chainParam) private chainParams;
+
+    event EventParamUpdate(uint, uint, uint, uint);
+
+    function updateParam(uint _proposalId, uint _paramId, uint _value) public {
+        require(_paramId >= 1 && _paramId <= 3);
+        require(_paramId != 3 || _value <= 1);
+        require(whilteList.paramProposalStatus(_proposalId, _paramId, _value));
+        uint oldValue = chainParams[_paramId].value;
+        chainParams[_paramId].registered = true;
+        chainParams[_paramId].value = _value;
+        emit EventParamUpdate(_proposalId, _paramId, oldValue, _value);
+    }
+
+    function getParam(uint _paramId) public view returns(uint, bool){
+        return (chainParams[_paramId].value, chainParams[_paramId].registered);
+    }
+}
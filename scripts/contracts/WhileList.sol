@@ -277,4 +277,69 @@ contract WhiteList {
         return false;
     }
 
+    struct ParamProposal {
+        uint proposalId;
+        uint paramId;
+        uint value;
+        bool isExist;
+        bool over;
+        uint currentVotes;
+        address issueAddress;
+        mapping(address => bool) voteState;
+    }
+    mapping(uint => ParamProposal) public paramProposalState;
+    mapping(uint => bool) public paramProposalCalledState;
+
+    event EventIssueParamProposal(address, uint, uint, uint);
+    event EventVoteForParamProposal(address, uint);
+
+    function issueParamProposal(uint proposalId, uint paramId, uint value) public {
+        require(!paramProposalState[proposalId].isExist);
+        paramProposalState[proposalId].proposalId = proposalId;
+        paramProposalState[proposalId].paramId = paramId;
+        paramProposalState[proposalId].value = value;
+        paramProposalState[proposalId].issueAddress = msg.sender;
+        paramProposalState[proposalId].isExist = true;
+        if (inWhiteList(msg.sender)) {
+            paramProposalState[proposalId].voteState[msg.sender] = true;
+            paramProposalState[proposalId].currentVotes = paramProposalState[proposalId].currentVotes.add(1);
+        }
+        emit EventIssueParamProposal(msg.sender, proposalId, paramId, value);
+    }
+
+    function conditionsForParamProposal(uint proposalId) private view returns(bool){
+        if (paramProposalState[proposalId].isExist){
+            uint thresHold = totalParticiates.div(3).mul(2) + 1;
+            if (paramProposalState[proposalId].currentVotes >= thresHold) {
+                return true;
+            }
+        }
+        return false;
+    }
+
+    function voteForParamProposal(uint proposalId) public {
+        require(inWhiteList(msg.sender));
+        require(paramProposalState[proposalId].isExist);
+        require(!paramProposalState[proposalId].voteState[msg.sender]);
+        require(!paramProposalState[proposalId].over);
+
+        paramProposalState[proposalId].voteState[msg.sender] = true;
+        paramProposalState[proposalId].currentVotes = paramProposalState[proposalId].currentVotes.add(1);
+        if (conditionsForParamProposal(proposalId)){
+            paramProposalState[proposalId].over = true;
+        }
+        emit EventVoteForParamProposal(msg.sender, proposalId);
+    }
+
+    function paramProposalStatus(uint proposalId, uint paramId, uint value) public returns(bool){
+        // only can be called once
+        if (!paramProposalCalledState[proposalId]){
+            if (paramProposalState[proposalId].paramId == paramId && paramProposalState[proposalId].value == value && paramProposalState[proposalId].over) {
+                paramProposalCalledState[proposalId] = true;
+                return true;
+            }
+        }
+        return false;
+    }
+
 }
\ No newline at end of file
@@ -0,0 +1,73 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/rlp"
+	"io"
+	"io/ioutil"
+)
+
+// snapshot archive layout: magic | version | sha256 of the rlp encoded snapshot | gzip compressed rlp encoded snapshot
+const (
+	archiveMagic   = "JTSNAPSH"
+	archiveVersion = byte(3)
+)
+
+// WriteArchive write the snapshot to a portable, checksummed archive.
+func WriteArchive(w io.Writer, snapshot *Snapshot) error {
+	payload, err := rlp.EncodeToBytes(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot, as: %v", err)
+	}
+	checksum := sha256.Sum256(payload)
+	if _, err := w.Write([]byte(archiveMagic)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{archiveVersion}); err != nil {
+		return err
+	}
+	if _, err := w.Write(checksum[:]); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(payload); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadArchive read snapshot from archive, and check the checksum of the snapshot.
+func ReadArchive(r io.Reader) (*Snapshot, error) {
+	header := make([]byte, len(archiveMagic)+1+sha256.Size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot archive header, as: %v", err)
+	}
+	if string(header[:len(archiveMagic)]) != archiveMagic {
+		return nil, errors.New("not a snapshot archive")
+	}
+	if version := header[len(archiveMagic)]; version != archiveVersion {
+		return nil, fmt.Errorf("unsupported snapshot archive version %d", version)
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress snapshot archive, as: %v", err)
+	}
+	defer zr.Close()
+	payload, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress snapshot archive, as: %v", err)
+	}
+	checksum := sha256.Sum256(payload)
+	if !bytes.Equal(checksum[:], header[len(archiveMagic)+1:]) {
+		return nil, errors.New("snapshot archive checksum mismatch")
+	}
+	snapshot := new(Snapshot)
+	if err := rlp.DecodeBytes(payload, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot, as: %v", err)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,88 @@
+package snapshot
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/p2p/message"
+)
+
+// snapshot message types, which are exchanged on the block syncer p2p channel.
+const (
+	SnapshotReqMsgType       message.MessageType = 0x80 + iota // SnapshotReqMsgType --> request a snapshot at specified height
+	SnapshotRespMsgType                                        // SnapshotRespMsgType --> response of the snapshot request
+	SnapshotChunkReqMsgType                                    // SnapshotChunkReqMsgType --> request a chunk of snapshot accounts
+	SnapshotChunkRespMsgType                                   // SnapshotChunkRespMsgType --> response of the chunk request
+)
+
+// SnapshotReq request a state snapshot at a specified height
+type SnapshotReq struct {
+	Height uint64
+}
+
+func (req *SnapshotReq) MsgId() types.Hash {
+	return types.Hash{}
+}
+
+func (req *SnapshotReq) MsgType() message.MessageType {
+	return SnapshotReqMsgType
+}
+
+func (req *SnapshotReq) ResponseMsgType() message.MessageType {
+	return SnapshotRespMsgType
+}
+
+// SnapshotResp response the state snapshot without accounts, which are fetched in Chunks chunks.
+// Snapshot is nil if the peer can not serve the request.
+type SnapshotResp struct {
+	Height   uint64
+	Snapshot *Snapshot
+	Chunks   uint64
+}
+
+func (resp *SnapshotResp) MsgId() types.Hash {
+	return types.Hash{}
+}
+
+func (resp *SnapshotResp) MsgType() message.MessageType {
+	return SnapshotRespMsgType
+}
+
+func (resp *SnapshotResp) ResponseMsgType() message.MessageType {
+	return message.NIL
+}
+
+// SnapshotChunkReq request the chunk at Index of the snapshot accounts at a specified height
+type SnapshotChunkReq struct {
+	Height uint64
+	Index  uint64
+}
+
+func (req *SnapshotChunkReq) MsgId() types.Hash {
+	return types.Hash{}
+}
+
+func (req *SnapshotChunkReq) MsgType() message.MessageType {
+	return SnapshotChunkReqMsgType
+}
+
+func (req *SnapshotChunkReq) ResponseMsgType() message.MessageType {
+	return SnapshotChunkRespMsgType
+}
+
+// SnapshotChunkResp response a chunk of snapshot accounts, Accounts is empty if the peer can not serve the request.
+type SnapshotChunkResp struct {
+	Height   uint64
+	Index    uint64
+	Accounts []Account
+}
+
+func (resp *SnapshotChunkResp) MsgId() types.Hash {
+	return types.Hash{}
+}
+
+func (resp *SnapshotChunkResp) MsgType() message.MessageType {
+	return SnapshotChunkRespMsgType
+}
+
+func (resp *SnapshotChunkResp) ResponseMsgType() message.MessageType {
+	return message.NIL
+}
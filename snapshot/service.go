@@ -0,0 +1,312 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/p2p"
+	pcommon "github.com/DSiSc/p2p/common"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// number of messages can be cached in forward channel
+const forwardChannelCacheLimit = 512
+
+// number of snapshot responses and chunk responses can be queued while fast sync is in progress
+const respChannelCacheLimit = 64
+
+// time to wait for a chunk from the peer, the next peer is tried after it
+const chunkWaitTimeout = 10 * time.Second
+
+var (
+	errFetchTimeout   = errors.New("fetch snapshot time out")
+	errServiceStopped = errors.New("snapshot service already stopped")
+)
+
+// syncerP2P is the view of the block syncer p2p without snapshot messages.
+type syncerP2P struct {
+	p2p.P2PAPI
+	msgChan chan *p2p.InternalMsg
+}
+
+// MessageChan get the message channel without snapshot messages
+func (sp *syncerP2P) MessageChan() <-chan *p2p.InternalMsg {
+	return sp.msgChan
+}
+
+// Service serve snapshot request from peers and fetch snapshot from peers.
+// Messages that not belong to snapshot protocol will be forwarded to the p2p returned by P2P().
+type Service struct {
+	chain     common.Chain
+	p2p       p2p.P2PAPI
+	forward   *syncerP2P
+	respChan  chan *p2p.InternalMsg
+	chunkChan chan *p2p.InternalMsg
+	syncing   int32
+	quitChan  chan interface{}
+	lock      sync.Mutex
+	isRunning int32
+	// the latest snapshot served to peers and its account chunks, reused by the chunk requests
+	servedLock   sync.Mutex
+	served       *Snapshot
+	servedChunks [][]Account
+}
+
+// NewService create a snapshot service of chain on the specified p2p.
+func NewService(chain common.Chain, network p2p.P2PAPI) *Service {
+	return &Service{
+		chain: chain,
+		p2p:   network,
+		forward: &syncerP2P{
+			P2PAPI:  network,
+			msgChan: make(chan *p2p.InternalMsg, forwardChannelCacheLimit),
+		},
+		respChan:  make(chan *p2p.InternalMsg, respChannelCacheLimit),
+		chunkChan: make(chan *p2p.InternalMsg, respChannelCacheLimit),
+		quitChan:  make(chan interface{}),
+		isRunning: 0,
+	}
+}
+
+// P2P get the p2p which can be used by other service sharing the same p2p.
+func (service *Service) P2P() p2p.P2PAPI {
+	return service.forward
+}
+
+// Start start snapshot service
+func (service *Service) Start() error {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	if service.isRunning == 1 {
+		log.Error("snapshot service already started")
+		return errors.New("snapshot service already started")
+	}
+	service.isRunning = 1
+	go service.recvHandler()
+	return nil
+}
+
+// Stop stop snapshot service
+func (service *Service) Stop() {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	if service.isRunning == 0 {
+		return
+	}
+	service.isRunning = 0
+	close(service.quitChan)
+}
+
+// FastSync fetch the snapshot at trusted height from peers, verify it and install it in the repository.
+// The snapshot block must have the trusted hash, which the state is verified against by its StateRoot,
+// the accounts are fetched in chunks from the peer responding the snapshot.
+func (service *Service) FastSync(trustedHeight uint64, trustedHash types.Hash, timeout time.Duration) error {
+	if (trustedHash == types.Hash{}) {
+		return errors.New("trusted hash is required by fast sync, as the snapshot from peers is verified against it")
+	}
+	chain, err := service.chain.Latest()
+	if err != nil {
+		return fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	if currentBlock := chain.GetCurrentBlock(); nil != currentBlock && currentBlock.Header.Height >= trustedHeight {
+		log.Info("local height %d is not lower than trusted height %d, skip fast sync", currentBlock.Header.Height, trustedHeight)
+		return nil
+	}
+	localMeta, err := config.ReadChainMeta(chain)
+	if err != nil {
+		return err
+	}
+	if nil == localMeta {
+		return errors.New("chain meta is not recorded in local repository")
+	}
+
+	atomic.StoreInt32(&service.syncing, 1)
+	defer atomic.StoreInt32(&service.syncing, 0)
+	service.p2p.BroadCast(&SnapshotReq{Height: trustedHeight})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-service.respChan:
+			resp := msg.Payload.(*SnapshotResp)
+			if resp.Height != trustedHeight || nil == resp.Snapshot {
+				log.Warn("received an useless snapshot response with height %d", resp.Height)
+				continue
+			}
+			snapshot := resp.Snapshot
+			if err := snapshot.Verify(); err != nil {
+				log.Warn("received an invalid snapshot, as: %v", err)
+				continue
+			}
+			if mismatches := localMeta.Mismatch(&snapshot.Meta); len(mismatches) > 0 {
+				log.Warn("snapshot belongs to another chain, mismatch: %s", strings.Join(mismatches, "; "))
+				continue
+			}
+			if common.HeaderHash(snapshot.Block) != trustedHash {
+				log.Warn("snapshot block hash %x mismatch with trusted hash %x", common.HeaderHash(snapshot.Block), trustedHash)
+				continue
+			}
+			accounts, err := service.fetchChunks(msg.From, trustedHeight, resp.Chunks, timer.C)
+			if errFetchTimeout == err || errServiceStopped == err {
+				return err
+			}
+			if err != nil {
+				log.Warn("failed to fetch snapshot accounts, as: %v", err)
+				continue
+			}
+			snapshot.Accounts = accounts
+			installChain, err := service.chain.Latest()
+			if err != nil {
+				return fmt.Errorf("failed to get latest state repository, as: %v", err)
+			}
+			if err := snapshot.Install(installChain); err != nil {
+				log.Warn("failed to install snapshot, as: %v", err)
+				continue
+			}
+			return nil
+		case <-timer.C:
+			return errFetchTimeout
+		case <-service.quitChan:
+			return errServiceStopped
+		}
+	}
+}
+
+// fetch the account chunks of snapshot at height from peer one by one.
+func (service *Service) fetchChunks(peer *pcommon.NetAddress, height uint64, chunks uint64, deadline <-chan time.Time) ([]Account, error) {
+	parts := make([][]Account, 0, chunks)
+	for index := uint64(0); index < chunks; index++ {
+		if err := service.p2p.SendMsg(peer, &SnapshotChunkReq{Height: height, Index: index}); err != nil {
+			return nil, fmt.Errorf("failed to request chunk %d from %s, as: %v", index, peer.ToString(), err)
+		}
+		chunk, err := service.waitChunk(peer, height, index, deadline)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, chunk)
+	}
+	return MergeChunks(parts), nil
+}
+
+// wait for the chunk at index from peer, the stale chunks are skipped.
+func (service *Service) waitChunk(peer *pcommon.NetAddress, height uint64, index uint64, deadline <-chan time.Time) ([]Account, error) {
+	timer := time.NewTimer(chunkWaitTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-service.chunkChan:
+			resp := msg.Payload.(*SnapshotChunkResp)
+			if msg.From.ToString() != peer.ToString() || resp.Height != height || resp.Index != index {
+				log.Debug("skip the stale chunk %d of snapshot at height %d", resp.Index, resp.Height)
+				continue
+			}
+			if 0 == len(resp.Accounts) {
+				return nil, fmt.Errorf("peer %s can not serve chunk %d of snapshot at height %d", peer.ToString(), index, height)
+			}
+			return resp.Accounts, nil
+		case <-timer.C:
+			return nil, fmt.Errorf("fetch chunk %d of snapshot at height %d from %s time out", index, height, peer.ToString())
+		case <-deadline:
+			return nil, errFetchTimeout
+		case <-service.quitChan:
+			return nil, errServiceStopped
+		}
+	}
+}
+
+// receive handler will serve the snapshot messages, and forward the others.
+func (service *Service) recvHandler() {
+	for {
+		select {
+		case msg := <-service.p2p.MessageChan():
+			switch msg.Payload.(type) {
+			case *SnapshotReq:
+				go service.serveSnapshot(msg)
+			case *SnapshotChunkReq:
+				go service.serveChunk(msg)
+			case *SnapshotResp:
+				service.deliver(service.respChan, msg)
+			case *SnapshotChunkResp:
+				service.deliver(service.chunkChan, msg)
+			default:
+				service.forward.msgChan <- msg
+			}
+		case <-service.quitChan:
+			log.Info("exit snapshot receive handler, as snapshot service already stopped")
+			return
+		}
+	}
+}
+
+// deliver the response to the fast sync in progress, the responses arriving while fast sync is
+// verifying a snapshot or fetching chunks are queued, only those beyond the cache limit are dropped.
+func (service *Service) deliver(ch chan *p2p.InternalMsg, msg *p2p.InternalMsg) {
+	if 0 == atomic.LoadInt32(&service.syncing) {
+		log.Debug("no fast sync in progress, drop the snapshot response")
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+		log.Warn("too many snapshot responses queued, drop the one from %s", msg.From.ToString())
+	}
+}
+
+// get the snapshot at height served to peers and its account chunks, it is taken if not cached.
+func (service *Service) servedSnapshot(height uint64) (*Snapshot, [][]Account, error) {
+	service.servedLock.Lock()
+	defer service.servedLock.Unlock()
+	if nil != service.served && service.served.Height == height {
+		return service.served, service.servedChunks, nil
+	}
+	snapshot, err := Take(service.chain, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	service.served, service.servedChunks = snapshot, snapshot.Chunks()
+	return service.served, service.servedChunks, nil
+}
+
+// serve the snapshot request from peer, the accounts are served by chunk requests.
+func (service *Service) serveSnapshot(msg *p2p.InternalMsg) {
+	req := msg.Payload.(*SnapshotReq)
+	resp := &SnapshotResp{
+		Height: req.Height,
+	}
+	snapshot, chunks, err := service.servedSnapshot(req.Height)
+	if err != nil {
+		log.Warn("failed to take snapshot at height %d, as: %v", req.Height, err)
+	} else {
+		header := *snapshot
+		header.Accounts = nil
+		resp.Snapshot = &header
+		resp.Chunks = uint64(len(chunks))
+	}
+	if err := service.p2p.SendMsg(msg.From, resp); err != nil {
+		log.Error("failed to send snapshot response to %s, as: %v", msg.From.ToString(), err)
+	}
+}
+
+// serve the chunk request from peer
+func (service *Service) serveChunk(msg *p2p.InternalMsg) {
+	req := msg.Payload.(*SnapshotChunkReq)
+	resp := &SnapshotChunkResp{
+		Height: req.Height,
+		Index:  req.Index,
+	}
+	_, chunks, err := service.servedSnapshot(req.Height)
+	if err != nil {
+		log.Warn("failed to take snapshot at height %d, as: %v", req.Height, err)
+	} else if req.Index < uint64(len(chunks)) {
+		resp.Accounts = chunks[req.Index]
+	}
+	if err := service.p2p.SendMsg(msg.From, resp); err != nil {
+		log.Error("failed to send snapshot chunk to %s, as: %v", msg.From.ToString(), err)
+	}
+}
@@ -0,0 +1,235 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/governance"
+	"github.com/DSiSc/justitia/tools"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/tools/account"
+	"math/big"
+	"sort"
+)
+
+// number of state entries, an account or a storage slot, in a chunk of snapshot accounts
+const chunkEntriesLimit = 4096
+
+// StorageEntry is a single storage slot of a contract account.
+type StorageEntry struct {
+	Key   types.Hash
+	Value types.Hash
+}
+
+// Account is the state of an account in snapshot.
+type Account struct {
+	Address types.Address
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage []StorageEntry
+}
+
+// Snapshot is the whole state of the chain at a specified height, together with the block at that height
+// and the meta of the chain, which is recorded in the repository the snapshot installed to.
+type Snapshot struct {
+	Height   uint64
+	Block    *types.Block
+	Accounts []Account
+	Meta     config.ChainMeta
+	// validators elected at the epoch boundary ElectedAt, which produce the blocks after snapshot,
+	// empty if validators are not elected by Voting contract
+	ElectedAt  uint64
+	Validators []account.Account
+}
+
+// Take take a snapshot of the state of chain at the specified height.
+func Take(source common.Chain, height uint64) (*Snapshot, error) {
+	chain, err := source.Latest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest state repository, as: %v", err)
+	}
+	block, err := chain.GetBlockByHeight(height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block with height %d, as: %v", height, err)
+	}
+	meta, err := config.ReadChainMeta(chain)
+	if err != nil {
+		return nil, err
+	}
+	if nil == meta {
+		return nil, fmt.Errorf("chain meta is not recorded in repository, start the node once before taking snapshot")
+	}
+	stateChain, err := source.At(common.HeaderHash(block))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state of block %d, as: %v", height, err)
+	}
+	snapshot := &Snapshot{
+		Height:   height,
+		Block:    block,
+		Accounts: dumpAccounts(stateChain),
+		Meta:     *meta,
+	}
+	if err := snapshot.takeValidators(chain); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// take the validators producing the blocks after snapshot, the state of the epoch boundary they are
+// elected at is not in the snapshot, so they are taken from the record in repository.
+func (snapshot *Snapshot) takeValidators(chain *repository.Repository) error {
+	rules, err := config.GetChainRulesFromConfig()
+	if err != nil {
+		return err
+	}
+	if nil == rules || 0 == rules.Consensus.Epoch || snapshot.Height < rules.Consensus.Epoch {
+		return nil
+	}
+	snapshot.ElectedAt = snapshot.Height / rules.Consensus.Epoch * rules.Consensus.Epoch
+	if snapshot.Validators, err = governance.ReadElected(chain, snapshot.ElectedAt); err != nil {
+		return err
+	}
+	if nil == snapshot.Validators {
+		return fmt.Errorf("validators elected at height %d are not recorded in repository", snapshot.ElectedAt)
+	}
+	return nil
+}
+
+// dump all accounts in the repository state, sorted by address and storage key, so that the
+// chunks of a snapshot are the same on every peer.
+func dumpAccounts(chain *repository.Repository) []Account {
+	dump := chain.RawDump()
+	accounts := make([]Account, 0, len(dump.Accounts))
+	for addr, dumpAccount := range dump.Accounts {
+		balance, ok := new(big.Int).SetString(dumpAccount.Balance, 10)
+		if !ok {
+			balance = new(big.Int)
+		}
+		account := Account{
+			Address: tools.HexToAddress(addr),
+			Balance: balance,
+			Nonce:   dumpAccount.Nonce,
+			Code:    tools.FromHex(dumpAccount.Code),
+			Storage: make([]StorageEntry, 0, len(dumpAccount.Storage)),
+		}
+		for key, value := range dumpAccount.Storage {
+			account.Storage = append(account.Storage, StorageEntry{
+				Key:   types.BytesToHash(tools.FromHex(key)),
+				Value: types.BytesToHash(tools.FromHex(value)),
+			})
+		}
+		sort.Slice(account.Storage, func(i, j int) bool {
+			return bytes.Compare(account.Storage[i].Key[:], account.Storage[j].Key[:]) < 0
+		})
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Address[:], accounts[j].Address[:]) < 0
+	})
+	return accounts
+}
+
+// Chunks split the snapshot accounts into chunks of at most chunkEntriesLimit entries. The
+// storage of a large account is split too, its parts are consecutive accounts with the same
+// address, which are merged by MergeChunks.
+func (snapshot *Snapshot) Chunks() [][]Account {
+	chunks := make([][]Account, 0)
+	chunk, entries := make([]Account, 0), 0
+	for _, account := range snapshot.Accounts {
+		part := account
+		for {
+			room := chunkEntriesLimit - entries - 1
+			if len(part.Storage) <= room {
+				chunk = append(chunk, part)
+				entries += 1 + len(part.Storage)
+				break
+			}
+			if room > 0 {
+				head := part
+				head.Storage = part.Storage[:room:room]
+				chunk = append(chunk, head)
+			}
+			chunks, chunk, entries = append(chunks, chunk), make([]Account, 0), 0
+			part.Storage = part.Storage[room:]
+		}
+		if entries >= chunkEntriesLimit {
+			chunks, chunk, entries = append(chunks, chunk), make([]Account, 0), 0
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// MergeChunks join the chunks of snapshot accounts, the parts of an account split by Chunks are merged.
+func MergeChunks(chunks [][]Account) []Account {
+	accounts := make([]Account, 0)
+	for _, chunk := range chunks {
+		for _, account := range chunk {
+			if last := len(accounts) - 1; last >= 0 && accounts[last].Address == account.Address {
+				accounts[last].Storage = append(accounts[last].Storage, account.Storage...)
+				continue
+			}
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+// Verify check the snapshot is well-formed, the state root is checked when installing it.
+func (snapshot *Snapshot) Verify() error {
+	if nil == snapshot.Block || nil == snapshot.Block.Header {
+		return fmt.Errorf("snapshot at height %d does not contain block header", snapshot.Height)
+	}
+	if snapshot.Block.Header.Height != snapshot.Height {
+		return fmt.Errorf("snapshot height %d mismatch with block height %d", snapshot.Height, snapshot.Block.Header.Height)
+	}
+	if "" == snapshot.Meta.GenesisHash {
+		return fmt.Errorf("snapshot at height %d does not contain chain meta", snapshot.Height)
+	}
+	return nil
+}
+
+// Install write the snapshot state and block into the repository, the state is verified
+// against the block header's StateRoot before the block is written. The chain meta of snapshot
+// is recorded, as the node seeded by snapshot has no genesis block to derive it from.
+func (snapshot *Snapshot) Install(chain *repository.Repository) error {
+	if err := snapshot.Verify(); err != nil {
+		return err
+	}
+	for _, account := range snapshot.Accounts {
+		chain.CreateAccount(account.Address)
+		if nil != account.Balance {
+			chain.SetBalance(account.Address, account.Balance)
+		}
+		chain.SetNonce(account.Address, account.Nonce)
+		if len(account.Code) != 0 {
+			chain.SetCode(account.Address, account.Code)
+		}
+		for _, entry := range account.Storage {
+			chain.SetState(account.Address, entry.Key, entry.Value)
+		}
+	}
+	stateRoot := chain.IntermediateRoot(false)
+	if stateRoot != snapshot.Block.Header.StateRoot {
+		return fmt.Errorf("snapshot state root %x mismatch with block header state root %x", stateRoot, snapshot.Block.Header.StateRoot)
+	}
+	if err := chain.WriteBlock(snapshot.Block); err != nil {
+		return fmt.Errorf("failed to write snapshot block %d, as: %v", snapshot.Height, err)
+	}
+	if err := config.WriteChainMeta(chain, &snapshot.Meta); err != nil {
+		return err
+	}
+	if len(snapshot.Validators) > 0 {
+		if err := governance.WriteElected(chain, snapshot.ElectedAt, snapshot.Validators); err != nil {
+			return err
+		}
+	}
+	log.Info("install snapshot at height %d with state root %x success", snapshot.Height, stateRoot)
+	return nil
+}
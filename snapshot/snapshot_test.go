@@ -0,0 +1,237 @@
+package snapshot
+
+import (
+	"bytes"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/governance"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/p2p"
+	pcommon "github.com/DSiSc/p2p/common"
+	"github.com/DSiSc/p2p/message"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/tools/account"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var mockStateRoot = types.Hash{
+	0x1d, 0xcf, 0x7, 0xba, 0xfc, 0x42, 0xb0, 0x8d, 0xfd, 0x23, 0x9c, 0x45, 0xa4, 0xb9, 0x38, 0xd,
+	0x8d, 0xfe, 0x5d, 0x6f, 0xa7, 0xdb, 0xd5, 0x50, 0xc9, 0x25, 0xb1, 0xb3, 0x4, 0xdc, 0xc5, 0x1c,
+}
+
+func mockSnapshot() *Snapshot {
+	return &Snapshot{
+		Height: 10,
+		Block: &types.Block{
+			Header: &types.Header{
+				Height:    10,
+				StateRoot: mockStateRoot,
+			},
+		},
+		Accounts: []Account{
+			{
+				Address: types.Address{0x33, 0x3c, 0x33, 0x10},
+				Balance: big.NewInt(1000),
+				Nonce:   1,
+			},
+		},
+		Meta: config.ChainMeta{
+			GenesisHash:   "0x01",
+			ChainId:       1,
+			HashAlgorithm: "SHA256",
+		},
+	}
+}
+
+func TestSnapshot_Verify(t *testing.T) {
+	assert := assert.New(t)
+	snapshot := mockSnapshot()
+	assert.Nil(snapshot.Verify())
+
+	snapshot.Meta.GenesisHash = ""
+	assert.NotNil(snapshot.Verify())
+
+	snapshot.Height = 11
+	assert.NotNil(snapshot.Verify())
+
+	snapshot.Block = nil
+	assert.NotNil(snapshot.Verify())
+}
+
+func TestSnapshot_Install(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	chain := &repository.Repository{}
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "CreateAccount", func(*repository.Repository, types.Address) {})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "SetBalance", func(*repository.Repository, types.Address, *big.Int) {})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "SetNonce", func(*repository.Repository, types.Address, uint64) {})
+	var written *types.Block
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "WriteBlock", func(_ *repository.Repository, block *types.Block) error {
+		written = block
+		return nil
+	})
+
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "IntermediateRoot", func(*repository.Repository, bool) types.Hash {
+		return types.Hash{}
+	})
+	snapshot := mockSnapshot()
+	assert.NotNil(snapshot.Install(chain))
+	assert.Nil(written)
+
+	records := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Put", func(_ *repository.Repository, key []byte, value []byte) error {
+		records[string(key)] = value
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Get", func(_ *repository.Repository, key []byte) ([]byte, error) {
+		return records[string(key)], nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "IntermediateRoot", func(*repository.Repository, bool) types.Hash {
+		return mockStateRoot
+	})
+	snapshot.ElectedAt = 10
+	snapshot.Validators = []account.Account{{Address: types.Address{0x01}, Extension: account.AccountExtension{Id: 1, Url: "127.0.0.1:8080"}}}
+	assert.Nil(snapshot.Install(chain))
+	assert.Equal(snapshot.Block, written)
+	stored, err := config.ReadChainMeta(chain)
+	assert.Nil(err)
+	assert.Equal(&snapshot.Meta, stored)
+	validators, err := governance.ReadElected(chain, 10)
+	assert.Nil(err)
+	assert.Equal(snapshot.Validators, validators)
+}
+
+func TestSnapshot_Chunks(t *testing.T) {
+	assert := assert.New(t)
+	snapshot := mockSnapshot()
+	contract := Account{
+		Address: types.Address{0x44},
+		Balance: big.NewInt(0),
+		Storage: make([]StorageEntry, 2*chunkEntriesLimit),
+	}
+	for i := range contract.Storage {
+		contract.Storage[i] = StorageEntry{Key: types.BytesToHash(big.NewInt(int64(i)).Bytes())}
+	}
+	snapshot.Accounts = append(snapshot.Accounts, contract)
+
+	chunks := snapshot.Chunks()
+	assert.Equal(3, len(chunks))
+	for _, chunk := range chunks {
+		entries := 0
+		for _, account := range chunk {
+			entries += 1 + len(account.Storage)
+		}
+		assert.True(entries <= chunkEntriesLimit)
+	}
+	assert.Equal(snapshot.Accounts, MergeChunks(chunks))
+}
+
+func TestService_FastSync(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	served := mockSnapshot()
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return nil
+	})
+	records := make(map[string][]byte)
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Put", func(_ *repository.Repository, key []byte, value []byte) error {
+		records[string(key)] = value
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "Get", func(_ *repository.Repository, key []byte) ([]byte, error) {
+		return records[string(key)], nil
+	})
+	assert.Nil(config.WriteChainMeta(chain, &served.Meta))
+	var installed *Snapshot
+	monkey.PatchInstanceMethod(reflect.TypeOf(installed), "Install", func(snapshot *Snapshot, _ *repository.Repository) error {
+		installed = snapshot
+		return nil
+	})
+
+	// the peer serves the snapshot header and then the chunks of accounts
+	p2pN := &p2p.P2P{}
+	msgChan := make(chan *p2p.InternalMsg, 4)
+	peer := &pcommon.NetAddress{IP: "127.0.0.1"}
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "MessageChan", func(*p2p.P2P) <-chan *p2p.InternalMsg {
+		return msgChan
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "BroadCast", func(_ *p2p.P2P, msg message.Message) {
+		header := *served
+		header.Accounts = nil
+		msgChan <- &p2p.InternalMsg{From: peer, Payload: &SnapshotResp{Height: 10, Snapshot: &header, Chunks: 1}}
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "SendMsg", func(_ *p2p.P2P, to *pcommon.NetAddress, msg message.Message) error {
+		req := msg.(*SnapshotChunkReq)
+		msgChan <- &p2p.InternalMsg{From: to, Payload: &SnapshotChunkResp{Height: req.Height, Index: req.Index, Accounts: served.Accounts}}
+		return nil
+	})
+	service := NewService(common.ProcessChain, p2pN)
+	assert.Nil(service.Start())
+	defer service.Stop()
+
+	assert.NotNil(service.FastSync(10, types.Hash{}, time.Second))
+	assert.Equal(errFetchTimeout, service.FastSync(10, types.Hash{0x01}, 100*time.Millisecond))
+	assert.Nil(installed)
+
+	assert.Nil(service.FastSync(10, common.HeaderHash(served.Block), time.Second))
+	assert.NotNil(installed)
+	assert.Equal(served.Accounts, installed.Accounts)
+}
+
+func TestService_Forward(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	p2pN := &p2p.P2P{}
+	msgChan := make(chan *p2p.InternalMsg)
+	monkey.PatchInstanceMethod(reflect.TypeOf(p2pN), "MessageChan", func(*p2p.P2P) <-chan *p2p.InternalMsg {
+		return msgChan
+	})
+	service := NewService(common.ProcessChain, p2pN)
+	assert.Nil(service.Start())
+	assert.NotNil(service.Start())
+
+	iMsg := &p2p.InternalMsg{
+		Payload: &message.Block{
+			Block: &types.Block{},
+		},
+	}
+	go func() {
+		msgChan <- iMsg
+	}()
+	forwarded := <-service.P2P().MessageChan()
+	assert.Equal(iMsg, forwarded)
+	service.Stop()
+	assert.Equal(int32(0), service.isRunning)
+}
+
+func TestArchive(t *testing.T) {
+	assert := assert.New(t)
+	snapshot := mockSnapshot()
+	var buf bytes.Buffer
+	assert.Nil(WriteArchive(&buf, snapshot))
+
+	archive := buf.Bytes()
+	decoded, err := ReadArchive(bytes.NewReader(archive))
+	assert.Nil(err)
+	assert.Equal(snapshot.Height, decoded.Height)
+	assert.Equal(snapshot.Block.Header.StateRoot, decoded.Block.Header.StateRoot)
+	assert.Equal(snapshot.Accounts[0].Address, decoded.Accounts[0].Address)
+	assert.Equal(0, snapshot.Accounts[0].Balance.Cmp(decoded.Accounts[0].Balance))
+	assert.Equal(snapshot.Meta, decoded.Meta)
+
+	archive[len(archiveMagic)+1] ^= 0xff
+	_, err = ReadArchive(bytes.NewReader(archive))
+	assert.NotNil(err)
+
+	_, err = ReadArchive(bytes.NewReader([]byte("invalid snapshot archive content")))
+	assert.NotNil(err)
+}
@@ -0,0 +1,70 @@
+package syscontract
+
+// VotingABI is the ABI definition of the Voting system contract, as scripts/contracts/Voting.sol deployed by genesis.
+const VotingABI = `[
+  {"constant":true,"inputs":[],"name":"Candidates","outputs":[{"name":"","type":"address[]"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"ranking","type":"uint256"}],"name":"GetCandidateByRanking","outputs":[{"name":"","type":"address"},{"name":"","type":"uint256"},{"name":"","type":"string"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"candidate","type":"address"}],"name":"candidateState","outputs":[{"name":"","type":"uint256"},{"name":"","type":"uint256"},{"name":"","type":"string"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"account","type":"address"}],"name":"isCandidate","outputs":[{"name":"","type":"bool"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_account","type":"address"}],"name":"isInBlackList","outputs":[{"name":"","type":"bool"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_candidate","type":"address"}],"name":"ranking","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"totalNodes","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"GetOnlineSymbol","outputs":[{"name":"","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"applicant","type":"address"},{"name":"pledge","type":"uint256"},{"name":"url","type":"string"},{"name":"memo","type":"string"}],"name":"ApplyToCandidate","outputs":[{"name":"","type":"bool"},{"name":"","type":"string"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"candidate","type":"address"},{"name":"pledge","type":"uint256"}],"name":"Votting","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"candidate","type":"address"},{"name":"canceledPledge","type":"uint256"}],"name":"VoteAdjustment","outputs":[],"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"bool"},{"indexed":false,"name":"","type":"string"}],"name":"ApplyToCandidateEvent","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"uint256"}],"name":"MainNetOnlineEvent","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"uint256"}],"name":"IssueVoteEvent","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"uint256"}],"name":"AdjustmentVoteEvent","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"string"}],"name":"AddToBlackListEvent","type":"event"}
+]`
+
+// WhiteListABI is the ABI definition of the WhiteList system contract.
+const WhiteListABI = `[
+  {"constant":true,"inputs":[{"name":"_account","type":"address"}],"name":"inWhiteList","outputs":[{"name":"","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"proposalId","type":"uint256"},{"name":"_account","type":"address"},{"name":"_opcode","type":"uint256"}],"name":"issueWhileListProposal","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"proposalId","type":"uint256"}],"name":"voteForWhiteListProposal","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"proposalId","type":"uint256"},{"name":"paramId","type":"uint256"},{"name":"value","type":"uint256"}],"name":"issueParamProposal","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"proposalId","type":"uint256"}],"name":"voteForParamProposal","outputs":[],"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"address"}],"name":"EventAddToWhiteList","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"address"}],"name":"EventRemoveFromWhiteList","type":"event"}
+]`
+
+// MetaDataABI is the ABI definition of the MetaData system contract.
+const MetaDataABI = `[
+  {"constant":true,"inputs":[{"name":"_contractId","type":"uint256"}],"name":"getContractById","outputs":[{"name":"","type":"address"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_proposalId","type":"uint256"},{"name":"_contractId","type":"uint256"},{"name":"_contractNewAddress","type":"address"}],"name":"updateContract","outputs":[],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_proposalId","type":"uint256"},{"name":"_newAddress","type":"address"}],"name":"updateWhiteListAddress","outputs":[],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_paramId","type":"uint256"}],"name":"getParam","outputs":[{"name":"","type":"uint256"},{"name":"","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_proposalId","type":"uint256"},{"name":"_paramId","type":"uint256"},{"name":"_value","type":"uint256"}],"name":"updateParam","outputs":[],"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"address"}],"name":"EventContractRegister","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"address"},{"indexed":false,"name":"","type":"address"}],"name":"EventContraceUpdate","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"uint256"},{"indexed":false,"name":"","type":"uint256"}],"name":"EventParamUpdate","type":"event"}
+]`
+
+// JustitiaRightABI is the ABI definition of the JustitiaRight token system contract.
+const JustitiaRightABI = `[
+  {"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},
+  {"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"balance","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_owner","type":"address"}],"name":"residePledge","outputs":[{"name":"balance","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"_owner","type":"address"},{"name":"_spender","type":"address"}],"name":"allowance","outputs":[{"name":"remaining","type":"uint256"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[{"name":"success","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"_spender","type":"address"},{"name":"_value","type":"uint256"}],"name":"approve","outputs":[{"name":"success","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[],"name":"buyJR","outputs":[],"payable":true,"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"_from","type":"address"},{"indexed":true,"name":"_to","type":"address"},{"indexed":false,"name":"_value","type":"uint256"}],"name":"Transfer","type":"event"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"_owner","type":"address"},{"indexed":true,"name":"_spender","type":"address"},{"indexed":false,"name":"_value","type":"uint256"}],"name":"Approval","type":"event"}
+]`
+
+// CrossFundsPoolABI is the ABI definition of the CrossFundsPool system contract.
+const CrossFundsPoolABI = `[
+  {"constant":true,"inputs":[{"name":"","type":"address"}],"name":"funds","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+  {"constant":true,"inputs":[{"name":"","type":"address"}],"name":"txnsInfo","outputs":[{"name":"toAddr","type":"address"},{"name":"txHash","type":"string"},{"name":"txState","type":"uint256"},{"name":"isValid","type":"bool"}],"type":"function"},
+  {"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"payload","type":"string"},{"name":"chainFlag","type":"string"}],"name":"crossTx","outputs":[{"name":"","type":"string"}],"payable":true,"type":"function"},
+  {"constant":false,"inputs":[{"name":"user","type":"address"},{"name":"chainFlag","type":"string"}],"name":"queryTx","outputs":[{"name":"","type":"string"},{"name":"","type":"bool"}],"payable":true,"type":"function"},
+  {"constant":false,"inputs":[{"name":"user","type":"address"},{"name":"payload","type":"string"},{"name":"amount","type":"uint64"},{"name":"chainId","type":"uint64"}],"name":"receiveFunds","outputs":[{"name":"","type":"bool"}],"payable":true,"type":"function"},
+  {"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":false,"name":"to","type":"address"},{"indexed":false,"name":"amount","type":"uint256"},{"indexed":false,"name":"payload","type":"string"},{"indexed":false,"name":"chainFlag","type":"string"}],"name":"CrossTxEvent","type":"event"}
+]`
@@ -0,0 +1,96 @@
+package syscontract
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"math/big"
+)
+
+// CrossTxInfo is the cross chain tx recorded in CrossFundsPool contract.
+type CrossTxInfo struct {
+	To      types.Address
+	TxHash  string
+	TxState *big.Int
+	IsValid bool
+}
+
+// CrossFundsPool is the binding of the CrossFundsPool system contract.
+type CrossFundsPool struct {
+	contract *bind.BoundContract
+}
+
+// NewCrossFundsPool bind the CrossFundsPool contract at address.
+func NewCrossFundsPool(address types.Address, caller bind.Caller, transactor bind.Transactor) (*CrossFundsPool, error) {
+	contract, err := bind.NewBoundContract(address, CrossFundsPoolABI, caller, transactor)
+	if err != nil {
+		return nil, err
+	}
+	return &CrossFundsPool{contract: contract}, nil
+}
+
+// Contract returns the underlying bound contract.
+func (pool *CrossFundsPool) Contract() *bind.BoundContract {
+	return pool.contract
+}
+
+// Funds get the funds locked by the account.
+func (pool *CrossFundsPool) Funds(account types.Address) (*big.Int, error) {
+	out, err := pool.contract.Call("funds", account)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// TxnsInfo get the cross chain tx of the account.
+func (pool *CrossFundsPool) TxnsInfo(account types.Address) (*CrossTxInfo, error) {
+	out, err := pool.contract.Call("txnsInfo", account)
+	if err != nil {
+		return nil, err
+	}
+	return &CrossTxInfo{
+		To:      out[0].(types.Address),
+		TxHash:  out[1].(string),
+		TxState: out[2].(*big.Int),
+		IsValid: out[3].(bool),
+	}, nil
+}
+
+// CrossTx send a transaction transferring value to the account on the chain.
+func (pool *CrossFundsPool) CrossTx(value *big.Int, to types.Address, payload, chainFlag string) (types.Hash, error) {
+	return pool.contract.Transact(value, "crossTx", to, payload, chainFlag)
+}
+
+// QueryTx send a transaction querying the state of the cross chain tx of user.
+func (pool *CrossFundsPool) QueryTx(user types.Address, chainFlag string) (types.Hash, error) {
+	return pool.contract.Transact(nil, "queryTx", user, chainFlag)
+}
+
+// ReceiveFunds send a transaction paying the funds transferred from the chain to user.
+func (pool *CrossFundsPool) ReceiveFunds(user types.Address, payload string, amount, chainId uint64) (types.Hash, error) {
+	return pool.contract.Transact(nil, "receiveFunds", user, payload, amount, chainId)
+}
+
+// CrossTxEvent is emitted when funds are locked to transfer to the account on the chain.
+type CrossTxEvent struct {
+	From      types.Address
+	To        types.Address
+	Amount    *big.Int
+	Payload   string
+	ChainFlag string
+}
+
+// ParseCrossTxEvent decode the CrossTxEvent log.
+func (pool *CrossFundsPool) ParseCrossTxEvent(log *types.Log) (*CrossTxEvent, error) {
+	values, err := pool.contract.UnpackLog("CrossTxEvent", log)
+	if err != nil {
+		return nil, err
+	}
+	return &CrossTxEvent{
+		From:      values[0].(types.Address),
+		To:        values[1].(types.Address),
+		Amount:    values[2].(*big.Int),
+		Payload:   values[3].(string),
+		ChainFlag: values[4].(string),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package syscontract
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"math/big"
+)
+
+// JustitiaRight is the binding of the JustitiaRight token system contract.
+type JustitiaRight struct {
+	contract *bind.BoundContract
+}
+
+// NewJustitiaRight bind the JustitiaRight contract at address.
+func NewJustitiaRight(address types.Address, caller bind.Caller, transactor bind.Transactor) (*JustitiaRight, error) {
+	contract, err := bind.NewBoundContract(address, JustitiaRightABI, caller, transactor)
+	if err != nil {
+		return nil, err
+	}
+	return &JustitiaRight{contract: contract}, nil
+}
+
+// Contract returns the underlying bound contract.
+func (token *JustitiaRight) Contract() *bind.BoundContract {
+	return token.contract
+}
+
+// Name get the token name.
+func (token *JustitiaRight) Name() (string, error) {
+	out, err := token.contract.Call("name")
+	if err != nil {
+		return "", err
+	}
+	return out[0].(string), nil
+}
+
+// Symbol get the token symbol.
+func (token *JustitiaRight) Symbol() (string, error) {
+	out, err := token.contract.Call("symbol")
+	if err != nil {
+		return "", err
+	}
+	return out[0].(string), nil
+}
+
+// Decimals get the token decimals.
+func (token *JustitiaRight) Decimals() (uint8, error) {
+	out, err := token.contract.Call("decimals")
+	if err != nil {
+		return 0, err
+	}
+	return out[0].(uint8), nil
+}
+
+// TotalSupply get the total supply of token.
+func (token *JustitiaRight) TotalSupply() (*big.Int, error) {
+	out, err := token.contract.Call("totalSupply")
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// BalanceOf get the token balance of the owner.
+func (token *JustitiaRight) BalanceOf(owner types.Address) (*big.Int, error) {
+	out, err := token.contract.Call("balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// ResidePledge get the token balance of owner not pledged.
+func (token *JustitiaRight) ResidePledge(owner types.Address) (*big.Int, error) {
+	out, err := token.contract.Call("residePledge", owner)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// Allowance get the token amount the spender is allowed to spend from owner.
+func (token *JustitiaRight) Allowance(owner, spender types.Address) (*big.Int, error) {
+	out, err := token.contract.Call("allowance", owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// Transfer send a transaction transferring token to the account.
+func (token *JustitiaRight) Transfer(to types.Address, value *big.Int) (types.Hash, error) {
+	return token.contract.Transact(nil, "transfer", to, value)
+}
+
+// Approve send a transaction allowing the spender to spend token.
+func (token *JustitiaRight) Approve(spender types.Address, value *big.Int) (types.Hash, error) {
+	return token.contract.Transact(nil, "approve", spender, value)
+}
+
+// BuyJR send a transaction buying token with value.
+func (token *JustitiaRight) BuyJR(value *big.Int) (types.Hash, error) {
+	return token.contract.Transact(value, "buyJR")
+}
+
+// TransferEvent is emitted when token transferred.
+type TransferEvent struct {
+	From  types.Address
+	To    types.Address
+	Value *big.Int
+}
+
+// ParseTransferEvent decode the Transfer log.
+func (token *JustitiaRight) ParseTransferEvent(log *types.Log) (*TransferEvent, error) {
+	values, err := token.contract.UnpackLog("Transfer", log)
+	if err != nil {
+		return nil, err
+	}
+	return &TransferEvent{
+		From:  values[0].(types.Address),
+		To:    values[1].(types.Address),
+		Value: values[2].(*big.Int),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package syscontract
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"math/big"
+)
+
+// ids of the chain parameters in MetaData contract
+const (
+	BlockIntervalParam    = 1
+	TxsPerBlockParam      = 2
+	EnableEmptyBlockParam = 3
+)
+
+// MetaData is the binding of the MetaData system contract.
+type MetaData struct {
+	contract *bind.BoundContract
+}
+
+// NewMetaData bind the MetaData contract at address.
+func NewMetaData(address types.Address, caller bind.Caller, transactor bind.Transactor) (*MetaData, error) {
+	contract, err := bind.NewBoundContract(address, MetaDataABI, caller, transactor)
+	if err != nil {
+		return nil, err
+	}
+	return &MetaData{contract: contract}, nil
+}
+
+// Contract returns the underlying bound contract.
+func (metaData *MetaData) Contract() *bind.BoundContract {
+	return metaData.contract
+}
+
+// GetContractById get the address of contract registered with id.
+func (metaData *MetaData) GetContractById(contractId *big.Int) (types.Address, error) {
+	out, err := metaData.contract.Call("getContractById", contractId)
+	if err != nil {
+		return types.Address{}, err
+	}
+	return out[0].(types.Address), nil
+}
+
+// UpdateContract send a transaction updating the address of contract by the approved proposal.
+func (metaData *MetaData) UpdateContract(proposalId, contractId *big.Int, newAddress types.Address) (types.Hash, error) {
+	return metaData.contract.Transact(nil, "updateContract", proposalId, contractId, newAddress)
+}
+
+// UpdateWhiteListAddress send a transaction updating the address of WhiteList contract by the approved proposal.
+func (metaData *MetaData) UpdateWhiteListAddress(proposalId *big.Int, newAddress types.Address) (types.Hash, error) {
+	return metaData.contract.Transact(nil, "updateWhiteListAddress", proposalId, newAddress)
+}
+
+// GetParam get the value of chain parameter, set is false if it has never been set.
+func (metaData *MetaData) GetParam(paramId *big.Int) (value *big.Int, set bool, err error) {
+	out, err := metaData.contract.Call("getParam", paramId)
+	if err != nil {
+		return nil, false, err
+	}
+	return out[0].(*big.Int), out[1].(bool), nil
+}
+
+// UpdateParam send a transaction setting the chain parameter by the approved proposal.
+func (metaData *MetaData) UpdateParam(proposalId, paramId, value *big.Int) (types.Hash, error) {
+	return metaData.contract.Transact(nil, "updateParam", proposalId, paramId, value)
+}
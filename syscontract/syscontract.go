@@ -0,0 +1,86 @@
+// Package syscontract provides typed bindings of the justitia system contracts.
+package syscontract
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	justitiac "github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/worker"
+	"github.com/DSiSc/validator/worker/common"
+	"math"
+	"math/big"
+)
+
+// gas limit of the read-only call on local state
+const callGasLimit = uint64(math.MaxInt32)
+
+// StateCaller call contracts on the state of local repository, state changes made by
+// the call are discarded.
+type StateCaller struct {
+	chain justitiac.Chain
+	from  types.Address
+	// hash of the block whose state is called on, nil for the latest state
+	blockHash *types.Hash
+}
+
+// NewStateCaller create a caller calling contracts on the latest state of chain from the account.
+func NewStateCaller(chain justitiac.Chain, from types.Address) *StateCaller {
+	return &StateCaller{
+		chain: chain,
+		from:  from,
+	}
+}
+
+// NewStateCallerAt create a caller calling contracts on the state of the block of chain from the account.
+func NewStateCallerAt(chain justitiac.Chain, from types.Address, blockHash types.Hash) *StateCaller {
+	return &StateCaller{
+		chain:     chain,
+		from:      from,
+		blockHash: &blockHash,
+	}
+}
+
+// Call the contract on the state of caller.
+func (caller *StateCaller) Call(contract types.Address, input []byte) ([]byte, error) {
+	chain, block, err := caller.state()
+	if err != nil {
+		return nil, err
+	}
+	tx := justitiac.NewTransaction(chain.GetNonce(caller.from), contract, big.NewInt(0), callGasLimit, big.NewInt(0), input, caller.from)
+	gasPool := new(common.GasPool)
+	gasPool.AddGas(callGasLimit)
+	output, _, failed, err, _ := worker.ApplyTransaction(block.Header.Coinbase, block.Header, chain, tx, gasPool)
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		return nil, errors.New("execution reverted")
+	}
+	return output, nil
+}
+
+// get the repository and block of the state to call on.
+func (caller *StateCaller) state() (*repository.Repository, *types.Block, error) {
+	if nil == caller.blockHash {
+		chain, err := caller.chain.Latest()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get latest state repository, as: %v", err)
+		}
+		block := chain.GetCurrentBlock()
+		if nil == block {
+			return nil, nil, errors.New("no block in local repository")
+		}
+		return chain, block, nil
+	}
+	chain, err := caller.chain.At(*caller.blockHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get state repository of block %x, as: %v", *caller.blockHash, err)
+	}
+	block, err := chain.GetBlockByHash(*caller.blockHash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get block %x, as: %v", *caller.blockHash, err)
+	}
+	return chain, block, nil
+}
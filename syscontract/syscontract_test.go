@@ -0,0 +1,257 @@
+package syscontract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/abi"
+	justitiac "github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/validator/worker"
+	"github.com/DSiSc/validator/worker/common"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var contractAddr = types.Address{0x10}
+
+// mock caller returns the packed outputs of the called method
+type mockCaller struct {
+	abi     abi.ABI
+	outputs map[string][]interface{}
+}
+
+func newMockCaller(definition string, outputs map[string][]interface{}) *mockCaller {
+	parsed, _ := abi.JSON(strings.NewReader(definition))
+	return &mockCaller{abi: parsed, outputs: outputs}
+}
+
+func (caller *mockCaller) Call(contract types.Address, input []byte) ([]byte, error) {
+	method, err := caller.abi.MethodByID(input)
+	if err != nil {
+		return nil, err
+	}
+	outputs, ok := caller.outputs[method.Name]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	return method.Outputs.Pack(outputs...)
+}
+
+// mock transactor records the sent input
+type mockTransactor struct {
+	value *big.Int
+	input []byte
+}
+
+func (transactor *mockTransactor) Transact(contract types.Address, value *big.Int, input []byte) (types.Hash, error) {
+	transactor.value = value
+	transactor.input = input
+	return types.Hash{0x01}, nil
+}
+
+func TestVoting(t *testing.T) {
+	assert := assert.New(t)
+	candidate := types.Address{0x01}
+	caller := newMockCaller(VotingABI, map[string][]interface{}{
+		"Candidates":            {[]types.Address{candidate}},
+		"GetCandidateByRanking": {candidate, big.NewInt(1), "127.0.0.1:47768"},
+		"candidateState":        {big.NewInt(0), big.NewInt(1000), "node1"},
+		"isCandidate":           {true},
+		"totalNodes":            {big.NewInt(4)},
+	})
+	transactor := &mockTransactor{}
+	voting, err := NewVoting(contractAddr, caller, transactor)
+	assert.Nil(err)
+
+	candidates, err := voting.Candidates()
+	assert.Nil(err)
+	assert.Equal([]types.Address{candidate}, candidates)
+	addr, url, id, err := voting.GetCandidateByRanking(0)
+	assert.Nil(err)
+	assert.Equal(candidate, addr)
+	assert.Equal("127.0.0.1:47768", url)
+	assert.Equal(uint64(1), id)
+	state, err := voting.CandidateState(candidate)
+	assert.Nil(err)
+	assert.Equal(uint64(0), state.Ranking.Uint64())
+	assert.Equal(big.NewInt(1000), state.Pledge)
+	assert.Equal("node1", state.Memo)
+	isCandidate, err := voting.IsCandidate(candidate)
+	assert.Nil(err)
+	assert.True(isCandidate)
+	totalNodes, err := voting.TotalNodes()
+	assert.Nil(err)
+	assert.Equal(uint64(4), totalNodes)
+	_, err = voting.GetOnlineSymbol()
+	assert.NotNil(err)
+
+	hash, err := voting.Vote(candidate, big.NewInt(100))
+	assert.Nil(err)
+	assert.Equal(types.Hash{0x01}, hash)
+	expect, _ := voting.Contract().ABI().Pack("Votting", candidate, big.NewInt(100))
+	assert.Equal(expect, transactor.input)
+
+	// read-only binding
+	voting, err = NewVoting(contractAddr, caller, nil)
+	assert.Nil(err)
+	_, err = voting.Vote(candidate, big.NewInt(100))
+	assert.NotNil(err)
+}
+
+func TestParseEvents(t *testing.T) {
+	assert := assert.New(t)
+	token, err := NewJustitiaRight(contractAddr, nil, nil)
+	assert.Nil(err)
+	from, to := types.Address{0x01}, types.Address{0x02}
+	topics, data, err := token.Contract().ABI().PackEvent("Transfer", from, to, big.NewInt(10))
+	assert.Nil(err)
+	event, err := token.ParseTransferEvent(&types.Log{Address: contractAddr, Topics: topics, Data: data})
+	assert.Nil(err)
+	assert.Equal(&TransferEvent{From: from, To: to, Value: big.NewInt(10)}, event)
+	_, err = token.ParseTransferEvent(&types.Log{Address: from, Topics: topics, Data: data})
+	assert.NotNil(err)
+
+	whiteList, err := NewWhiteList(contractAddr, nil, nil)
+	assert.Nil(err)
+	topics, data, err = whiteList.Contract().ABI().PackEvent("EventRemoveFromWhiteList", big.NewInt(3), from)
+	assert.Nil(err)
+	whiteListEvent, err := whiteList.ParseWhiteListEvent(&types.Log{Address: contractAddr, Topics: topics, Data: data})
+	assert.Nil(err)
+	assert.Equal(&WhiteListEvent{ProposalId: big.NewInt(3), Account: from, Added: false}, whiteListEvent)
+
+	pool, err := NewCrossFundsPool(contractAddr, nil, nil)
+	assert.Nil(err)
+	topics, data, err = pool.Contract().ABI().PackEvent("CrossTxEvent", from, to, big.NewInt(5), "payload", "sidechain")
+	assert.Nil(err)
+	crossTxEvent, err := pool.ParseCrossTxEvent(&types.Log{Address: contractAddr, Topics: topics, Data: data})
+	assert.Nil(err)
+	assert.Equal(&CrossTxEvent{From: from, To: to, Amount: big.NewInt(5), Payload: "payload", ChainFlag: "sidechain"}, crossTxEvent)
+}
+
+func TestCrossFundsPool(t *testing.T) {
+	assert := assert.New(t)
+	user := types.Address{0x01}
+	caller := newMockCaller(CrossFundsPoolABI, map[string][]interface{}{
+		"txnsInfo": {user, "0x1234", big.NewInt(0), true},
+	})
+	transactor := &mockTransactor{}
+	pool, err := NewCrossFundsPool(contractAddr, caller, transactor)
+	assert.Nil(err)
+	info, err := pool.TxnsInfo(user)
+	assert.Nil(err)
+	assert.Equal("0x1234", info.TxHash)
+	assert.True(info.IsValid)
+	_, err = pool.CrossTx(big.NewInt(100), user, "", "chainB")
+	assert.Nil(err)
+	assert.Equal(big.NewInt(100), transactor.value)
+}
+
+func TestStateCaller(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	chain := &repository.Repository{}
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return &types.Block{Header: &types.Header{Height: 1}}
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetNonce", func(*repository.Repository, types.Address) uint64 {
+		return 0
+	})
+	var called *types.Transaction
+	monkey.Patch(worker.ApplyTransaction, func(_ types.Address, _ *types.Header, _ *repository.Repository, tx *types.Transaction, _ *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		called = tx
+		return []byte{0x01}, 0, false, nil, types.Address{}
+	})
+	caller := NewStateCaller(justitiac.ProcessChain, types.Address{0x02})
+	output, err := caller.Call(contractAddr, []byte{0x0a})
+	assert.Nil(err)
+	assert.Equal([]byte{0x01}, output)
+	assert.Equal(contractAddr, *called.Data.Recipient)
+	assert.Equal([]byte{0x0a}, called.Data.Payload)
+
+	monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *types.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		return nil, 0, true, nil, types.Address{}
+	})
+	_, err = caller.Call(contractAddr, []byte{0x0a})
+	assert.NotNil(err)
+
+	// call on the state of specified block
+	blockHash := types.Hash{0x0b}
+	var stateHash types.Hash
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(hash types.Hash) (*repository.Repository, error) {
+		stateHash = hash
+		return chain, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(chain), "GetBlockByHash", func(*repository.Repository, types.Hash) (*types.Block, error) {
+		return &types.Block{Header: &types.Header{Height: 10}}, nil
+	})
+	var header *types.Header
+	monkey.Patch(worker.ApplyTransaction, func(_ types.Address, h *types.Header, _ *repository.Repository, _ *types.Transaction, _ *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		header = h
+		return []byte{0x02}, 0, false, nil, types.Address{}
+	})
+	output, err = NewStateCallerAt(justitiac.ProcessChain, types.Address{0x02}, blockHash).Call(contractAddr, []byte{0x0a})
+	assert.Nil(err)
+	assert.Equal([]byte{0x02}, output)
+	assert.Equal(blockHash, stateHash)
+	assert.Equal(uint64(10), header.Height)
+}
+
+// test the methods and events in system contract ABIs are present in the code deployed by genesis.json
+func TestGenesisCode(t *testing.T) {
+	assert := assert.New(t)
+	content, err := ioutil.ReadFile("../config/genesis.json")
+	assert.Nil(err)
+	var genesis struct {
+		GenesisAccounts []struct {
+			Code     string `json:"code"`
+			Contract string `json:"contract"`
+		}
+	}
+	assert.Nil(json.Unmarshal(content, &genesis))
+	codes := make(map[string]string)
+	for _, account := range genesis.GenesisAccounts {
+		codes[account.Contract] = account.Code
+	}
+	// the code of these contracts in genesis.json is compiled from sources older than scripts/contracts,
+	// so the whitelist and chain parameters refuse to start on it until the code is regenerated.
+	stale := map[string]bool{
+		types.JustitiaWhiteList: true,
+		types.JustitiaMetaData:  true,
+	}
+	for contract, definition := range map[string]string{
+		types.JustitiaRightToken: JustitiaRightABI,
+		types.JustitiaVoting:     VotingABI,
+		types.JustitiaWhiteList:  WhiteListABI,
+		types.JustitiaMetaData:   MetaDataABI,
+	} {
+		parsed, err := abi.JSON(strings.NewReader(definition))
+		assert.Nil(err)
+		missing := make([]string, 0)
+		for _, method := range parsed.Methods {
+			// methods are dispatched by PUSH4 <selector>
+			if !strings.Contains(codes[contract], fmt.Sprintf("63%x", method.ID())) {
+				missing = append(missing, method.Sig())
+			}
+		}
+		for _, event := range parsed.Events {
+			if !strings.Contains(codes[contract], fmt.Sprintf("%x", event.ID())) {
+				missing = append(missing, event.Sig())
+			}
+		}
+		if stale[contract] {
+			assert.NotEmpty(missing, "code of %s is regenerated, remove it from stale contracts", contract)
+		} else {
+			assert.Empty(missing, "%s", contract)
+		}
+	}
+}
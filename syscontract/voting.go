@@ -0,0 +1,146 @@
+package syscontract
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"math/big"
+)
+
+// Candidate is the candidate state recorded in Voting contract.
+type Candidate struct {
+	Address types.Address
+	Ranking *big.Int
+	Pledge  *big.Int
+	Memo    string
+}
+
+// Voting is the binding of the Voting system contract.
+type Voting struct {
+	contract *bind.BoundContract
+}
+
+// NewVoting bind the Voting contract at address.
+func NewVoting(address types.Address, caller bind.Caller, transactor bind.Transactor) (*Voting, error) {
+	contract, err := bind.NewBoundContract(address, VotingABI, caller, transactor)
+	if err != nil {
+		return nil, err
+	}
+	return &Voting{contract: contract}, nil
+}
+
+// Contract returns the underlying bound contract.
+func (voting *Voting) Contract() *bind.BoundContract {
+	return voting.contract
+}
+
+// Candidates get the candidates in descending order of pledge.
+func (voting *Voting) Candidates() ([]types.Address, error) {
+	out, err := voting.contract.Call("Candidates")
+	if err != nil {
+		return nil, err
+	}
+	return out[0].([]types.Address), nil
+}
+
+// GetCandidateByRanking get the address, url and id of the candidate at the ranking.
+func (voting *Voting) GetCandidateByRanking(ranking uint64) (types.Address, string, uint64, error) {
+	out, err := voting.contract.Call("GetCandidateByRanking", ranking)
+	if err != nil {
+		return types.Address{}, "", 0, err
+	}
+	return out[0].(types.Address), out[2].(string), out[1].(*big.Int).Uint64(), nil
+}
+
+// CandidateState get the ranking, pledge and memo of the candidate.
+func (voting *Voting) CandidateState(candidate types.Address) (*Candidate, error) {
+	out, err := voting.contract.Call("candidateState", candidate)
+	if err != nil {
+		return nil, err
+	}
+	return &Candidate{
+		Address: candidate,
+		Ranking: out[0].(*big.Int),
+		Pledge:  out[1].(*big.Int),
+		Memo:    out[2].(string),
+	}, nil
+}
+
+// IsCandidate check whether the account is a candidate.
+func (voting *Voting) IsCandidate(account types.Address) (bool, error) {
+	out, err := voting.contract.Call("isCandidate", account)
+	if err != nil {
+		return false, err
+	}
+	return out[0].(bool), nil
+}
+
+// IsInBlackList check whether the account is in black list.
+func (voting *Voting) IsInBlackList(account types.Address) (bool, error) {
+	out, err := voting.contract.Call("isInBlackList", account)
+	if err != nil {
+		return false, err
+	}
+	return out[0].(bool), nil
+}
+
+// Ranking get the ranking of the candidate.
+func (voting *Voting) Ranking(candidate types.Address) (*big.Int, error) {
+	out, err := voting.contract.Call("ranking", candidate)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// TotalNodes get the number of validators.
+func (voting *Voting) TotalNodes() (uint64, error) {
+	out, err := voting.contract.Call("totalNodes")
+	if err != nil {
+		return 0, err
+	}
+	return out[0].(*big.Int).Uint64(), nil
+}
+
+// GetOnlineSymbol check whether the main net is online.
+func (voting *Voting) GetOnlineSymbol() (bool, error) {
+	out, err := voting.contract.Call("GetOnlineSymbol")
+	if err != nil {
+		return false, err
+	}
+	return out[0].(bool), nil
+}
+
+// ApplyToCandidate send a transaction applying the account to be candidate with pledge.
+func (voting *Voting) ApplyToCandidate(applicant types.Address, pledge *big.Int, url, memo string) (types.Hash, error) {
+	return voting.contract.Transact(nil, "ApplyToCandidate", applicant, pledge, url, memo)
+}
+
+// Vote send a transaction voting for the candidate with pledge.
+func (voting *Voting) Vote(candidate types.Address, pledge *big.Int) (types.Hash, error) {
+	return voting.contract.Transact(nil, "Votting", candidate, pledge)
+}
+
+// VoteAdjustment send a transaction canceling the pledge voted for the candidate.
+func (voting *Voting) VoteAdjustment(candidate types.Address, canceledPledge *big.Int) (types.Hash, error) {
+	return voting.contract.Transact(nil, "VoteAdjustment", candidate, canceledPledge)
+}
+
+// ApplyToCandidateEvent is emitted when an account applies to be candidate.
+type ApplyToCandidateEvent struct {
+	Applicant types.Address
+	Succeed   bool
+	Errors    string
+}
+
+// ParseApplyToCandidateEvent decode the ApplyToCandidateEvent log.
+func (voting *Voting) ParseApplyToCandidateEvent(log *types.Log) (*ApplyToCandidateEvent, error) {
+	values, err := voting.contract.UnpackLog("ApplyToCandidateEvent", log)
+	if err != nil {
+		return nil, err
+	}
+	return &ApplyToCandidateEvent{
+		Applicant: values[0].(types.Address),
+		Succeed:   values[1].(bool),
+		Errors:    values[2].(string),
+	}, nil
+}
@@ -0,0 +1,87 @@
+package syscontract
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"math/big"
+)
+
+// WhiteList is the binding of the WhiteList system contract.
+type WhiteList struct {
+	contract *bind.BoundContract
+}
+
+// NewWhiteList bind the WhiteList contract at address.
+func NewWhiteList(address types.Address, caller bind.Caller, transactor bind.Transactor) (*WhiteList, error) {
+	contract, err := bind.NewBoundContract(address, WhiteListABI, caller, transactor)
+	if err != nil {
+		return nil, err
+	}
+	return &WhiteList{contract: contract}, nil
+}
+
+// Contract returns the underlying bound contract.
+func (whiteList *WhiteList) Contract() *bind.BoundContract {
+	return whiteList.contract
+}
+
+// InWhiteList check whether the account is in white list.
+func (whiteList *WhiteList) InWhiteList(account types.Address) (bool, error) {
+	out, err := whiteList.contract.Call("inWhiteList", account)
+	if err != nil {
+		return false, err
+	}
+	return out[0].(bool), nil
+}
+
+// IssueProposal send a transaction issuing a proposal to add or remove the account.
+func (whiteList *WhiteList) IssueProposal(proposalId *big.Int, account types.Address, opcode *big.Int) (types.Hash, error) {
+	return whiteList.contract.Transact(nil, "issueWhileListProposal", proposalId, account, opcode)
+}
+
+// VoteForProposal send a transaction voting for the proposal.
+func (whiteList *WhiteList) VoteForProposal(proposalId *big.Int) (types.Hash, error) {
+	return whiteList.contract.Transact(nil, "voteForWhiteListProposal", proposalId)
+}
+
+// IssueParamProposal send a transaction issuing a proposal to set the chain parameter of MetaData contract.
+func (whiteList *WhiteList) IssueParamProposal(proposalId, paramId, value *big.Int) (types.Hash, error) {
+	return whiteList.contract.Transact(nil, "issueParamProposal", proposalId, paramId, value)
+}
+
+// VoteForParamProposal send a transaction voting for the chain parameter proposal.
+func (whiteList *WhiteList) VoteForParamProposal(proposalId *big.Int) (types.Hash, error) {
+	return whiteList.contract.Transact(nil, "voteForParamProposal", proposalId)
+}
+
+// WhiteListEvent is emitted when an account is added to or removed from white list.
+type WhiteListEvent struct {
+	ProposalId *big.Int
+	Account    types.Address
+	Added      bool
+}
+
+// ParseWhiteListEvent decode the EventAddToWhiteList or EventRemoveFromWhiteList log.
+func (whiteList *WhiteList) ParseWhiteListEvent(log *types.Log) (*WhiteListEvent, error) {
+	event, err := whiteList.contract.ABI().EventByID(firstTopic(log))
+	if err != nil {
+		return nil, err
+	}
+	values, err := whiteList.contract.UnpackLog(event.Name, log)
+	if err != nil {
+		return nil, err
+	}
+	return &WhiteListEvent{
+		ProposalId: values[0].(*big.Int),
+		Account:    values[1].(types.Address),
+		Added:      "EventAddToWhiteList" == event.Name,
+	}, nil
+}
+
+// first topic of log, which is the event id of non-anonymous event.
+func firstTopic(log *types.Log) types.Hash {
+	if len(log.Topics) == 0 {
+		return types.Hash{}
+	}
+	return log.Topics[0]
+}
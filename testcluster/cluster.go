@@ -0,0 +1,733 @@
+// Package testcluster boots a local network of justitia nodes on loopback ports for
+// integration tests. The nodes share a genesis generated from the cluster config, and each
+// of them has its own config home and data dirs under a temp dir.
+//
+// The repository, tx switch and hash algorithm of a node are process level globals in
+// their modules, so a process can only run one node (see node.Context). The cluster runs
+// each node as a child process of the justitia binary instead, which also lets tests kill
+// and freeze nodes the way they fail in production.
+//
+// The nodes dial their p2p peers through tcp proxies of the cluster, one for each pair of
+// nodes and p2p type, so that tests partition the block, tx and block syncer networks by
+// cutting the proxies. The consensus messages to a validator are routed through a proxy of
+// the pair as well (see config.ConsensusRoutes), while it still listens on its url in
+// genesis, so a partition also splits the validators.
+package testcluster
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/bind"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/tools"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// environment variable of a prebuilt justitia binary, the binary is built from source if not set
+	BinaryEnv = "JUSTITIA_BINARY"
+	// package built when no binary specified
+	justitiaPackage = "github.com/DSiSc/justitia"
+	// default port offset between nodes
+	defaultPortOffset = 10
+	// default port of the consensus url of the first node
+	defaultConsensusPort = 48080
+	// default block interval in millisecond
+	defaultBlockInterval = 1000
+	// interval to poll the nodes
+	pollInterval = 200 * time.Millisecond
+)
+
+// p2p networks of nodes, linked through the cluster
+var p2pTypes = []string{config.BlockSyncerP2P, config.BlockP2P, config.TxP2P}
+
+// type of the links carrying consensus messages to validators
+const consensusLink = "consensus"
+
+// Faucet is the account funded in genesis, transactions of the cluster are sent from it.
+var Faucet = types.Address{0xa9, 0x4f, 0x53, 0x74, 0xfc, 0x5e, 0xdb, 0xbc, 0x8e, 0x2a, 0x86, 0x97, 0xc1, 0x53, 0x31, 0x67, 0x7e, 0x6e, 0xbf, 0x0b}
+
+// faucet balance in genesis
+const faucetBalance = "1000000000000000000000000"
+
+// Config is the config of cluster.
+type Config struct {
+	// justitia binary, default to $JUSTITIA_BINARY or built from source
+	Binary string
+	// number of validators
+	Nodes int
+	// number of full nodes, which follow the validators by block propagation and sync
+	FullNodes int
+	// consensus policy, default to solo for one node and fbft for more
+	Policy string
+	// block interval in millisecond, default to 1000
+	BlockInterval int64
+	// produce blocks without txs, so that height grows without traffic
+	EnableEmptyBlock bool
+	// port offset between nodes, default to 10. The first node uses the ports in justitia.yaml
+	PortOffset int
+	// port of the consensus url of the first node, default to 48080
+	ConsensusPort int
+	// shift of the api gateway and p2p ports of all nodes, so that clusters run side by side
+	PortShift int
+	// chain id, default to 1
+	ChainId uint64
+	// system contracts deployed in genesis, which are compiled with solc
+	Contracts []config.GenesisSpecContract
+	// relayer of the first node if enabled, its data path is in the node dir
+	Relayer config.RelayerConfig
+	// keep the temp dir after closed, for inspecting node logs
+	KeepDir bool
+}
+
+// Node is a node of the cluster.
+type Node struct {
+	Id      uint64
+	Address types.Address
+	// whether the node is a validator
+	Consensus bool
+	// config home of the node, holding justitia.yaml, genesis.json, data and log
+	Dir string
+	// client of the node's api gateway, sending txs from Faucet
+	Client *bind.Client
+	cmd    *exec.Cmd
+	exited chan struct{}
+	frozen bool
+}
+
+// Cluster is a network of justitia nodes running on loopback.
+type Cluster struct {
+	conf   Config
+	dir    string
+	binary string
+	Nodes  []*Node
+	// p2p and consensus links from each node to the others
+	links []*link
+	lock  sync.Mutex
+}
+
+// New create the cluster in a temp dir, the genesis and node configs are generated but
+// the nodes are not started.
+func New(conf Config) (*Cluster, error) {
+	if conf.Nodes <= 0 {
+		return nil, errors.New("cluster must contain at least one node")
+	}
+	if common.BlankString == conf.Policy {
+		conf.Policy = "solo"
+		if conf.Nodes > 1 {
+			conf.Policy = "fbft"
+		}
+	}
+	if conf.BlockInterval <= 0 {
+		conf.BlockInterval = defaultBlockInterval
+	}
+	if conf.PortOffset <= 0 {
+		conf.PortOffset = defaultPortOffset
+	}
+	if conf.ConsensusPort <= 0 {
+		conf.ConsensusPort = defaultConsensusPort
+	}
+	if 0 == conf.ChainId {
+		conf.ChainId = 1
+	}
+	dir, err := ioutil.TempDir("", "testcluster")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cluster dir, as: %v", err)
+	}
+	cluster := &Cluster{
+		conf:  conf,
+		dir:   dir,
+		Nodes: make([]*Node, 0, conf.Nodes+conf.FullNodes),
+	}
+	if cluster.binary, err = cluster.findBinary(); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+	if err = cluster.writeConfigs(); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// Dir get the temp dir of cluster.
+func (cluster *Cluster) Dir() string {
+	return cluster.dir
+}
+
+func (cluster *Cluster) findBinary() (string, error) {
+	if common.BlankString != cluster.conf.Binary {
+		return cluster.conf.Binary, nil
+	}
+	if binary := os.Getenv(BinaryEnv); common.BlankString != binary {
+		return binary, nil
+	}
+	return BuildBinary(cluster.dir)
+}
+
+// BuildBinary build the justitia binary in dir, returns the path of binary. Tests build it once
+// and share it with the clusters through $JUSTITIA_BINARY.
+func BuildBinary(dir string) (string, error) {
+	binary := filepath.Join(dir, "justitia")
+	output, err := exec.Command("go", "build", "-o", binary, justitiaPackage).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to build justitia, as: %v\n%s", err, output)
+	}
+	return binary, nil
+}
+
+// generate the genesis of cluster, and the justitia.yaml of each node in dir node<id>.
+func (cluster *Cluster) writeConfigs() error {
+	spec := &config.GenesisSpec{
+		ChainId:       cluster.conf.ChainId,
+		HashAlgorithm: "SHA256",
+		Consensus: config.GenesisConsensusConfig{
+			Policy:           cluster.conf.Policy,
+			BlockInterval:    cluster.conf.BlockInterval,
+			EnableEmptyBlock: cluster.conf.EnableEmptyBlock,
+		},
+		Accounts:   []config.GenesisSpecAccount{{Addr: fmt.Sprintf("0x%x", Faucet), Balance: faucetBalance}},
+		Contracts:  cluster.conf.Contracts,
+		PortOffset: cluster.conf.PortOffset,
+	}
+	for index := 0; index < cluster.conf.Nodes; index++ {
+		address := types.Address{0x7c, byte(index + 1)}
+		spec.Validators = append(spec.Validators, config.GenesisSpecValidator{
+			Address: fmt.Sprintf("0x%x", address),
+			Id:      uint64(index),
+			Url:     fmt.Sprintf("127.0.0.1:%d", cluster.conf.ConsensusPort+index*cluster.conf.PortOffset),
+		})
+		cluster.Nodes = append(cluster.Nodes, &Node{
+			Id:        uint64(index),
+			Address:   address,
+			Consensus: true,
+			Dir:       filepath.Join(cluster.dir, fmt.Sprintf("node%d", index)),
+		})
+	}
+	genesis, err := config.BuildGenesisConfig(spec)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteValidatorConfigs(spec, cluster.dir); err != nil {
+		return err
+	}
+	for index := cluster.conf.Nodes; index < cluster.conf.Nodes+cluster.conf.FullNodes; index++ {
+		node := &Node{
+			Id:      uint64(index),
+			Address: types.Address{0x7f, byte(index + 1)},
+			Dir:     filepath.Join(cluster.dir, fmt.Sprintf("node%d", index)),
+		}
+		if err := cluster.writeFullNodeConfig(node); err != nil {
+			return err
+		}
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+	if cluster.conf.PortShift > 0 {
+		for _, node := range cluster.Nodes {
+			if err := cluster.shiftPorts(node); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cluster.linkNodes(); err != nil {
+		return err
+	}
+	for index, node := range cluster.Nodes {
+		if err := config.WriteGenesisConfig(genesis, filepath.Join(node.Dir, config.GenesisFileName)); err != nil {
+			return fmt.Errorf("failed to write genesis file of node %d, as: %v", node.Id, err)
+		}
+		gateway, err := cluster.localizeConfig(index)
+		if err != nil {
+			return err
+		}
+		node.Client = bind.NewClient(gateway, Faucet)
+		node.Client.Timeout = time.Duration(10*cluster.conf.BlockInterval) * time.Millisecond
+	}
+	return nil
+}
+
+// read the justitia.yaml of node.
+func readConfig(node *Node) (*viper.Viper, error) {
+	conf := viper.New()
+	conf.SetConfigFile(filepath.Join(node.Dir, "justitia.yaml"))
+	if err := conf.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config of node %d, as: %v", node.Id, err)
+	}
+	return conf, nil
+}
+
+// write the justitia.yaml of full node from the config of the first validator, with the ports
+// offset by node id.
+func (cluster *Cluster) writeFullNodeConfig(node *Node) error {
+	conf, err := readConfig(cluster.Nodes[0])
+	if err != nil {
+		return err
+	}
+	offset := int(node.Id) * cluster.conf.PortOffset
+	conf.Set(config.NodeType, int(common.FullNode))
+	conf.Set(config.NodeAddress, fmt.Sprintf("%x", node.Address))
+	conf.Set(config.NodeId, node.Id)
+	conf.Set(config.NodeUrl, fmt.Sprintf("127.0.0.1:%d", cluster.conf.ConsensusPort+offset))
+	conf.Set(config.ApiGatewayAddr, config.OffsetAddr(conf.GetString(config.ApiGatewayAddr), offset))
+	for _, p2pType := range p2pTypes {
+		conf.Set(p2pType+"."+config.P2PListenAddr, config.OffsetAddr(conf.GetString(p2pType+"."+config.P2PListenAddr), offset))
+	}
+	if err := os.MkdirAll(node.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dir of node %d, as: %v", node.Id, err)
+	}
+	if err := conf.WriteConfigAs(filepath.Join(node.Dir, "justitia.yaml")); err != nil {
+		return fmt.Errorf("failed to write config of node %d, as: %v", node.Id, err)
+	}
+	return nil
+}
+
+// shift the api gateway and p2p ports of node by PortShift.
+func (cluster *Cluster) shiftPorts(node *Node) error {
+	conf, err := readConfig(node)
+	if err != nil {
+		return err
+	}
+	conf.Set(config.ApiGatewayAddr, config.OffsetAddr(conf.GetString(config.ApiGatewayAddr), cluster.conf.PortShift))
+	for _, p2pType := range p2pTypes {
+		conf.Set(p2pType+"."+config.P2PListenAddr, config.OffsetAddr(conf.GetString(p2pType+"."+config.P2PListenAddr), cluster.conf.PortShift))
+	}
+	if err := conf.WriteConfigAs(filepath.Join(node.Dir, "justitia.yaml")); err != nil {
+		return fmt.Errorf("failed to write config of node %d, as: %v", node.Id, err)
+	}
+	return nil
+}
+
+// link each node to the p2p listen ports of the others, and to the consensus urls of validators.
+func (cluster *Cluster) linkNodes() error {
+	for to, node := range cluster.Nodes {
+		conf, err := readConfig(node)
+		if err != nil {
+			return err
+		}
+		targets := make(map[string]string)
+		for _, p2pType := range p2pTypes {
+			targets[p2pType] = fmt.Sprintf("127.0.0.1:%d", config.AddrPort(conf.GetString(p2pType+"."+config.P2PListenAddr)))
+		}
+		if node.Consensus {
+			targets[consensusLink] = conf.GetString(config.NodeUrl)
+		}
+		for linkType, target := range targets {
+			for from := range cluster.Nodes {
+				if from == to {
+					continue
+				}
+				l, err := newLink(from, to, linkType, target)
+				if err != nil {
+					return err
+				}
+				cluster.links = append(cluster.links, l)
+			}
+		}
+	}
+	return nil
+}
+
+// peers get the addresses of the links from the node at index by p2p type, the consensus peers
+// of its block p2p, and its consensus routes to validators.
+func (cluster *Cluster) peers(index int) (map[string][]string, []string, []string) {
+	peers := make(map[string][]string)
+	consensusPeers := make([]string, 0)
+	routes := make([]string, 0)
+	for _, l := range cluster.links {
+		if l.from != index {
+			continue
+		}
+		if consensusLink == l.p2pType {
+			routes = append(routes, fmt.Sprintf("0x%x@%s", cluster.Nodes[l.to].Address, l.Addr()))
+			continue
+		}
+		peers[l.p2pType] = append(peers[l.p2pType], l.Addr())
+		if config.BlockP2P == l.p2pType && cluster.Nodes[l.to].Consensus {
+			consensusPeers = append(consensusPeers, fmt.Sprintf("0x%x@%s", cluster.Nodes[l.to].Address, l.Addr()))
+		}
+	}
+	return peers, consensusPeers, routes
+}
+
+// point the data and log paths of the node at index to its dir, and its p2p peers and consensus
+// routes to the links, returns the api gateway address of node. The outbound connections are
+// limited to the links and dns seeds are disabled, so that the node does not dial the peers learnt
+// from address book around them.
+func (cluster *Cluster) localizeConfig(index int) (string, error) {
+	node := cluster.Nodes[index]
+	conf, err := readConfig(node)
+	if err != nil {
+		return "", err
+	}
+	peers, consensusPeers, routes := cluster.peers(index)
+	conf.Set(config.RepositoryPlugin, "leveldb")
+	conf.Set(config.RepositoryStatePath, filepath.Join(node.Dir, "state"))
+	conf.Set(config.RepositoryDataPath, filepath.Join(node.Dir, "block"))
+	conf.Set(config.RelayerDataPath, filepath.Join(node.Dir, "relayer"))
+	conf.Set(config.LogFilePath, filepath.Join(node.Dir, "justitia.log"))
+	for _, p2pType := range p2pTypes {
+		name := p2pType[strings.LastIndex(p2pType, ".")+1:]
+		conf.Set(p2pType+"."+config.P2PAddrBook, filepath.Join(node.Dir, name+"_address.json"))
+		conf.Set(p2pType+"."+config.P2PPersistendPeers, strings.Join(peers[p2pType], ","))
+		conf.Set(p2pType+"."+config.P2PDisableDNSSeed, true)
+		if len(peers[p2pType]) > 0 {
+			conf.Set(p2pType+"."+config.P2PMaxOut, len(peers[p2pType]))
+		}
+	}
+	conf.Set(config.BlockP2P+"."+config.P2PConsensusPeers, strings.Join(consensusPeers, ","))
+	conf.Set(config.ConsensusRoutes, strings.Join(routes, ","))
+	conf.Set(config.PrometheusEnabled, false)
+	conf.Set(config.ExpvarEnabled, false)
+	conf.Set(config.PprofEnabled, false)
+	if cluster.conf.Nodes > 1 {
+		conf.Set(config.ParticipatesPolicy, "dpos")
+		conf.Set(config.RolePolicy, "dpos")
+	}
+	// a relayer on every node would pay each cross chain tx once per node
+	if relayer := cluster.conf.Relayer; relayer.Enabled && 0 == index {
+		routes := make([]map[string]interface{}, 0, len(relayer.Routes))
+		for _, route := range relayer.Routes {
+			routes = append(routes, map[string]interface{}{
+				"chainFlag":  route.ChainFlag,
+				"apigateway": route.ApiGateway,
+				"contract":   fmt.Sprintf("0x%x", route.Contract),
+			})
+		}
+		conf.Set(config.RelayerEnabled, true)
+		conf.Set(config.RelayerConfirmations, relayer.Confirmations)
+		conf.Set(config.RelayerAccount, fmt.Sprintf("0x%x", relayer.Account))
+		conf.Set(config.RelayerRoutes, routes)
+		if relayer.ResubmitTimeout > 0 {
+			conf.Set(config.RelayerResubmit, relayer.ResubmitTimeout)
+		}
+	}
+	if err := conf.WriteConfigAs(filepath.Join(node.Dir, "justitia.yaml")); err != nil {
+		return "", fmt.Errorf("failed to write config of node %d, as: %v", node.Id, err)
+	}
+	gateway := strings.TrimPrefix(conf.GetString(config.ApiGatewayAddr), "tcp://")
+	return strings.Replace(gateway, "0.0.0.0", "127.0.0.1", 1), nil
+}
+
+// FastSync make the node at index fetch the state snapshot at the trusted height and hash from
+// its peers on next start, instead of syncing the blocks from genesis.
+func (cluster *Cluster) FastSync(index int, height uint64, hash types.Hash) error {
+	node := cluster.Nodes[index]
+	conf, err := readConfig(node)
+	if err != nil {
+		return err
+	}
+	conf.Set(config.SyncerMode, common.FastSyncMode)
+	conf.Set(config.SyncerTrustedHeight, height)
+	conf.Set(config.SyncerTrustedHash, fmt.Sprintf("0x%x", hash))
+	if err := conf.WriteConfigAs(filepath.Join(node.Dir, "justitia.yaml")); err != nil {
+		return fmt.Errorf("failed to write config of node %d, as: %v", node.Id, err)
+	}
+	return nil
+}
+
+// Start start all nodes of cluster.
+func (cluster *Cluster) Start() error {
+	for index := range cluster.Nodes {
+		if err := cluster.StartNode(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartNode start the node at index, it keeps the data of last run.
+func (cluster *Cluster) StartNode(index int) error {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	node := cluster.Nodes[index]
+	if nil != node.cmd {
+		return fmt.Errorf("node %d already started", node.Id)
+	}
+	output, err := os.OpenFile(filepath.Join(node.Dir, "output.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output of node %d, as: %v", node.Id, err)
+	}
+	cmd := exec.Command(cluster.binary)
+	cmd.Dir = node.Dir
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", config.HomeEnv, node.Dir))
+	cmd.Stdout, cmd.Stderr = output, output
+	if err := cmd.Start(); err != nil {
+		output.Close()
+		return fmt.Errorf("failed to start node %d, as: %v", node.Id, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		output.Close()
+		close(exited)
+	}()
+	node.cmd, node.exited, node.frozen = cmd, exited, false
+	return nil
+}
+
+// Kill kill the node at index, it can be started again with Restart.
+func (cluster *Cluster) Kill(index int) error {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	node := cluster.Nodes[index]
+	if nil == node.cmd {
+		return fmt.Errorf("node %d not started", node.Id)
+	}
+	select {
+	case <-node.exited:
+	default:
+		if err := node.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("failed to kill node %d, as: %v", node.Id, err)
+		}
+		<-node.exited
+	}
+	node.cmd, node.exited, node.frozen = nil, nil, false
+	return nil
+}
+
+// Restart kill the node at index if running, and start it again.
+func (cluster *Cluster) Restart(index int) error {
+	if cluster.Running(index) {
+		if err := cluster.Kill(index); err != nil {
+			return err
+		}
+	}
+	return cluster.StartNode(index)
+}
+
+// Freeze stop the processes of nodes at indexes, the way a node hangs. A frozen node neither
+// produces, relays nor answers anything, and its peers' messages queue up in the kernel, which
+// are handled after thawed. Use Partition to cut the network of running nodes instead.
+func (cluster *Cluster) Freeze(indexes ...int) error {
+	return cluster.signal(syscall.SIGSTOP, true, indexes)
+}
+
+// Thaw resume the frozen nodes at indexes.
+func (cluster *Cluster) Thaw(indexes ...int) error {
+	return cluster.signal(syscall.SIGCONT, false, indexes)
+}
+
+// Partition split the p2p and consensus networks of nodes into groups of node indexes, nodes not
+// in any group form a group of their own. The connections across groups are dropped and refused
+// until healed.
+func (cluster *Cluster) Partition(groups ...[]int) {
+	group := make(map[int]int)
+	for id, indexes := range groups {
+		for _, index := range indexes {
+			group[index] = id + 1
+		}
+	}
+	for _, l := range cluster.links {
+		l.setCut(group[l.from] != group[l.to])
+	}
+}
+
+// Heal remove the partitions, the nodes reconnect to their peers.
+func (cluster *Cluster) Heal() {
+	cluster.Partition()
+}
+
+func (cluster *Cluster) signal(signal syscall.Signal, frozen bool, indexes []int) error {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	for _, index := range indexes {
+		node := cluster.Nodes[index]
+		if nil == node.cmd {
+			return fmt.Errorf("node %d not started", node.Id)
+		}
+		if err := node.cmd.Process.Signal(signal); err != nil {
+			return fmt.Errorf("failed to signal node %d, as: %v", node.Id, err)
+		}
+		node.frozen = frozen
+	}
+	return nil
+}
+
+// Running check whether the node at index is started and not exited.
+func (cluster *Cluster) Running(index int) bool {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	node := cluster.Nodes[index]
+	if nil == node.cmd {
+		return false
+	}
+	select {
+	case <-node.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// live get the indexes of nodes running and not frozen.
+func (cluster *Cluster) live() []int {
+	indexes := make([]int, 0, len(cluster.Nodes))
+	for index, node := range cluster.Nodes {
+		if cluster.Running(index) && !node.frozen {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// SendTx send value from Faucet to account through the node at index, returns the tx hash.
+func (cluster *Cluster) SendTx(index int, to types.Address, value *big.Int) (types.Hash, error) {
+	return cluster.Nodes[index].Client.Transact(to, value, nil)
+}
+
+// Height get the height of the node at index.
+func (cluster *Cluster) Height(index int) (uint64, error) {
+	return cluster.Nodes[index].Client.BlockNumber()
+}
+
+// Balance get the balance of account on the node at index.
+func (cluster *Cluster) Balance(index int, account types.Address) (*big.Int, error) {
+	var result string
+	if err := cluster.Nodes[index].Client.CallRPC(&result, "eth_getBalance", fmt.Sprintf("0x%x", account), "latest"); err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(strings.TrimPrefix(result, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance %s of account %x", result, account)
+	}
+	return balance, nil
+}
+
+// ContractAddress get the address of the system contract deployed in genesis.
+func (cluster *Cluster) ContractAddress(name string) (types.Address, error) {
+	for index, contract := range cluster.conf.Contracts {
+		if contract.Name == name {
+			// genesis contracts are deployed by the zero address in order
+			return common.CreateAddress(types.Address{}, uint64(index)), nil
+		}
+	}
+	return types.Address{}, fmt.Errorf("contract %s not deployed in genesis", name)
+}
+
+// WaitForHeight wait until all live nodes reach height.
+func (cluster *Cluster) WaitForHeight(height uint64, timeout time.Duration) error {
+	return cluster.WaitForHeightOf(cluster.live(), height, timeout)
+}
+
+// WaitForHeightOf wait until the nodes at indexes reach height.
+func (cluster *Cluster) WaitForHeightOf(indexes []int, height uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		lowest, index := uint64(0), -1
+		for _, live := range indexes {
+			current, err := cluster.Height(live)
+			if err != nil {
+				current = 0
+			}
+			if -1 == index || current < lowest {
+				lowest, index = current, live
+			}
+		}
+		if -1 == index {
+			return errors.New("no node is running")
+		}
+		if lowest >= height {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("node %d is still at height %d after %v, waiting for %d", cluster.Nodes[index].Id, lowest, timeout, height)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// WaitForTx wait until the tx is mined on all live nodes.
+func (cluster *Cluster) WaitForTx(hash types.Hash, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, index := range cluster.live() {
+		for {
+			_, err := cluster.Nodes[index].Client.TransactionReceipt(hash)
+			if nil == err {
+				break
+			}
+			if err != bind.ErrNoReceipt {
+				return err
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("tx %x not mined on node %d after %v", hash, cluster.Nodes[index].Id, timeout)
+			}
+			time.Sleep(pollInterval)
+		}
+	}
+	return nil
+}
+
+// BlockHash get the hash of block at height from the node at index.
+func (cluster *Cluster) BlockHash(index int, height uint64) (types.Hash, error) {
+	var block struct {
+		Hash string `json:"hash"`
+	}
+	if err := cluster.Nodes[index].Client.CallRPC(&block, "eth_getBlockByNumber", fmt.Sprintf("0x%x", height), false); err != nil {
+		return types.Hash{}, err
+	}
+	if common.BlankString == block.Hash {
+		return types.Hash{}, fmt.Errorf("block %d not found on node %d", height, cluster.Nodes[index].Id)
+	}
+	return types.BytesToHash(tools.FromHex(block.Hash)), nil
+}
+
+// CheckSameHashes check that all live nodes have the same block hashes up to height.
+func (cluster *Cluster) CheckSameHashes(height uint64) error {
+	indexes := cluster.live()
+	if len(indexes) == 0 {
+		return errors.New("no node is running")
+	}
+	for h := uint64(1); h <= height; h++ {
+		expect, err := cluster.BlockHash(indexes[0], h)
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes[1:] {
+			hash, err := cluster.BlockHash(index, h)
+			if err != nil {
+				return err
+			}
+			if hash != expect {
+				return fmt.Errorf("block %d of node %d is %x, but %x on node %d", h, cluster.Nodes[index].Id, hash, expect, cluster.Nodes[indexes[0]].Id)
+			}
+		}
+	}
+	return nil
+}
+
+// AssertSameHashes fail the test if the live nodes have different block hashes up to height.
+func (cluster *Cluster) AssertSameHashes(t testing.TB, height uint64) {
+	if err := cluster.CheckSameHashes(height); err != nil {
+		t.Fatalf("nodes diverged: %v", err)
+	}
+}
+
+// Close kill all nodes, close the links and remove the temp dir unless KeepDir.
+func (cluster *Cluster) Close() {
+	for index, node := range cluster.Nodes {
+		if node.frozen {
+			cluster.Thaw(index)
+		}
+		if nil != node.cmd {
+			cluster.Kill(index)
+		}
+	}
+	for _, l := range cluster.links {
+		l.close()
+	}
+	if !cluster.conf.KeepDir {
+		os.RemoveAll(cluster.dir)
+	}
+}
@@ -0,0 +1,350 @@
+package testcluster
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/config"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the tests booting nodes share the binary in $JUSTITIA_BINARY, which is built once if not set
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() || "" != os.Getenv(BinaryEnv) {
+		os.Exit(m.Run())
+	}
+	dir, err := ioutil.TempDir("", "justitia")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	binary, err := BuildBinary(dir)
+	if err != nil {
+		fmt.Println(err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	os.Setenv(BinaryEnv, binary)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newCluster(t *testing.T, conf Config) *Cluster {
+	if testing.Short() {
+		t.Skip("skip cluster test in short mode")
+	}
+	cluster, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cluster.Start(); err != nil {
+		cluster.Close()
+		t.Fatal(err)
+	}
+	return cluster
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+	cluster, err := New(Config{Binary: "justitia", Nodes: 3, FullNodes: 1})
+	assert.Nil(err)
+	defer cluster.Close()
+	assert.Equal(4, len(cluster.Nodes))
+
+	content, err := ioutil.ReadFile(filepath.Join(cluster.Nodes[0].Dir, config.GenesisFileName))
+	assert.Nil(err)
+	genesis := new(config.GenesisBlockConfig)
+	assert.Nil(json.Unmarshal(content, genesis))
+	assert.Equal("fbft", genesis.Rules.Consensus.Policy)
+	assert.Equal(3, len(genesis.Rules.Validators))
+	for index, node := range cluster.Nodes {
+		conf := viper.New()
+		conf.SetConfigFile(filepath.Join(node.Dir, "justitia.yaml"))
+		assert.Nil(conf.ReadInConfig())
+		assert.Equal(node.Dir+"/state", conf.GetString(config.RepositoryStatePath))
+		assert.Equal(fmt.Sprintf("127.0.0.1:%d", defaultConsensusPort+index*defaultPortOffset), conf.GetString(config.NodeUrl))
+		assert.Equal("dpos", conf.GetString(config.ParticipatesPolicy))
+		assert.Equal(index < 3, node.Consensus)
+		// the peers are dialed through the links of cluster
+		peers := strings.Split(conf.GetString(config.TxP2P+"."+config.P2PPersistendPeers), ",")
+		assert.Equal(3, len(peers))
+		for _, peer := range peers {
+			assert.True(strings.HasPrefix(peer, "127.0.0.1:"))
+		}
+		consensusPeers := strings.Split(conf.GetString(config.BlockP2P+"."+config.P2PConsensusPeers), ",")
+		// the consensus messages to validators are routed through the links of cluster
+		routes := config.GetConsensusRoutes(conf)
+		if node.Consensus {
+			assert.Equal(2, len(consensusPeers))
+			assert.Equal(2, len(routes))
+		} else {
+			assert.Equal(3, len(consensusPeers))
+			assert.Equal(3, len(routes))
+		}
+		for _, validator := range genesis.Rules.Validators {
+			if route, ok := routes[tools.HexToAddress(validator.Address)]; ok {
+				assert.NotEqual(validator.Url, route)
+			}
+		}
+	}
+	fullNode := viper.New()
+	fullNode.SetConfigFile(filepath.Join(cluster.Nodes[3].Dir, "justitia.yaml"))
+	assert.Nil(fullNode.ReadInConfig())
+	assert.Equal(int(common.FullNode), fullNode.GetInt(config.NodeType))
+	assert.Nil(cluster.FastSync(3, 5, types.Hash{0x01}))
+	assert.Nil(fullNode.ReadInConfig())
+	syncerConf := config.NewSyncerConf(fullNode)
+	assert.Equal(common.FastSyncMode, syncerConf.Mode)
+	assert.Equal(uint64(5), syncerConf.TrustedHeight)
+	assert.Equal(types.Hash{0x01}, syncerConf.TrustedHash)
+	assert.Equal(3*3*4+3*3, len(cluster.links))
+	assert.NotEqual(cluster.Nodes[0].Client.Endpoint(), cluster.Nodes[1].Client.Endpoint())
+
+	dir := cluster.Dir()
+	cluster.Close()
+	_, err = os.Stat(dir)
+	assert.True(os.IsNotExist(err))
+
+	_, err = New(Config{Binary: "justitia"})
+	assert.NotNil(err)
+}
+
+func TestNew_Relayer(t *testing.T) {
+	assert := assert.New(t)
+	route := config.RelayerRoute{ChainFlag: "target", ApiGateway: "127.0.0.1:48768", Contract: types.Address{0x20}}
+	cluster, err := New(Config{
+		Binary:    "justitia",
+		Nodes:     2,
+		ChainId:   2,
+		PortShift: 1000,
+		Relayer:   config.RelayerConfig{Enabled: true, Confirmations: 1, Account: Faucet, Routes: []config.RelayerRoute{route}},
+	})
+	assert.Nil(err)
+	defer cluster.Close()
+
+	content, err := ioutil.ReadFile(filepath.Join(cluster.Nodes[0].Dir, config.GenesisFileName))
+	assert.Nil(err)
+	genesis := new(config.GenesisBlockConfig)
+	assert.Nil(json.Unmarshal(content, genesis))
+	assert.Equal(uint64(2), genesis.Rules.ChainId)
+	for index, node := range cluster.Nodes {
+		conf := viper.New()
+		conf.SetConfigFile(filepath.Join(node.Dir, "justitia.yaml"))
+		assert.Nil(conf.ReadInConfig())
+		assert.Equal(fmt.Sprintf("tcp://0.0.0.0:%d", 47768+1000+index*defaultPortOffset), conf.GetString(config.ApiGatewayAddr))
+		// only the first node relays
+		relayerConf := config.NewRelayerConf(conf)
+		assert.Equal(0 == index, relayerConf.Enabled)
+		if relayerConf.Enabled {
+			assert.Equal(uint64(1), relayerConf.Confirmations)
+			assert.Equal(Faucet, relayerConf.Account)
+			assert.Equal([]config.RelayerRoute{route}, relayerConf.Routes)
+		}
+	}
+}
+
+// txs sent to any node are mined on all nodes
+func TestCluster_TxPropagation(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newCluster(t, Config{Nodes: 4})
+	defer cluster.Close()
+	assert.Nil(cluster.WaitForHeight(0, time.Minute))
+	for index := range cluster.Nodes {
+		hash, err := cluster.SendTx(index, types.Address{0x01}, big.NewInt(1))
+		assert.Nil(err)
+		assert.Nil(cluster.WaitForTx(hash, time.Minute))
+	}
+	height, err := cluster.Height(0)
+	assert.Nil(err)
+	assert.Nil(cluster.WaitForHeight(height, time.Minute))
+	cluster.AssertSameHashes(t, height)
+}
+
+// killed and frozen nodes catch up the blocks produced by the others
+func TestCluster_BlockPropagation(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newCluster(t, Config{Nodes: 4, EnableEmptyBlock: true})
+	defer cluster.Close()
+	assert.Nil(cluster.WaitForHeight(2, time.Minute))
+
+	assert.Nil(cluster.Kill(3))
+	assert.Nil(cluster.WaitForHeight(5, time.Minute))
+	assert.Nil(cluster.Restart(3))
+	assert.Nil(cluster.WaitForHeight(6, time.Minute))
+	cluster.AssertSameHashes(t, 6)
+
+	assert.Nil(cluster.Freeze(2))
+	assert.Nil(cluster.WaitForHeight(8, time.Minute))
+	assert.Nil(cluster.Thaw(2))
+	assert.Nil(cluster.WaitForHeight(9, time.Minute))
+	cluster.AssertSameHashes(t, 9)
+}
+
+// a full node partitioned from the validators stops at its height while the validators go on,
+// and it catches up after healed
+func TestCluster_Partition(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newCluster(t, Config{Nodes: 4, FullNodes: 1, EnableEmptyBlock: true})
+	defer cluster.Close()
+	assert.Nil(cluster.WaitForHeight(2, time.Minute))
+
+	validators := []int{0, 1, 2, 3}
+	cluster.Partition(validators)
+	height, err := cluster.Height(0)
+	assert.Nil(err)
+	assert.Nil(cluster.WaitForHeightOf(validators, height+3, time.Minute))
+	partitioned, err := cluster.Height(4)
+	assert.Nil(err)
+	// only the block in flight when partitioned may arrive
+	assert.True(partitioned <= height+1, "full node reached %d while partitioned at %d", partitioned, height)
+
+	cluster.Heal()
+	assert.Nil(cluster.WaitForHeight(height+4, time.Minute))
+	cluster.AssertSameHashes(t, height+4)
+}
+
+// the validators split in halves stop producing blocks, as neither half has a quorum, and go on
+// after healed
+func TestCluster_Partition_Validators(t *testing.T) {
+	assert := assert.New(t)
+	cluster := newCluster(t, Config{Nodes: 4, EnableEmptyBlock: true})
+	defer cluster.Close()
+	assert.Nil(cluster.WaitForHeight(2, time.Minute))
+
+	cluster.Partition([]int{0, 1}, []int{2, 3})
+	height, err := cluster.Height(0)
+	assert.Nil(err)
+	assert.NotNil(cluster.WaitForHeightOf([]int{0, 1, 2, 3}, height+3, 10*time.Second))
+	for index := range cluster.Nodes {
+		partitioned, err := cluster.Height(index)
+		assert.Nil(err)
+		// only the block in flight when partitioned may be committed
+		assert.True(partitioned <= height+1, "node %d reached %d while partitioned at %d", index, partitioned, height)
+	}
+
+	cluster.Heal()
+	assert.Nil(cluster.WaitForHeight(height+3, 2*time.Minute))
+	cluster.AssertSameHashes(t, height+3)
+}
+
+// a fresh full node fast syncs the state at a trusted hash from the running validators, then
+// goes on with the blocks after it by block sync
+func TestCluster_FastSync(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip cluster test in short mode")
+	}
+	assert := assert.New(t)
+	cluster, err := New(Config{Nodes: 4, FullNodes: 1, EnableEmptyBlock: true})
+	assert.Nil(err)
+	defer cluster.Close()
+	validators := []int{0, 1, 2, 3}
+	for _, index := range validators {
+		assert.Nil(cluster.StartNode(index))
+	}
+	assert.Nil(cluster.WaitForHeightOf(validators, 3, time.Minute))
+	// the state carried by the snapshot
+	receiver := types.Address{0x02}
+	hash, err := cluster.SendTx(0, receiver, big.NewInt(100))
+	assert.Nil(err)
+	assert.Nil(cluster.WaitForTx(hash, time.Minute))
+	trusted, err := cluster.Height(0)
+	assert.Nil(err)
+	trustedHash, err := cluster.BlockHash(0, trusted)
+	assert.Nil(err)
+
+	assert.Nil(cluster.FastSync(4, trusted, trustedHash))
+	assert.Nil(cluster.StartNode(4))
+	assert.Nil(cluster.WaitForHeight(trusted+3, time.Minute))
+	for height := trusted; height <= trusted+3; height++ {
+		expect, err := cluster.BlockHash(0, height)
+		assert.Nil(err)
+		hash, err := cluster.BlockHash(4, height)
+		assert.Nil(err)
+		assert.Equal(expect, hash, "block %d", height)
+	}
+	// the blocks before trusted height are never fetched
+	_, err = cluster.BlockHash(4, trusted-1)
+	assert.NotNil(err)
+	balance, err := cluster.Balance(4, receiver)
+	assert.Nil(err)
+	assert.Equal(big.NewInt(100), balance)
+}
+
+// a cross chain tx locked in CrossFundsPool on one chain is relayed to and paid on another chain
+func TestCluster_CrossChain(t *testing.T) {
+	if _, err := exec.LookPath("solc"); err != nil {
+		t.Skip("skip cross chain test, as solc not found to compile CrossFundsPool")
+	}
+	assert := assert.New(t)
+	pool := config.GenesisSpecContract{
+		Name:     types.JustitiaCrossFundsPool,
+		Source:   "../scripts/contracts/CrossFundsPool.sol",
+		Contract: "CrossFundsPool",
+		Balance:  faucetBalance,
+	}
+	target := newCluster(t, Config{
+		Nodes:            1,
+		ChainId:          2,
+		EnableEmptyBlock: true,
+		Contracts:        []config.GenesisSpecContract{pool},
+		PortShift:        1000,
+		ConsensusPort:    defaultConsensusPort + 1000,
+	})
+	defer target.Close()
+	targetPool, err := target.ContractAddress(types.JustitiaCrossFundsPool)
+	assert.Nil(err)
+	source := newCluster(t, Config{
+		Nodes:            1,
+		EnableEmptyBlock: true,
+		Contracts:        []config.GenesisSpecContract{pool},
+		Relayer: config.RelayerConfig{
+			Enabled:         true,
+			Confirmations:   1,
+			Account:         Faucet,
+			ResubmitTimeout: 10,
+			Routes: []config.RelayerRoute{
+				{ChainFlag: "target", ApiGateway: target.Nodes[0].Client.Endpoint(), Contract: targetPool},
+			},
+		},
+	})
+	defer source.Close()
+	sourcePool, err := source.ContractAddress(types.JustitiaCrossFundsPool)
+	assert.Nil(err)
+	assert.Nil(source.WaitForHeight(1, time.Minute))
+	assert.Nil(target.WaitForHeight(1, time.Minute))
+
+	receiver := types.Address{0x0e}
+	contract, err := syscontract.NewCrossFundsPool(sourcePool, source.Nodes[0].Client, source.Nodes[0].Client)
+	assert.Nil(err)
+	hash, err := contract.CrossTx(big.NewInt(100), receiver, "payload", "target")
+	assert.Nil(err)
+	assert.Nil(source.WaitForTx(hash, time.Minute))
+
+	deadline := time.Now().Add(time.Minute)
+	for {
+		balance, err := target.Balance(0, receiver)
+		assert.Nil(err)
+		if nil != balance && 0 == balance.Cmp(big.NewInt(100)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cross chain tx %x not paid on target chain, receiver balance %v", hash, balance)
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,121 @@
+package testcluster
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// link is a tcp proxy on loopback carrying the p2p connections from one node to a p2p port of
+// another. The node dials its peers through the links, so that cutting a link drops the
+// connections between the two nodes, and refuses new ones until it is restored.
+type link struct {
+	from, to int
+	p2pType  string
+	// p2p listen address of the node linked to
+	target   string
+	listener net.Listener
+	lock     sync.Mutex
+	cut      bool
+	conns    map[net.Conn]bool
+}
+
+func newLink(from, to int, p2pType, target string) (*link, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen link from node %d to %s, as: %v", from, target, err)
+	}
+	l := &link{
+		from:     from,
+		to:       to,
+		p2pType:  p2pType,
+		target:   target,
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+	}
+	go l.serve()
+	return l, nil
+}
+
+// Addr get the address dialed by the node linking.
+func (l *link) Addr() string {
+	return l.listener.Addr().String()
+}
+
+func (l *link) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go l.forward(conn)
+	}
+}
+
+// forward the connection to target, until either side closes or the link is cut.
+func (l *link) forward(conn net.Conn) {
+	peer, err := net.Dial("tcp", l.target)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if !l.track(conn, peer) {
+		conn.Close()
+		peer.Close()
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(peer, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, peer)
+		done <- struct{}{}
+	}()
+	<-done
+	conn.Close()
+	peer.Close()
+	<-done
+	l.untrack(conn, peer)
+}
+
+// track the connections of link, returns false if the link is cut.
+func (l *link) track(conns ...net.Conn) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.cut {
+		return false
+	}
+	for _, conn := range conns {
+		l.conns[conn] = true
+	}
+	return true
+}
+
+func (l *link) untrack(conns ...net.Conn) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, conn := range conns {
+		delete(l.conns, conn)
+	}
+}
+
+// setCut cut the link and drop its connections, or restore it.
+func (l *link) setCut(cut bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cut = cut
+	if cut {
+		for conn := range l.conns {
+			conn.Close()
+		}
+		l.conns = make(map[net.Conn]bool)
+	}
+}
+
+func (l *link) close() {
+	l.listener.Close()
+	l.setCut(true)
+}
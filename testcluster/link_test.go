@@ -0,0 +1,102 @@
+package testcluster
+
+import (
+	"bufio"
+	"github.com/DSiSc/justitia/config"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// echo the lines received on a loopback listener
+func echoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	return listener
+}
+
+func echo(conn net.Conn, line string) (string, error) {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestLink(t *testing.T) {
+	assert := assert.New(t)
+	server := echoServer(t)
+	defer server.Close()
+	l, err := newLink(0, 1, config.TxP2P, server.Addr().String())
+	assert.Nil(err)
+	defer l.close()
+
+	conn, err := net.Dial("tcp", l.Addr())
+	assert.Nil(err)
+	defer conn.Close()
+	reply, err := echo(conn, "hello")
+	assert.Nil(err)
+	assert.Equal("hello\n", reply)
+
+	// cutting the link drops its connections and refuses new ones
+	l.setCut(true)
+	_, err = echo(conn, "hello")
+	assert.NotNil(err)
+	refused, err := net.Dial("tcp", l.Addr())
+	assert.Nil(err)
+	defer refused.Close()
+	_, err = echo(refused, "hello")
+	assert.NotNil(err)
+
+	l.setCut(false)
+	restored, err := net.Dial("tcp", l.Addr())
+	assert.Nil(err)
+	defer restored.Close()
+	reply, err = echo(restored, "hello")
+	assert.Nil(err)
+	assert.Equal("hello\n", reply)
+}
+
+func TestCluster_Partition_Links(t *testing.T) {
+	assert := assert.New(t)
+	cluster, err := New(Config{Binary: "justitia", Nodes: 2, FullNodes: 1})
+	assert.Nil(err)
+	defer cluster.Close()
+
+	cut := func() map[[2]int]bool {
+		cuts := make(map[[2]int]bool)
+		for _, l := range cluster.links {
+			l.lock.Lock()
+			if l.cut {
+				cuts[[2]int{l.from, l.to}] = true
+			}
+			l.lock.Unlock()
+		}
+		return cuts
+	}
+	cluster.Partition([]int{0, 1})
+	assert.Equal(map[[2]int]bool{{0, 2}: true, {1, 2}: true, {2, 0}: true, {2, 1}: true}, cut())
+	cluster.Partition([]int{0}, []int{1, 2})
+	assert.Equal(map[[2]int]bool{{0, 1}: true, {0, 2}: true, {1, 0}: true, {2, 0}: true}, cut())
+	// the consensus links to the validator cut off are cut as well
+	for _, l := range cluster.links {
+		if consensusLink == l.p2pType && (0 == l.from || 0 == l.to) {
+			assert.True(l.cut, "consensus link from node %d to %d is not cut", l.from, l.to)
+		}
+	}
+	cluster.Heal()
+	assert.Equal(0, len(cut()))
+}
@@ -0,0 +1,87 @@
+// Package clock abstracts the time source of node, so that the block interval and round
+// timeouts can be driven by a virtual clock in simulation.
+package clock
+
+import (
+	"time"
+)
+
+// Clock is the time source.
+type Clock interface {
+	// Now get the current time
+	Now() time.Time
+	// Sleep block until d elapsed
+	Sleep(d time.Duration)
+	// NewTimer create a timer firing after d
+	NewTimer(d time.Duration) Timer
+	// AfterFunc call f in its own goroutine after d
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event timer of Clock.
+type Timer interface {
+	// C get the channel the time is sent to when fired, nil for timer created by AfterFunc
+	C() <-chan time.Time
+	// Stop prevent the timer from firing, returns false if it already fired or stopped
+	Stop() bool
+}
+
+// Activity is implemented by the clocks advanced only when the work in flight is done. The work
+// woken by a timer, or handed over to another goroutine, holds the clock until it reaches its next
+// waiting point, so that simulations step the clock on explicit quiescence instead of sleeping.
+type Activity interface {
+	// Hold mark a piece of work in flight
+	Hold()
+	// Release mark a piece of work held done
+	Release()
+}
+
+// Hold mark a piece of work in flight if clock tracks activity, it does nothing on wall clock.
+func Hold(clock Clock) {
+	if activity, ok := clock.(Activity); ok {
+		activity.Hold()
+	}
+}
+
+// Release mark a piece of work held done if clock tracks activity, it does nothing on wall clock.
+func Release(clock Clock) {
+	if activity, ok := clock.(Activity); ok {
+		activity.Release()
+	}
+}
+
+// systemClock is the wall clock.
+type systemClock struct{}
+
+// NewSystemClock create the clock of system time.
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{timer: time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &systemTimer{timer: time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
@@ -0,0 +1,101 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSystemClock(t *testing.T) {
+	assert := assert.New(t)
+	clock := NewSystemClock()
+	start := clock.Now()
+	timer := clock.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(timer.Stop())
+	assert.True(clock.Now().After(start))
+
+	fired := make(chan struct{})
+	clock.AfterFunc(time.Millisecond, func() { close(fired) })
+	<-fired
+}
+
+func TestVirtualClock_Advance(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Unix(0, 0)
+	clock := NewVirtualClock(start)
+
+	first := clock.NewTimer(2 * time.Second)
+	second := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(stopped.Stop())
+	assert.False(stopped.Stop())
+	assert.Equal(2, clock.Pending())
+
+	clock.Advance(time.Second)
+	assert.Equal(start.Add(time.Second), <-second.C())
+	select {
+	case <-first.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	assert.Equal(start.Add(2*time.Second), <-first.C())
+	assert.Equal(start.Add(time.Minute+time.Second), clock.Now())
+	assert.Equal(0, clock.Pending())
+}
+
+func TestVirtualClock_Sleep(t *testing.T) {
+	assert := assert.New(t)
+	clock := NewVirtualClock(time.Unix(0, 0))
+	woken := make(chan time.Time)
+	go func() {
+		clock.Sleep(time.Hour)
+		woken <- clock.Now()
+	}()
+	clock.BlockUntil(1)
+	assert.True(clock.AdvanceToNext())
+	assert.Equal(time.Unix(0, 0).Add(time.Hour), <-woken)
+	assert.False(clock.AdvanceToNext())
+
+	fired := make(chan struct{})
+	clock.AfterFunc(time.Second, func() { close(fired) })
+	clock.Advance(time.Second)
+	<-fired
+}
+
+func TestVirtualClock_Step(t *testing.T) {
+	assert := assert.New(t)
+	clock := NewVirtualClock(time.Unix(0, 0))
+	// the first message handed over is handled after a second, and hands over the second one
+	handled := make([]time.Time, 0)
+	messages := make(chan int, 2)
+	clock.Hold()
+	messages <- 1
+	go func() {
+		for message := range messages {
+			clock.Sleep(time.Second)
+			handled = append(handled, clock.Now())
+			if message < 2 {
+				clock.Hold()
+				messages <- message + 1
+			}
+			clock.Release()
+		}
+	}()
+	assert.True(clock.Step())
+	assert.True(clock.Step())
+	assert.False(clock.Step())
+	assert.Equal([]time.Time{time.Unix(1, 0), time.Unix(2, 0)}, handled)
+
+	fired := 0
+	clock.AfterFunc(time.Second, func() {
+		fired++
+		clock.AfterFunc(time.Second, func() { fired++ })
+	})
+	for clock.Step() {
+	}
+	assert.Equal(2, fired)
+	assert.Equal(time.Unix(4, 0), clock.Now())
+}
@@ -0,0 +1,253 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// VirtualClock is a clock whose time only moves when advanced, the timers and sleepers
+// due are fired in order of their deadlines. It lets tests run hours of block intervals
+// and timeouts in milliseconds, and replay them in the same order.
+//
+// The clock tracks the work in flight as an Activity. A fired timer holds the clock until its
+// receiver releases it, the functions of AfterFunc hold it until they return, and sleepers
+// release the hold of caller while sleeping. Step fires the next timer only after the work
+// woken by the last one is released.
+type VirtualClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	seq     uint64
+	timers  []*virtualTimer
+	waiters []chan struct{}
+	// work in flight, and the channels notified once it is all done
+	held  int
+	idles []chan struct{}
+}
+
+// NewVirtualClock create a virtual clock starting at start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{
+		now:    start,
+		timers: make([]*virtualTimer, 0),
+	}
+}
+
+type virtualTimer struct {
+	clock    *VirtualClock
+	deadline time.Time
+	// creation order, keeps the timers with same deadline firing in order
+	seq     uint64
+	c       chan time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *virtualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *virtualTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
+	t.clock.remove(t)
+	return true
+}
+
+// Now get the virtual time.
+func (clock *VirtualClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+// Sleep block until the clock advanced by d. The caller must hold the clock, the hold is
+// released while sleeping and taken back when woken.
+func (clock *VirtualClock) Sleep(d time.Duration) {
+	timer := clock.NewTimer(d)
+	clock.Release()
+	<-timer.C()
+}
+
+// NewTimer create a timer firing when the clock advanced by d.
+func (clock *VirtualClock) NewTimer(d time.Duration) Timer {
+	return clock.add(d, make(chan time.Time, 1), nil)
+}
+
+// AfterFunc call f in its own goroutine when the clock advanced by d.
+func (clock *VirtualClock) AfterFunc(d time.Duration, f func()) Timer {
+	return clock.add(d, nil, f)
+}
+
+func (clock *VirtualClock) add(d time.Duration, c chan time.Time, f func()) *virtualTimer {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.seq++
+	timer := &virtualTimer{
+		clock:    clock,
+		deadline: clock.now.Add(d),
+		seq:      clock.seq,
+		c:        c,
+		f:        f,
+	}
+	clock.timers = append(clock.timers, timer)
+	sort.SliceStable(clock.timers, func(i, j int) bool {
+		if clock.timers[i].deadline.Equal(clock.timers[j].deadline) {
+			return clock.timers[i].seq < clock.timers[j].seq
+		}
+		return clock.timers[i].deadline.Before(clock.timers[j].deadline)
+	})
+	for _, waiter := range clock.waiters {
+		select {
+		case waiter <- struct{}{}:
+		default:
+		}
+	}
+	return timer
+}
+
+func (clock *VirtualClock) remove(timer *virtualTimer) {
+	for index, t := range clock.timers {
+		if t == timer {
+			clock.timers = append(clock.timers[:index], clock.timers[index+1:]...)
+			return
+		}
+	}
+}
+
+// Hold mark a piece of work in flight, the clock is not stepped until it is released.
+func (clock *VirtualClock) Hold() {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.held++
+}
+
+// Release mark a piece of work held done.
+func (clock *VirtualClock) Release() {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.held--
+	if clock.held > 0 {
+		return
+	}
+	for _, idle := range clock.idles {
+		close(idle)
+	}
+	clock.idles = nil
+}
+
+// WaitIdle block until the work in flight is all released.
+func (clock *VirtualClock) WaitIdle() {
+	clock.lock.Lock()
+	if clock.held <= 0 {
+		clock.lock.Unlock()
+		return
+	}
+	idle := make(chan struct{})
+	clock.idles = append(clock.idles, idle)
+	clock.lock.Unlock()
+	<-idle
+}
+
+// Step wait until the work in flight is all released, then fire the next timer, returns false
+// if no timer pending once idle.
+func (clock *VirtualClock) Step() bool {
+	clock.WaitIdle()
+	return clock.AdvanceToNext()
+}
+
+// Pending get the number of timers and sleepers not fired yet.
+func (clock *VirtualClock) Pending() int {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return len(clock.timers)
+}
+
+// BlockUntil block until at least n timers and sleepers are pending, so that the goroutines
+// under test reach their waiting point before the clock is advanced.
+func (clock *VirtualClock) BlockUntil(n int) {
+	clock.lock.Lock()
+	if len(clock.timers) >= n {
+		clock.lock.Unlock()
+		return
+	}
+	waiter := make(chan struct{}, 1)
+	clock.waiters = append(clock.waiters, waiter)
+	clock.lock.Unlock()
+	defer func() {
+		clock.lock.Lock()
+		defer clock.lock.Unlock()
+		for index, w := range clock.waiters {
+			if w == waiter {
+				clock.waiters = append(clock.waiters[:index], clock.waiters[index+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		<-waiter
+		if clock.Pending() >= n {
+			return
+		}
+	}
+}
+
+// Advance move the clock forward by d, firing the timers due in order of their deadlines.
+func (clock *VirtualClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	target := clock.now.Add(d)
+	clock.lock.Unlock()
+	for clock.fireNext(target) {
+	}
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	if clock.now.Before(target) {
+		clock.now = target
+	}
+}
+
+// AdvanceToNext move the clock to the deadline of next timer and fire it, returns false
+// if no timer pending.
+func (clock *VirtualClock) AdvanceToNext() bool {
+	clock.lock.Lock()
+	if len(clock.timers) == 0 {
+		clock.lock.Unlock()
+		return false
+	}
+	target := clock.timers[0].deadline
+	clock.lock.Unlock()
+	clock.fireNext(target)
+	return true
+}
+
+// fire the earliest timer due before target, returns false if none.
+func (clock *VirtualClock) fireNext(target time.Time) bool {
+	clock.lock.Lock()
+	if len(clock.timers) == 0 || clock.timers[0].deadline.After(target) {
+		clock.lock.Unlock()
+		return false
+	}
+	timer := clock.timers[0]
+	clock.timers = clock.timers[1:]
+	timer.stopped = true
+	if clock.now.Before(timer.deadline) {
+		clock.now = timer.deadline
+	}
+	now := clock.now
+	// held by the function until it returns, or by the receiver of channel until it releases
+	clock.held++
+	clock.lock.Unlock()
+	if nil != timer.f {
+		go func() {
+			defer clock.Release()
+			timer.f()
+		}()
+	} else {
+		timer.c <- now
+	}
+	return true
+}
@@ -2,14 +2,21 @@ package events
 
 import (
 	"errors"
+	"fmt"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/fault"
 	"sync"
 )
 
 type Event struct {
 	m           sync.RWMutex
 	Subscribers map[types.EventType]map[types.Subscriber]types.EventFunc
+	// faults injected into the notification of events, nil if fault injection disabled
+	faults *fault.Injector
+	// clock held while the subscribers are notified, a virtual clock in simulation
+	clock clock.Clock
 }
 
 func NewEvent() types.EventCenter {
@@ -18,6 +25,17 @@ func NewEvent() types.EventCenter {
 	}
 }
 
+// SetFaultInjector set the injector of faults at events.notify.<event type>.
+func (e *Event) SetFaultInjector(injector *fault.Injector) {
+	e.faults = injector
+}
+
+// SetClock set the clock held until the subscribers notified return, so that a virtual clock is
+// not advanced while events are being handled.
+func (e *Event) SetClock(clock clock.Clock) {
+	e.clock = clock
+}
+
 //  adds a new subscriber to Event.
 func (e *Event) Subscribe(eventType types.EventType, eventFunc types.EventFunc) types.Subscriber {
 	e.m.Lock()
@@ -53,6 +71,12 @@ func (e *Event) UnSubscribe(eventType types.EventType, subscriber types.Subscrib
 // Notify subscribers that Subscribe specified event
 func (e *Event) Notify(eventType types.EventType, value interface{}) (err error) {
 
+	// checked before locking, so that a delayed event doesn't block the others
+	if e.faults.Enabled() && e.faults.Drop(fmt.Sprintf("%s.%d", fault.EventNotify, eventType)) {
+		log.Warn("drop event %d, as fault injected", eventType)
+		return nil
+	}
+
 	e.m.RLock()
 	defer e.m.RUnlock()
 
@@ -69,7 +93,11 @@ func (e *Event) Notify(eventType types.EventType, value interface{}) (err error)
 	log.Info("Receive eventType is [%d].", eventType)
 
 	for _, event := range subs {
-		go e.NotifySubscriber(event, value)
+		clock.Hold(e.clock)
+		go func(eventFunc types.EventFunc) {
+			defer clock.Release(e.clock)
+			e.NotifySubscriber(eventFunc, value)
+		}(event)
 	}
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/fault"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -93,3 +95,54 @@ func TestEvent_Notify(t *testing.T) {
 	event.Notify(EventSaveBlock, block)
 	time.Sleep(10 * time.Millisecond)
 }
+
+func TestEvent_NotifyFault(t *testing.T) {
+	assert := assert.New(t)
+	var eventType types.EventType = 1
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	injector := fault.NewInjector(virtualClock)
+	injector.Enable()
+	event := NewEvent().(*Event)
+	event.SetFaultInjector(injector)
+	notified := make(chan interface{}, 1)
+	event.Subscribe(eventType, func(v interface{}) {
+		notified <- v
+	})
+
+	assert.Nil(injector.Inject(fault.Fault{Point: fmt.Sprintf("%s.%d", fault.EventNotify, eventType), Action: fault.ActionDelay, Delay: 1000, Times: 1}))
+	go event.Notify(eventType, 1)
+	virtualClock.BlockUntil(1)
+	// the delayed event doesn't hold the lock of event center
+	sub := event.Subscribe(2, func(v interface{}) {})
+	assert.Nil(event.UnSubscribe(2, sub))
+	virtualClock.Advance(time.Second)
+	assert.Equal(1, <-notified)
+
+	assert.Nil(injector.Inject(fault.Fault{Point: fmt.Sprintf("%s.%d", fault.EventNotify, eventType), Action: fault.ActionDrop, Times: 1}))
+	assert.Nil(event.Notify(eventType, 2))
+	assert.Nil(event.Notify(eventType, 3))
+	assert.Equal(3, <-notified)
+}
+
+func TestEvent_SetClock(t *testing.T) {
+	assert := assert.New(t)
+	var eventType types.EventType = 1
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	event := NewEvent().(*Event)
+	event.SetClock(virtualClock)
+	release := make(chan struct{})
+	handled := make(chan interface{}, 1)
+	event.Subscribe(eventType, func(v interface{}) {
+		<-release
+		// the timer set by subscriber is fired by the next step
+		virtualClock.AfterFunc(time.Second, func() { handled <- v })
+	})
+	assert.Nil(event.Notify(eventType, 1))
+	stepped := make(chan bool)
+	go func() {
+		stepped <- virtualClock.Step()
+	}()
+	close(release)
+	assert.True(<-stepped)
+	assert.Equal(1, <-handled)
+}
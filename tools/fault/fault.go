@@ -0,0 +1,212 @@
+// Package fault is the fault injection of chaos testing. Faults are injected at named points
+// in node, propagator and event code through the Injector of node, they take effect only
+// after Enable is called, which is never done unless fault injection is enabled in config.
+// The nil Injector never triggers, and a disabled point costs an atomic load.
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/justitia/tools/clock"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// injection points
+const (
+	// block messages sent to and received from p2p by block propagator
+	BlockSend = "propagator.block.send"
+	BlockRecv = "propagator.block.recv"
+	// tx messages sent to and received from p2p by tx propagator
+	TxSend = "propagator.tx.send"
+	TxRecv = "propagator.tx.recv"
+	// blocks committed by consensus, failed with EventBlockCommitFailed instead of sent to block switch
+	ConsensusCommit = "consensus.commit"
+	// blocks written to repository by block switch, the synced, propagated and consensus blocks
+	// fail with EventBlockCommitFailed instead of written
+	RepositoryWrite = "repository.write"
+	// producer.MakeBlock of master
+	MakeBlock = "producer.makeBlock"
+	// consensus of the block made by master, the round times out without consensus
+	ConsensusTimeout = "consensus.timeout"
+	// prefix of the events notified by event center, the point of an event is events.notify.<event type>
+	EventNotify = "events.notify"
+)
+
+// actions of fault
+const (
+	// fail the operation with error
+	ActionError = "error"
+	// drop the message or event
+	ActionDrop = "drop"
+	// delay the operation by Delay millisecond of the clock of injector, then go on
+	ActionDelay = "delay"
+)
+
+// Fault is a fault injected at point.
+type Fault struct {
+	Point  string `json:"point" mapstructure:"point"`
+	Action string `json:"action" mapstructure:"action"`
+	// delay in millisecond of ActionDelay
+	Delay int64 `json:"delay" mapstructure:"delay"`
+	// probability the fault is triggered, 0 means always
+	Probability float64 `json:"probability" mapstructure:"probability"`
+	// number of times the fault is triggered before removed, 0 means unlimited
+	Times int `json:"times" mapstructure:"times"`
+	// number of times the fault triggered
+	Triggered int `json:"triggered"`
+}
+
+// ErrInjected is the error of operations failed by injected faults.
+var ErrInjected = errors.New("fault injected")
+
+// Injector hold the faults injected into a node.
+type Injector struct {
+	enabled int32
+	lock    sync.Mutex
+	faults  map[string]*Fault
+	rand    *rand.Rand
+	// time source of delays
+	clock clock.Clock
+}
+
+// NewInjector create a disabled injector without fault, the delays are slept on clock.
+func NewInjector(clock clock.Clock) *Injector {
+	return &Injector{
+		faults: make(map[string]*Fault),
+		rand:   rand.New(rand.NewSource(clock.Now().UnixNano())),
+		clock:  clock,
+	}
+}
+
+// Enable enable fault injection, the faults injected take effect.
+func (injector *Injector) Enable() {
+	atomic.StoreInt32(&injector.enabled, 1)
+}
+
+// Disable disable fault injection, the faults injected are kept but not triggered.
+func (injector *Injector) Disable() {
+	atomic.StoreInt32(&injector.enabled, 0)
+}
+
+// Enabled check whether fault injection is enabled, false for the nil injector.
+func (injector *Injector) Enabled() bool {
+	return nil != injector && atomic.LoadInt32(&injector.enabled) == 1
+}
+
+// Inject inject fault at its point, replacing the fault injected at the same point.
+func (injector *Injector) Inject(fault Fault) error {
+	if "" == fault.Point {
+		return errors.New("fault point must be specified")
+	}
+	switch fault.Action {
+	case ActionError, ActionDrop:
+	case ActionDelay:
+		if fault.Delay <= 0 {
+			return fmt.Errorf("delay of fault at %s must be positive", fault.Point)
+		}
+	default:
+		return fmt.Errorf("unknown action %s of fault at %s", fault.Action, fault.Point)
+	}
+	if fault.Probability < 0 || fault.Probability > 1 {
+		return fmt.Errorf("probability of fault at %s must be in [0, 1]", fault.Point)
+	}
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	fault.Triggered = 0
+	injector.faults[fault.Point] = &fault
+	log.Warn("inject fault %s at %s", fault.Action, fault.Point)
+	return nil
+}
+
+// Remove remove the fault injected at point.
+func (injector *Injector) Remove(point string) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	delete(injector.faults, point)
+}
+
+// Clear remove all faults.
+func (injector *Injector) Clear() {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.faults = make(map[string]*Fault)
+}
+
+// List get the faults injected, in order of point.
+func (injector *Injector) List() []Fault {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	list := make([]Fault, 0, len(injector.faults))
+	for _, fault := range injector.faults {
+		list = append(list, *fault)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Point < list[j].Point
+	})
+	return list
+}
+
+// hit get the fault triggered at point, nil if not triggered.
+func (injector *Injector) hit(point string) *Fault {
+	if !injector.Enabled() {
+		return nil
+	}
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	fault, ok := injector.faults[point]
+	if !ok {
+		return nil
+	}
+	if fault.Probability > 0 && injector.rand.Float64() >= fault.Probability {
+		return nil
+	}
+	fault.Triggered++
+	if fault.Times > 0 && fault.Triggered >= fault.Times {
+		delete(injector.faults, point)
+	}
+	triggered := *fault
+	return &triggered
+}
+
+// Error get the error of operation at point, the operation is delayed if a delay fault triggered.
+func (injector *Injector) Error(point string) error {
+	fault := injector.hit(point)
+	if nil == fault {
+		return nil
+	}
+	if ActionDelay == fault.Action {
+		injector.clock.Sleep(time.Duration(fault.Delay) * time.Millisecond)
+		return nil
+	}
+	return fmt.Errorf("%v at %s", ErrInjected, point)
+}
+
+// Drop check whether the message at point should be dropped, the message is delayed if a delay
+// fault triggered.
+func (injector *Injector) Drop(point string) bool {
+	return nil != injector.Error(point)
+}
+
+// number of messages can be cached in the channel of Wrap
+const wrapChannelCacheLimit = 1024
+
+// Wrap returns a channel in front of in, the messages sent to it are forwarded to in unless
+// the fault at point triggered, in which case onFault is called with the message and error.
+func (injector *Injector) Wrap(point string, in chan<- interface{}, onFault func(msg interface{}, err error)) chan<- interface{} {
+	ch := make(chan interface{}, wrapChannelCacheLimit)
+	go func() {
+		for msg := range ch {
+			if err := injector.Error(point); nil != err {
+				onFault(msg, err)
+				continue
+			}
+			in <- msg
+		}
+	}()
+	return ch
+}
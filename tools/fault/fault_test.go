@@ -0,0 +1,124 @@
+package fault
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInject(t *testing.T) {
+	assert := assert.New(t)
+	injector := NewInjector(clock.NewSystemClock())
+	assert.NotNil(injector.Inject(Fault{Action: ActionError}))
+	assert.NotNil(injector.Inject(Fault{Point: MakeBlock, Action: "crash"}))
+	assert.NotNil(injector.Inject(Fault{Point: MakeBlock, Action: ActionDelay}))
+	assert.NotNil(injector.Inject(Fault{Point: MakeBlock, Action: ActionError, Probability: 2}))
+
+	assert.Nil(injector.Inject(Fault{Point: MakeBlock, Action: ActionError, Times: 2}))
+	assert.Nil(injector.Inject(Fault{Point: TxRecv, Action: ActionDrop}))
+	assert.Equal(2, len(injector.List()))
+
+	// disabled by default
+	assert.Nil(injector.Error(MakeBlock))
+	assert.False(injector.Drop(TxRecv))
+
+	injector.Enable()
+	assert.NotNil(injector.Error(MakeBlock))
+	assert.NotNil(injector.Error(MakeBlock))
+	assert.Nil(injector.Error(MakeBlock))
+	assert.True(injector.Drop(TxRecv))
+	assert.False(injector.Drop(TxSend))
+	assert.Equal([]Fault{{Point: TxRecv, Action: ActionDrop, Triggered: 1}}, injector.List())
+
+	injector.Remove(TxRecv)
+	assert.False(injector.Drop(TxRecv))
+
+	// faults of another injector, and the nil injector, never trigger
+	assert.Nil(injector.Inject(Fault{Point: TxRecv, Action: ActionDrop}))
+	another := NewInjector(clock.NewSystemClock())
+	another.Enable()
+	assert.False(another.Drop(TxRecv))
+	var disabled *Injector
+	assert.False(disabled.Enabled())
+	assert.False(disabled.Drop(TxRecv))
+}
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+	injector := NewInjector(clock.NewSystemClock())
+	injector.Enable()
+	assert.Nil(injector.Inject(Fault{Point: BlockSend, Action: ActionDelay, Delay: 20}))
+	start := time.Now()
+	assert.False(injector.Drop(BlockSend))
+	assert.True(time.Since(start) >= 20*time.Millisecond)
+
+	// delayed by virtual clock
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	injector = NewInjector(virtualClock)
+	injector.Enable()
+	assert.Nil(injector.Inject(Fault{Point: BlockSend, Action: ActionDelay, Delay: 1000}))
+	delayed := make(chan bool)
+	go func() {
+		delayed <- injector.Drop(BlockSend)
+	}()
+	virtualClock.BlockUntil(1)
+	virtualClock.Advance(time.Second)
+	assert.False(<-delayed)
+	assert.Equal(time.Unix(1, 0), virtualClock.Now())
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+	injector := NewInjector(clock.NewSystemClock())
+	server := httptest.NewServer(injector.Handler())
+	defer server.Close()
+	url := server.URL + debugPath
+
+	body, _ := json.Marshal(Fault{Point: ConsensusTimeout, Action: ActionError})
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Post(url, "application/json", bytes.NewReader([]byte(`{"point":"x","action":"crash"}`)))
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get(url)
+	assert.Nil(err)
+	var list []Fault
+	assert.Nil(json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	assert.Equal([]Fault{{Point: ConsensusTimeout, Action: ActionError}}, list)
+
+	request, _ := http.NewRequest(http.MethodDelete, url+"?point="+ConsensusTimeout, nil)
+	resp, err = http.DefaultClient.Do(request)
+	assert.Nil(err)
+	resp.Body.Close()
+	assert.Equal(0, len(injector.List()))
+}
+
+func TestWrap(t *testing.T) {
+	assert := assert.New(t)
+	injector := NewInjector(clock.NewSystemClock())
+	injector.Enable()
+	in := make(chan interface{})
+	failed := make(chan interface{}, 1)
+	ch := injector.Wrap(ConsensusCommit, in, func(msg interface{}, err error) {
+		failed <- msg
+	})
+	ch <- 1
+	assert.Equal(1, <-in)
+
+	assert.Nil(injector.Inject(Fault{Point: ConsensusCommit, Action: ActionError, Times: 1}))
+	ch <- 2
+	assert.Equal(2, <-failed)
+	ch <- 3
+	assert.Equal(3, <-in)
+}
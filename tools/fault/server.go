@@ -0,0 +1,62 @@
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"net"
+	"net/http"
+)
+
+// path of the debug api
+const debugPath = "/debug/faults"
+
+// Handler get the handler of debug api:
+//   GET    /debug/faults                list the faults injected
+//   POST   /debug/faults                inject the fault in request body
+//   DELETE /debug/faults?point=<point>  remove the fault at point, or all faults without point
+func (injector *Injector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(debugPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var fault Fault
+			if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+				http.Error(w, fmt.Sprintf("failed to parse fault, as: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := injector.Inject(fault); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if point := r.URL.Query().Get("point"); "" != point {
+				injector.Remove(point)
+			} else {
+				injector.Clear()
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(injector.List())
+	})
+	return mux
+}
+
+// StartServer start the debug api on addr, it is served until the listener closed.
+func (injector *Injector) StartServer(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen fault debug api on %s, as: %v", addr, err)
+	}
+	go func() {
+		if err := http.Serve(listener, injector.Handler()); nil != err {
+			log.Info("fault debug api on %s stopped, as: %v", addr, err)
+		}
+	}()
+	log.Warn("fault debug api listening on %s", addr)
+	return listener, nil
+}
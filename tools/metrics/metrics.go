@@ -0,0 +1,34 @@
+// Package metrics register the prometheus metrics of node services into the registerer of node,
+// so that the nodes in a process do not share metrics unless they share the registerer.
+package metrics
+
+import (
+	"github.com/DSiSc/craft/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register register collector into registerer, the collector registered before with the same
+// descriptor is returned if any, so that a service can be created again with the same registerer.
+// Collector is returned unregistered if registerer is nil.
+func Register(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if nil == registerer {
+		return collector
+	}
+	if err := registerer.Register(collector); nil != err {
+		if registered, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return registered.ExistingCollector
+		}
+		log.Warn("failed to register metrics, as: %v", err)
+	}
+	return collector
+}
+
+// Gauge register gauge into registerer, returns the one registered before if any.
+func Gauge(registerer prometheus.Registerer, gauge prometheus.Gauge) prometheus.Gauge {
+	return Register(registerer, gauge).(prometheus.Gauge)
+}
+
+// Counter register counter into registerer, returns the one registered before if any.
+func Counter(registerer prometheus.Registerer, counter prometheus.Counter) prometheus.Counter {
+	return Register(registerer, counter).(prometheus.Counter)
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+	opts := prometheus.CounterOpts{
+		Namespace: "justitia",
+		Subsystem: "test",
+		Name:      "count",
+	}
+	registry := prometheus.NewRegistry()
+	counter := Counter(registry, prometheus.NewCounter(opts))
+	counter.Inc()
+	// registered again with the same registry
+	assert.Equal(counter, Counter(registry, prometheus.NewCounter(opts)))
+
+	// another registry
+	another := Counter(prometheus.NewRegistry(), prometheus.NewCounter(opts))
+	assert.NotEqual(counter, another)
+
+	assert.NotNil(Counter(nil, prometheus.NewCounter(opts)))
+}
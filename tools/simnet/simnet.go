@@ -0,0 +1,262 @@
+//go:build simulation
+// +build simulation
+
+// Package simnet is an in-memory p2p network for simulation, built with tag simulation.
+// Messages are delivered by the virtual clock after a latency drawn from a seeded random
+// source, and can be lost or blocked by partitions, so that a scenario replays the same
+// delays and losses from the same seed and message order. A message delivered holds the
+// clock until its receiver releases it (see clock.Activity).
+//
+// The endpoints implement the part of p2p.P2PAPI used by propagators and syncers: Start,
+// Stop, BroadCast, SendMsg, MessageChan and GetPeers, and list their peers by PeerAddrs. Other
+// methods are not supported.
+package simnet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/p2p"
+	pcommon "github.com/DSiSc/p2p/common"
+	p2pConf "github.com/DSiSc/p2p/config"
+	"github.com/DSiSc/p2p/message"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// number of messages can be cached in the message channel of endpoint
+const msgChannelCacheLimit = 1024
+
+// Network is an in-memory p2p network.
+type Network struct {
+	clock     clock.Clock
+	rand      *rand.Rand
+	lock      sync.Mutex
+	endpoints map[string]*Endpoint
+	// latency of message is in [minLatency, maxLatency]
+	minLatency time.Duration
+	maxLatency time.Duration
+	// probability a message is lost
+	loss float64
+	// partition group of endpoints, endpoints in different groups can't reach each other
+	groups map[string]int
+}
+
+// NewNetwork create a network delivering messages by clock, losses and latencies are drawn
+// from the random source of seed.
+func NewNetwork(seed int64, clock clock.Clock) *Network {
+	return &Network{
+		clock:     clock,
+		rand:      rand.New(rand.NewSource(seed)),
+		endpoints: make(map[string]*Endpoint),
+		groups:    make(map[string]int),
+	}
+}
+
+// Endpoint get the endpoint of network at addr, it is created if not exist. The endpoints
+// are addressed by the IP of their NetAddress.
+func (network *Network) Endpoint(addr string) *Endpoint {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if endpoint, ok := network.endpoints[addr]; ok {
+		return endpoint
+	}
+	endpoint := &Endpoint{
+		network: network,
+		addr:    &pcommon.NetAddress{IP: addr},
+		msgChan: make(chan *p2p.InternalMsg, msgChannelCacheLimit),
+	}
+	network.endpoints[addr] = endpoint
+	return endpoint
+}
+
+// NewP2P get a creator of the node's p2p with the same signature as node.Context.NewP2P,
+// the endpoint of node is addr in the network of name.
+func NewP2P(networks map[string]*Network, addr string) func(string, *p2pConf.P2PConfig, types.EventCenter) (p2p.P2PAPI, error) {
+	return func(name string, conf *p2pConf.P2PConfig, eventCenter types.EventCenter) (p2p.P2PAPI, error) {
+		network, ok := networks[name]
+		if !ok {
+			return nil, fmt.Errorf("no simulated network of %s", name)
+		}
+		return network.Endpoint(addr), nil
+	}
+}
+
+// SetLatency set the latency of messages in [min, max].
+func (network *Network) SetLatency(min, max time.Duration) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if max < min {
+		max = min
+	}
+	network.minLatency, network.maxLatency = min, max
+}
+
+// SetLoss set the probability a message is lost, in [0, 1].
+func (network *Network) SetLoss(loss float64) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.loss = loss
+}
+
+// Partition split the network into groups of endpoint addresses, endpoints not in any
+// group form a group of their own. The messages in flight across groups are lost.
+func (network *Network) Partition(groups ...[]string) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.groups = make(map[string]int)
+	for index, group := range groups {
+		for _, addr := range group {
+			network.groups[addr] = index + 1
+		}
+	}
+}
+
+// Heal remove the partitions.
+func (network *Network) Heal() {
+	network.Partition()
+}
+
+func (network *Network) reachable(from, to string) bool {
+	return network.groups[from] == network.groups[to]
+}
+
+// send msg from endpoint to the endpoint at addr.
+func (network *Network) send(from *Endpoint, to string, msg message.Message) error {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	target, ok := network.endpoints[to]
+	if !ok || !target.isStarted() {
+		return fmt.Errorf("peer %s not connected", to)
+	}
+	if !network.reachable(from.addr.IP, to) {
+		return nil
+	}
+	if network.loss > 0 && network.rand.Float64() < network.loss {
+		log.Debug("simulated network lost message %v from %s to %s", msg.MsgType(), from.addr.IP, to)
+		return nil
+	}
+	latency := network.minLatency
+	if network.maxLatency > network.minLatency {
+		latency += time.Duration(network.rand.Int63n(int64(network.maxLatency - network.minLatency)))
+	}
+	internalMsg := &p2p.InternalMsg{
+		From:    from.addr,
+		Payload: msg,
+	}
+	fromAddr := from.addr.IP
+	network.clock.AfterFunc(latency, func() {
+		network.lock.Lock()
+		reachable := network.reachable(fromAddr, to)
+		network.lock.Unlock()
+		if reachable && target.isStarted() {
+			target.deliver(internalMsg)
+		}
+	})
+	return nil
+}
+
+// peers of endpoint in address order.
+func (network *Network) peers(from string) []string {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	peers := make([]string, 0, len(network.endpoints))
+	for addr, endpoint := range network.endpoints {
+		if addr != from && endpoint.isStarted() {
+			peers = append(peers, addr)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Endpoint is a node's p2p in the simulated network.
+type Endpoint struct {
+	// not supported methods of p2p.P2PAPI panic on the nil interface
+	p2p.P2PAPI
+	network *Network
+	addr    *pcommon.NetAddress
+	msgChan chan *p2p.InternalMsg
+	lock    sync.RWMutex
+	started bool
+}
+
+// Addr get the address of endpoint.
+func (endpoint *Endpoint) Addr() *pcommon.NetAddress {
+	return endpoint.addr
+}
+
+// Start connect endpoint to the network.
+func (endpoint *Endpoint) Start() error {
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	if endpoint.started {
+		return errors.New("endpoint already started")
+	}
+	endpoint.started = true
+	return nil
+}
+
+// Stop disconnect endpoint from the network, the messages in flight to it are lost.
+func (endpoint *Endpoint) Stop() {
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	endpoint.started = false
+}
+
+func (endpoint *Endpoint) isStarted() bool {
+	endpoint.lock.RLock()
+	defer endpoint.lock.RUnlock()
+	return endpoint.started
+}
+
+func (endpoint *Endpoint) deliver(msg *p2p.InternalMsg) {
+	clock.Hold(endpoint.network.clock)
+	select {
+	case endpoint.msgChan <- msg:
+	default:
+		clock.Release(endpoint.network.clock)
+		log.Warn("simulated endpoint %s message channel is full, drop message %v", endpoint.addr.IP, msg.Payload.MsgType())
+	}
+}
+
+// BroadCast send msg to all connected endpoints.
+func (endpoint *Endpoint) BroadCast(msg message.Message) {
+	for _, peer := range endpoint.network.peers(endpoint.addr.IP) {
+		if err := endpoint.network.send(endpoint, peer, msg); nil != err {
+			log.Warn("simulated endpoint %s failed to broadcast to %s, as: %v", endpoint.addr.IP, peer, err)
+		}
+	}
+}
+
+// SendMsg send msg to the endpoint at addr.
+func (endpoint *Endpoint) SendMsg(addr *pcommon.NetAddress, msg message.Message) error {
+	return endpoint.network.send(endpoint, addr.IP, msg)
+}
+
+// MessageChan get the channel of messages received, the receiver releases the clock of network
+// after handling each of them.
+func (endpoint *Endpoint) MessageChan() <-chan *p2p.InternalMsg {
+	return endpoint.msgChan
+}
+
+// GetPeers returns no peer, as the endpoints of simulated network have no connection. The
+// endpoints are reached by SendMsg to their address or BroadCast.
+func (endpoint *Endpoint) GetPeers() []*p2p.Peer {
+	return nil
+}
+
+// PeerAddrs get the addresses of the other started endpoints in address order, which stand for
+// the peers connected. The endpoints listen on port 0.
+func (endpoint *Endpoint) PeerAddrs() []*pcommon.NetAddress {
+	peers := endpoint.network.peers(endpoint.addr.IP)
+	addrs := make([]*pcommon.NetAddress, 0, len(peers))
+	for _, peer := range peers {
+		addrs = append(addrs, &pcommon.NetAddress{IP: peer})
+	}
+	return addrs
+}
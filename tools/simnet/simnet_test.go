@@ -0,0 +1,219 @@
+//go:build simulation
+// +build simulation
+
+package simnet
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/propagator"
+	"github.com/DSiSc/justitia/tools/clock"
+	"github.com/DSiSc/justitia/tools/events"
+	pcommon "github.com/DSiSc/p2p/common"
+	"github.com/DSiSc/p2p/message"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newNetwork(seed int64, addrs ...string) (*Network, *clock.VirtualClock) {
+	virtualClock := clock.NewVirtualClock(time.Unix(0, 0))
+	network := NewNetwork(seed, virtualClock)
+	for _, addr := range addrs {
+		network.Endpoint(addr).Start()
+	}
+	return network, virtualClock
+}
+
+func received(endpoint *Endpoint) int {
+	count := 0
+	for {
+		select {
+		case <-endpoint.MessageChan():
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+// wait for the messages delivered by AfterFunc goroutines
+func receive(t *testing.T, endpoint *Endpoint) message.Message {
+	select {
+	case msg := <-endpoint.MessageChan():
+		return msg.Payload
+	case <-time.After(time.Second):
+		t.Fatalf("no message received by %s", endpoint.Addr().IP)
+	}
+	return nil
+}
+
+func TestNetwork_Latency(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1", "node2")
+	network.SetLatency(100*time.Millisecond, 200*time.Millisecond)
+	tx := &message.Transaction{Tx: &types.Transaction{}}
+	network.Endpoint("node0").BroadCast(tx)
+	assert.Equal(2, virtualClock.Pending())
+
+	virtualClock.Advance(99 * time.Millisecond)
+	assert.Equal(0, received(network.Endpoint("node1")))
+	virtualClock.Advance(101 * time.Millisecond)
+	assert.Equal(tx, receive(t, network.Endpoint("node1")))
+	assert.Equal(tx, receive(t, network.Endpoint("node2")))
+	assert.Equal(0, received(network.Endpoint("node0")))
+
+	assert.NotNil(network.Endpoint("node0").SendMsg(&pcommon.NetAddress{IP: "unknown"}, tx))
+}
+
+func TestNetwork_Step(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1")
+	network.SetLatency(100*time.Millisecond, 100*time.Millisecond)
+	tx := &message.Transaction{Tx: &types.Transaction{}}
+	assert.Nil(network.Endpoint("node0").SendMsg(&pcommon.NetAddress{IP: "node1"}, tx))
+	virtualClock.AfterFunc(time.Second, func() {})
+	assert.True(virtualClock.Step())
+	assert.Equal(tx, receive(t, network.Endpoint("node1")))
+
+	// the clock is not stepped until the message received is released
+	stepped := make(chan bool)
+	go func() {
+		stepped <- virtualClock.Step()
+	}()
+	assert.Equal(time.Unix(0, 0).Add(100*time.Millisecond), virtualClock.Now())
+	virtualClock.Release()
+	assert.True(<-stepped)
+	assert.Equal(time.Unix(1, 0), virtualClock.Now())
+}
+
+func TestNetwork_Partition(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1", "node2")
+	network.SetLatency(time.Second, time.Second)
+	tx := &message.Transaction{Tx: &types.Transaction{}}
+
+	network.Partition([]string{"node0", "node1"})
+	network.Endpoint("node0").BroadCast(tx)
+	assert.Equal(1, virtualClock.Pending())
+	virtualClock.Advance(time.Second)
+	assert.Equal(tx, receive(t, network.Endpoint("node1")))
+	assert.Equal(0, received(network.Endpoint("node2")))
+
+	// messages in flight are lost when partitioned
+	network.Heal()
+	network.Endpoint("node0").BroadCast(tx)
+	network.Partition([]string{"node0"}, []string{"node1", "node2"})
+	virtualClock.Advance(time.Second)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(0, received(network.Endpoint("node1")))
+	assert.Equal(0, received(network.Endpoint("node2")))
+}
+
+func TestNetwork_Loss(t *testing.T) {
+	assert := assert.New(t)
+	lost := func(seed int64) []bool {
+		network, virtualClock := newNetwork(seed, "node0", "node1")
+		network.SetLoss(0.5)
+		result := make([]bool, 0, 32)
+		for i := 0; i < 32; i++ {
+			before := virtualClock.Pending()
+			network.Endpoint("node0").SendMsg(&pcommon.NetAddress{IP: "node1"}, &message.Transaction{Tx: &types.Transaction{}})
+			result = append(result, virtualClock.Pending() == before)
+		}
+		return result
+	}
+	first := lost(7)
+	assert.Equal(first, lost(7))
+	assert.Contains(first, true)
+	assert.Contains(first, false)
+}
+
+// txs are propagated between tx propagators through the simulated network
+func TestNetwork_TxPropagator(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1")
+	network.SetLatency(50*time.Millisecond, 50*time.Millisecond)
+	eventCenter := events.NewEvent()
+	sender, err := propagator.NewTxPropagator(network.Endpoint("node0"), make(chan interface{}), eventCenter)
+	assert.Nil(err)
+	txOut := make(chan interface{})
+	receiver, err := propagator.NewTxPropagator(network.Endpoint("node1"), txOut, events.NewEvent())
+	assert.Nil(err)
+	assert.Nil(receiver.Start())
+	defer receiver.Stop()
+
+	tx := &types.Transaction{}
+	sender.TxEventFunc(tx)
+	virtualClock.Advance(50 * time.Millisecond)
+	select {
+	case out := <-txOut:
+		assert.Equal(tx, out)
+	case <-time.After(time.Second):
+		t.Fatal("tx not propagated")
+	}
+}
+
+// committed blocks are relayed to consensus peers ahead of the others through the simulated network
+func TestNetwork_BlockPropagator(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1", "node2")
+	network.SetLatency(10*time.Millisecond, 10*time.Millisecond)
+	eventCenter := events.NewEvent()
+	sender, err := propagator.NewBlockPropagator(network.Endpoint("node0"), make(chan interface{}), eventCenter, virtualClock)
+	assert.Nil(err)
+	assert.Nil(sender.Start())
+	defer sender.Stop()
+	sender.SetConsensusPeers([]string{"node2:0"})
+
+	block := &types.Block{Header: &types.Header{Height: 1}}
+	eventCenter.Notify(types.EventBlockCommitted, block)
+	virtualClock.BlockUntil(2)
+	virtualClock.Advance(10 * time.Millisecond)
+	assert.Equal(block, receive(t, network.Endpoint("node2")).(*message.Block).Block)
+	assert.Equal(0, received(network.Endpoint("node1")))
+
+	// relayed to the others once the lead passed, the consensus peer doesn't get it twice
+	virtualClock.Advance(90 * time.Millisecond)
+	virtualClock.BlockUntil(1)
+	virtualClock.Advance(10 * time.Millisecond)
+	assert.Equal(block, receive(t, network.Endpoint("node1")).(*message.Block).Block)
+	assert.Equal(0, received(network.Endpoint("node2")))
+}
+
+// the blocks relayed are handled by the receivers before the clock is stepped, so the scenario
+// runs to the end without waiting on wall clock
+func TestNetwork_BlockPropagatorStep(t *testing.T) {
+	assert := assert.New(t)
+	network, virtualClock := newNetwork(1, "node0", "node1", "node2")
+	network.SetLatency(10*time.Millisecond, 10*time.Millisecond)
+	eventCenter := events.NewEvent()
+	eventCenter.(*events.Event).SetClock(virtualClock)
+	sender, err := propagator.NewBlockPropagator(network.Endpoint("node0"), make(chan interface{}), eventCenter, virtualClock)
+	assert.Nil(err)
+	assert.Nil(sender.Start())
+	defer sender.Stop()
+	sender.SetConsensusPeers([]string{"node2:0"})
+	outs := make([]chan interface{}, 0)
+	for _, addr := range []string{"node1", "node2"} {
+		out := make(chan interface{}, 1)
+		receiver, err := propagator.NewBlockPropagator(network.Endpoint(addr), out, events.NewEvent(), virtualClock)
+		assert.Nil(err)
+		assert.Nil(receiver.Start())
+		defer receiver.Stop()
+		outs = append(outs, out)
+	}
+
+	block := &types.Block{Header: &types.Header{Height: 1}}
+	eventCenter.Notify(types.EventBlockCommitted, block)
+	for virtualClock.Step() {
+	}
+	assert.Equal(time.Unix(0, 0).Add(110*time.Millisecond), virtualClock.Now())
+	for _, out := range outs {
+		select {
+		case received := <-out:
+			assert.Equal(block, received)
+		default:
+			t.Fatal("block not relayed")
+		}
+	}
+}
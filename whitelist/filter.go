@@ -0,0 +1,179 @@
+// Package whitelist admits the transactions whose sender is in the WhiteList system contract.
+package whitelist
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// number of transactions can be cached in the channel before filtering
+	filterChannelCacheLimit = 1024
+	// number of senders whose membership can be cached, the cache is dropped when it is full
+	membershipCacheLimit = 4096
+)
+
+// Filter check the senders of transactions against the WhiteList contract, the membership is
+// cached on the latest state and refreshed after block committed.
+type Filter struct {
+	whiteList   *syscontract.WhiteList
+	eventCenter types.EventCenter
+	subscriber  types.Subscriber
+	lock        sync.RWMutex
+	isRunning   int32
+	cache       map[types.Address]bool
+	// increased on every refresh, the membership looked up before refresh is not cached after it
+	generation uint64
+	rejected   uint64
+	metrics    *filterMetrics
+}
+
+// NewFilter create a filter of the WhiteList contract at address on the latest state of chain, an
+// error is returned if the contract deployed at address can not answer inWhiteList. Its metrics are
+// registered in registerer.
+func NewFilter(chain common.Chain, contract types.Address, eventCenter types.EventCenter, registerer prometheus.Registerer) (*Filter, error) {
+	whiteList, err := syscontract.NewWhiteList(contract, syscontract.NewStateCaller(chain, types.Address{}), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := whiteList.InWhiteList(types.Address{}); err != nil {
+		return nil, fmt.Errorf("contract %x does not implement inWhiteList(address), as: %v", contract, err)
+	}
+	return &Filter{
+		whiteList:   whiteList,
+		eventCenter: eventCenter,
+		cache:       make(map[types.Address]bool),
+		metrics:     newFilterMetrics(registerer),
+	}, nil
+}
+
+// BlockEventFunc get a EventFunc that can be bound to event center, the cached membership
+// is dropped as the contract state may be changed by the committed block.
+func (filter *Filter) BlockEventFunc(event interface{}) {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+	filter.generation++
+	filter.cache = make(map[types.Address]bool)
+}
+
+// Start caching the membership, it is refreshed after block committed.
+func (filter *Filter) Start() error {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+	if filter.isRunning == 1 {
+		log.Error("whitelist filter already started")
+		return errors.New("whitelist filter already started")
+	}
+	filter.isRunning = 1
+	filter.generation++
+	filter.cache = make(map[types.Address]bool)
+	filter.subscriber = filter.eventCenter.Subscribe(types.EventBlockCommitted, filter.BlockEventFunc)
+	return nil
+}
+
+// Stop caching the membership, the contract is called for every transaction after stopped.
+func (filter *Filter) Stop() {
+	filter.lock.Lock()
+	defer filter.lock.Unlock()
+	if filter.isRunning == 0 {
+		return
+	}
+	filter.isRunning = 0
+	filter.eventCenter.UnSubscribe(types.EventBlockCommitted, filter.subscriber)
+}
+
+// InWhiteList check whether the account is in the WhiteList contract. The membership looked up
+// is cached only if no block is committed during the lookup, as it may be read from the state
+// before the block, so that the cache never serves the membership older than the refresh.
+func (filter *Filter) InWhiteList(account types.Address) (bool, error) {
+	filter.lock.RLock()
+	admitted, ok := filter.cache[account]
+	running := filter.isRunning == 1
+	generation := filter.generation
+	filter.lock.RUnlock()
+	if ok && running {
+		return admitted, nil
+	}
+	admitted, err := filter.whiteList.InWhiteList(account)
+	if err != nil {
+		return false, err
+	}
+	if running {
+		filter.lock.Lock()
+		if filter.isRunning == 1 && filter.generation == generation {
+			if len(filter.cache) >= membershipCacheLimit {
+				filter.cache = make(map[types.Address]bool)
+			}
+			filter.cache[account] = admitted
+		}
+		filter.lock.Unlock()
+	}
+	return admitted, nil
+}
+
+// Rejected get the number of transactions rejected by Wrap.
+func (filter *Filter) Rejected() uint64 {
+	return atomic.LoadUint64(&filter.rejected)
+}
+
+// log and count the transaction rejected after it has been accepted by rpc or p2p.
+func (filter *Filter) reject(tx *types.Transaction, err error) {
+	atomic.AddUint64(&filter.rejected, 1)
+	filter.metrics.rejectedTxs.Inc()
+	log.Warn("reject transaction %x from %x, as: %v", tx.Hash, tx.Data.From, err)
+}
+
+// check whether the membership of account is cached.
+func (filter *Filter) cached(account types.Address) bool {
+	filter.lock.RLock()
+	defer filter.lock.RUnlock()
+	_, ok := filter.cache[account]
+	return ok && filter.isRunning == 1
+}
+
+// Admit check whether the transaction can be admitted, an error is returned if not.
+func (filter *Filter) Admit(tx *types.Transaction) error {
+	if nil == tx.Data.From {
+		return errors.New("sender of transaction is unknown")
+	}
+	admitted, err := filter.InWhiteList(*tx.Data.From)
+	if err != nil {
+		return fmt.Errorf("failed to check whitelist of %x, as: %v", *tx.Data.From, err)
+	}
+	if !admitted {
+		return fmt.Errorf("sender %x is not in whitelist", *tx.Data.From)
+	}
+	return nil
+}
+
+// Wrap returns a channel in front of the switch in-port channel, the transactions sent to it
+// are forwarded to the in-port only if they are admitted. When the in-port is full, the
+// transactions whose sender is not cached are rejected without calling the contract.
+// The senders have been answered when the transactions are rejected here, so the rejections
+// are logged and counted in the rejected_txs metric.
+func (filter *Filter) Wrap(in chan<- interface{}) chan<- interface{} {
+	ch := make(chan interface{}, filterChannelCacheLimit)
+	go func() {
+		for msg := range ch {
+			if tx, ok := msg.(*types.Transaction); ok {
+				if cap(in) > 0 && len(in) >= cap(in) && (nil == tx.Data.From || !filter.cached(*tx.Data.From)) {
+					filter.reject(tx, errors.New("in-port is full"))
+					continue
+				}
+				if err := filter.Admit(tx); err != nil {
+					filter.reject(tx, err)
+					continue
+				}
+			}
+			in <- msg
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,206 @@
+package whitelist
+
+import (
+	"errors"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/justitia/common"
+	"github.com/DSiSc/justitia/syscontract"
+	"github.com/DSiSc/justitia/tools/events"
+	"github.com/DSiSc/monkey"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	admitted = types.Address{0x01}
+	rejected = types.Address{0x02}
+	unknown  = types.Address{0x03}
+)
+
+// mock the WhiteList contract, returns the calls to it
+func mockWhiteList() *int {
+	calls := 0
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.WhiteList{}), "InWhiteList", func(_ *syscontract.WhiteList, account types.Address) (bool, error) {
+		calls++
+		switch account {
+		case admitted:
+			return true, nil
+		case unknown:
+			return false, errors.New("execution reverted")
+		}
+		return false, nil
+	})
+	return &calls
+}
+
+func mockTx(from *types.Address) *types.Transaction {
+	return &types.Transaction{Data: types.TxData{From: from}}
+}
+
+func TestNewFilter(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockWhiteList()
+	_, err := NewFilter(common.ProcessChain, types.Address{0x10}, events.NewEvent(), prometheus.NewRegistry())
+	assert.Nil(err)
+
+	// contract without inWhiteList
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.WhiteList{}), "InWhiteList", func(_ *syscontract.WhiteList, account types.Address) (bool, error) {
+		return false, errors.New("execution reverted")
+	})
+	_, err = NewFilter(common.ProcessChain, types.Address{0x10}, events.NewEvent(), prometheus.NewRegistry())
+	assert.NotNil(err)
+}
+
+func TestFilter_Admit(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	mockWhiteList()
+	filter, err := NewFilter(common.ProcessChain, types.Address{0x10}, events.NewEvent(), prometheus.NewRegistry())
+	assert.Nil(err)
+	assert.Nil(filter.Admit(mockTx(&admitted)))
+	assert.NotNil(filter.Admit(mockTx(&rejected)))
+	assert.NotNil(filter.Admit(mockTx(nil)))
+	assert.NotNil(filter.Admit(mockTx(&unknown)))
+}
+
+func TestFilter_Cache(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	calls := mockWhiteList()
+	eventCenter := events.NewEvent()
+	filter, err := NewFilter(common.ProcessChain, types.Address{0x10}, eventCenter, prometheus.NewRegistry())
+	assert.Nil(err)
+	*calls = 0
+
+	// not cached before started
+	filter.InWhiteList(admitted)
+	filter.InWhiteList(admitted)
+	assert.Equal(2, *calls)
+
+	assert.Nil(filter.Start())
+	assert.NotNil(filter.Start())
+	filter.InWhiteList(admitted)
+	filter.InWhiteList(admitted)
+	assert.Equal(3, *calls)
+
+	// refreshed after block committed
+	eventCenter.Notify(types.EventBlockCommitted, nil)
+	time.Sleep(50 * time.Millisecond)
+	filter.InWhiteList(admitted)
+	assert.Equal(4, *calls)
+
+	// dropped when it is full
+	for i := 0; i < membershipCacheLimit; i++ {
+		filter.InWhiteList(types.Address{0x04, byte(i >> 8), byte(i)})
+	}
+	assert.Equal(1, len(filter.cache))
+	filter.Stop()
+}
+
+func TestFilter_Wrap(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	calls := mockWhiteList()
+	filter, err := NewFilter(common.ProcessChain, types.Address{0x10}, events.NewEvent(), prometheus.NewRegistry())
+	assert.Nil(err)
+	in := make(chan interface{}, 4)
+	ch := filter.Wrap(in)
+	ch <- mockTx(&rejected)
+	ch <- mockTx(&admitted)
+	ch <- "not a tx"
+	assert.Equal(&admitted, (<-in).(*types.Transaction).Data.From)
+	assert.Equal("not a tx", <-in)
+	assert.Equal(uint64(1), filter.Rejected())
+	close(ch)
+
+	// senders not cached are rejected when the in-port is full
+	assert.Nil(filter.Start())
+	defer filter.Stop()
+	filter.InWhiteList(admitted)
+	*calls = 0
+	in = make(chan interface{}, 1)
+	in <- "backlog"
+	ch = filter.Wrap(in)
+	ch <- mockTx(&types.Address{0x05})
+	ch <- mockTx(&admitted)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal("backlog", <-in)
+	assert.Equal(&admitted, (<-in).(*types.Transaction).Data.From)
+	assert.Equal(0, *calls)
+	assert.Equal(uint64(2), filter.Rejected())
+	close(ch)
+}
+
+// test the membership looked up before refresh is not cached after it, run with -race
+func TestFilter_ConcurrentRefresh(t *testing.T) {
+	defer monkey.UnpatchAll()
+	assert := assert.New(t)
+	var member int32
+	var gated int32
+	looked, resume := make(chan struct{}), make(chan struct{})
+	monkey.PatchInstanceMethod(reflect.TypeOf(&syscontract.WhiteList{}), "InWhiteList", func(_ *syscontract.WhiteList, account types.Address) (bool, error) {
+		inWhiteList := atomic.LoadInt32(&member) == 1
+		if account == unknown && atomic.CompareAndSwapInt32(&gated, 0, 1) {
+			looked <- struct{}{}
+			<-resume
+		}
+		return inWhiteList, nil
+	})
+	filter, err := NewFilter(common.ProcessChain, types.Address{0x10}, events.NewEvent(), prometheus.NewRegistry())
+	assert.Nil(err)
+	assert.Nil(filter.Start())
+	defer filter.Stop()
+
+	// the block adding the sender is committed while its membership is looked up on the state before it
+	done := make(chan bool)
+	go func() {
+		inWhiteList, _ := filter.InWhiteList(unknown)
+		done <- inWhiteList
+	}()
+	<-looked
+	atomic.StoreInt32(&member, 1)
+	filter.BlockEventFunc(nil)
+	close(resume)
+	assert.False(<-done)
+	inWhiteList, err := filter.InWhiteList(unknown)
+	assert.Nil(err)
+	assert.True(inWhiteList)
+
+	// readers racing with refreshes always see the membership after the last refresh
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					filter.InWhiteList(types.Address{0x06, byte(i)})
+					filter.cached(types.Address{0x06, byte(i)})
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		atomic.StoreInt32(&member, int32(i%2))
+		filter.BlockEventFunc(nil)
+	}
+	close(stop)
+	wg.Wait()
+	atomic.StoreInt32(&member, 0)
+	filter.BlockEventFunc(nil)
+	for i := 0; i < 8; i++ {
+		inWhiteList, err := filter.InWhiteList(types.Address{0x06, byte(i)})
+		assert.Nil(err)
+		assert.False(inWhiteList)
+	}
+}
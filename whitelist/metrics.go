@@ -0,0 +1,22 @@
+package whitelist
+
+import (
+	"github.com/DSiSc/justitia/tools/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics of whitelist filter registered in the registerer of node.
+type filterMetrics struct {
+	rejectedTxs prometheus.Counter
+}
+
+func newFilterMetrics(registerer prometheus.Registerer) *filterMetrics {
+	return &filterMetrics{
+		rejectedTxs: metrics.Counter(registerer, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "justitia",
+			Subsystem: "whitelist",
+			Name:      "rejected_txs",
+			Help:      "The number of transactions rejected by whitelist filter after accepted by rpc or p2p.",
+		})),
+	}
+}